@@ -0,0 +1,121 @@
+package marshaler
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ParseCIDRs parses CIDR ranges like 10.0.0.0/8 and bare addresses, which
+// stand for themselves alone.
+func ParseCIDRs(cidrs ...string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if nil == ip {
+				return nil, &net.ParseError{Type: "IP address", Text: cidr}
+			}
+			bits := 8 * len(ip.To4())
+			if 0 == bits {
+				bits = 128
+			}
+			cidr += "/" + strconv.Itoa(bits)
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if nil != err {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// MustParseCIDRs is like ParseCIDRs but panics if a range can't be parsed.
+func MustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets, err := ParseCIDRs(cidrs...)
+	if nil != err {
+		panic(err)
+	}
+	return nets
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveClientIP returns the address of the client that made a request.
+// If the request came from one of the trusted proxies, the client is the
+// rightmost address in X-Forwarded-For that isn't also a trusted proxy.
+func resolveClientIP(r *http.Request, trusted []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if nil != err {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if nil == ip || !containsIP(trusted, ip) {
+		return ip
+	}
+	forwarded := splitHeader(r.Header, "X-Forwarded-For")
+	for i := len(forwarded) - 1; 0 <= i; i-- {
+		hop := net.ParseIP(forwarded[i])
+		if nil == hop {
+			break
+		}
+		ip = hop
+		if !containsIP(trusted, ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// TrustedClientIP returns a RateLimitKeyer that limits each client IP
+// address, looking past the given trusted proxies as AccessControl does.
+func TrustedClientIP(trusted []*net.IPNet) RateLimitKeyer {
+	return func(r *http.Request) string {
+		if ip := resolveClientIP(r, trusted); nil != ip {
+			return ip.String()
+		}
+		return ""
+	}
+}
+
+// AccessControl is an http.Handler that admits requests to the handler it
+// wraps only from client addresses within the Allow ranges, if any are
+// given, and not within the Deny ranges, which take precedence.  Clients
+// behind TrustedProxies are identified by the X-Forwarded-For header.
+// Other requests are rejected 403 Forbidden and logged.
+type AccessControl struct {
+	Allow          []*net.IPNet
+	Deny           []*net.IPNet
+	TrustedProxies []*net.IPNet
+	handler        http.Handler
+}
+
+// AccessControlled returns an http.Handler that admits requests to the
+// given handler from the allowed and not denied ranges.
+func AccessControlled(handler http.Handler, allow, deny []*net.IPNet) *AccessControl {
+	return &AccessControl{
+		Allow:   allow,
+		Deny:    deny,
+		handler: handler,
+	}
+}
+
+func (a *AccessControl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ip := resolveClientIP(r, a.TrustedProxies)
+	if nil == ip || containsIP(a.Deny, ip) || 0 < len(a.Allow) && !containsIP(a.Allow, ip) {
+		logRequestLine(r, "denied access to %v", ip)
+		writeError(w, r, Forbidden{errors.New(Message(r, "access denied"))})
+		return
+	}
+	a.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,62 @@
+package marshaler
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAccessControlled(t *testing.T) {
+	a := AccessControlled(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}), MustParseCIDRs("10.0.0.0/8", "2001:db8::/32"), MustParseCIDRs("10.0.0.1"))
+	a.TrustedProxies = MustParseCIDRs("192.168.0.0/16")
+	for _, test := range []struct {
+		remoteAddr, forwardedFor string
+		code                     int
+	}{
+		{"10.1.2.3:1234", "", http.StatusNoContent},
+		{"[2001:db8::1]:1234", "", http.StatusNoContent},
+		{"10.0.0.1:1234", "", http.StatusForbidden},
+		{"172.16.0.1:1234", "", http.StatusForbidden},
+		{"172.16.0.1:1234", "10.1.2.3", http.StatusForbidden},
+		{"192.168.0.1:1234", "10.1.2.3", http.StatusNoContent},
+		{"192.168.0.1:1234", "172.16.0.1, 10.1.2.3, 192.168.0.2", http.StatusNoContent},
+		{"192.168.0.1:1234", "10.1.2.3, 172.16.0.1", http.StatusForbidden},
+	} {
+		w := &testResponseWriter{}
+		r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+		r.RemoteAddr = test.remoteAddr
+		if "" != test.forwardedFor {
+			r.Header.Set("X-Forwarded-For", test.forwardedFor)
+		}
+		a.ServeHTTP(w, r)
+		if test.code != w.StatusCode {
+			t.Fatal(test, w.StatusCode)
+		}
+	}
+}
+
+func TestAccessControlledLogged(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logged(AccessControlled(http.NotFoundHandler(), nil, MustParseCIDRs("0.0.0.0/0")), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	l.ServeHTTP(&testResponseWriter{}, r)
+	if !strings.Contains(buf.String(), "foo denied access to 192.0.2.1") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	if _, err := ParseCIDRs("10.0.0.0/8", "::1", "192.0.2.1"); nil != err {
+		t.Fatal(err)
+	}
+	if _, err := ParseCIDRs("example.com"); nil == err {
+		t.Fatal("parsed example.com")
+	}
+}
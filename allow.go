@@ -0,0 +1,55 @@
+package marshaler
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// MethodNotAllowedHandler responds 405 Method Not Allowed with an Allow
+// header listing the methods that would have been accepted.
+type MethodNotAllowedHandler struct {
+	Methods []string
+}
+
+func (h MethodNotAllowedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	allow := Allow(h.Methods)
+	w.Header().Set("Allow", allow)
+	writeError(w, r, MethodNotAllowed{errors.New(Message(
+		r,
+		"%s not allowed; try %s",
+		r.Method,
+		allow,
+	))})
+}
+
+// OptionsHandler responds 204 No Content to OPTIONS requests with an Allow
+// header listing the methods that are accepted.
+type OptionsHandler struct {
+	Methods []string
+}
+
+func (h OptionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", Allow(h.Methods))
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Allow returns the value of an Allow header for the given methods.  HEAD is
+// implied by GET and OPTIONS is always allowed.
+func Allow(methods []string) string {
+	set := map[string]bool{"OPTIONS": true}
+	for _, method := range methods {
+		set[method] = true
+		if "GET" == method {
+			set["HEAD"] = true
+		}
+	}
+	allowed := make([]string, 0, len(set))
+	for method := range set {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	return strings.Join(allowed, ", ")
+}
@@ -0,0 +1,40 @@
+package marshaler
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAllow(t *testing.T) {
+	if "GET, HEAD, OPTIONS, POST" != Allow([]string{"POST", "GET"}) {
+		t.Fatal(Allow([]string{"POST", "GET"}))
+	}
+}
+
+func TestMethodNotAllowedHandler(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("DELETE", "http://example.com/foo", nil)
+	r.Header.Set("Accept", "application/json")
+	MethodNotAllowedHandler{[]string{"GET"}}.ServeHTTP(w, r)
+	if http.StatusMethodNotAllowed != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if "GET, HEAD, OPTIONS" != w.Header().Get("Allow") {
+		t.Fatal(w.Header().Get("Allow"))
+	}
+	if "{\"description\":\"DELETE not allowed; try GET, HEAD, OPTIONS\",\"error\":\"marshaler.MethodNotAllowed\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestOptionsHandler(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("OPTIONS", "http://example.com/foo", nil)
+	OptionsHandler{[]string{"PUT"}}.ServeHTTP(w, r)
+	if http.StatusNoContent != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if "OPTIONS, PUT" != w.Header().Get("Allow") {
+		t.Fatal(w.Header().Get("Allow"))
+	}
+}
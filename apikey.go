@@ -0,0 +1,134 @@
+package marshaler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultAPIKeyHeader is the header from which APIKeyAuth reads API keys.
+var DefaultAPIKeyHeader = "X-API-Key"
+
+// An APIKeyStore looks up the Principal an API key belongs to.  Lookup
+// returns a nil Principal for keys that don't belong to anyone and an error
+// only when the lookup itself fails.
+type APIKeyStore interface {
+	Lookup(key string) (*Principal, error)
+}
+
+// APIKeys is an APIKeyStore of a fixed set of keys.
+type APIKeys map[string]*Principal
+
+// Lookup compares the key to each known key in constant time.
+func (keys APIKeys) Lookup(key string) (*Principal, error) {
+	var principal *Principal
+	for k, p := range keys {
+		if 1 == subtle.ConstantTimeCompare([]byte(k), []byte(key)) {
+			principal = p
+		}
+	}
+	return principal, nil
+}
+
+// APIKeyAuthenticator is an http.Handler that authenticates requests by API
+// key before passing them to the handler it wraps with their Principal in
+// the request's context.  Keys are read from Header or, only if it's set,
+// from the Query parameter, which is then removed from the request's URL
+// before it's passed on.  Since URLs end up in logs, browser histories, and
+// Referer headers, query keys are best avoided; loggers wrapping an
+// APIKeyAuthenticator that accepts them see the key before it's removed and
+// should be given RedactQuery(Query) as their Redactor.  Requests without a
+// known key are rejected 401 Unauthorized and, if Roles is set, requests
+// whose Principal has none of them are rejected 403 Forbidden.
+type APIKeyAuthenticator struct {
+	Header  string
+	Query   string
+	Roles   []string
+	handler http.Handler
+	keys    APIKeyStore
+}
+
+// APIKeyAuth returns an http.Handler that authenticates requests to the given
+// handler by the API keys in the given store.
+func APIKeyAuth(handler http.Handler, keys APIKeyStore) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{
+		Header:  DefaultAPIKeyHeader,
+		handler: handler,
+		keys:    keys,
+	}
+}
+
+func (a *APIKeyAuthenticator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get(a.Header)
+	if "" != a.Query {
+		query := r.URL.Query()
+		if _, ok := query[a.Query]; ok {
+			if "" == key {
+				key = query.Get(a.Query)
+			}
+			query.Del(a.Query)
+			r = r.Clone(r.Context())
+			r.URL.RawQuery = query.Encode()
+			r.RequestURI = r.URL.RequestURI()
+		}
+	}
+	if "" == key {
+		writeError(w, r, Unauthorized{errors.New(Message(r, "API key required"))})
+		return
+	}
+	principal, err := a.keys.Lookup(key)
+	if nil != err {
+		writeError(w, r, err)
+		return
+	}
+	if nil == principal {
+		writeError(w, r, Unauthorized{errors.New(Message(r, "invalid API key"))})
+		return
+	}
+	authenticated(w, r, a.handler, principal, a.Roles)
+}
+
+// RedactQuery returns a Redactor that replaces the values of the given
+// query parameters in any URL in a line with [redacted], for logging
+// requests to an APIKeyAuthenticator that reads keys from the query.
+func RedactQuery(names ...string) Redactor {
+	return func(s string) string {
+		for _, name := range names {
+			for _, sep := range []string{"?", "&"} {
+				prefix := sep + url.QueryEscape(name) + "="
+				for i := 0; ; {
+					j := strings.Index(s[i:], prefix)
+					if 0 > j {
+						break
+					}
+					start := i + j + len(prefix)
+					end := start + strings.IndexAny(s[start:], "& #")
+					if end < start {
+						end = len(s)
+					}
+					s = s[:start] + "[redacted]" + s[end:]
+					i = start + len("[redacted]")
+				}
+			}
+		}
+		return s
+	}
+}
+
+// authenticated passes a request to a handler with its Principal in the
+// request's context after checking that the Principal has one of the
+// required roles, if there are any.
+func authenticated(w http.ResponseWriter, r *http.Request, handler http.Handler, principal *Principal, roles []string) {
+	logRequestLine(r, "authenticated as %s", principal.Name)
+	if 0 < len(roles) && !principal.HasRole(roles...) {
+		writeError(w, r, Forbidden{errors.New(Message(
+			r,
+			"%s may not access this resource",
+			principal.Name,
+		))})
+		return
+	}
+	handler.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+}
@@ -0,0 +1,94 @@
+package marshaler
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func testAPIKeyAuth() *APIKeyAuthenticator {
+	return APIKeyAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(PrincipalFromContext(r.Context()).Name))
+	}), APIKeys{
+		"foo-key": {Name: "foo", Roles: []string{"admin"}},
+		"bar-key": {Name: "bar"},
+	})
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logged(testAPIKeyAuth(), nil)
+	l.Logger = log.New(&buf, "", 0)
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("X-API-Key", "foo-key")
+	l.ServeHTTP(w, r)
+	if http.StatusOK != w.StatusCode || "foo" != w.Body.String() {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+	if !strings.Contains(buf.String(), "authenticated as foo") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestAPIKeyAuthQuery(t *testing.T) {
+	a := testAPIKeyAuth()
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo?api_key=bar-key", nil)
+	a.ServeHTTP(w, r)
+	if http.StatusUnauthorized != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	a.Query = "api_key"
+	w = &testResponseWriter{}
+	a.ServeHTTP(w, r)
+	if "bar" != w.Body.String() {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+}
+
+func TestAPIKeyAuthQueryRedacted(t *testing.T) {
+	var buf bytes.Buffer
+	a := APIKeyAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if "/foo?page=2" != r.RequestURI || "" != r.URL.Query().Get("api_key") {
+			t.Fatal(r.RequestURI, r.URL)
+		}
+	}), APIKeys{"bar-key": {Name: "bar"}})
+	a.Query = "api_key"
+	l := Logged(a, RedactQuery("api_key"))
+	l.Logger = log.New(&buf, "", 0)
+	r, _ := http.NewRequest("GET", "http://example.com/foo?api_key=bar-key&page=2", nil)
+	r.RequestURI = r.URL.RequestURI()
+	l.ServeHTTP(&testResponseWriter{}, r)
+	if strings.Contains(buf.String(), "bar-key") || !strings.Contains(buf.String(), "GET /foo?api_key=[redacted]&page=2 HTTP/1.1") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestAPIKeyAuthInvalid(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Accept", "application/json")
+	r.Header.Set("X-API-Key", "baz-key")
+	testAPIKeyAuth().ServeHTTP(w, r)
+	if http.StatusUnauthorized != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if "{\"description\":\"invalid API key\",\"error\":\"marshaler.Unauthorized\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestAPIKeyAuthForbidden(t *testing.T) {
+	a := testAPIKeyAuth()
+	a.Roles = []string{"admin"}
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("X-API-Key", "bar-key")
+	a.ServeHTTP(w, r)
+	if http.StatusForbidden != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
@@ -0,0 +1,167 @@
+package marshaler
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// auditSignatureMarker begins signature lines.  Logged lines that begin
+// with '#' or '\' are escaped with another '\' so that they never do.
+const auditSignatureMarker = "#signature hmac-sha256="
+
+// AuditLogger is a BytesLogger for access logs that must be tamper-evident.
+// Each line ends with " sha256=" and the SHA-256 hash of the previous
+// line's hash and the rest of this line, timestamp and all, so that lines
+// can't be changed, removed, or reordered without breaking the chain from
+// that point on, as VerifyAuditLog reports.  If SignEvery is positive, a
+// signature line beginning "#signature hmac-sha256=" and carrying the
+// HMAC-SHA256 of the chain so far under the Secret is logged after every
+// SignEvery lines, and when a chain is continued, so that a chain can't be
+// rewritten wholesale by anyone without the secret either.  Newlines within
+// lines are escaped as \n to keep one record per line.  Times are formatted
+// as by a WriterLogger.  It's safe for concurrent use.
+//
+//	audit := NewAuditLogger(f, nil)
+//	audit.SignEvery, audit.Secret = 1000, secret
+//	l := Logged(handler, nil)
+//	l.Logger = audit
+type AuditLogger struct {
+	*WriterLogger
+	Secret    []byte
+	SignEvery int
+	continued bool
+	n         int
+	prev      []byte
+}
+
+// NewAuditLogger returns an AuditLogger that writes lines to w, continuing
+// the chain that ended with the given hash, as returned by VerifyAuditLog,
+// or beginning a new one if it's nil.
+func NewAuditLogger(w io.Writer, previous []byte) *AuditLogger {
+	prev := make([]byte, sha256.Size)
+	copy(prev, previous)
+	l := &AuditLogger{
+		WriterLogger: NewWriterLogger(w),
+		continued:    nil != previous,
+		prev:         prev,
+	}
+	l.TimeFormat = time.RFC3339Nano
+	l.finish = l.write
+	return l
+}
+
+// Sign logs a signature line now, as when the log is about to be closed,
+// so that the lines since the last one can be trusted.
+func (l *AuditLogger) Sign() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sign()
+}
+
+// write chains the line in b and writes it, preceded by a signature line if
+// it continues a chain and followed by one if one is due.  The
+// WriterLogger's lock is held.
+func (l *AuditLogger) write(b []byte) error {
+	b = bytes.TrimSuffix(b, []byte("\n"))
+	if 0 <= bytes.IndexByte(b, '\n') {
+		b = bytes.Replace(b, []byte("\n"), []byte(`\n`), -1)
+	}
+	if 0 < len(b) && ('#' == b[0] || '\\' == b[0]) {
+		b = append([]byte{'\\'}, b...)
+	}
+	if l.continued && 0 < l.SignEvery {
+		line := append([]byte(nil), b...)
+		if err := l.sign(); nil != err {
+			return err
+		}
+		b = line
+	}
+	l.continued = false
+	if err := l.chain(b); nil != err {
+		return err
+	}
+	if l.n++; 0 >= l.SignEvery || l.n < l.SignEvery {
+		return nil
+	}
+	return l.sign()
+}
+
+// sign chains and writes a signature line, starting a new interval.
+func (l *AuditLogger) sign() error {
+	l.n = 0
+	mac := hmac.New(sha256.New, l.Secret)
+	mac.Write(l.prev)
+	return l.chain(append(append(l.buf[:0], auditSignatureMarker...), hex.EncodeToString(mac.Sum(nil))...))
+}
+
+// chain appends the hash of the previous line's hash and b to b and
+// writes it, keeping b for the next line.
+func (l *AuditLogger) chain(b []byte) error {
+	h := sha256.New()
+	h.Write(l.prev)
+	h.Write(b)
+	l.prev = h.Sum(l.prev[:0])
+	b = append(append(b, " sha256="...), hex.EncodeToString(l.prev)...)
+	l.buf = append(b, '\n')
+	_, err := l.w.Write(l.buf)
+	return err
+}
+
+// VerifyAuditLog reads lines written by an AuditLogger and checks that
+// each hash follows from the line before it, beginning with the given hash
+// of the line before the first, or a new chain if it's nil.  If secret
+// isn't nil, every signature line is checked against it, and no more than
+// signEvery lines may go unsigned, so that a chain rewritten without
+// signatures doesn't verify; only the lines after the last signature can't
+// be trusted further than the chain.  It returns the hash of the last line,
+// from which an AuditLogger may continue the chain, or an error naming the
+// first line that doesn't verify.
+func VerifyAuditLog(r io.Reader, previous, secret []byte, signEvery int) ([]byte, error) {
+	prev := make([]byte, sha256.Size)
+	copy(prev, previous)
+	if nil != secret && 0 >= signEvery {
+		return prev, errors.New("verifying audit log signatures requires a positive signEvery")
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<24)
+	unsigned := 0
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Bytes()
+		i := bytes.LastIndex(line, []byte(" sha256="))
+		if 0 > i {
+			return prev, fmt.Errorf("audit log line %d has no hash", n)
+		}
+		got, err := hex.DecodeString(string(line[i+len(" sha256="):]))
+		if nil != err {
+			return prev, fmt.Errorf("audit log line %d has a malformed hash", n)
+		}
+		if nil != secret {
+			if bytes.HasPrefix(line, []byte(auditSignatureMarker)) {
+				signature, _ := hex.DecodeString(string(line[len(auditSignatureMarker):i]))
+				mac := hmac.New(sha256.New, secret)
+				mac.Write(prev)
+				if !hmac.Equal(signature, mac.Sum(nil)) {
+					return prev, fmt.Errorf("audit log line %d has an invalid signature", n)
+				}
+				unsigned = 0
+			} else if unsigned++; signEvery < unsigned {
+				return prev, fmt.Errorf("audit log line %d should be a signature", n)
+			}
+		}
+		h := sha256.New()
+		h.Write(prev)
+		h.Write(line[:i])
+		if want := h.Sum(nil); !bytes.Equal(want, got) {
+			return prev, fmt.Errorf("audit log line %d doesn't follow from the line before it", n)
+		}
+		prev = got
+	}
+	return prev, scanner.Err()
+}
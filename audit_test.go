@@ -0,0 +1,109 @@
+package marshaler
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLogger(t *testing.T) {
+	var buf bytes.Buffer
+	audit := NewAuditLogger(&buf, nil)
+	audit.Clock = FixedClock(DeterministicTime)
+	audit.Secret = []byte("secret")
+	audit.SignEvery = 2
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello\nworld"))
+	}), nil)
+	l.Logger = audit
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	r, _ := http.NewRequest("GET", "/", nil)
+	l.ServeHTTP(&testResponseWriter{}, r)
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if 7 != len(lines) || !strings.HasPrefix(lines[0], "2000-01-01T00:00:00Z foo > GET / HTTP/1.1 sha256=") || !strings.HasPrefix(lines[2], "#signature hmac-sha256=") || !strings.Contains(buf.String(), `foo < hello\nworld sha256=`) {
+		t.Fatal(buf.String())
+	}
+	last, err := VerifyAuditLog(strings.NewReader(buf.String()), nil, []byte("secret"), 2)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, err := VerifyAuditLog(strings.NewReader(buf.String()), nil, []byte("wrong"), 2); nil == err || "audit log line 3 has an invalid signature" != err.Error() {
+		t.Fatal(err)
+	}
+
+	// Continuing the chain.
+	audit = NewAuditLogger(&buf, last)
+	audit.Print("bar")
+	if _, err := VerifyAuditLog(strings.NewReader(buf.String()), nil, nil, 0); nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestAuditLoggerContinuedSigned(t *testing.T) {
+	var buf bytes.Buffer
+	audit := NewAuditLogger(&buf, []byte("previous"))
+	audit.Secret = []byte("secret")
+	audit.SignEvery = 2
+	audit.Print("foo")
+	audit.Print("#signature hmac-sha256=00")
+	audit.Print("bar")
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if 5 != len(lines) || !strings.HasPrefix(lines[0], "#signature hmac-sha256=") || !strings.HasPrefix(lines[3], "#signature hmac-sha256=") {
+		t.Fatal(buf.String())
+	}
+	if _, err := VerifyAuditLog(strings.NewReader(buf.String()), []byte("previous"), []byte("secret"), 2); nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestAuditLoggerUnsigned(t *testing.T) {
+	var buf bytes.Buffer
+	audit := NewAuditLogger(&buf, nil)
+	audit.TimeFormat = time.RFC1123
+	for _, s := range []string{"foo", "bar", "baz"} {
+		audit.Print(s)
+	}
+	if _, err := VerifyAuditLog(strings.NewReader(buf.String()), nil, []byte("secret"), 2); nil == err || "audit log line 3 should be a signature" != err.Error() {
+		t.Fatal(err)
+	}
+	if _, err := VerifyAuditLog(strings.NewReader(buf.String()), nil, []byte("secret"), 0); nil == err {
+		t.Fatal(err)
+	}
+
+	// With signatures, RFC1123's spaces don't matter.
+	buf.Reset()
+	audit = NewAuditLogger(&buf, nil)
+	audit.TimeFormat = time.RFC1123
+	audit.Secret = []byte("secret")
+	audit.SignEvery = 2
+	for _, s := range []string{"foo", "bar", "baz"} {
+		audit.Print(s)
+	}
+	if err := audit.Sign(); nil != err {
+		t.Fatal(err)
+	}
+	if _, err := VerifyAuditLog(strings.NewReader(buf.String()), nil, []byte("secret"), 2); nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestAuditLoggerTampered(t *testing.T) {
+	var buf bytes.Buffer
+	audit := NewAuditLogger(&buf, nil)
+	audit.TimeFormat = time.Kitchen
+	for _, s := range []string{"foo", "bar", "baz"} {
+		audit.Print(s)
+	}
+	lines := strings.SplitAfter(buf.String(), "\n")
+	for _, tampered := range []string{
+		strings.Replace(buf.String(), "bar", "BAR", 1),
+		lines[0] + lines[2],
+		lines[1] + lines[0] + lines[2],
+	} {
+		if _, err := VerifyAuditLog(strings.NewReader(tampered), nil, nil, 0); nil == err {
+			t.Fatal(tampered)
+		}
+	}
+}
@@ -0,0 +1,693 @@
+package marshaler
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// AvroType is the media type of Avro request and response bodies.
+const AvroType = "avro/binary"
+
+// A SchemaRegistry assigns IDs to Avro schemas, like the Confluent Schema
+// Registry, so that each body may identify the schema it was written with.
+type SchemaRegistry interface {
+
+	// ID returns the ID of the schema under the given subject, registering
+	// the schema if necessary.
+	ID(subject, schema string) (int, error)
+
+	// Schema returns the schema with the given ID.
+	Schema(id int) (string, error)
+}
+
+// Avro is the Codec for Avro binary encoding.  Request and response types
+// are encoded against the schemas registered for them, with record fields
+// matched to the fields' json names.  Without a SchemaRegistry, bodies are
+// bare Avro data; with one, they're framed as the Confluent wire format:
+// a zero byte and the big-endian schema ID, followed by the data.
+//
+//	avro := marshaler.NewAvro(nil)
+//	if err := avro.Register(&Response{}, schema); nil != err {
+//	    log.Fatal(err)
+//	}
+//	marshaler.RegisterCodec(marshaler.AvroType, avro)
+type Avro struct {
+	Registry SchemaRegistry
+
+	mu       sync.Mutex
+	schemas  map[reflect.Type]*avroSchema
+	registry map[int]*avroSchema
+}
+
+// NewAvro returns an Avro Codec that uses the given SchemaRegistry, which
+// may be nil.
+func NewAvro(registry SchemaRegistry) *Avro {
+	return &Avro{
+		Registry: registry,
+		schemas:  make(map[reflect.Type]*avroSchema),
+		registry: make(map[int]*avroSchema),
+	}
+}
+
+// Register parses an Avro schema and uses it to encode and decode values of
+// the type of v.
+func (a *Avro) Register(v interface{}, schema string) error {
+	s, err := parseAvroSchema(schema)
+	if nil != err {
+		return err
+	}
+	s.text = schema
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.schemas[indirectType(reflect.TypeOf(v))] = s
+	return nil
+}
+
+// Marshal encodes v against the schema registered for its type.
+func (a *Avro) Marshal(v interface{}) ([]byte, error) {
+	return a.MarshalType(reflect.TypeOf(v), v)
+}
+
+// MarshalType encodes v, which may have been transformed by the Marshaler,
+// against the schema registered for t.
+func (a *Avro) MarshalType(t reflect.Type, v interface{}) ([]byte, error) {
+	s, err := a.schema(t)
+	if nil != err {
+		return nil, err
+	}
+	tree, err := (&encodeOptions{transforming: true}).transform(reflect.ValueOf(v))
+	if nil != err {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if nil != a.Registry {
+		id, err := a.Registry.ID(s.Name, s.text)
+		if nil != err {
+			return nil, err
+		}
+		buf.WriteByte(0)
+		binary.Write(&buf, binary.BigEndian, int32(id))
+	}
+	if err := s.encode(&buf, tree); nil != err {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes data into v, using the schema identified by the data
+// if there is a SchemaRegistry and the schema registered for the type of v
+// otherwise.  Record fields missing from the writer's schema are left
+// untouched.
+func (a *Avro) Unmarshal(data []byte, v interface{}) error {
+	s, err := a.schema(reflect.TypeOf(v))
+	if nil != a.Registry {
+		if len(data) < 5 || 0 != data[0] {
+			return errors.New("Avro data is missing its schema ID")
+		}
+		s, err = a.registeredSchema(int(int32(binary.BigEndian.Uint32(data[1:5]))))
+		data = data[5:]
+	}
+	if nil != err {
+		return err
+	}
+	r := bytes.NewReader(data)
+	tree, err := s.decode(r)
+	if nil != err {
+		return err
+	}
+	if 0 != r.Len() {
+		return errors.New("Avro data is followed by extra data")
+	}
+	b, err := json.Marshal(tree)
+	if nil != err {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func (a *Avro) schema(t reflect.Type) (*avroSchema, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, ok := a.schemas[indirectType(t)]
+	if !ok {
+		return nil, fmt.Errorf("no Avro schema is registered for %v", t)
+	}
+	return s, nil
+}
+
+func (a *Avro) registeredSchema(id int) (*avroSchema, error) {
+	a.mu.Lock()
+	s, ok := a.registry[id]
+	a.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+	text, err := a.Registry.Schema(id)
+	if nil != err {
+		return nil, err
+	}
+	if s, err = parseAvroSchema(text); nil != err {
+		return nil, err
+	}
+	s.text = text
+	a.mu.Lock()
+	a.registry[id] = s
+	a.mu.Unlock()
+	return s, nil
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for reflect.Ptr == t.Kind() {
+		t = t.Elem()
+	}
+	return t
+}
+
+// avroSchema is a parsed Avro schema.  Unions have the type "union" and
+// named types referenced more than once share an avroSchema.  Nil slices and
+// maps are encoded as empty arrays and maps.
+type avroSchema struct {
+	Type        string
+	Name        string
+	LogicalType string
+	Fields      []avroField
+	Symbols     []string
+	Items       *avroSchema
+	Values      *avroSchema
+	Size        int
+	Branches    []*avroSchema
+	text        string
+}
+
+type avroField struct {
+	Name       string
+	Schema     *avroSchema
+	Default    interface{}
+	HasDefault bool
+}
+
+func parseAvroSchema(text string) (*avroSchema, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(text)))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); nil != err {
+		return nil, err
+	}
+	return parseAvroNode(v, map[string]*avroSchema{})
+}
+
+func parseAvroNode(v interface{}, named map[string]*avroSchema) (*avroSchema, error) {
+	switch v := v.(type) {
+	case string:
+		switch v {
+		case "null", "boolean", "int", "long", "float", "double", "bytes", "string":
+			return &avroSchema{Type: v}, nil
+		}
+		if s, ok := named[v]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("Avro type %s is not defined", v)
+	case []interface{}:
+		s := &avroSchema{Type: "union"}
+		for _, branch := range v {
+			b, err := parseAvroNode(branch, named)
+			if nil != err {
+				return nil, err
+			}
+			s.Branches = append(s.Branches, b)
+		}
+		return s, nil
+	case map[string]interface{}:
+		t, _ := v["type"].(string)
+		s := &avroSchema{Type: t}
+		s.Name, _ = v["name"].(string)
+		s.LogicalType, _ = v["logicalType"].(string)
+		if ns, ok := v["namespace"].(string); ok && "" != s.Name {
+			named[ns+"."+s.Name] = s
+		}
+		if "" != s.Name {
+			named[s.Name] = s
+		}
+		switch t {
+		case "record", "error":
+			s.Type = "record"
+			fields, _ := v["fields"].([]interface{})
+			for _, field := range fields {
+				f, ok := field.(map[string]interface{})
+				if !ok {
+					return nil, errors.New("Avro record fields must be objects")
+				}
+				fs, err := parseAvroNode(f["type"], named)
+				if nil != err {
+					return nil, err
+				}
+				name, _ := f["name"].(string)
+				def, hasDefault := f["default"]
+				s.Fields = append(s.Fields, avroField{name, fs, def, hasDefault})
+			}
+		case "enum":
+			symbols, _ := v["symbols"].([]interface{})
+			for _, symbol := range symbols {
+				s.Symbols = append(s.Symbols, fmt.Sprint(symbol))
+			}
+		case "array":
+			items, err := parseAvroNode(v["items"], named)
+			if nil != err {
+				return nil, err
+			}
+			s.Items = items
+		case "map":
+			values, err := parseAvroNode(v["values"], named)
+			if nil != err {
+				return nil, err
+			}
+			s.Values = values
+		case "fixed":
+			size, _ := v["size"].(json.Number)
+			n, err := size.Int64()
+			if nil != err {
+				return nil, err
+			}
+			s.Size = int(n)
+		default:
+			primitive, err := parseAvroNode(t, named)
+			if nil != err {
+				return nil, err
+			}
+			s.Type = primitive.Type
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("Avro schema %v is not valid", v)
+}
+
+// avroValue reduces a leaf of a transformed tree to one of nil, bool,
+// string, int64, float64, []byte, time.Time, []interface{}, or an object.
+func avroValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, orderedObject, map[string]interface{}, []interface{}, []byte, time.Time:
+		return v, nil
+	case *time.Time:
+		if nil == v {
+			return nil, nil
+		}
+		return *v, nil
+	case json.Number:
+		if i, err := v.Int64(); nil == err {
+			return i, nil
+		}
+		return v.Float64()
+	case json.Marshaler:
+		b, err := v.MarshalJSON()
+		if nil != err {
+			return nil, err
+		}
+		decoder := json.NewDecoder(bytes.NewReader(b))
+		decoder.UseNumber()
+		var generic interface{}
+		if err := decoder.Decode(&generic); nil != err {
+			return nil, err
+		}
+		return avroValue(generic)
+	case encoding.TextMarshaler:
+		b, err := v.MarshalText()
+		return string(b), err
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("Avro can't encode %d as a long", v.Uint())
+		}
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	}
+	return nil, fmt.Errorf("Avro can't encode %T", value)
+}
+
+// matches reports whether a value is suitable for a union branch.
+func (s *avroSchema) matches(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return "null" == s.Type
+	case bool:
+		return "boolean" == s.Type
+	case string:
+		if "enum" == s.Type {
+			for _, symbol := range s.Symbols {
+				if symbol == v {
+					return true
+				}
+			}
+			return false
+		}
+		return "string" == s.Type
+	case int64:
+		return "int" == s.Type || "long" == s.Type || "float" == s.Type || "double" == s.Type
+	case float64:
+		return "float" == s.Type || "double" == s.Type
+	case []byte:
+		return "bytes" == s.Type || "fixed" == s.Type && len(v) == s.Size
+	case time.Time:
+		return "long" == s.Type && "" != s.LogicalType || "string" == s.Type
+	case orderedObject, map[string]interface{}:
+		return "record" == s.Type || "map" == s.Type
+	case []interface{}:
+		return "array" == s.Type
+	}
+	return false
+}
+
+func (s *avroSchema) encode(buf *bytes.Buffer, value interface{}) error {
+	v, err := avroValue(value)
+	if nil != err {
+		return err
+	}
+	mismatch := fmt.Errorf("Avro %s can't encode %T", s.Type, value)
+	switch s.Type {
+	case "null":
+		if nil != v {
+			return mismatch
+		}
+	case "boolean":
+		b, ok := v.(bool)
+		if !ok {
+			return mismatch
+		}
+		if b {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case "int", "long":
+		switch v := v.(type) {
+		case int64:
+			writeAvroLong(buf, v)
+		case float64:
+			if v != math.Trunc(v) {
+				return mismatch
+			}
+			writeAvroLong(buf, int64(v))
+		case time.Time:
+			switch s.LogicalType {
+			case "timestamp-micros":
+				writeAvroLong(buf, v.UnixMicro())
+			case "timestamp-millis":
+				writeAvroLong(buf, v.UnixMilli())
+			default:
+				return mismatch
+			}
+		default:
+			return mismatch
+		}
+	case "float", "double":
+		var f float64
+		switch v := v.(type) {
+		case int64:
+			f = float64(v)
+		case float64:
+			f = v
+		default:
+			return mismatch
+		}
+		if "float" == s.Type {
+			binary.Write(buf, binary.LittleEndian, float32(f))
+		} else {
+			binary.Write(buf, binary.LittleEndian, f)
+		}
+	case "bytes", "string":
+		switch v := v.(type) {
+		case string:
+			writeAvroLong(buf, int64(len(v)))
+			buf.WriteString(v)
+		case []byte:
+			writeAvroLong(buf, int64(len(v)))
+			buf.Write(v)
+		case time.Time:
+			text := v.Format(time.RFC3339Nano)
+			writeAvroLong(buf, int64(len(text)))
+			buf.WriteString(text)
+		default:
+			return mismatch
+		}
+	case "fixed":
+		b, ok := v.([]byte)
+		if !ok || len(b) != s.Size {
+			return mismatch
+		}
+		buf.Write(b)
+	case "enum":
+		symbol, ok := v.(string)
+		if !ok {
+			return mismatch
+		}
+		for i, candidate := range s.Symbols {
+			if candidate == symbol {
+				writeAvroLong(buf, int64(i))
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not a symbol of Avro enum %s", symbol, s.Name)
+	case "union":
+		for i, branch := range s.Branches {
+			if branch.matches(v) {
+				writeAvroLong(buf, int64(i))
+				return branch.encode(buf, v)
+			}
+		}
+		return fmt.Errorf("no branch of Avro union can encode %T", value)
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok && nil != v {
+			return mismatch
+		}
+		if 0 < len(items) {
+			writeAvroLong(buf, int64(len(items)))
+			for _, item := range items {
+				if err := s.Items.encode(buf, item); nil != err {
+					return err
+				}
+			}
+		}
+		buf.WriteByte(0)
+	case "map":
+		obj, ok := v.(map[string]interface{})
+		if o, isOrdered := v.(orderedObject); isOrdered {
+			obj, ok = make(map[string]interface{}, len(o)), true
+			for _, f := range o {
+				obj[f.Name] = f.Value
+			}
+		}
+		if !ok && nil != v {
+			return mismatch
+		}
+		if 0 < len(obj) {
+			writeAvroLong(buf, int64(len(obj)))
+			for _, key := range sortedKeys(obj) {
+				writeAvroLong(buf, int64(len(key)))
+				buf.WriteString(key)
+				if err := s.Values.encode(buf, obj[key]); nil != err {
+					return err
+				}
+			}
+		}
+		buf.WriteByte(0)
+	case "record":
+		for _, f := range s.Fields {
+			value, ok := avroFieldValue(v, f.Name)
+			if !ok {
+				if !f.HasDefault && !f.Schema.matches(nil) {
+					return fmt.Errorf("Avro record %s is missing field %s", s.Name, f.Name)
+				}
+				value = f.Default
+			}
+			if err := f.Schema.encode(buf, value); nil != err {
+				return fmt.Errorf("%s: %s", f.Name, err)
+			}
+		}
+	default:
+		return fmt.Errorf("Avro type %s is not supported", s.Type)
+	}
+	return nil
+}
+
+func avroFieldValue(v interface{}, name string) (interface{}, bool) {
+	switch v := v.(type) {
+	case orderedObject:
+		for _, f := range v {
+			if f.Name == name {
+				return f.Value, true
+			}
+		}
+	case map[string]interface{}:
+		value, ok := v[name]
+		return value, ok
+	}
+	return nil, false
+}
+
+func writeAvroLong(buf *bytes.Buffer, i int64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutVarint(b[:], i)])
+}
+
+var errAvroTruncated = errors.New("Avro data is truncated")
+
+func readAvroLong(r *bytes.Reader) (int64, error) {
+	i, err := binary.ReadVarint(r)
+	if nil != err {
+		return 0, errAvroTruncated
+	}
+	return i, nil
+}
+
+func readAvroBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := readAvroLong(r)
+	if nil != err {
+		return nil, err
+	}
+	if n < 0 || n > int64(r.Len()) {
+		return nil, errAvroTruncated
+	}
+	b := make([]byte, n)
+	io.ReadFull(r, b)
+	return b, nil
+}
+
+// decode reads a value into a tree that encoding/json encodes as the JSON
+// equivalent of the Avro value.
+func (s *avroSchema) decode(r *bytes.Reader) (interface{}, error) {
+	switch s.Type {
+	case "null":
+		return nil, nil
+	case "boolean":
+		b, err := r.ReadByte()
+		if nil != err {
+			return nil, errAvroTruncated
+		}
+		return 0 != b, nil
+	case "int", "long":
+		i, err := readAvroLong(r)
+		if nil != err {
+			return nil, err
+		}
+		switch s.LogicalType {
+		case "timestamp-millis":
+			return time.UnixMilli(i).UTC(), nil
+		case "timestamp-micros":
+			return time.UnixMicro(i).UTC(), nil
+		}
+		return i, nil
+	case "float":
+		var f float32
+		if err := binary.Read(r, binary.LittleEndian, &f); nil != err {
+			return nil, errAvroTruncated
+		}
+		return float64(f), nil
+	case "double":
+		var f float64
+		if err := binary.Read(r, binary.LittleEndian, &f); nil != err {
+			return nil, errAvroTruncated
+		}
+		return f, nil
+	case "bytes":
+		return readAvroBytes(r)
+	case "string":
+		b, err := readAvroBytes(r)
+		return string(b), err
+	case "fixed":
+		if s.Size > r.Len() {
+			return nil, errAvroTruncated
+		}
+		b := make([]byte, s.Size)
+		io.ReadFull(r, b)
+		return b, nil
+	case "enum":
+		i, err := readAvroLong(r)
+		if nil != err {
+			return nil, err
+		}
+		if i < 0 || i >= int64(len(s.Symbols)) {
+			return nil, fmt.Errorf("Avro enum %s has no symbol %d", s.Name, i)
+		}
+		return s.Symbols[i], nil
+	case "union":
+		i, err := readAvroLong(r)
+		if nil != err {
+			return nil, err
+		}
+		if i < 0 || i >= int64(len(s.Branches)) {
+			return nil, fmt.Errorf("Avro union has no branch %d", i)
+		}
+		return s.Branches[i].decode(r)
+	case "array", "map":
+		var items []interface{}
+		obj := map[string]interface{}{}
+		for {
+			n, err := readAvroLong(r)
+			if nil != err {
+				return nil, err
+			}
+			if 0 == n {
+				break
+			}
+			if n < 0 { // Negative counts are followed by the block's size.
+				n = -n
+				if _, err := readAvroLong(r); nil != err {
+					return nil, err
+				}
+			}
+			for ; 0 < n; n-- {
+				if "array" == s.Type {
+					item, err := s.Items.decode(r)
+					if nil != err {
+						return nil, err
+					}
+					items = append(items, item)
+					continue
+				}
+				key, err := readAvroBytes(r)
+				if nil != err {
+					return nil, err
+				}
+				if obj[string(key)], err = s.Values.decode(r); nil != err {
+					return nil, err
+				}
+			}
+		}
+		if "map" == s.Type {
+			return obj, nil
+		}
+		if nil == items {
+			items = []interface{}{}
+		}
+		return items, nil
+	case "record":
+		obj := map[string]interface{}{}
+		for _, f := range s.Fields {
+			value, err := f.Schema.decode(r)
+			if nil != err {
+				return nil, fmt.Errorf("%s: %s", f.Name, err)
+			}
+			obj[f.Name] = value
+		}
+		return obj, nil
+	}
+	return nil, fmt.Errorf("Avro type %s is not supported", s.Type)
+}
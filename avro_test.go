@@ -0,0 +1,164 @@
+package marshaler
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const testAvroSchema = `{
+	"type": "record",
+	"name": "Event",
+	"namespace": "com.example",
+	"fields": [
+		{"name": "id", "type": "long"},
+		{"name": "kind", "type": {"type": "enum", "name": "Kind", "symbols": ["CREATED", "DELETED"]}},
+		{"name": "at", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "tags", "type": {"type": "array", "items": "string"}},
+		{"name": "counts", "type": {"type": "map", "values": "int"}},
+		{"name": "note", "type": ["null", "string"]},
+		{"name": "ratio", "type": "double"},
+		{"name": "ok", "type": "boolean"},
+		{"name": "version", "type": "int", "default": 1}
+	]
+}`
+
+type testAvroEvent struct {
+	ID      int64          `json:"id"`
+	Kind    string         `json:"kind"`
+	At      time.Time      `json:"at"`
+	Tags    []string       `json:"tags"`
+	Counts  map[string]int `json:"counts"`
+	Note    *string        `json:"note"`
+	Ratio   float64        `json:"ratio"`
+	OK      bool           `json:"ok"`
+	Version int            `json:"-"`
+}
+
+func testAvroCodec(t *testing.T, registry SchemaRegistry) *Avro {
+	avro := NewAvro(registry)
+	if err := avro.Register(&testAvroEvent{}, testAvroSchema); nil != err {
+		t.Fatal(err)
+	}
+	return avro
+}
+
+func TestAvroRoundTrip(t *testing.T) {
+	avro := testAvroCodec(t, nil)
+	note := "hi"
+	in := &testAvroEvent{
+		ID:     -1 << 40,
+		Kind:   "DELETED",
+		At:     time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC),
+		Tags:   []string{"a", "b"},
+		Counts: map[string]int{"x": 1},
+		Note:   &note,
+		Ratio:  0.5,
+		OK:     true,
+	}
+	b, err := avro.Marshal(in)
+	if nil != err {
+		t.Fatal(err)
+	}
+	out := &testAvroEvent{}
+	if err := avro.Unmarshal(b, out); nil != err {
+		t.Fatal(err)
+	}
+	if in.ID != out.ID || "DELETED" != out.Kind || !in.At.Equal(out.At) || 2 != len(out.Tags) || 1 != out.Counts["x"] {
+		t.Fatal(out)
+	}
+	if nil == out.Note || "hi" != *out.Note || 0.5 != out.Ratio || !out.OK {
+		t.Fatal(out)
+	}
+}
+
+func TestAvroEncoding(t *testing.T) {
+	avro := NewAvro(nil)
+	if err := avro.Register(testRequest{}, `{"type":"record","name":"R","fields":[{"name":"foo","type":"string"}]}`); nil != err {
+		t.Fatal(err)
+	}
+	b, err := avro.Marshal(&testRequest{"bar"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "\x06bar" != string(b) {
+		t.Fatalf("%q", b)
+	}
+}
+
+func TestAvroErrors(t *testing.T) {
+	avro := testAvroCodec(t, nil)
+	if _, err := avro.Marshal(&testResponse{"foo"}); nil == err {
+		t.Fatal(err)
+	}
+	if _, err := avro.Marshal(&testAvroEvent{Kind: "UPDATED"}); nil == err {
+		t.Fatal(err)
+	}
+	if err := avro.Unmarshal([]byte{0x02}, &testAvroEvent{}); nil == err {
+		t.Fatal(err)
+	}
+	if err := NewAvro(nil).Register(&testAvroEvent{}, `{"type":"record","fields":[{"name":"x","type":"Missing"}]}`); nil == err {
+		t.Fatal(err)
+	}
+}
+
+type testSchemaRegistry map[int]string
+
+func (r testSchemaRegistry) ID(subject, schema string) (int, error) {
+	for id, s := range r {
+		if s == schema {
+			return id, nil
+		}
+	}
+	id := 256 + len(r)
+	r[id] = schema
+	return id, nil
+}
+
+func (r testSchemaRegistry) Schema(id int) (string, error) {
+	if schema, ok := r[id]; ok {
+		return schema, nil
+	}
+	return "", errors.New("schema not found")
+}
+
+func TestAvroSchemaRegistry(t *testing.T) {
+	registry := testSchemaRegistry{}
+	avro := testAvroCodec(t, registry)
+	b, err := avro.Marshal(&testAvroEvent{Kind: "CREATED"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b, []byte{0, 0, 0, 1, 0}) {
+		t.Fatalf("%q", b)
+	}
+	out := &testAvroEvent{}
+	if err := testAvroCodec(t, registry).Unmarshal(b, out); nil != err || "CREATED" != out.Kind {
+		t.Fatal(err, out)
+	}
+	b[4] = 1
+	if err := testAvroCodec(t, registry).Unmarshal(b, out); nil == err {
+		t.Fatal(err)
+	}
+}
+
+func TestAvroMarshaler(t *testing.T) {
+	RegisterCodec(AvroType, testAvroCodec(t, nil))
+	defer delete(codecs, AvroType)
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Accept", AvroType)
+	Handler(func(u *url.URL, h http.Header) (int, http.Header, *testAvroEvent, error) {
+		return http.StatusOK, nil, &testAvroEvent{ID: 1, Kind: "CREATED"}, nil
+	}).ServeHTTP(w, r)
+	if http.StatusOK != w.StatusCode || AvroType != w.Header().Get("Content-Type") {
+		t.Fatal(w.StatusCode, w.Header(), w.Body.String())
+	}
+	out := &testAvroEvent{}
+	if err := testAvroCodec(t, nil).Unmarshal(w.Body.Bytes(), out); nil != err || 1 != out.ID {
+		t.Fatal(err, out)
+	}
+}
@@ -0,0 +1,89 @@
+package marshaler
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// A CredentialChecker checks a username and password, returning the
+// Principal they belong to or nil if they're invalid.  Check returns an error
+// only when checking itself fails.
+type CredentialChecker interface {
+	Check(username, password string) (*Principal, error)
+}
+
+// BasicCredentials is a CredentialChecker of a fixed set of usernames and
+// their passwords.
+type BasicCredentials map[string]string
+
+// Check compares the password in constant time, hashing both passwords
+// first so that not even their lengths leak.
+func (c BasicCredentials) Check(username, password string) (*Principal, error) {
+	expected, ok := c[username]
+	given, want := sha256.Sum256([]byte(password)), sha256.Sum256([]byte(expected))
+	if 1 != subtle.ConstantTimeCompare(given[:], want[:]) || !ok {
+		return nil, nil
+	}
+	return &Principal{Name: username}, nil
+}
+
+// BasicAuthenticator is an http.Handler that authenticates requests by HTTP
+// Basic authentication before passing them to the handler it wraps with
+// their Principal in the request's context.  Requests without valid
+// credentials are rejected 401 Unauthorized with a WWW-Authenticate
+// challenge and, if Roles is set, requests whose Principal has none of them
+// are rejected 403 Forbidden.  Only usernames are logged.
+type BasicAuthenticator struct {
+	Roles       []string
+	handler     http.Handler
+	realm       string
+	credentials CredentialChecker
+}
+
+// HTTPBasicAuth returns an http.Handler that authenticates requests to the
+// given handler in the given realm by the given credentials.
+func HTTPBasicAuth(handler http.Handler, realm string, credentials CredentialChecker) *BasicAuthenticator {
+	return &BasicAuthenticator{
+		handler:     handler,
+		realm:       realm,
+		credentials: credentials,
+	}
+}
+
+func (a *BasicAuthenticator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		a.challenge(w, r, errors.New(Message(r, "credentials required")))
+		return
+	}
+	principal, err := a.credentials.Check(username, password)
+	if nil != err {
+		writeError(w, r, err)
+		return
+	}
+	if nil == principal {
+		logRequestLine(r, "invalid credentials for %s", username)
+		a.challenge(w, r, errors.New(Message(r, "invalid credentials")))
+		return
+	}
+	authenticated(w, r, a.handler, principal, a.Roles)
+}
+
+func (a *BasicAuthenticator) challenge(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("WWW-Authenticate", "Basic realm="+strconv.Quote(a.realm)+", charset=\"UTF-8\"")
+	writeError(w, r, Unauthorized{err})
+}
+
+// redactBasicAuth replaces the password in the value of an Authorization
+// header that uses Basic authentication so that the logger records only the
+// username.
+func redactBasicAuth(value string) string {
+	r := &http.Request{Header: http.Header{"Authorization": {value}}}
+	if username, _, ok := r.BasicAuth(); ok {
+		return "Basic " + username + ":[redacted]"
+	}
+	return value
+}
@@ -0,0 +1,61 @@
+package marshaler
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func testBasicAuth() *BasicAuthenticator {
+	return HTTPBasicAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(PrincipalFromContext(r.Context()).Name))
+	}), "example", BasicCredentials{"foo": "secret"})
+}
+
+func TestHTTPBasicAuth(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logged(testBasicAuth(), nil)
+	l.Logger = log.New(&buf, "", 0)
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.SetBasicAuth("foo", "secret")
+	l.ServeHTTP(w, r)
+	if "foo" != w.Body.String() {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+	if strings.Contains(buf.String(), "secret") || strings.Contains(buf.String(), r.Header.Get("Authorization")) {
+		t.Fatal(buf.String())
+	}
+	if !strings.Contains(buf.String(), "> Authorization: Basic foo:[redacted]") || !strings.Contains(buf.String(), "authenticated as foo") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestHTTPBasicAuthInvalid(t *testing.T) {
+	for _, password := range []string{"", "wrong"} {
+		w := &testResponseWriter{}
+		r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+		if "" != password {
+			r.SetBasicAuth("foo", password)
+		}
+		testBasicAuth().ServeHTTP(w, r)
+		if http.StatusUnauthorized != w.StatusCode {
+			t.Fatal(password, w.StatusCode)
+		}
+		if "Basic realm=\"example\", charset=\"UTF-8\"" != w.Header().Get("WWW-Authenticate") {
+			t.Fatal(password, w.Header())
+		}
+	}
+}
+
+func TestBasicCredentials(t *testing.T) {
+	c := BasicCredentials{"foo": "secret"}
+	if p, _ := c.Check("foo", "secret"); nil == p || "foo" != p.Name {
+		t.Fatal(p)
+	}
+	if p, _ := c.Check("bar", ""); nil != p {
+		t.Fatal(p)
+	}
+}
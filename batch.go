@@ -0,0 +1,145 @@
+package marshaler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+)
+
+// DefaultMaxBatchParts is the number of sub-requests a BatchHandler accepts
+// in one batch unless its MaxParts field is changed.
+var DefaultMaxBatchParts = 100
+
+// BatchHandler is an http.Handler that answers multipart/mixed batches of
+// sub-requests.  Each part of the batch is an application/http message that
+// is dispatched to the handler, usually a mux, and answered by an
+// application/http part of the multipart/mixed response, in order and with
+// the same Content-ID.  When the batch is being logged, each sub-request
+// and sub-response is summarized under the batch's RequestID.
+type BatchHandler struct {
+	MaxParts int
+	handler  http.Handler
+}
+
+// Batch returns an http.Handler that dispatches each sub-request of a batch
+// to the given handler.
+func Batch(handler http.Handler) *BatchHandler {
+	return &BatchHandler{
+		MaxParts: DefaultMaxBatchParts,
+		handler:  handler,
+	}
+}
+
+func (h *BatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if "POST" != r.Method {
+		MethodNotAllowedHandler{Methods: []string{"POST"}}.ServeHTTP(w, r)
+		return
+	}
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if nil != err || "multipart/mixed" != mediaType || "" == params["boundary"] {
+		writeError(w, r, UnsupportedMediaType{errors.New(Message(
+			r,
+			"Content-Type header is %s, not multipart/mixed",
+			r.Header.Get("Content-Type"),
+		))})
+		return
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mr := multipart.NewReader(r.Body, params["boundary"])
+	for i := 0; ; i++ {
+		part, err := mr.NextPart()
+		if io.EOF == err {
+			break
+		}
+		if nil != err {
+			writeError(w, r, BadRequest{err})
+			return
+		}
+		if 0 < h.MaxParts && i == h.MaxParts {
+			writeError(w, r, RequestEntityTooLarge{errors.New(Message(
+				r,
+				"batch has more than %d parts",
+				h.MaxParts,
+			))})
+			return
+		}
+		if err := h.servePart(r, i, part, mw); nil != err {
+			writeError(w, r, err)
+			return
+		}
+	}
+	mw.Close()
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
+
+// servePart dispatches one part of a batch and writes its response part.
+// Malformed sub-requests are answered with 400 parts rather than errors.
+func (h *BatchHandler) servePart(r *http.Request, i int, part *multipart.Part, mw *multipart.Writer) error {
+	rb := newResponseBuffer()
+	sub, err := readBatchRequest(r, part)
+	if nil != err {
+		writeError(rb, r, BadRequest{err})
+		logMarkedLine(r, false, "[batch %d] malformed: %s", i, err)
+	} else {
+		logMarkedLine(r, false, "[batch %d] %s %s", i, sub.Method, sub.URL.RequestURI())
+		h.handler.ServeHTTP(rb, sub)
+	}
+	if !rb.WroteHeader {
+		rb.WriteHeader(http.StatusOK)
+	}
+	logMarkedLine(r, true, "[batch %d] %d %s", i, rb.StatusCode, http.StatusText(rb.StatusCode))
+	header := textproto.MIMEHeader{"Content-Type": {"application/http"}}
+	if id := part.Header.Get("Content-ID"); "" != id {
+		header.Set("Content-ID", id)
+	}
+	pw, err := mw.CreatePart(header)
+	if nil != err {
+		return err
+	}
+	return (&http.Response{
+		StatusCode:    rb.StatusCode,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        rb.Header(),
+		Body:          io.NopCloser(&rb.Body),
+		ContentLength: int64(rb.Body.Len()),
+	}).Write(pw)
+}
+
+// readBatchRequest parses an application/http part into a sub-request that
+// inherits the batch request's context, except that it isn't logged as if
+// it were the batch request itself.
+func readBatchRequest(r *http.Request, part *multipart.Part) (*http.Request, error) {
+	if mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); "application/http" != mediaType {
+		return nil, errors.New(Message(
+			r,
+			"batch part Content-Type is %s, not application/http",
+			part.Header.Get("Content-Type"),
+		))
+	}
+	sub, err := http.ReadRequest(bufio.NewReader(part))
+	if nil != err {
+		return nil, err
+	}
+	body, err := io.ReadAll(sub.Body)
+	if nil != err {
+		return nil, err
+	}
+	sub.Body = io.NopCloser(bytes.NewReader(body))
+	sub.RemoteAddr = r.RemoteAddr
+	sub.TLS = r.TLS
+	if "" == sub.Host {
+		sub.Host = r.Host
+	}
+	ctx := context.WithValue(r.Context(), loggerResponseWriterKey{}, nil)
+	return sub.WithContext(ctx), nil
+}
@@ -0,0 +1,139 @@
+package marshaler
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func testBatchRequest(t *testing.T, parts ...string) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for i, part := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"application/http"},
+			"Content-Id":   {string(rune('a' + i))},
+		})
+		if nil != err {
+			t.Fatal(err)
+		}
+		pw.Write([]byte(part))
+	}
+	mw.Close()
+	r, _ := http.NewRequest("POST", "http://example.com/batch", &body)
+	r.Header.Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	return r
+}
+
+func testBatchHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /foo/{id}", Handler(func(u *url.URL, h http.Header, rq *testPathRequest) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, nil, &testResponse{rq.ID}, nil
+	}))
+	mux.Handle("POST /foo", Handler(func(u *url.URL, h http.Header, rq *testRequest) (int, http.Header, *testResponse, error) {
+		return http.StatusCreated, nil, &testResponse{rq.Foo}, nil
+	}))
+	return Batch(mux)
+}
+
+func testBatchResponses(t *testing.T, w *testResponseWriter) []*http.Response {
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if nil != err || "multipart/mixed" != mediaType {
+		t.Fatal(w.Header())
+	}
+	var responses []*http.Response
+	mr := multipart.NewReader(&w.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if io.EOF == err {
+			break
+		}
+		if nil != err {
+			t.Fatal(err)
+		}
+		if "application/http" != part.Header.Get("Content-Type") {
+			t.Fatal(part.Header)
+		}
+		rs, err := http.ReadResponse(bufio.NewReader(part), nil)
+		if nil != err {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rs.Body)
+		rs.Body = io.NopCloser(bytes.NewReader(b))
+		rs.Header.Set("Content-Id", part.Header.Get("Content-Id"))
+		responses = append(responses, rs)
+	}
+	return responses
+}
+
+func TestBatch(t *testing.T) {
+	w := &testResponseWriter{}
+	r := testBatchRequest(
+		t,
+		"GET /foo/bar HTTP/1.1\r\nHost: example.com\r\n\r\n",
+		"POST /foo HTTP/1.1\r\nHost: example.com\r\nContent-Type: application/json\r\nContent-Length: 13\r\n\r\n{\"foo\":\"baz\"}",
+		"nonsense",
+	)
+	var buf bytes.Buffer
+	l := Logged(testBatchHandler(), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.ServeHTTP(w, r)
+	if http.StatusOK != w.StatusCode {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+	responses := testBatchResponses(t, w)
+	if 3 != len(responses) {
+		t.Fatal(responses)
+	}
+	b, _ := io.ReadAll(responses[0].Body)
+	if http.StatusOK != responses[0].StatusCode || "{\"foo\":\"bar\"}\n" != string(b) || "a" != responses[0].Header.Get("Content-Id") {
+		t.Fatal(responses[0], string(b))
+	}
+	b, _ = io.ReadAll(responses[1].Body)
+	if http.StatusCreated != responses[1].StatusCode || "{\"foo\":\"baz\"}\n" != string(b) {
+		t.Fatal(responses[1], string(b))
+	}
+	if http.StatusBadRequest != responses[2].StatusCode {
+		t.Fatal(responses[2])
+	}
+	for _, line := range []string{"> [batch 0] GET /foo/bar", "< [batch 1] 201 Created", "> [batch 2] malformed"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Fatal(buf.String())
+		}
+	}
+}
+
+func TestBatchMaxParts(t *testing.T) {
+	w := &testResponseWriter{}
+	r := testBatchRequest(t, "GET /foo/a HTTP/1.1\r\n\r\n", "GET /foo/b HTTP/1.1\r\n\r\n")
+	h := testBatchHandler().(*BatchHandler)
+	h.MaxParts = 1
+	h.ServeHTTP(w, r)
+	if http.StatusRequestEntityTooLarge != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
+
+func TestBatchNotMultipart(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("POST", "http://example.com/batch", strings.NewReader("{}"))
+	r.Header.Set("Content-Type", "application/json")
+	testBatchHandler().ServeHTTP(w, r)
+	if http.StatusUnsupportedMediaType != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	w = &testResponseWriter{}
+	r, _ = http.NewRequest("GET", "http://example.com/batch", nil)
+	testBatchHandler().ServeHTTP(w, r)
+	if http.StatusMethodNotAllowed != w.StatusCode || "OPTIONS, POST" != w.Header().Get("Allow") {
+		t.Fatal(w.StatusCode, w.Header())
+	}
+}
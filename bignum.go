@@ -0,0 +1,41 @@
+package marshaler
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+)
+
+var bigNumberTypes = map[reflect.Type]bool{}
+
+// RegisterBigNumber makes the type of v, like *big.Int, subject to the
+// Marshaler's BigNumbersAsStrings option, which quotes its JSON numbers in
+// responses and unquotes them in requests.  RegisterBigNumber is not safe to
+// call once the server has started.
+func RegisterBigNumber(v interface{}) {
+	t := reflect.TypeOf(v)
+	for reflect.Ptr == t.Kind() {
+		t = t.Elem()
+	}
+	bigNumberTypes[t] = true
+}
+
+func isBigNumber(t reflect.Type) bool {
+	for reflect.Ptr == t.Kind() {
+		t = t.Elem()
+	}
+	return bigNumberTypes[t]
+}
+
+// quoteBigNumber returns the JSON encoding of v as a string if it encodes as
+// a number and as is otherwise.
+func quoteBigNumber(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if nil != err {
+		return nil, err
+	}
+	if 0 < len(b) && ('-' == b[0] || '0' <= b[0] && b[0] <= '9') {
+		return string(b), nil
+	}
+	return json.RawMessage(bytes.TrimSpace(b)), nil
+}
@@ -0,0 +1,53 @@
+package marshaler
+
+import (
+	"math/big"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type testBigNumbers struct {
+	ID      int64    `json:"id"`
+	Count   uint64   `json:"count"`
+	Small   int32    `json:"small"`
+	Balance *big.Int `json:"balance"`
+}
+
+func testBigNumbersHandler() *Marshaler {
+	m := Handler(func(u *url.URL, h http.Header, rq *testBigNumbers) (int, http.Header, *testBigNumbers, error) {
+		return http.StatusOK, nil, rq, nil
+	})
+	m.BigNumbersAsStrings = true
+	return m
+}
+
+func TestBigNumbersAsStrings(t *testing.T) {
+	RegisterBigNumber(&big.Int{})
+	defer delete(bigNumberTypes, reflect.TypeOf(big.Int{}))
+	w := testPostJSON(t, testBigNumbersHandler(), `{"id":"9007199254740993","count":"18446744073709551615","small":7,"balance":"123456789012345678901234567890"}`)
+	if http.StatusOK != w.StatusCode {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+	if "{\"id\":\"9007199254740993\",\"count\":\"18446744073709551615\",\"small\":7,\"balance\":\"123456789012345678901234567890\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestBigNumbersAsStringsNumbers(t *testing.T) {
+	w := testPostJSON(t, testBigNumbersHandler(), `{"id":1,"count":2,"small":3,"balance":4}`)
+	if http.StatusOK != w.StatusCode {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+	if "{\"id\":\"1\",\"count\":\"2\",\"small\":3,\"balance\":4}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestBigNumbersAsStringsInvalid(t *testing.T) {
+	w := testPostJSON(t, testBigNumbersHandler(), `{"id":"one"}`)
+	if http.StatusBadRequest != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
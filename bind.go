@@ -0,0 +1,216 @@
+package marshaler
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A bindingSource supplies the values of one kind of request input, like
+// query parameters, by the names given in the struct tag of the same name.
+type bindingSource struct {
+	tag    string
+	what   string
+	values func(r *http.Request, name string) []string
+}
+
+var bindingSources = []bindingSource{
+	{"query", "query parameter", func(r *http.Request, name string) []string {
+		return r.URL.Query()[name]
+	}},
+	{"path", "path parameter", func(r *http.Request, name string) []string {
+		if value := r.PathValue(name); "" != value {
+			return []string{value}
+		}
+		return nil
+	}},
+	{"header", "header", func(r *http.Request, name string) []string {
+		return r.Header.Values(name)
+	}},
+	{"cookie", "cookie", func(r *http.Request, name string) []string {
+		if cookie, err := r.Cookie(name); nil == err {
+			return []string{cookie.Value}
+		}
+		return nil
+	}},
+}
+
+// bindRequest populates the tagged fields of a request struct from the
+// request, including path parameters matched by a pattern-matching mux like
+// http.ServeMux, leaving fields whose inputs are absent with their default
+// values, which come from the default tag if present.
+//
+//	type Request struct {
+//	    Limit  int      `query:"limit" default:"20"`
+//	    Tags   []string `query:"tag"`
+//	    Key    string   `query:"key,required"`
+//	    User   int      `path:"user_id"`
+//	    Tenant string   `header:"X-Tenant-ID,required"`
+//	    Token  string   `cookie:"session"`
+//	}
+func bindRequest(r *http.Request, rq reflect.Value) error {
+	if reflect.Ptr != rq.Kind() || rq.IsNil() || reflect.Struct != rq.Elem().Kind() {
+		return nil
+	}
+	if !typeHasBindings(rq.Elem().Type()) {
+		return nil
+	}
+	return bindFields(r, rq.Elem())
+}
+
+func bindFields(r *http.Request, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if "" != f.PkgPath && !f.Anonymous {
+			continue
+		}
+		fv := v.Field(i)
+		if f.Anonymous && reflect.Struct == fv.Kind() {
+			if err := bindFields(r, fv); nil != err {
+				return err
+			}
+			continue
+		}
+		for _, source := range bindingSources {
+			tag, ok := f.Tag.Lookup(source.tag)
+			if !ok {
+				continue
+			}
+			name, required := parseBindingTag(tag)
+			values := source.values(r, name)
+			if 0 == len(values) {
+				if def, ok := f.Tag.Lookup("default"); ok {
+					values = []string{def}
+				} else if required {
+					return errors.New(Message(r, "%s %s is required", source.what, name))
+				} else {
+					continue
+				}
+			}
+			if err := setField(fv, values); nil != err {
+				return errors.New(Message(r, "%s %s is invalid: %s", source.what, name, err))
+			}
+		}
+	}
+	return nil
+}
+
+func parseBindingTag(tag string) (name string, required bool) {
+	parts := strings.Split(tag, ",")
+	for _, option := range parts[1:] {
+		if "required" == option {
+			required = true
+		}
+	}
+	return parts[0], required
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// setField converts string values to the type of a field and sets it.
+// Slices receive every value and all other types the first.
+func setField(v reflect.Value, values []string) error {
+	if reflect.Slice == v.Kind() && !reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		s := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(s.Index(i), value); nil != err {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	return setValue(v, values[0])
+}
+
+func setValue(v reflect.Value, s string) error {
+	if reflect.Ptr == v.Kind() {
+		p := reflect.New(v.Type().Elem())
+		if err := setValue(p.Elem(), s); nil != err {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	if reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	if durationType == v.Type() {
+		d, err := time.ParseDuration(s)
+		if nil != err {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if nil != err {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if nil != err {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if nil != err {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if nil != err {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("can't bind to %v", v.Type())
+	}
+	return nil
+}
+
+func requestHasBindings(rq reflect.Value) bool {
+	return reflect.Ptr == rq.Kind() && reflect.Struct == rq.Type().Elem().Kind() && typeHasBindings(rq.Type().Elem())
+}
+
+var bindingTypes sync.Map // map[reflect.Type]bool
+
+// typeHasBindings reports whether a struct type has any fields tagged for
+// binding, directly or through embedded structs.
+func typeHasBindings(t reflect.Type) bool {
+	if has, ok := bindingTypes.Load(t); ok {
+		return has.(bool)
+	}
+	has := false
+	for i := 0; i < t.NumField() && !has; i++ {
+		f := t.Field(i)
+		if f.Anonymous && reflect.Struct == f.Type.Kind() {
+			has = typeHasBindings(f.Type)
+			continue
+		}
+		for _, source := range bindingSources {
+			if _, ok := f.Tag.Lookup(source.tag); ok {
+				has = true
+			}
+		}
+	}
+	bindingTypes.Store(t, has)
+	return has
+}
@@ -0,0 +1,139 @@
+package marshaler
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testQueryRequest struct {
+	Limit   int           `query:"limit" default:"20"`
+	Tags    []string      `query:"tag"`
+	Key     string        `query:"key,required"`
+	Since   *time.Time    `query:"since"`
+	Timeout time.Duration `query:"timeout"`
+	Verbose bool          `query:"verbose"`
+	Ratio   float64       `query:"ratio"`
+}
+
+func testBind(t *testing.T, rawurl string) (*testResponseWriter, *testQueryRequest) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", rawurl, nil)
+	var bound *testQueryRequest
+	Handler(func(u *url.URL, h http.Header, rq *testQueryRequest) (int, http.Header, *testResponse, error) {
+		bound = rq
+		return http.StatusNoContent, nil, nil, nil
+	}).ServeHTTP(w, r)
+	return w, bound
+}
+
+func TestBindQuery(t *testing.T) {
+	w, rq := testBind(t, "http://example.com/foo?key=k&tag=a&tag=b&since=2014-01-01T00:00:00Z&timeout=1m&verbose=true&ratio=0.5")
+	if http.StatusNoContent != w.StatusCode {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+	if 20 != rq.Limit || "k" != rq.Key || 2 != len(rq.Tags) || "b" != rq.Tags[1] {
+		t.Fatal(rq)
+	}
+	if 2014 != rq.Since.Year() || time.Minute != rq.Timeout || !rq.Verbose || 0.5 != rq.Ratio {
+		t.Fatal(rq)
+	}
+}
+
+func TestBindQueryRequired(t *testing.T) {
+	w, _ := testBind(t, "http://example.com/foo")
+	if http.StatusBadRequest != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if "{\"description\":\"query parameter key is required\",\"error\":\"marshaler.BadRequest\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestBindQueryInvalid(t *testing.T) {
+	w, _ := testBind(t, "http://example.com/foo?key=k&limit=ten")
+	if http.StatusBadRequest != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
+
+func TestBindQueryOpenAPI(t *testing.T) {
+	parameters := bindingParameters(reflect.TypeOf(testQueryRequest{}))
+	if 7 != len(parameters) {
+		t.Fatal(parameters)
+	}
+	key := parameters[2].(map[string]interface{})
+	if "key" != key["name"] || "query" != key["in"] || true != key["required"] {
+		t.Fatal(key)
+	}
+}
+
+type testPathRequest struct {
+	UserID int    `path:"user_id"`
+	ID     string `path:"id"`
+}
+
+func TestBindPath(t *testing.T) {
+	var bound *testPathRequest
+	mux := http.NewServeMux()
+	mux.Handle("GET /users/{user_id}/orders/{id}", Handler(func(u *url.URL, h http.Header, rq *testPathRequest) (int, http.Header, *testResponse, error) {
+		bound = rq
+		return http.StatusNoContent, nil, nil, nil
+	}))
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/users/47/orders/abc", nil)
+	mux.ServeHTTP(w, r)
+	if http.StatusNoContent != w.StatusCode {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+	if 47 != bound.UserID || "abc" != bound.ID {
+		t.Fatal(bound)
+	}
+}
+
+func TestBindPathInvalid(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /users/{user_id}/orders/{id}", Handler(func(u *url.URL, h http.Header, rq *testPathRequest) (int, http.Header, *testResponse, error) {
+		return http.StatusNoContent, nil, nil, nil
+	}))
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/users/me/orders/abc", nil)
+	mux.ServeHTTP(w, r)
+	if http.StatusBadRequest != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
+
+type testHeaderRequest struct {
+	Tenant  string  `header:"X-Tenant-ID,required"`
+	TraceID *string `header:"X-Trace-ID"`
+}
+
+func TestBindHeader(t *testing.T) {
+	var bound *testHeaderRequest
+	handler := Handler(func(u *url.URL, h http.Header, rq *testHeaderRequest) (int, http.Header, *testResponse, error) {
+		bound = rq
+		return http.StatusNoContent, nil, nil, nil
+	})
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("X-Tenant-ID", "acme")
+	handler.ServeHTTP(w, r)
+	if http.StatusNoContent != w.StatusCode {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+	if "acme" != bound.Tenant || nil != bound.TraceID {
+		t.Fatal(bound)
+	}
+	w = &testResponseWriter{}
+	r, _ = http.NewRequest("GET", "http://example.com/foo", nil)
+	handler.ServeHTTP(w, r)
+	if http.StatusBadRequest != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if "{\"description\":\"header X-Tenant-ID is required\",\"error\":\"marshaler.BadRequest\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
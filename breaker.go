@@ -0,0 +1,192 @@
+package marshaler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned in place of calls a CircuitBreaker refuses.
+// It's a ServiceUnavailable so that handlers returning it respond 503.
+var ErrCircuitOpen error = ServiceUnavailable{errors.New("circuit breaker is open")}
+
+// Defaults for the CircuitBreakers returned by NewCircuitBreaker.
+var (
+	DefaultBreakerFailureRate = 0.5
+	DefaultBreakerMinRequests = 10
+	DefaultBreakerWindow      = 10 * time.Second
+	DefaultBreakerCooldown    = 30 * time.Second
+)
+
+// CircuitBreaker is an http.RoundTripper that stops calling a flaky upstream
+// once too many calls to it fail, so that callers fail fast instead of
+// piling up.  The breaker opens when at least FailureRate of at least
+// MinRequests calls within a Window fail, where failures are errors and 5xx
+// responses, and refuses calls with ErrCircuitOpen for the Cooldown.  Then
+// it's half open: it lets one call through as a probe and closes again if
+// the probe succeeds or reopens if it fails.  State changes are logged to
+// Logger and, if Sink is not nil, counted in it.
+type CircuitBreaker struct {
+	Name        string
+	FailureRate float64
+	MinRequests int
+	Window      time.Duration
+	Cooldown    time.Duration
+	Logger      Logger
+	Sink        MetricsSink
+	Transport   http.RoundTripper
+
+	mu          sync.Mutex
+	state       breakerState
+	generation  int
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probing     bool
+	now         func() time.Time
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	return [...]string{"closed", "open", "half-open"}[s]
+}
+
+// NewCircuitBreaker returns a CircuitBreaker with the given name, for logs
+// and metrics, that makes calls with the given transport or, if it's nil,
+// http.DefaultTransport.
+func NewCircuitBreaker(name string, transport http.RoundTripper) *CircuitBreaker {
+	if nil == transport {
+		transport = http.DefaultTransport
+	}
+	return &CircuitBreaker{
+		Name:        name,
+		FailureRate: DefaultBreakerFailureRate,
+		MinRequests: DefaultBreakerMinRequests,
+		Window:      DefaultBreakerWindow,
+		Cooldown:    DefaultBreakerCooldown,
+		Logger:      log.New(os.Stdout, "", log.Ltime|log.Lmicroseconds),
+		Transport:   transport,
+		now:         time.Now,
+	}
+}
+
+// RoundTrip makes the request with the Transport unless the breaker is open.
+func (b *CircuitBreaker) RoundTrip(r *http.Request) (*http.Response, error) {
+	var resp *http.Response
+	err := b.Do(func() error {
+		var err error
+		if resp, err = b.Transport.RoundTrip(r); nil != err {
+			return err
+		}
+		if http.StatusInternalServerError <= resp.StatusCode {
+			return errBreakerUpstream
+		}
+		return nil
+	})
+	if errBreakerUpstream == err {
+		err = nil
+	}
+	return resp, err
+}
+
+var errBreakerUpstream = errors.New("upstream error")
+
+// Do calls f unless the breaker is open, counting an error as a failure, so
+// that calls other than HTTP requests may also be protected.
+func (b *CircuitBreaker) Do(f func() error) error {
+	generation, err := b.allow()
+	if nil != err {
+		return err
+	}
+	err = f()
+	b.record(generation, nil == err)
+	return err
+}
+
+func (b *CircuitBreaker) allow() (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	switch b.state {
+	case breakerOpen:
+		if now.Sub(b.openedAt) < b.Cooldown {
+			b.count("circuit_breaker_rejections")
+			return 0, ErrCircuitOpen
+		}
+		b.transition(breakerHalfOpen, now)
+		b.probing = true
+	case breakerHalfOpen:
+		if b.probing {
+			b.count("circuit_breaker_rejections")
+			return 0, ErrCircuitOpen
+		}
+		b.probing = true
+	case breakerClosed:
+		if b.Window <= now.Sub(b.windowStart) {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+	}
+	return b.generation, nil
+}
+
+func (b *CircuitBreaker) record(generation int, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+	now := b.now()
+	switch b.state {
+	case breakerHalfOpen:
+		b.probing = false
+		if success {
+			b.transition(breakerClosed, now)
+		} else {
+			b.transition(breakerOpen, now)
+		}
+	case breakerClosed:
+		b.requests++
+		if !success {
+			b.failures++
+		}
+		if b.MinRequests <= b.requests && b.FailureRate <= float64(b.failures)/float64(b.requests) {
+			b.transition(breakerOpen, now)
+		}
+	}
+}
+
+// transition changes state, starting a new generation so that the outcomes
+// of calls begun in the previous state are ignored.
+func (b *CircuitBreaker) transition(state breakerState, now time.Time) {
+	b.Logger.Printf("circuit breaker %s %s -> %s", b.Name, b.state, state)
+	if nil != b.Sink {
+		b.Sink.Count("circuit_breaker_transitions", 1, map[string]string{
+			"breaker": b.Name,
+			"from":    b.state.String(),
+			"to":      state.String(),
+		})
+	}
+	b.state = state
+	b.generation++
+	b.windowStart, b.requests, b.failures = now, 0, 0
+	if breakerOpen == state {
+		b.openedAt = now
+	}
+}
+
+func (b *CircuitBreaker) count(name string) {
+	if nil != b.Sink {
+		b.Sink.Count(name, 1, map[string]string{"breaker": b.Name})
+	}
+}
@@ -0,0 +1,84 @@
+package marshaler
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	fail := true
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer s.Close()
+	now := time.Now()
+	b := NewCircuitBreaker("upstream", nil)
+	b.MinRequests = 2
+	b.now = func() time.Time { return now }
+	var buf bytes.Buffer
+	b.Logger = log.New(&buf, "", 0)
+	sink := &testMetricsSink{}
+	b.Sink = sink
+	client := &http.Client{Transport: b}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(s.URL)
+		if nil != err {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if http.StatusBadGateway != resp.StatusCode {
+			t.Fatal(resp.StatusCode)
+		}
+	}
+	if _, err := client.Get(s.URL); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatal(err)
+	}
+	now = now.Add(b.Cooldown)
+	fail = false
+	resp, err := client.Get(s.URL)
+	if nil != err {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if http.StatusOK != resp.StatusCode {
+		t.Fatal(resp.StatusCode)
+	}
+	if "circuit breaker upstream closed -> open\ncircuit breaker upstream open -> half-open\ncircuit breaker upstream half-open -> closed\n" != buf.String() {
+		t.Fatal(buf.String())
+	}
+	if 4 != len(sink.metrics) || "circuit_breaker_rejections" != sink.metrics[1].name || "open" != sink.metrics[0].labels["to"] {
+		t.Fatal(sink.metrics)
+	}
+}
+
+func TestCircuitBreakerProbeFails(t *testing.T) {
+	now := time.Now()
+	b := NewCircuitBreaker("upstream", nil)
+	b.MinRequests = 1
+	b.now = func() time.Time { return now }
+	b.Logger = log.New(&bytes.Buffer{}, "", 0)
+	failure := errors.New("failure")
+	if err := b.Do(func() error { return failure }); failure != err {
+		t.Fatal(err)
+	}
+	now = now.Add(b.Cooldown)
+	if err := b.Do(func() error {
+		if err := b.Do(func() error { return nil }); ErrCircuitOpen != err {
+			t.Fatal("concurrent probe allowed")
+		}
+		return failure
+	}); failure != err {
+		t.Fatal(err)
+	}
+	if err := b.Do(func() error { return nil }); ErrCircuitOpen != err || !strings.Contains(b.state.String(), "open") {
+		t.Fatal(err)
+	}
+}
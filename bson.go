@@ -0,0 +1,294 @@
+package marshaler
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// BSONType is the media type of BSON request and response bodies.
+const BSONType = "application/bson"
+
+// BSON is the Codec for BSON, the binary format of MongoDB documents.  Like
+// JSON, fields are named by their json tags, so responses have the same
+// shape in either format.  Times are encoded as BSON datetimes and byte
+// slices as binary data.  Request and response bodies must be documents,
+// not arrays or other values.
+type BSON struct{}
+
+// Marshal encodes v, which must encode as a JSON object, as a BSON
+// document.
+func (BSON) Marshal(v interface{}) ([]byte, error) {
+	tree, err := (&encodeOptions{transforming: true}).transform(reflect.ValueOf(v))
+	if nil != err {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	switch tree := tree.(type) {
+	case orderedObject, map[string]interface{}:
+		err = writeBSONDocument(&buf, tree)
+	default:
+		err = fmt.Errorf("BSON can't encode %T as a document", v)
+	}
+	if nil != err {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes a BSON document into v as encoding/json would decode
+// the equivalent JSON object.
+func (BSON) Unmarshal(data []byte, v interface{}) error {
+	doc, n, err := readBSONDocument(data, false, 0)
+	if nil != err {
+		return err
+	}
+	if n != len(data) {
+		return errors.New("BSON document is followed by extra data")
+	}
+	b, err := json.Marshal(doc)
+	if nil != err {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func writeBSONDocument(buf *bytes.Buffer, doc interface{}) error {
+	start := buf.Len()
+	buf.Write([]byte{0, 0, 0, 0})
+	switch doc := doc.(type) {
+	case orderedObject:
+		for _, f := range doc {
+			if err := writeBSONElement(buf, f.Name, f.Value); nil != err {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		for _, key := range sortedKeys(doc) {
+			if err := writeBSONElement(buf, key, doc[key]); nil != err {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, value := range doc {
+			if err := writeBSONElement(buf, strconv.Itoa(i), value); nil != err {
+				return err
+			}
+		}
+	}
+	buf.WriteByte(0)
+	binary.LittleEndian.PutUint32(buf.Bytes()[start:], uint32(buf.Len()-start))
+	return nil
+}
+
+func writeBSONElement(buf *bytes.Buffer, name string, value interface{}) error {
+	header := func(kind byte) {
+		buf.WriteByte(kind)
+		buf.WriteString(name)
+		buf.WriteByte(0)
+	}
+	switch value := value.(type) {
+	case nil:
+		header(0x0a)
+		return nil
+	case orderedObject, map[string]interface{}:
+		header(0x03)
+		return writeBSONDocument(buf, value)
+	case []interface{}:
+		header(0x04)
+		return writeBSONDocument(buf, value)
+	case []byte:
+		header(0x05)
+		binary.Write(buf, binary.LittleEndian, int32(len(value)))
+		buf.WriteByte(0)
+		buf.Write(value)
+		return nil
+	case time.Time:
+		header(0x09)
+		return binary.Write(buf, binary.LittleEndian, value.UnixMilli())
+	case *time.Time:
+		if nil == value {
+			header(0x0a)
+			return nil
+		}
+		return writeBSONElement(buf, name, *value)
+	case json.Number:
+		if i, err := value.Int64(); nil == err {
+			return writeBSONElement(buf, name, i)
+		}
+		f, err := value.Float64()
+		if nil != err {
+			return err
+		}
+		return writeBSONElement(buf, name, f)
+	case json.Marshaler:
+		b, err := value.MarshalJSON()
+		if nil != err {
+			return err
+		}
+		decoder := json.NewDecoder(bytes.NewReader(b))
+		decoder.UseNumber()
+		var generic interface{}
+		if err := decoder.Decode(&generic); nil != err {
+			return err
+		}
+		return writeBSONElement(buf, name, generic)
+	case encoding.TextMarshaler:
+		b, err := value.MarshalText()
+		if nil != err {
+			return err
+		}
+		return writeBSONElement(buf, name, string(b))
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Bool:
+		header(0x08)
+		if v.Bool() {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case reflect.String:
+		header(0x02)
+		binary.Write(buf, binary.LittleEndian, int32(v.Len()+1))
+		buf.WriteString(v.String())
+		buf.WriteByte(0)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		header(0x10)
+		if reflect.Uint8 == v.Kind() || reflect.Uint16 == v.Kind() {
+			binary.Write(buf, binary.LittleEndian, int32(v.Uint()))
+		} else {
+			binary.Write(buf, binary.LittleEndian, int32(v.Int()))
+		}
+	case reflect.Int, reflect.Int64:
+		header(0x12)
+		binary.Write(buf, binary.LittleEndian, v.Int())
+	case reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return fmt.Errorf("BSON can't encode %d as a 64-bit integer", v.Uint())
+		}
+		header(0x12)
+		binary.Write(buf, binary.LittleEndian, int64(v.Uint()))
+	case reflect.Float32, reflect.Float64:
+		header(0x01)
+		binary.Write(buf, binary.LittleEndian, v.Float())
+	default:
+		return fmt.Errorf("BSON can't encode %T", value)
+	}
+	return nil
+}
+
+var errBSONTruncated = errors.New("BSON document is truncated")
+
+// maxBSONDepth is how deeply documents and arrays may be nested before
+// decoding gives up, so that a body can't exhaust the stack.
+const maxBSONDepth = 100
+
+// readBSONDocument decodes a BSON document into a map, or into a slice if it
+// is an array, and returns the number of bytes it occupied.  Depth is how
+// many documents enclose it.
+func readBSONDocument(data []byte, array bool, depth int) (interface{}, int, error) {
+	if depth > maxBSONDepth {
+		return nil, 0, fmt.Errorf("BSON documents are nested deeper than %d", maxBSONDepth)
+	}
+	if len(data) < 5 {
+		return nil, 0, errBSONTruncated
+	}
+	size := int(int32(binary.LittleEndian.Uint32(data)))
+	if size < 5 || size > len(data) || 0 != data[size-1] {
+		return nil, 0, errBSONTruncated
+	}
+	doc := map[string]interface{}{}
+	var elements []interface{}
+	for i := 4; i < size-1; {
+		kind := data[i]
+		end := bytes.IndexByte(data[i+1:size-1], 0)
+		if end < 0 {
+			return nil, 0, errBSONTruncated
+		}
+		name := string(data[i+1 : i+1+end])
+		i += end + 2
+		value, n, err := readBSONValue(kind, data[i:size-1], depth)
+		if nil != err {
+			return nil, 0, fmt.Errorf("%s: %s", name, err)
+		}
+		i += n
+		if array {
+			elements = append(elements, value)
+		} else {
+			doc[name] = value
+		}
+	}
+	if array {
+		if nil == elements {
+			elements = []interface{}{}
+		}
+		return elements, size, nil
+	}
+	return doc, size, nil
+}
+
+func readBSONValue(kind byte, data []byte, depth int) (interface{}, int, error) {
+	fixed := map[byte]int{0x01: 8, 0x07: 12, 0x08: 1, 0x09: 8, 0x10: 4, 0x11: 8, 0x12: 8}
+	if n, ok := fixed[kind]; ok && len(data) < n {
+		return nil, 0, errBSONTruncated
+	}
+	switch kind {
+	case 0x01:
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), 8, nil
+	case 0x02:
+		if len(data) < 4 {
+			return nil, 0, errBSONTruncated
+		}
+		n := int(int32(binary.LittleEndian.Uint32(data)))
+		if n < 1 || 4+n > len(data) || 0 != data[3+n] {
+			return nil, 0, errBSONTruncated
+		}
+		return string(data[4 : 3+n]), 4 + n, nil
+	case 0x03, 0x04:
+		return readBSONDocument(data, 0x04 == kind, depth+1)
+	case 0x05:
+		if len(data) < 5 {
+			return nil, 0, errBSONTruncated
+		}
+		n := int(int32(binary.LittleEndian.Uint32(data)))
+		if n < 0 || 5+n > len(data) {
+			return nil, 0, errBSONTruncated
+		}
+		return append([]byte(nil), data[5:5+n]...), 5 + n, nil
+	case 0x07:
+		return hex.EncodeToString(data[:12]), 12, nil
+	case 0x08:
+		return 0 != data[0], 1, nil
+	case 0x09:
+		return time.UnixMilli(int64(binary.LittleEndian.Uint64(data))).UTC(), 8, nil
+	case 0x0a:
+		return nil, 0, nil
+	case 0x10:
+		return int32(binary.LittleEndian.Uint32(data)), 4, nil
+	case 0x11:
+		return binary.LittleEndian.Uint64(data), 8, nil
+	case 0x12:
+		return int64(binary.LittleEndian.Uint64(data)), 8, nil
+	}
+	return nil, 0, fmt.Errorf("BSON type 0x%02x is not supported", kind)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
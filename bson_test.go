@@ -0,0 +1,120 @@
+package marshaler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testBSONDocument struct {
+	Name    string            `json:"name"`
+	Count   int64             `json:"count"`
+	Small   int32             `json:"small"`
+	Ratio   float64           `json:"ratio"`
+	OK      bool              `json:"ok"`
+	At      time.Time         `json:"at"`
+	Data    []byte            `json:"data"`
+	Tags    []string          `json:"tags"`
+	Extra   map[string]string `json:"extra,omitempty"`
+	Missing *string           `json:"missing"`
+	hidden  string
+}
+
+func TestBSONRoundTrip(t *testing.T) {
+	in := &testBSONDocument{
+		Name:  "foo",
+		Count: 1 << 60,
+		Small: -7,
+		Ratio: 0.25,
+		OK:    true,
+		At:    time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC),
+		Data:  []byte{0, 1, 2},
+		Tags:  []string{"a", "b"},
+		Extra: map[string]string{"k": "v"},
+	}
+	b, err := BSON{}.Marshal(in)
+	if nil != err {
+		t.Fatal(err)
+	}
+	out := &testBSONDocument{}
+	if err := (BSON{}).Unmarshal(b, out); nil != err {
+		t.Fatal(err)
+	}
+	if in.Name != out.Name || in.Count != out.Count || in.Small != out.Small || in.Ratio != out.Ratio || !out.OK {
+		t.Fatal(out)
+	}
+	if !in.At.Equal(out.At) || !bytes.Equal(in.Data, out.Data) || 2 != len(out.Tags) || "v" != out.Extra["k"] || nil != out.Missing {
+		t.Fatal(out)
+	}
+}
+
+func TestBSONEncoding(t *testing.T) {
+	b, err := BSON{}.Marshal(map[string]interface{}{"hello": "world"})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "\x16\x00\x00\x00\x02hello\x00\x06\x00\x00\x00world\x00\x00" != string(b) {
+		t.Fatalf("%q", b)
+	}
+}
+
+func TestBSONNotDocument(t *testing.T) {
+	if _, err := (BSON{}).Marshal([]string{"foo"}); nil == err {
+		t.Fatal(err)
+	}
+	if err := (BSON{}).Unmarshal([]byte("\x05\x00\x00"), &testRequest{}); nil == err {
+		t.Fatal(err)
+	}
+}
+
+func TestBSONMalformed(t *testing.T) {
+	if err := (BSON{}).Unmarshal([]byte("\x07\x00\x00\x00\x02a\x00"), &testRequest{}); nil == err {
+		t.Fatal(err)
+	}
+	doc := []byte{5, 0, 0, 0, 0}
+	for i := 0; i < 200; i++ {
+		element := append([]byte{0x03, 'a', 0}, doc...)
+		doc = binary.LittleEndian.AppendUint32(nil, uint32(4+len(element)+1))
+		doc = append(append(doc, element...), 0)
+	}
+	if err := (BSON{}).Unmarshal(doc, &testRequest{}); nil == err || !strings.Contains(err.Error(), "nested deeper than 100") {
+		t.Fatal(err)
+	}
+}
+
+func TestBSONNegotiation(t *testing.T) {
+	request, _ := BSON{}.Marshal(&testRequest{"bar"})
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("POST", "http://example.com/foo", bytes.NewReader(request))
+	r.Header.Set("Accept", "application/json;q=0.5, application/bson")
+	r.Header.Set("Content-Type", BSONType)
+	Handler(func(u *url.URL, h http.Header, rq *testRequest) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, nil, &testResponse{rq.Foo}, nil
+	}).ServeHTTP(w, r)
+	if http.StatusOK != w.StatusCode {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+	if BSONType != w.Header().Get("Content-Type") || "Accept" != w.Header().Get("Vary") {
+		t.Fatal(w.Header())
+	}
+	rs := &testResponse{}
+	if err := (BSON{}).Unmarshal(w.Body.Bytes(), rs); nil != err || "bar" != rs.Foo {
+		t.Fatal(err, rs)
+	}
+}
+
+func TestBSONNotPreferred(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Accept", "application/json, application/bson;q=0.5")
+	Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, nil, &testResponse{"bar"}, nil
+	}).ServeHTTP(w, r)
+	if "application/json; charset=utf-8" != w.Header().Get("Content-Type") {
+		t.Fatal(w.Header())
+	}
+}
@@ -0,0 +1,112 @@
+package marshaler
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// A BytesLogger is a Logger that can also log a line given as a byte slice,
+// which MultilineLogger uses to log bodies without first copying each chunk
+// into a string.  The slice is only valid for the duration of the call.
+type BytesLogger interface {
+	Logger
+	OutputBytes(calldepth int, p []byte) error
+}
+
+// A BytesRedactor redacts sensitive information from a line given as a byte
+// slice, either in place or by returning a different slice.  Lines logged
+// through a BytesLogger are only passed through the Redactor given to Logged
+// if there's no BytesRedactor, since that requires a string.
+type BytesRedactor func([]byte) []byte
+
+// DeterministicTime is the time given by the FixedClock Deterministic sets.
+var DeterministicTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// FixedClock returns a clock for WriterLogger that's stopped at t.
+func FixedClock(t time.Time) func() time.Time {
+	return func() time.Time { return t }
+}
+
+// DefaultWriterLoggerTimeFormat matches the log.Ltime|log.Lmicroseconds
+// flags of the default Logger used by Logged.
+const DefaultWriterLoggerTimeFormat = "15:04:05.000000"
+
+// WriterLogger is a BytesLogger that writes each line to an io.Writer,
+// preceded by the time in TimeFormat, if it's not empty, and followed by a
+// newline.  Times come from Clock, or time.Now if it's nil.  Writes are
+// serialized so it's safe for concurrent use.
+type WriterLogger struct {
+	Clock      func() time.Time
+	TimeFormat string
+	buf        []byte
+	finish     func(b []byte) error
+	mu         sync.Mutex
+	w          io.Writer
+}
+
+// NewWriterLogger returns a WriterLogger that writes lines to w.
+func NewWriterLogger(w io.Writer) *WriterLogger {
+	return &WriterLogger{
+		TimeFormat: DefaultWriterLoggerTimeFormat,
+		w:          w,
+	}
+}
+
+// Output writes s as a line.
+func (l *WriterLogger) Output(calldepth int, s string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.write(append(l.start(), s...))
+}
+
+// OutputBytes writes p as a line without converting it to a string.
+func (l *WriterLogger) OutputBytes(calldepth int, p []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.write(append(l.start(), p...))
+}
+
+// Print is identical to log.Logger's Print.
+func (l *WriterLogger) Print(v ...interface{}) {
+	l.Output(2, fmt.Sprint(v...))
+}
+
+// Printf is identical to log.Logger's Printf.
+func (l *WriterLogger) Printf(format string, v ...interface{}) {
+	l.Output(2, fmt.Sprintf(format, v...))
+}
+
+// Println is identical to log.Logger's Println.
+func (l *WriterLogger) Println(v ...interface{}) {
+	l.Output(2, fmt.Sprintln(v...))
+}
+
+// start begins a line in the buffer, which must be locked.
+func (l *WriterLogger) start() []byte {
+	b := l.buf[:0]
+	if "" != l.TimeFormat {
+		now := time.Now
+		if nil != l.Clock {
+			now = l.Clock
+		}
+		b = now().AppendFormat(b, l.TimeFormat)
+		b = append(b, ' ')
+	}
+	return b
+}
+
+// write ends the line in b and writes it, keeping b for the next line, or
+// hands it to finish if that's set by a logger built on this one.
+func (l *WriterLogger) write(b []byte) error {
+	if nil != l.finish {
+		return l.finish(b)
+	}
+	if 0 == len(b) || '\n' != b[len(b)-1] {
+		b = append(b, '\n')
+	}
+	l.buf = b
+	_, err := l.w.Write(b)
+	return err
+}
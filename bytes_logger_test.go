@@ -0,0 +1,95 @@
+package marshaler
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWriterLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWriterLogger(&buf)
+	l.TimeFormat = ""
+	l.Printf("foo %d", 1)
+	l.OutputBytes(1, []byte("bar"))
+	l.Println("baz")
+	if "foo 1\nbar\nbaz\n" != buf.String() {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestLoggedBytesRedactor(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}), nil)
+	l.Logger = NewWriterLogger(&buf)
+	l.Logger.(*WriterLogger).TimeFormat = ""
+	l.BytesRedactor = func(p []byte) []byte {
+		return bytes.ReplaceAll(p, []byte("secret"), []byte("******"))
+	}
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	r, _ := http.NewRequest("POST", "http://example.com/foo", strings.NewReader("my secret\n"))
+	w := &testResponseWriter{}
+	l.ServeHTTP(w, r)
+	if "my secret\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Fatal(buf.String())
+	}
+	if !strings.Contains(buf.String(), "foo > my ******\n") || !strings.Contains(buf.String(), "foo < my ******\n") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestLoggedBytesRedactorTrailers(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logRequestLine(r, "token %s", "secret")
+		w.Header().Set("Trailer", "X-Token")
+		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set("X-Token", "secret")
+		w.Header().Set(http.TrailerPrefix+"X-Other", "secret")
+	}), nil)
+	l.Logger = NewWriterLogger(&buf)
+	l.Logger.(*WriterLogger).TimeFormat = ""
+	l.BytesRedactor = func(p []byte) []byte {
+		return bytes.ReplaceAll(p, []byte("secret"), []byte("******"))
+	}
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	l.ServeHTTP(&testResponseWriter{}, r)
+	if strings.Contains(buf.String(), "secret") {
+		t.Fatal(buf.String())
+	}
+	for _, line := range []string{
+		"foo token ******\n",
+		"foo superfluous WriteHeader(200) ignored; already wrote 200\n",
+		"foo < trailer X-Token: ******\n",
+		"foo < trailer X-Other: ******\n",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Fatal(buf.String())
+		}
+	}
+}
+
+func BenchmarkLoggedBody(b *testing.B) {
+	body := bytes.Repeat([]byte("0123456789abcdef"), 256)
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}), nil)
+	l.Logger = NewWriterLogger(io.Discard)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	for i := 0; i < b.N; i++ {
+		l.ServeHTTP(&testResponseWriter{}, r)
+	}
+}
@@ -0,0 +1,238 @@
+package marshaler
+
+import (
+	"container/list"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache is an http.Handler that serves repeated GET and HEAD requests from a
+// CacheStore without invoking the handler it wraps.  Responses are keyed by
+// method and request URI and by the request's values of each header named
+// in their Vary header, which always includes Accept since it selects their
+// format, so that compressed or localized responses are only served to
+// requests that would get the same.  The names are kept in the CacheStore
+// too, under a key of their own.  Responses to requests with Authorization
+// are only stored if they're marked Cache-Control: public.
+type Cache struct {
+	handler http.Handler
+	store   CacheStore
+	ttl     time.Duration
+}
+
+// Cached returns an http.Handler that caches successful responses from the
+// given handler for up to ttl.  If store is nil, responses are held in a
+// MemoryCacheStore of DefaultCacheEntries entries and DefaultCacheBytes bytes.
+func Cached(handler http.Handler, ttl time.Duration, store CacheStore) *Cache {
+	if nil == store {
+		store = NewMemoryCacheStore(DefaultCacheEntries, DefaultCacheBytes)
+	}
+	return &Cache{
+		handler: handler,
+		store:   store,
+		ttl:     ttl,
+	}
+}
+
+// ServeHTTP responds from the cache if it holds a fresh response for the
+// request and otherwise calls the wrapped handler, buffering and storing its
+// response if it may be cached.
+func (c *Cache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if "GET" != r.Method && "HEAD" != r.Method {
+		c.handler.ServeHTTP(w, r)
+		return
+	}
+	base := r.Method + " " + r.URL.RequestURI()
+	names := []string{"Accept"}
+	if rs, ok := c.store.Get(varyKey(base)); ok {
+		names = varyNames(rs.Header)
+	}
+	now := time.Now()
+	if rs, ok := c.store.Get(cacheKey(base, r, names)); ok {
+		if age := now.Sub(rs.Created); age < c.ttl {
+			copyHeader(w.Header(), rs.Header)
+			w.Header().Set("Age", strconv.Itoa(int(age/time.Second)))
+			w.WriteHeader(rs.StatusCode)
+			w.Write(rs.Body)
+			return
+		}
+	}
+	b := newResponseBuffer()
+	c.handler.ServeHTTP(b, r)
+	addVary(b.Header(), "Accept")
+	if cacheable(b, r) {
+		names = varyNames(b.Header())
+		c.store.Set(varyKey(base), &CachedResponse{
+			Header:  http.Header{"Vary": names},
+			Created: now,
+		})
+		c.store.Set(cacheKey(base, r, names), &CachedResponse{
+			StatusCode: b.StatusCode,
+			Header:     cloneHeader(b.Header()),
+			Body:       append([]byte(nil), b.Body.Bytes()...),
+			Created:    now,
+		})
+	}
+	b.WriteTo(w)
+}
+
+// CachedResponse is a complete response held by a CacheStore.
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Created    time.Time
+}
+
+// A CacheStore holds responses for a Cache.  Implementations must be safe
+// for concurrent use and may evict entries at any time.
+type CacheStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, rs *CachedResponse)
+}
+
+// Default bounds for the MemoryCacheStore created by Cached.
+var (
+	DefaultCacheEntries = 1024
+	DefaultCacheBytes   = 16 << 20
+)
+
+// MemoryCacheStore is a CacheStore that keeps responses in memory, evicting
+// the least recently used when either of its bounds is exceeded.
+type MemoryCacheStore struct {
+	mu                   sync.Mutex
+	entries              map[string]*list.Element
+	lru                  *list.List
+	size                 int
+	maxEntries, maxBytes int
+}
+
+// NewMemoryCacheStore returns a MemoryCacheStore that holds at most
+// maxEntries responses with bodies totalling at most maxBytes.
+func NewMemoryCacheStore(maxEntries, maxBytes int) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+	}
+}
+
+type memoryCacheEntry struct {
+	key string
+	rs  *CachedResponse
+}
+
+func (s *MemoryCacheStore) Get(key string) (*CachedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	s.lru.MoveToFront(e)
+	return e.Value.(*memoryCacheEntry).rs, true
+}
+
+func (s *MemoryCacheStore) Set(key string, rs *CachedResponse) {
+	if len(rs.Body) > s.maxBytes {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		s.remove(e)
+	}
+	s.entries[key] = s.lru.PushFront(&memoryCacheEntry{key, rs})
+	s.size += len(rs.Body)
+	for s.lru.Len() > s.maxEntries || s.size > s.maxBytes {
+		s.remove(s.lru.Back())
+	}
+}
+
+func (s *MemoryCacheStore) remove(e *list.Element) {
+	entry := s.lru.Remove(e).(*memoryCacheEntry)
+	delete(s.entries, entry.key)
+	s.size -= len(entry.rs.Body)
+}
+
+// addVary adds name to the Vary header unless it's already present.
+func addVary(header http.Header, name string) {
+	for _, value := range header["Vary"] {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if "*" == field || strings.EqualFold(name, field) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", name)
+}
+
+// varyKey is the key under which the names in the Vary header of the
+// responses with the given base key are stored.
+func varyKey(base string) string {
+	return "vary " + base
+}
+
+// varyNames returns the canonical names in a Vary header, sorted.
+func varyNames(header http.Header) []string {
+	var names []string
+	for _, value := range header["Vary"] {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); "" != field {
+				names = append(names, http.CanonicalHeaderKey(field))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cacheKey adds the request's values of the named headers to the base key.
+func cacheKey(base string, r *http.Request, names []string) string {
+	var b strings.Builder
+	b.WriteString(base)
+	for i, name := range names {
+		if 0 < i && names[i-1] == name {
+			continue
+		}
+		b.WriteString("\n")
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(strings.Join(r.Header.Values(name), ", "))
+	}
+	return b.String()
+}
+
+// cacheable reports whether a buffered response may be stored: it must be a
+// 200 that doesn't set cookies, forbid storage, or vary on everything, and
+// it must be public if the request was authorized.
+func cacheable(b *responseBuffer, r *http.Request) bool {
+	if http.StatusOK != b.StatusCode || "" != b.Header().Get("Set-Cookie") {
+		return false
+	}
+	cacheControl := strings.ToLower(b.Header().Get("Cache-Control"))
+	if strings.Contains(cacheControl, "no-store") || strings.Contains(cacheControl, "private") {
+		return false
+	}
+	if "" != r.Header.Get("Authorization") && !strings.Contains(cacheControl, "public") {
+		return false
+	}
+	for _, name := range varyNames(b.Header()) {
+		if "*" == name {
+			return false
+		}
+	}
+	return true
+}
+
+func cloneHeader(header http.Header) http.Header {
+	clone := make(http.Header, len(header))
+	copyHeader(clone, header)
+	return clone
+}
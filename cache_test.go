@@ -0,0 +1,111 @@
+package marshaler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCached(t *testing.T) {
+	calls := 0
+	c := Cached(Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		calls++
+		return http.StatusOK, nil, &testResponse{"bar"}, nil
+	}), time.Minute, nil)
+	for i := 0; i < 2; i++ {
+		w := &testResponseWriter{}
+		r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+		r.Header.Set("Accept", "application/json")
+		c.ServeHTTP(w, r)
+		if http.StatusOK != w.StatusCode {
+			t.Fatal(w.StatusCode)
+		}
+		if "{\"foo\":\"bar\"}\n" != w.Body.String() {
+			t.Fatal(w.Body.String())
+		}
+		if "Accept" != w.Header().Get("Vary") {
+			t.Fatal(w.Header().Get("Vary"))
+		}
+	}
+	if 1 != calls {
+		t.Fatal(calls)
+	}
+}
+
+func TestCachedExpired(t *testing.T) {
+	calls := 0
+	c := Cached(Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		calls++
+		return http.StatusOK, nil, &testResponse{"bar"}, nil
+	}), 0, nil)
+	for i := 0; i < 2; i++ {
+		r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+		c.ServeHTTP(&testResponseWriter{}, r)
+	}
+	if 2 != calls {
+		t.Fatal(calls)
+	}
+}
+
+func TestMemoryCacheStoreEviction(t *testing.T) {
+	s := NewMemoryCacheStore(2, 1024)
+	s.Set("a", &CachedResponse{Body: []byte("a")})
+	s.Set("b", &CachedResponse{Body: []byte("b")})
+	s.Get("a")
+	s.Set("c", &CachedResponse{Body: []byte("c")})
+	if _, ok := s.Get("b"); ok {
+		t.Fatal("b")
+	}
+	if _, ok := s.Get("a"); !ok {
+		t.Fatal("a")
+	}
+}
+
+func TestCachedVary(t *testing.T) {
+	calls := 0
+	c := Cached(Compressed(Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		calls++
+		return http.StatusOK, nil, &testResponse{strings.Repeat("bar", 1000)}, nil
+	})), time.Minute, nil)
+	for _, encoding := range []string{"gzip", "", "gzip", ""} {
+		w := &testResponseWriter{}
+		r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+		if "" != encoding {
+			r.Header.Set("Accept-Encoding", encoding)
+		}
+		c.ServeHTTP(w, r)
+		if encoding != w.Header().Get("Content-Encoding") {
+			t.Fatal(encoding, w.Header())
+		}
+	}
+	if 2 != calls {
+		t.Fatal(calls)
+	}
+}
+
+func TestCachedAuthorization(t *testing.T) {
+	calls := 0
+	cacheControl := ""
+	c := Cached(Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		calls++
+		return http.StatusOK, http.Header{"Cache-Control": {cacheControl}}, &testResponse{"bar"}, nil
+	}), time.Minute, nil)
+	get := func() {
+		r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+		r.Header.Set("Authorization", "Bearer secret")
+		c.ServeHTTP(&testResponseWriter{}, r)
+	}
+	get()
+	get()
+	if 2 != calls {
+		t.Fatal(calls)
+	}
+	cacheControl = "public, max-age=60"
+	get()
+	get()
+	if 3 != calls {
+		t.Fatal(calls)
+	}
+}
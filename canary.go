@@ -0,0 +1,61 @@
+package marshaler
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+)
+
+// Canary is an http.Handler that sends a percentage of requests to a canary
+// handler and the rest to the stable handler, for gradual rollouts.
+// Requests may choose for themselves with a boolean Header or Cookie, if
+// either is set, so that testers can reach the canary and customers can be
+// kept off it.  The variant chosen, "canary" or "stable", is logged and
+// labels the measurements of metrics middleware wrapping the Canary.
+type Canary struct {
+	Percent float64
+	Header  string
+	Cookie  string
+	stable  http.Handler
+	canary  http.Handler
+	random  func() float64
+}
+
+// Canaried returns an http.Handler that sends percent of requests to the
+// canary handler and the rest to the stable handler.
+func Canaried(stable, canary http.Handler, percent float64) *Canary {
+	return &Canary{
+		Percent: percent,
+		stable:  stable,
+		canary:  canary,
+		random:  rand.Float64,
+	}
+}
+
+func (c *Canary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, variant := c.stable, "stable"
+	if c.chooseCanary(r) {
+		handler, variant = c.canary, "canary"
+	}
+	logRequestLine(r, "variant %s", variant)
+	if recorder, ok := w.(responseRecorder); ok {
+		recorder.responseRecord().Variant = variant
+	}
+	handler.ServeHTTP(w, r)
+}
+
+func (c *Canary) chooseCanary(r *http.Request) bool {
+	if "" != c.Header {
+		if canary, err := strconv.ParseBool(r.Header.Get(c.Header)); nil == err {
+			return canary
+		}
+	}
+	if "" != c.Cookie {
+		if cookie, err := r.Cookie(c.Cookie); nil == err {
+			if canary, err := strconv.ParseBool(cookie.Value); nil == err {
+				return canary
+			}
+		}
+	}
+	return c.random()*100 < c.Percent
+}
@@ -0,0 +1,67 @@
+package marshaler
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func testCanaried() *Canary {
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		})
+	}
+	return Canaried(handler("stable"), handler("canary"), 10)
+}
+
+func TestCanaried(t *testing.T) {
+	c := testCanaried()
+	c.Header, c.Cookie = "X-Canary", "canary"
+	for _, test := range []struct {
+		random         float64
+		header, cookie string
+		variant        string
+	}{
+		{0.05, "", "", "canary"},
+		{0.5, "", "", "stable"},
+		{0.5, "true", "", "canary"},
+		{0.05, "false", "", "stable"},
+		{0.5, "", "1", "canary"},
+		{0.5, "maybe", "", "stable"},
+	} {
+		c.random = func() float64 { return test.random }
+		w := &testResponseWriter{}
+		r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+		if "" != test.header {
+			r.Header.Set("X-Canary", test.header)
+		}
+		if "" != test.cookie {
+			r.AddCookie(&http.Cookie{Name: "canary", Value: test.cookie})
+		}
+		c.ServeHTTP(w, r)
+		if test.variant != w.Body.String() {
+			t.Fatal(test, w.Body.String())
+		}
+	}
+}
+
+func TestCanariedMetrics(t *testing.T) {
+	c := testCanaried()
+	c.random = func() float64 { return 0 }
+	sink := &testMetricsSink{}
+	var buf bytes.Buffer
+	l := Logged(Timed(c, "foo", sink), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	l.ServeHTTP(&testResponseWriter{}, r)
+	if "canary" != sink.metrics[0].labels["variant"] {
+		t.Fatal(sink.metrics)
+	}
+	if !strings.Contains(buf.String(), "foo variant canary") {
+		t.Fatal(buf.String())
+	}
+}
@@ -0,0 +1,137 @@
+package marshaler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+// MarshalCanonical returns the canonical JSON encoding of v as defined by
+// RFC 8785: object keys sorted, numbers formatted as by ECMAScript, minimal
+// string escaping, and no insignificant whitespace.  Equal values always
+// have identical encodings, so they may be signed, hashed, or compared byte
+// for byte.
+func MarshalCanonical(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if nil != err {
+		return nil, err
+	}
+	return Canonicalize(b)
+}
+
+// Canonicalize re-encodes JSON in its canonical form as MarshalCanonical
+// does.
+func Canonicalize(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); nil != err {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("invalid character after top-level value")
+	}
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, v); nil != err {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeCanonical(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case string:
+		writeCanonicalString(buf, v)
+	case json.Number:
+		f, err := v.Float64()
+		if nil != err {
+			return err
+		}
+		b, err := json.Marshal(f) // encoding/json formats floats as ECMAScript does.
+		if nil != err {
+			return err
+		}
+		buf.Write(b)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, value := range v {
+			if 0 < i {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, value); nil != err {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return lessUTF16(keys[i], keys[j]) })
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if 0 < i {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, key)
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, v[key]); nil != err {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("can't canonicalize %T", v)
+	}
+	return nil
+}
+
+// writeCanonicalString escapes only quotation marks, backslashes, and
+// control characters, using the short escapes where they exist.
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// lessUTF16 orders strings by their UTF-16 code units, as RFC 8785 requires.
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
@@ -0,0 +1,51 @@
+package marshaler
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestMarshalCanonical(t *testing.T) {
+	b, err := MarshalCanonical(map[string]interface{}{
+		"b":          []interface{}{1.0, 1e21, 1e-7, 0.1, "<&>"},
+		"a":          map[string]interface{}{"z": nil, "y": true},
+		"\u20ac":     "\u2028\x01",
+		"\U0001f600": "\t",
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "{\"a\":{\"y\":true,\"z\":null},\"b\":[1,1e+21,1e-7,0.1,\"<&>\"],\"\u20ac\":\"\u2028\\u0001\",\"\U0001f600\":\"\\t\"}" != string(b) {
+		t.Fatal(string(b))
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	b, err := Canonicalize([]byte(" { \"b\" : 2.50 , \"a\" : 1E2 } "))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if `{"a":100,"b":2.5}` != string(b) {
+		t.Fatal(string(b))
+	}
+	if _, err := Canonicalize([]byte(`{} {}`)); nil == err {
+		t.Fatal(err)
+	}
+}
+
+func TestCanonicalMarshaler(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	m := Handler(func(u *url.URL, h http.Header) (int, http.Header, map[string]interface{}, error) {
+		return http.StatusOK, nil, map[string]interface{}{"foo": "bar", "baz": 1.50}, nil
+	})
+	m.Canonical = true
+	m.ServeHTTP(w, r)
+	if `{"baz":1.5,"foo":"bar"}` != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+	if "23" != w.Header().Get("Content-Length") {
+		t.Fatal(w.Header())
+	}
+}
@@ -0,0 +1,114 @@
+package marshaler
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A CharsetDecoder transcodes a request body from some charset to UTF-8.
+type CharsetDecoder func(io.Reader) io.Reader
+
+var charsets = map[string]CharsetDecoder{
+	"utf-8":      nil,
+	"us-ascii":   nil,
+	"iso-8859-1": latin1Decoder,
+	"latin1":     latin1Decoder,
+}
+
+// RegisterCharset makes request bodies in the named charset acceptable to
+// the Marshaler, which transcodes them to UTF-8 with the given decoder
+// before unmarshaling them.  Requests in unregistered charsets are answered
+// 415 Unsupported Media Type.  RegisterCharset is not safe to call once the
+// server has started.
+func RegisterCharset(name string, decoder CharsetDecoder) {
+	charsets[strings.ToLower(name)] = decoder
+}
+
+// acceptCharset reports whether the Accept-Charset header, if any, allows a
+// UTF-8 response.
+func acceptCharset(r *http.Request) bool {
+	accept := r.Header.Get("Accept-Charset")
+	if "" == accept {
+		return true
+	}
+	for _, field := range strings.Split(accept, ",") {
+		name, q := qualityValue(field)
+		if ("*" == name || "utf-8" == name) && 0 < q {
+			return true
+		}
+	}
+	return false
+}
+
+// charsetReader returns a reader of the UTF-8 transcoding of a request body
+// according to the charset parameter of its Content-Type.
+func charsetReader(r *http.Request) (io.Reader, error) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if nil != err {
+		return nil, err
+	}
+	charset, ok := params["charset"]
+	if !ok {
+		return r.Body, nil
+	}
+	decoder, ok := charsets[strings.ToLower(charset)]
+	if !ok {
+		return nil, MarshalerError(Message(r, "charset %s is not supported", charset))
+	}
+	if nil == decoder {
+		return r.Body, nil
+	}
+	return decoder(r.Body), nil
+}
+
+// qualityValue splits an element of an Accept-style header into its
+// lowercase value and its q parameter, which defaults to 1.
+func qualityValue(field string) (string, float64) {
+	parts := strings.Split(field, ";")
+	q := 1.0
+	for _, param := range parts[1:] {
+		param = strings.TrimSpace(param)
+		if strings.HasPrefix(param, "q=") {
+			if f, err := strconv.ParseFloat(param[2:], 64); nil == err {
+				q = f
+			}
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(parts[0])), q
+}
+
+func latin1Decoder(r io.Reader) io.Reader {
+	return &latin1Reader{r: bufio.NewReader(r)}
+}
+
+// latin1Reader transcodes ISO-8859-1 to UTF-8, in which each byte above 0x7f
+// becomes two bytes.
+type latin1Reader struct {
+	r       *bufio.Reader
+	pending []byte
+}
+
+func (r *latin1Reader) Read(p []byte) (int, error) {
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	for n < len(p) {
+		b, err := r.r.ReadByte()
+		if nil != err {
+			if 0 < n {
+				return n, nil
+			}
+			return n, err
+		}
+		var buf [utf8.UTFMax]byte
+		size := utf8.EncodeRune(buf[:], rune(b))
+		copied := copy(p[n:], buf[:size])
+		r.pending = append(r.pending, buf[copied:size]...)
+		n += copied
+	}
+	return n, nil
+}
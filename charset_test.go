@@ -0,0 +1,47 @@
+package marshaler
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestCharsetLatin1(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("POST", "http://example.com/foo", bytes.NewBufferString("{\"foo\":\"caf\xe9\"}"))
+	r.Header.Set("Content-Type", "application/json; charset=ISO-8859-1")
+	Handler(func(u *url.URL, h http.Header, rq *testRequest) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, nil, &testResponse{rq.Foo}, nil
+	}).ServeHTTP(w, r)
+	if "{\"foo\":\"café\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+	if "application/json; charset=utf-8" != w.Header().Get("Content-Type") {
+		t.Fatal(w.Header().Get("Content-Type"))
+	}
+}
+
+func TestCharsetUnsupported(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("POST", "http://example.com/foo", bytes.NewBufferString("{}"))
+	r.Header.Set("Content-Type", "application/json; charset=ebcdic")
+	Handler(func(u *url.URL, h http.Header, rq *testRequest) (int, http.Header, *testResponse, error) {
+		return http.StatusNoContent, nil, nil, nil
+	}).ServeHTTP(w, r)
+	if http.StatusUnsupportedMediaType != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
+
+func TestAcceptCharset(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Accept-Charset", "iso-8859-1, utf-8;q=0")
+	Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		return http.StatusNoContent, nil, nil, nil
+	}).ServeHTTP(w, r)
+	if http.StatusNotAcceptable != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
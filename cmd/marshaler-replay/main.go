@@ -0,0 +1,100 @@
+// Command marshaler-replay replays traffic captured by marshalertest's
+// Recording and WriteExchange against a target server and compares the
+// statuses of the responses with those recorded.
+//
+//	marshaler-replay -target http://localhost:8080 -concurrency 8 -rate 50 captured.jsonl
+//
+// Exchanges are read from the files named, or from standard input if there
+// are none.  Each exchange whose status differs is printed, with a diff of
+// the whole response if -diff is given, followed by a summary.  The exit
+// status is 1 if any status differed and 2 if the replay couldn't be run.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/lhigueragamboa/marshaler"
+	"github.com/lhigueragamboa/marshaler/marshalertest"
+)
+
+func main() {
+	target := flag.String("target", "", "URL of the server to replay against")
+	concurrency := flag.Int("concurrency", 1, "number of requests in flight at once")
+	rate := flag.Float64("rate", 0, "most requests per second, or 0 for no limit")
+	keepHost := flag.Bool("keep-host", false, "send the recorded Host header instead of the target's")
+	diff := flag.Bool("diff", false, "print how the whole response differs, not just the status")
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("marshaler-replay: ")
+	if "" == *target {
+		log.Print("-target is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	u, err := url.Parse(*target)
+	if nil != err {
+		log.Print(err)
+		os.Exit(2)
+	}
+
+	exchanges, err := readExchanges(flag.Args())
+	if nil != err {
+		log.Print(err)
+		os.Exit(2)
+	}
+
+	proxy := marshaler.ReverseProxy(u)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !*keepHost {
+			r.Host = ""
+		}
+		proxy.ServeHTTP(w, r)
+	})
+	differed := 0
+	marshalertest.ReplayAll(handler, exchanges, *concurrency, *rate, func(original, replayed *marshalertest.Exchange) {
+		if !*diff && original.Response.StatusCode == replayed.Response.StatusCode {
+			return
+		}
+		d := ""
+		if *diff {
+			if d = original.Diff(replayed); "" == d {
+				return
+			}
+		} else {
+			d = fmt.Sprintf("status: %d != %d\n", original.Response.StatusCode, replayed.Response.StatusCode)
+		}
+		differed++
+		fmt.Printf("%s %s\n%s", original.Request.Method, original.Request.URL, d)
+	})
+	fmt.Printf("replayed %d exchanges; %d differed\n", len(exchanges), differed)
+	if 0 < differed {
+		os.Exit(1)
+	}
+}
+
+// readExchanges reads the exchanges in the named files, or standard input if
+// none are named.
+func readExchanges(paths []string) ([]*marshalertest.Exchange, error) {
+	if 0 == len(paths) {
+		return marshalertest.ReadExchanges(os.Stdin)
+	}
+	var exchanges []*marshalertest.Exchange
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if nil != err {
+			return nil, err
+		}
+		e, err := marshalertest.ReadExchanges(f)
+		f.Close()
+		if nil != err {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		exchanges = append(exchanges, e...)
+	}
+	return exchanges, nil
+}
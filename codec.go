@@ -0,0 +1,92 @@
+package marshaler
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// A Codec encodes and decodes request and response bodies in a media type
+// other than JSON.  Responses are passed to Marshal after the Marshaler has
+// applied its options, so Codecs should support the same values as
+// encoding/json, including the json.Marshaler interface.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// A TypedCodec is a Codec that encodes values according to their types, like
+// Avro, which encodes against the schema registered for each type.  Since
+// the Marshaler may transform responses before encoding them, it passes
+// the response's original type to MarshalType.
+type TypedCodec interface {
+	Codec
+	MarshalType(t reflect.Type, v interface{}) ([]byte, error)
+}
+
+var codecs = map[string]Codec{
+	BSONType: BSON{},
+}
+
+// RegisterCodec makes the Marshaler accept request bodies in the given media
+// type and answer requests that prefer it with bodies in that media type.
+// RegisterCodec is not safe to call once the server has started.
+func RegisterCodec(mediaType string, codec Codec) {
+	codecs[strings.ToLower(mediaType)] = codec
+}
+
+// negotiateCodec chooses the media type of the response from the Accept
+// header, returning a nil Codec for JSON.  It reports false if neither JSON
+// nor any registered media type is acceptable.
+func negotiateCodec(r *http.Request) (string, Codec, bool) {
+	accept := r.Header.Get("Accept")
+	bestQ := -1.0
+	if acceptJSON(r) {
+		bestQ = 0
+		if "" == accept {
+			bestQ = 1
+		}
+		for _, field := range strings.Split(accept, ",") {
+			if name, q := qualityValue(field); q > bestQ && ("application/json" == name || "application/*" == name || "*/*" == name) {
+				bestQ = q
+			}
+		}
+	}
+	var bestType string
+	var bestCodec Codec
+	for _, field := range strings.Split(accept, ",") {
+		name, q := qualityValue(field)
+		if codec, ok := codecs[name]; ok && 0 < q && q > bestQ {
+			bestQ, bestType, bestCodec = q, name, codec
+		}
+	}
+	return bestType, bestCodec, 0 <= bestQ
+}
+
+// requestCodec returns the Codec registered for the request's Content-Type,
+// or nil if there is none.
+func requestCodec(r *http.Request) Codec {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if nil != err {
+		return nil
+	}
+	return codecs[mediaType]
+}
+
+// decodeCodec unmarshals a request body with a Codec.
+func decodeCodec(r *http.Request, codec Codec, rq interface{}) error {
+	body, err := io.ReadAll(r.Body)
+	if nil != err {
+		return NewHTTPEquivError(err, http.StatusBadRequest)
+	}
+	if 0 == len(body) {
+		return NewHTTPEquivError(errors.New("EOF"), http.StatusBadRequest)
+	}
+	if err := codec.Unmarshal(body, rq); nil != err {
+		return NewHTTPEquivError(err, http.StatusBadRequest)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package marshaler
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// A ContentCoding compresses response bodies and decompresses request
+// bodies for one Content-Encoding.
+type ContentCoding struct {
+	NewWriter func(io.Writer) (io.WriteCloser, error)
+	NewReader func(io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	contentCodingsMu sync.RWMutex
+	contentCodings   = map[string]ContentCoding{
+		"gzip": {
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+			NewReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		},
+		"deflate": {
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, flate.DefaultCompression) },
+			NewReader: func(r io.Reader) (io.ReadCloser, error) { return flate.NewReader(r), nil },
+		},
+	}
+)
+
+// ContentCodingPreference orders the content codings Compressed chooses
+// among when a client accepts several equally.  Codings that haven't been
+// registered are skipped.
+var ContentCodingPreference = []string{"zstd", "br", "gzip", "deflate"}
+
+// RegisterContentCoding adds support for a Content-Encoding.  gzip and
+// deflate are built in; br and zstd may be added by registering adapters for
+// the brotli and zstd implementations of your choice so that this package
+// remains free of dependencies:
+//
+//	marshaler.RegisterContentCoding("br", marshaler.ContentCoding{
+//	    NewWriter: func(w io.Writer) (io.WriteCloser, error) { return brotli.NewWriter(w), nil },
+//	    NewReader: func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(brotli.NewReader(r)), nil },
+//	})
+func RegisterContentCoding(name string, coding ContentCoding) {
+	contentCodingsMu.Lock()
+	defer contentCodingsMu.Unlock()
+	contentCodings[strings.ToLower(name)] = coding
+}
+
+func contentCoding(name string) (ContentCoding, bool) {
+	contentCodingsMu.RLock()
+	defer contentCodingsMu.RUnlock()
+	coding, ok := contentCodings[strings.ToLower(name)]
+	return coding, ok
+}
+
+// Compressor is an http.Handler that decompresses request bodies according
+// to their Content-Encoding and compresses responses with the best coding
+// the client accepts.
+type Compressor struct {
+	handler http.Handler
+}
+
+// Compressed returns an http.Handler that decompresses requests to and
+// compresses responses from the given handler.
+func Compressed(handler http.Handler) *Compressor {
+	return &Compressor{handler}
+}
+
+func (c *Compressor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if encoding := r.Header.Get("Content-Encoding"); "" != encoding && "identity" != encoding {
+		coding, ok := contentCoding(encoding)
+		if !ok || nil == coding.NewReader {
+			writeError(w, r, UnsupportedMediaType{MarshalerError(Message(
+				r,
+				"Content-Encoding %s is not supported",
+				encoding,
+			))})
+			return
+		}
+		body, err := coding.NewReader(r.Body)
+		if nil != err {
+			writeError(w, r, BadRequest{err})
+			return
+		}
+		defer body.Close()
+		r.Body = readCloser{body, r.Body}
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+	}
+	addVary(w.Header(), "Accept-Encoding")
+	name := negotiateContentCoding(r.Header.Get("Accept-Encoding"))
+	if "" == name || "HEAD" == r.Method {
+		c.handler.ServeHTTP(w, r)
+		return
+	}
+	cw := &compressingResponseWriter{ResponseWriter: w, name: name}
+	defer cw.Close()
+	c.handler.ServeHTTP(cw, r)
+}
+
+// negotiateContentCoding returns the registered content coding the client
+// most prefers, or the empty string if it prefers none over identity.
+func negotiateContentCoding(acceptEncoding string) string {
+	qs := map[string]float64{}
+	for _, field := range strings.Split(acceptEncoding, ",") {
+		if name, q := qualityValue(field); "" != name {
+			qs[name] = q
+		}
+	}
+	best, bestQ := "", 0.0
+	for _, name := range ContentCodingPreference {
+		q, ok := qs[name]
+		if !ok {
+			q, ok = qs["*"]
+		}
+		if _, registered := contentCoding(name); ok && registered && q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+type compressingResponseWriter struct {
+	http.ResponseWriter
+	name        string
+	writer      io.WriteCloser
+	wroteHeader bool
+}
+
+func (w *compressingResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if nil == w.writer {
+		return w.ResponseWriter.Write(p)
+	}
+	return w.writer.Write(p)
+}
+
+// WriteHeader decides whether to compress the response, which it doesn't if
+// the response has no body, is already encoded, is a media type that's
+// already compressed, or is part of a representation, whose Content-Range
+// counts bytes of the uncompressed body.
+func (w *compressingResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.wroteHeader = true
+	header := w.Header()
+	if http.StatusNoContent != code && http.StatusNotModified != code && http.StatusPartialContent != code && 200 <= code &&
+		"" == header.Get("Content-Encoding") && "" == header.Get("Content-Range") && compressible(header.Get("Content-Type")) {
+		coding, _ := contentCoding(w.name)
+		if writer, err := coding.NewWriter(w.ResponseWriter); nil == err {
+			w.writer = writer
+			header.Set("Content-Encoding", w.name)
+			header.Del("Content-Length")
+			if etag := header.Get("ETag"); "" != etag && !strings.HasPrefix(etag, "W/") {
+				header.Set("ETag", "W/"+etag)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressingResponseWriter) Flush() {
+	if f, ok := w.writer.(interface {
+		Flush() error
+	}); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressingResponseWriter) Close() error {
+	if nil == w.writer {
+		return nil
+	}
+	return w.writer.Close()
+}
+
+func compressible(contentType string) bool {
+	for _, prefix := range []string{"image/", "video/", "audio/", "application/zip", "application/gzip", "application/zstd"} {
+		if strings.HasPrefix(contentType, prefix) && "image/svg+xml" != contentType {
+			return false
+		}
+	}
+	return true
+}
+
+// readCloser reads from one io.Reader and closes another io.Closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
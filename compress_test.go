@@ -0,0 +1,100 @@
+package marshaler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateContentCoding(t *testing.T) {
+	for accept, name := range map[string]string{
+		"":                        "",
+		"identity":                "",
+		"gzip, deflate":           "gzip",
+		"deflate;q=1, gzip;q=0.5": "deflate",
+		"br":                      "",
+		"*":                       "gzip",
+		"*, gzip;q=0":             "deflate",
+	} {
+		if n := negotiateContentCoding(accept); name != n {
+			t.Fatal(accept, n)
+		}
+	}
+}
+
+func TestCompressed(t *testing.T) {
+	w := &testResponseWriter{}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte("{\"foo\":\"bar\"}"))
+	gz.Close()
+	r, _ := http.NewRequest("POST", "http://example.com/foo", &buf)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Encoding", "gzip")
+	r.Header.Set("Accept-Encoding", "gzip")
+	Compressed(Handler(func(u *url.URL, h http.Header, rq *testRequest) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, nil, &testResponse{rq.Foo}, nil
+	})).ServeHTTP(w, r)
+	if "gzip" != w.Header().Get("Content-Encoding") || "Accept-Encoding" != w.Header().Get("Vary") {
+		t.Fatal(w.Header())
+	}
+	if "" != w.Header().Get("Content-Length") {
+		t.Fatal(w.Header().Get("Content-Length"))
+	}
+	gzr, err := gzip.NewReader(&w.Body)
+	if nil != err {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(gzr)
+	if "{\"foo\":\"bar\"}\n" != string(body) {
+		t.Fatal(string(body))
+	}
+}
+
+func TestCompressedRange(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Header.Set("Range", "bytes=2-4")
+	Compressed(Handler(func(u *url.URL, h http.Header) (int, http.Header, *FileResponse, error) {
+		return http.StatusOK, nil, &FileResponse{
+			Name:   "foo.txt",
+			Reader: strings.NewReader("0123456789"),
+			Size:   10,
+		}, nil
+	})).ServeHTTP(w, r)
+	if http.StatusPartialContent != w.StatusCode || "" != w.Header().Get("Content-Encoding") {
+		t.Fatal(w.StatusCode, w.Header())
+	}
+	if "234" != w.Body.String() || "bytes 2-4/10" != w.Header().Get("Content-Range") {
+		t.Fatal(w.Body.String(), w.Header())
+	}
+}
+
+func TestCompressedUnsupportedContentEncoding(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("POST", "http://example.com/foo", bytes.NewBufferString("{}"))
+	r.Header.Set("Content-Encoding", "compress")
+	Compressed(OptionsHandler{}).ServeHTTP(w, r)
+	if http.StatusUnsupportedMediaType != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
+
+func TestRegisterContentCoding(t *testing.T) {
+	RegisterContentCoding("br", ContentCoding{
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+	})
+	defer func() {
+		contentCodingsMu.Lock()
+		delete(contentCodings, "br")
+		contentCodingsMu.Unlock()
+	}()
+	if "br" != negotiateContentCoding("gzip, br") {
+		t.Fatal(negotiateContentCoding("gzip, br"))
+	}
+}
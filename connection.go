@@ -0,0 +1,28 @@
+package marshaler
+
+import (
+	"context"
+	"net"
+)
+
+// A ConnectionID is given to each connection a Server accepts so that the
+// requests made over it, one after another with keep-alive or at once over
+// HTTP/2, can be grouped.  MultilineLogger logs it under the RequestID of
+// each request.
+type ConnectionID string
+
+type connectionIDKey struct{}
+
+// ConnectionIDContext gives a new connection a random 16-character
+// ConnectionID.  It's the ConnContext of Servers and may be used as that of
+// any http.Server.
+func ConnectionIDContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connectionIDKey{}, ConnectionID(RandomBase62Bytes(16)))
+}
+
+// ConnectionIDFromContext returns the ConnectionID of the connection a
+// request arrived on, or the empty string if it wasn't given one.
+func ConnectionIDFromContext(ctx context.Context) ConnectionID {
+	connectionID, _ := ctx.Value(connectionIDKey{}).(ConnectionID)
+	return connectionID
+}
@@ -0,0 +1,61 @@
+package marshaler
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestConnectionID(t *testing.T) {
+	s := NewServer("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, string(ConnectionIDFromContext(r.Context())))
+	}))
+	s.Logger = log.New(io.Discard, "", 0)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	served := make(chan error)
+	go func() { served <- s.Serve(l) }()
+	get := func(client *http.Client) string {
+		resp, err := client.Get("http://" + l.Addr().String())
+		if nil != err {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	transport, other := &http.Transport{}, &http.Transport{}
+	defer transport.CloseIdleConnections()
+	defer other.CloseIdleConnections()
+	first := get(&http.Client{Transport: transport})
+	if 16 != len(first) {
+		t.Fatal(first)
+	}
+	if second := get(&http.Client{Transport: transport}); first != second {
+		t.Fatal(first, second)
+	}
+	if third := get(&http.Client{Transport: other}); first == third {
+		t.Fatal(first, third)
+	}
+	s.Stop()
+	<-served
+}
+
+func TestLoggedConnectionID(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logged(http.NotFoundHandler(), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r = r.WithContext(ConnectionIDContext(r.Context(), nil))
+	l.ServeHTTP(&testResponseWriter{}, r)
+	if want := "foo connection " + string(ConnectionIDFromContext(r.Context())) + "\n"; !strings.Contains(buf.String(), want) {
+		t.Fatal(buf.String())
+	}
+}
@@ -0,0 +1,454 @@
+package marshaler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A ContractViolation describes how a request or response differs from the
+// OpenAPI document a ContractValidator checks it against.
+type ContractViolation struct {
+	Response    bool
+	Description string
+}
+
+func (v *ContractViolation) Error() string {
+	if v.Response {
+		return "response " + v.Description
+	}
+	return "request " + v.Description
+}
+
+// ContractValidator is an http.Handler that checks requests and responses
+// against an OpenAPI 3 document, like the one OpenAPI generates or one
+// decoded from JSON, so that handlers stay honest with the published
+// contract.  Violations are passed to OnViolation, which by default logs
+// them if the request is being logged.  If RejectRequests is set, requests
+// that violate the contract are answered 400 Bad Request without reaching
+// the handler and if RejectResponses is set, responses that violate it are
+// replaced by 500 Internal Server Error.
+//
+// Paths, methods, parameters, request bodies, status codes, and JSON
+// response bodies are checked.  Schemas may use type, properties,
+// required, additionalProperties, items, enum, nullable, and $ref; other
+// keywords are ignored.  Optional properties, arrays, and objects may be
+// null, as encoding/json encodes nil pointers, slices, and maps.  Responses
+// are buffered in order to be checked.
+type ContractValidator struct {
+	RejectRequests  bool
+	RejectResponses bool
+	OnViolation     func(r *http.Request, v *ContractViolation)
+	handler         http.Handler
+	document        map[string]interface{}
+	paths           []contractPath
+}
+
+type contractPath struct {
+	segments []string
+	item     map[string]interface{}
+}
+
+// ContractValidated returns an http.Handler that checks requests and
+// responses against an OpenAPI 3 document.
+func ContractValidated(handler http.Handler, document map[string]interface{}) *ContractValidator {
+	v := &ContractValidator{
+		OnViolation: func(r *http.Request, v *ContractViolation) {
+			logRequestLine(r, "contract violation: %v", v)
+		},
+		handler:  handler,
+		document: document,
+	}
+	paths, _ := document["paths"].(map[string]interface{})
+	for path, item := range paths {
+		if item, ok := item.(map[string]interface{}); ok {
+			v.paths = append(v.paths, contractPath{strings.Split(path, "/"), item})
+		}
+	}
+
+	// Prefer static segments to parameters, as TrieServeMux does.
+	sort.Slice(v.paths, func(i, j int) bool {
+		a, b := v.paths[i].segments, v.paths[j].segments
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if ap, bp := isPathParameter(a[k]), isPathParameter(b[k]); ap != bp {
+				return bp
+			}
+		}
+		return strings.Join(a, "/") < strings.Join(b, "/")
+	})
+
+	return v
+}
+
+func (v *ContractValidator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	operation, params := v.operation(r)
+	if nil == operation {
+		v.violation(w, r, &ContractViolation{Description: Message(
+			r,
+			"%s %s is not described",
+			r.Method,
+			r.URL.Path,
+		)})
+		if v.RejectRequests {
+			return
+		}
+		v.handler.ServeHTTP(w, r)
+		return
+	}
+	if err := v.checkRequest(r, operation, params); nil != err {
+		v.violation(w, r, &ContractViolation{Description: err.Error()})
+		if v.RejectRequests {
+			return
+		}
+	}
+	b := newResponseBuffer()
+	v.handler.ServeHTTP(b, r)
+	if err := v.checkResponse(b, operation); nil != err {
+		violation := &ContractViolation{Response: true, Description: err.Error()}
+		v.OnViolation(r, violation)
+		if v.RejectResponses {
+			writeError(w, r, InternalServerError{violation})
+			return
+		}
+	}
+	b.WriteTo(w)
+}
+
+// violation reports a violation by the request, answering it if
+// RejectRequests is set.
+func (v *ContractValidator) violation(w http.ResponseWriter, r *http.Request, violation *ContractViolation) {
+	v.OnViolation(r, violation)
+	if v.RejectRequests {
+		writeError(w, r, BadRequest{violation})
+	}
+}
+
+// operation finds the Operation Object for a request and the values of its
+// path parameters.
+func (v *ContractValidator) operation(r *http.Request) (map[string]interface{}, map[string]string) {
+	segments := strings.Split(r.URL.Path, "/")
+	for _, path := range v.paths {
+		if len(path.segments) != len(segments) {
+			continue
+		}
+		params := map[string]string{}
+		for i, segment := range path.segments {
+			if isPathParameter(segment) && "" != segments[i] {
+				params[segment[1:len(segment)-1]] = segments[i]
+			} else if segment != segments[i] {
+				params = nil
+				break
+			}
+		}
+		if nil == params {
+			continue
+		}
+		operation, ok := path.item[strings.ToLower(r.Method)].(map[string]interface{})
+		if !ok && "HEAD" == r.Method {
+			operation, ok = path.item["get"].(map[string]interface{})
+		}
+		if !ok {
+			return nil, nil
+		}
+		if parameters, ok := path.item["parameters"].([]interface{}); ok {
+			operation = withParameters(operation, parameters)
+		}
+		return operation, params
+	}
+	return nil, nil
+}
+
+// withParameters returns a copy of an operation with the parameters of its
+// Path Item Object added.
+func withParameters(operation map[string]interface{}, parameters []interface{}) map[string]interface{} {
+	o := make(map[string]interface{}, len(operation))
+	for k, v := range operation {
+		o[k] = v
+	}
+	own, _ := operation["parameters"].([]interface{})
+	o["parameters"] = append(append([]interface{}(nil), parameters...), own...)
+	return o
+}
+
+func isPathParameter(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// checkRequest checks a request's parameters and body against an
+// operation.  The body is read and replaced so the handler can read it too.
+func (v *ContractValidator) checkRequest(r *http.Request, operation map[string]interface{}, params map[string]string) error {
+	parameters, _ := operation["parameters"].([]interface{})
+	for _, parameter := range parameters {
+		parameter, ok := v.resolve(parameter).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := parameter["name"].(string)
+		in, _ := parameter["in"].(string)
+		var values []string
+		switch in {
+		case "path":
+			if value, ok := params[name]; ok {
+				values = []string{value}
+			}
+		case "query":
+			values = r.URL.Query()[name]
+		case "header":
+			values = r.Header.Values(name)
+		case "cookie":
+			if cookie, err := r.Cookie(name); nil == err {
+				values = []string{cookie.Value}
+			}
+		}
+		if 0 == len(values) {
+			if required, _ := parameter["required"].(bool); required {
+				return fmt.Errorf("%s parameter %s is required", in, name)
+			}
+			continue
+		}
+		schema, _ := v.resolve(parameter["schema"]).(map[string]interface{})
+		if "array" == schema["type"] {
+			schema, _ = v.resolve(schema["items"]).(map[string]interface{})
+		} else {
+			values = values[:1]
+		}
+		for _, value := range values {
+			if err := checkParameter(schema, value); nil != err {
+				return fmt.Errorf("%s parameter %s %s", in, name, err)
+			}
+		}
+	}
+	body, _ := v.resolve(operation["requestBody"]).(map[string]interface{})
+	if nil == body {
+		return nil
+	}
+	p, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(p))
+	if nil != err {
+		return err
+	}
+	if 0 == len(p) {
+		if required, _ := body["required"].(bool); required {
+			return fmt.Errorf("body is required")
+		}
+		return nil
+	}
+	content, _ := body["content"].(map[string]interface{})
+	return v.checkContent("body", content, r.Header.Get("Content-Type"), p)
+}
+
+// checkResponse checks a buffered response's status and body against an
+// operation.
+func (v *ContractValidator) checkResponse(b *responseBuffer, operation map[string]interface{}) error {
+	code := b.StatusCode
+	if !b.WroteHeader {
+		code = http.StatusOK
+	}
+	responses, _ := operation["responses"].(map[string]interface{})
+	response, ok := responses[strconv.Itoa(code)]
+	if !ok {
+		response, ok = responses[strconv.Itoa(code/100)+"XX"]
+	}
+	if !ok {
+		response, ok = responses["default"]
+	}
+	if !ok {
+		return fmt.Errorf("status %d is not described", code)
+	}
+	content, _ := v.resolve(response).(map[string]interface{})["content"].(map[string]interface{})
+	if 0 == b.Body.Len() || 0 == len(content) {
+		return nil
+	}
+	return v.checkContent("body", content, b.Header().Get("Content-Type"), b.Body.Bytes())
+}
+
+// checkContent checks a body against the schema of its media type.  Only
+// JSON bodies are checked against schemas.
+func (v *ContractValidator) checkContent(what string, content map[string]interface{}, contentType string, p []byte) error {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	mt, ok := content[mediaType].(map[string]interface{})
+	if !ok {
+		mt, ok = content[strings.SplitN(mediaType, "/", 2)[0]+"/*"].(map[string]interface{})
+	}
+	if !ok {
+		mt, ok = content["*/*"].(map[string]interface{})
+	}
+	if !ok {
+		return fmt.Errorf("%s content type %q is not described", what, contentType)
+	}
+	if "application/json" != mediaType && !strings.HasSuffix(mediaType, "+json") {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(p))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); nil != err {
+		return fmt.Errorf("%s isn't JSON: %s", what, err)
+	}
+	if schema, ok := v.resolve(mt["schema"]).(map[string]interface{}); ok {
+		return v.checkValue(schema, value, what)
+	}
+	return nil
+}
+
+// checkValue checks a value decoded from JSON against a Schema Object.
+func (v *ContractValidator) checkValue(schema map[string]interface{}, value interface{}, where string) error {
+	if nil == value {
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			return nil
+		}
+		if t := schema["type"]; nil == t || "array" == t || "object" == t {
+			return nil
+		}
+		return fmt.Errorf("%s is null", where)
+	}
+	if enum, ok := schema["enum"]; ok {
+		found := false
+		for _, e := range contractStrings(enum) {
+			if e == fmt.Sprint(value) {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s %v is not one of %s", where, value, strings.Join(contractStrings(enum), ", "))
+		}
+	}
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not an object", where)
+		}
+		for _, name := range contractStrings(schema["required"]) {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s.%s is required", where, name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := v.resolve(properties[name]).(map[string]interface{})
+			if !ok {
+				if false == schema["additionalProperties"] {
+					return fmt.Errorf("%s.%s is not described", where, name)
+				}
+				property, ok = v.resolve(schema["additionalProperties"]).(map[string]interface{})
+			}
+			if !ok || (nil == object[name] && !contractContains(schema["required"], name)) {
+				continue
+			}
+			if err := v.checkValue(property, object[name], where+"."+name); nil != err {
+				return err
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not an array", where)
+		}
+		items, _ := v.resolve(schema["items"]).(map[string]interface{})
+		for i, item := range array {
+			if nil == items {
+				break
+			}
+			if err := v.checkValue(items, item, fmt.Sprintf("%s[%d]", where, i)); nil != err {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s is not a string", where)
+		}
+	case "integer":
+		if n, ok := value.(json.Number); !ok || strings.ContainsAny(n.String(), ".eE") {
+			return fmt.Errorf("%s is not an integer", where)
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return fmt.Errorf("%s is not a number", where)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s is not a boolean", where)
+		}
+	}
+	return nil
+}
+
+// checkParameter checks a parameter's value against a Schema Object.
+func checkParameter(schema map[string]interface{}, value string) error {
+	var err error
+	switch schema["type"] {
+	case "integer":
+		_, err = strconv.ParseInt(value, 10, 64)
+	case "number":
+		_, err = strconv.ParseFloat(value, 64)
+	case "boolean":
+		_, err = strconv.ParseBool(value)
+	}
+	if nil != err {
+		return fmt.Errorf("%q is not %s", value, schema["type"])
+	}
+	if enum, ok := schema["enum"]; ok && !contractContains(enum, value) {
+		return fmt.Errorf("%q is not one of %s", value, strings.Join(contractStrings(enum), ", "))
+	}
+	return nil
+}
+
+// resolve follows a Reference Object within the document.
+func (v *ContractValidator) resolve(value interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		ref, ok := object["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#/") {
+			return value
+		}
+		value = interface{}(v.document)
+		for _, name := range strings.Split(ref[2:], "/") {
+			name = strings.Replace(strings.Replace(name, "~1", "/", -1), "~0", "~", -1)
+			object, _ := value.(map[string]interface{})
+			value = object[name]
+		}
+	}
+	return nil
+}
+
+// contractStrings returns the strings in a list from a document, which may
+// be a []string if the document came from OpenAPI or a []interface{} if it
+// was decoded from JSON.
+func contractStrings(value interface{}) []string {
+	switch list := value.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		s := make([]string, len(list))
+		for i, v := range list {
+			s[i] = fmt.Sprint(v)
+		}
+		return s
+	}
+	return nil
+}
+
+func contractContains(list interface{}, s string) bool {
+	for _, v := range contractStrings(list) {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package marshaler
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func testContractDocument() map[string]interface{} {
+	doc := NewOpenAPI("Widgets", "1.0.0")
+	doc.Register("", "/widgets/{id}", Methods{
+		"GET": Handler(func(u *url.URL, h http.Header) (int, http.Header, *testOpenAPIWidget, error) {
+			return http.StatusOK, nil, &testOpenAPIWidget{ID: 1}, nil
+		}),
+		"PUT": Handler(func(u *url.URL, h http.Header, rq *testOpenAPIWidget) (int, http.Header, *testOpenAPIWidget, error) {
+			return http.StatusOK, nil, rq, nil
+		}),
+	})
+
+	// Round-trip through JSON as a published document would be.
+	p, _ := json.Marshal(doc.Document())
+	var document map[string]interface{}
+	json.Unmarshal(p, &document)
+	return document
+}
+
+func TestContractValidated(t *testing.T) {
+	v := ContractValidated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if "PUT" == r.Method {
+			var buf bytes.Buffer
+			buf.ReadFrom(r.Body)
+			w.Write(buf.Bytes())
+			return
+		}
+		w.Write([]byte(`{"id":1,"children":null}`))
+	}), testContractDocument())
+	var violations []string
+	v.OnViolation = func(r *http.Request, violation *ContractViolation) {
+		violations = append(violations, violation.Error())
+	}
+	v.RejectRequests = true
+	for _, c := range []struct {
+		method, url, body string
+		code              int
+		violations        []string
+	}{
+		{"GET", "/widgets/1", "", 200, nil},
+		{"PUT", "/widgets/1", `{"id":2,"children":[{"id":3,"children":[]}]}`, 200, nil},
+		{"PUT", "/widgets/1", `{"id":"2","children":[]}`, 400, []string{"request body.id is not an integer"}},
+		{"PUT", "/widgets/1", `{"id":2,"children":[{"name":"x"}]}`, 400, []string{"request body.children[0].children is required"}},
+		{"PUT", "/widgets/1", "", 400, []string{"request body is required"}},
+		{"DELETE", "/widgets/1", "", 400, []string{"request DELETE /widgets/1 is not described"}},
+		{"GET", "/gadgets/1", "", 400, []string{"request GET /gadgets/1 is not described"}},
+	} {
+		violations = nil
+		r, _ := http.NewRequest(c.method, "http://example.com"+c.url, strings.NewReader(c.body))
+		r.Header.Set("Content-Type", "application/json")
+		w := &testResponseWriter{}
+		v.ServeHTTP(w, r)
+		if c.code != w.StatusCode || len(c.violations) != len(violations) {
+			t.Fatal(c, w.StatusCode, violations)
+		}
+		for i := range violations {
+			if c.violations[i] != violations[i] {
+				t.Fatal(c, violations)
+			}
+		}
+	}
+}
+
+func TestContractValidatedResponse(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logged(ContractValidated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":1.5,"children":[]}`))
+	}), testContractDocument()), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	r, _ := http.NewRequest("GET", "http://example.com/widgets/1", nil)
+	w := &testResponseWriter{}
+	l.ServeHTTP(w, r)
+	if `{"id":1.5,"children":[]}` != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+	if !strings.Contains(buf.String(), "foo contract violation: response body.id is not an integer") {
+		t.Fatal(buf.String())
+	}
+
+	v := ContractValidated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}), map[string]interface{}{"paths": map[string]interface{}{
+		"/teapot": map[string]interface{}{"get": map[string]interface{}{
+			"responses": map[string]interface{}{"200": map[string]interface{}{}},
+		}},
+	}})
+	v.RejectResponses = true
+	r, _ = http.NewRequest("GET", "http://example.com/teapot", nil)
+	w = &testResponseWriter{}
+	v.ServeHTTP(w, r)
+	if http.StatusInternalServerError != w.StatusCode || !strings.Contains(w.Body.String(), "response status 418 is not described") {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+}
@@ -0,0 +1,21 @@
+package marshaler
+
+import "net/http"
+
+// A CookieSetter is a response type that sets cookies.  The Marshaler adds
+// a Set-Cookie header for each of its cookies, so handler functions never
+// need the http.ResponseWriter to set them.
+type CookieSetter interface {
+	Cookies() []*http.Cookie
+}
+
+// SetCookies adds a Set-Cookie header to the given header for each valid
+// cookie, for handler functions that would rather return cookies in their
+// response headers than from their response type.
+func SetCookies(header http.Header, cookies ...*http.Cookie) {
+	for _, cookie := range cookies {
+		if value := cookie.String(); "" != value {
+			header.Add("Set-Cookie", value)
+		}
+	}
+}
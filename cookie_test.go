@@ -0,0 +1,56 @@
+package marshaler
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+type testCookieRequest struct {
+	Session string `cookie:"session,required"`
+}
+
+type testCookieResponse struct {
+	Foo string `json:"foo"`
+}
+
+func (rs *testCookieResponse) Cookies() []*http.Cookie {
+	return []*http.Cookie{{Name: "session", Value: rs.Foo, Path: "/", HttpOnly: true}}
+}
+
+func TestCookie(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	Handler(func(u *url.URL, h http.Header, rq *testCookieRequest) (int, http.Header, *testCookieResponse, error) {
+		return http.StatusOK, nil, &testCookieResponse{rq.Session + "def"}, nil
+	}).ServeHTTP(w, r)
+	if http.StatusOK != w.StatusCode {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+	if "session=abcdef; Path=/; HttpOnly" != w.Header().Get("Set-Cookie") {
+		t.Fatal(w.Header())
+	}
+}
+
+func TestCookieRequired(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	Handler(func(u *url.URL, h http.Header, rq *testCookieRequest) (int, http.Header, *testCookieResponse, error) {
+		return http.StatusOK, nil, &testCookieResponse{rq.Session}, nil
+	}).ServeHTTP(w, r)
+	if http.StatusBadRequest != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if "" != w.Header().Get("Set-Cookie") {
+		t.Fatal(w.Header())
+	}
+}
+
+func TestSetCookies(t *testing.T) {
+	header := make(http.Header)
+	SetCookies(header, &http.Cookie{Name: "a", Value: "1"}, &http.Cookie{Name: "", Value: "2"}, &http.Cookie{Name: "b", Value: "2"})
+	if 2 != len(header["Set-Cookie"]) || "a=1" != header["Set-Cookie"][0] || "b=2" != header["Set-Cookie"][1] {
+		t.Fatal(header)
+	}
+}
@@ -0,0 +1,172 @@
+package marshaler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// decodeOptions control the normalization of a request body into the form
+// encoding/json expects before it is decoded, mirroring the encodeOptions
+// applied to responses.  Bodies are only normalized when the options
+// require it.
+type decodeOptions struct {
+	timeFormat     string
+	humanDurations bool
+	bigNumbers     bool
+}
+
+func (o *decodeOptions) normalizing() bool {
+	return "" != o.timeFormat || o.humanDurations || o.bigNumbers
+}
+
+// decode decodes JSON into v after normalizing it.
+func (o *decodeOptions) decode(r io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var tree interface{}
+	if err := decoder.Decode(&tree); nil != err {
+		return err
+	}
+	tree, err := o.normalize(tree, reflect.TypeOf(v))
+	if nil != err {
+		return err
+	}
+	b, err := json.Marshal(tree)
+	if nil != err {
+		return err
+	}
+	return json.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+// normalize walks a decoded JSON tree alongside the type it will be decoded
+// into, rewriting the values destined for types the options affect.
+func (o *decodeOptions) normalize(v interface{}, t reflect.Type) (interface{}, error) {
+	for reflect.Ptr == t.Kind() {
+		t = t.Elem()
+	}
+	if nil == v {
+		return v, nil
+	}
+	switch {
+	case timeType == t:
+		if "" == o.timeFormat {
+			return v, nil
+		}
+		tm, err := parseTime(v, o.timeFormat)
+		if nil != err {
+			return nil, err
+		}
+		return tm.Format(time.RFC3339Nano), nil
+	case durationType == t && o.humanDurations:
+		if s, ok := v.(string); ok {
+			d, err := time.ParseDuration(s)
+			if nil != err {
+				return nil, err
+			}
+			return int64(d), nil
+		}
+		return v, nil
+	case o.bigNumbers && isBigNumber(t):
+		if s, ok := v.(string); ok {
+			return json.Number(s), nil
+		}
+		return v, nil
+	case reflect.PtrTo(t).Implements(jsonUnmarshalerType):
+		return v, nil
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int64:
+		if s, ok := v.(string); ok && o.bigNumbers {
+			if _, err := strconv.ParseInt(s, 10, 64); nil != err {
+				return nil, err
+			}
+			return json.Number(s), nil
+		}
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		if s, ok := v.(string); ok && o.bigNumbers {
+			if _, err := strconv.ParseUint(s, 10, 64); nil != err {
+				return nil, err
+			}
+			return json.Number(s), nil
+		}
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return v, nil
+		}
+		fields := make(map[string]reflect.Type)
+		jsonFieldTypes(t, fields)
+		for key, value := range obj {
+			ft, ok := fields[key]
+			if !ok {
+				ft, ok = fields[strings.ToLower(key)]
+			}
+			if !ok {
+				continue
+			}
+			value, err := o.normalize(value, ft)
+			if nil != err {
+				return nil, fmt.Errorf("%s: %s", key, err)
+			}
+			obj[key] = value
+		}
+	case reflect.Map:
+		if obj, ok := v.(map[string]interface{}); ok {
+			for key, value := range obj {
+				value, err := o.normalize(value, t.Elem())
+				if nil != err {
+					return nil, fmt.Errorf("%s: %s", key, err)
+				}
+				obj[key] = value
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if s, ok := v.([]interface{}); ok {
+			for i, value := range s {
+				value, err := o.normalize(value, t.Elem())
+				if nil != err {
+					return nil, fmt.Errorf("%d: %s", i, err)
+				}
+				s[i] = value
+			}
+		}
+	}
+	return v, nil
+}
+
+// jsonFieldTypes maps the JSON names of a struct's fields, and their
+// lowercase forms for encoding/json's case-insensitive matching, to the
+// fields' types.
+func jsonFieldTypes(t reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		ft := f.Type
+		if f.Anonymous && "" == f.Tag.Get("json") {
+			if reflect.Ptr == ft.Kind() {
+				ft = ft.Elem()
+			}
+			if reflect.Struct == ft.Kind() {
+				jsonFieldTypes(ft, fields)
+				continue
+			}
+		}
+		name, _, ok := jsonFieldName(f)
+		if !ok {
+			continue
+		}
+		if _, ok := fields[name]; !ok {
+			fields[name] = f.Type
+		}
+		if _, ok := fields[strings.ToLower(name)]; !ok {
+			fields[strings.ToLower(name)] = f.Type
+		}
+	}
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
@@ -0,0 +1,201 @@
+package marshaler
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var digestAlgorithms = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha":     sha1.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// DefaultDigestMaxBodySize is the MaxBodySize of the DigestVerifiers
+// returned by Digested.
+var DefaultDigestMaxBodySize int64 = 1 << 20
+
+// DigestVerifier is an http.Handler that verifies the Content-Digest,
+// Digest, and Content-MD5 headers of requests against their bodies.  Bodies
+// up to MaxBodySize are read and verified before the handler is called, so
+// it never sees a body that doesn't match, which is answered with 400 Bad
+// Request.  Longer bodies are verified as they're read, with reads ending
+// in an error in place of io.EOF if the body doesn't match and, since the
+// handler it wraps may not have read the whole body, responses buffered and
+// replaced with 400 Bad Request if the remainder doesn't match either.
+// Digests in unsupported algorithms are ignored.  Requests with a
+// Want-Content-Digest header are answered with a Content-Digest header.
+//
+// DigestVerifier should wrap Compressed rather than the other way around,
+// so that digests are verified against bodies as they were sent.
+type DigestVerifier struct {
+	MaxBodySize int64
+	handler     http.Handler
+}
+
+// Digested returns an http.Handler that verifies request digests before
+// trusting the given handler's response.
+func Digested(handler http.Handler) *DigestVerifier {
+	return &DigestVerifier{
+		MaxBodySize: DefaultDigestMaxBodySize,
+		handler:     handler,
+	}
+}
+
+func (v *DigestVerifier) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	digests, err := requestDigests(r.Header)
+	if nil != err {
+		writeError(w, r, BadRequest{err})
+		return
+	}
+	wantDigest := "" != r.Header.Get("Want-Content-Digest")
+	if 0 == len(digests) && !wantDigest {
+		v.handler.ServeHTTP(w, r)
+		return
+	}
+	var mismatch error
+	streamed := false
+	if 0 < len(digests) {
+		hashes := make(map[string]hash.Hash)
+		for _, d := range digests {
+			hashes[d.algorithm] = digestAlgorithms[d.algorithm]()
+		}
+		verify := func() error {
+			for _, d := range digests {
+				if !bytes.Equal(d.sum, hashes[d.algorithm].Sum(nil)) {
+					mismatch = BadRequest{errors.New(Message(
+						r,
+						"%s header doesn't match the request body",
+						d.header,
+					))}
+					return mismatch
+				}
+			}
+			return nil
+		}
+		var body []byte
+		if nil != r.Body && http.NoBody != r.Body {
+			if body, err = io.ReadAll(io.LimitReader(r.Body, v.MaxBodySize+1)); nil != err {
+				writeError(w, r, BadRequest{err})
+				return
+			}
+		}
+		for _, h := range hashes {
+			h.Write(body)
+		}
+		if v.MaxBodySize >= int64(len(body)) {
+			if err := verify(); nil != err {
+				writeError(w, r, err)
+				return
+			}
+			if nil != r.Body {
+				r.Body = readCloser{bytes.NewReader(body), r.Body}
+			}
+		} else {
+			streamed = true
+			rest := &teeReadCloser{
+				ReadCloser: r.Body,
+				onRead: func(p []byte) {
+					for _, h := range hashes {
+						h.Write(p)
+					}
+				},
+				onEOF: verify,
+			}
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(body), rest), rest}
+		}
+	}
+	if !streamed && !wantDigest {
+		v.handler.ServeHTTP(w, r)
+		return
+	}
+	b := newResponseBuffer()
+	v.handler.ServeHTTP(b, r)
+	if streamed {
+		io.Copy(io.Discard, r.Body)
+	}
+	if nil != mismatch {
+		writeError(w, r, mismatch)
+		return
+	}
+	if wantDigest {
+		SetContentDigest(b.Header(), b.Body.Bytes())
+	}
+	b.WriteTo(w)
+}
+
+// SetContentDigest sets the Content-Digest header to the SHA-256 digest of
+// the given response body, as defined by RFC 9530.
+func SetContentDigest(header http.Header, body []byte) {
+	sum := sha256.Sum256(body)
+	header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+}
+
+type requestDigest struct {
+	header    string
+	algorithm string
+	sum       []byte
+}
+
+// requestDigests parses the digests in supported algorithms from the
+// Content-Digest, Digest, and Content-MD5 headers.
+func requestDigests(header http.Header) ([]requestDigest, error) {
+	var digests []requestDigest
+	add := func(name, algorithm, value string) error {
+		algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+		if _, ok := digestAlgorithms[algorithm]; !ok {
+			return nil
+		}
+		sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if nil != err {
+			return errors.New(name + " header is malformed")
+		}
+		digests = append(digests, requestDigest{name, algorithm, sum})
+		return nil
+	}
+	for _, field := range splitHeader(header, "Content-Digest") {
+		algorithm, value, _ := strings.Cut(field, "=")
+		value = strings.TrimSpace(value)
+		if !strings.HasPrefix(value, ":") || !strings.HasSuffix(value, ":") || len(value) < 2 {
+			return nil, errors.New("Content-Digest header is malformed")
+		}
+		if err := add("Content-Digest", algorithm, value[1:len(value)-1]); nil != err {
+			return nil, err
+		}
+	}
+	for _, field := range splitHeader(header, "Digest") {
+		algorithm, value, _ := strings.Cut(field, "=")
+		if err := add("Digest", algorithm, value); nil != err {
+			return nil, err
+		}
+	}
+	if value := header.Get("Content-MD5"); "" != value {
+		if err := add("Content-MD5", "md5", value); nil != err {
+			return nil, err
+		}
+	}
+	return digests, nil
+}
+
+// splitHeader returns the comma-separated fields of every value of a header.
+func splitHeader(header http.Header, name string) []string {
+	var fields []string
+	for _, value := range header.Values(name) {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); "" != field {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
@@ -0,0 +1,129 @@
+package marshaler
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testDigestBody = `{"foo":"bar"}`
+
+func testDigestRequest(name, value string) *http.Request {
+	r, _ := http.NewRequest("POST", "http://example.com/foo", strings.NewReader(testDigestBody))
+	r.Header.Set("Content-Type", "application/json")
+	if "" != name {
+		r.Header.Set(name, value)
+	}
+	return r
+}
+
+func testDigestHandler() http.Handler {
+	return Digested(Handler(func(u *url.URL, h http.Header, rq *testRequest) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, nil, &testResponse{rq.Foo}, nil
+	}))
+}
+
+func TestDigested(t *testing.T) {
+	sha := sha256.Sum256([]byte(testDigestBody))
+	md := md5.Sum([]byte(testDigestBody))
+	for _, header := range [][2]string{
+		{"", ""},
+		{"Content-Digest", "sha-256=:" + base64.StdEncoding.EncodeToString(sha[:]) + ":"},
+		{"Digest", "SHA-256=" + base64.StdEncoding.EncodeToString(sha[:]) + ", unknown=abc"},
+		{"Content-MD5", base64.StdEncoding.EncodeToString(md[:])},
+	} {
+		w := &testResponseWriter{}
+		testDigestHandler().ServeHTTP(w, testDigestRequest(header[0], header[1]))
+		if http.StatusOK != w.StatusCode {
+			t.Fatal(header, w.StatusCode, w.Body.String())
+		}
+	}
+}
+
+func TestDigestedMismatch(t *testing.T) {
+	sha := sha256.Sum256([]byte("something else"))
+	for _, header := range [][2]string{
+		{"Content-Digest", "sha-256=:" + base64.StdEncoding.EncodeToString(sha[:]) + ":"},
+		{"Content-Digest", "sha-256=nope"},
+		{"Content-MD5", "!!!"},
+	} {
+		w := &testResponseWriter{}
+		testDigestHandler().ServeHTTP(w, testDigestRequest(header[0], header[1]))
+		if http.StatusBadRequest != w.StatusCode {
+			t.Fatal(header, w.StatusCode)
+		}
+	}
+}
+
+func TestDigestedBeforeHandler(t *testing.T) {
+	sha := sha256.Sum256([]byte("something else"))
+	r := testDigestRequest("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sha[:])+":")
+	w := &testResponseWriter{}
+	Digested(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler called with a mismatched body")
+	})).ServeHTTP(w, r)
+	if http.StatusBadRequest != w.StatusCode {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+}
+
+func TestDigestedUnbuffered(t *testing.T) {
+	sha := sha256.Sum256([]byte(testDigestBody))
+	r := testDigestRequest("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sha[:])+":")
+	w := &testResponseWriter{}
+	Digested(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if w != rw {
+			t.Fatal("response buffered")
+		}
+		body, _ := io.ReadAll(r.Body)
+		rw.Write(body)
+	})).ServeHTTP(w, r)
+	if testDigestBody != w.Body.String() {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+}
+
+func TestDigestedUnreadBody(t *testing.T) {
+	sha := sha256.Sum256([]byte("something else"))
+	r := testDigestRequest("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sha[:])+":")
+	w := &testResponseWriter{}
+	v := Digested(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadFull(r.Body, make([]byte, 3))
+		w.Write([]byte("ok"))
+	}))
+	v.MaxBodySize = 4
+	v.ServeHTTP(w, r)
+	if http.StatusBadRequest != w.StatusCode || strings.Contains(w.Body.String(), "ok") {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+}
+
+func TestDigestedLongBody(t *testing.T) {
+	sha := sha256.Sum256([]byte(testDigestBody))
+	v := Digested(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if testDigestBody != string(body) || nil != err {
+			t.Fatal(string(body), err)
+		}
+	}))
+	v.MaxBodySize = 4
+	w := &testResponseWriter{}
+	v.ServeHTTP(w, testDigestRequest("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sha[:])+":"))
+	if http.StatusOK != w.StatusCode {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+}
+
+func TestWantContentDigest(t *testing.T) {
+	w := &testResponseWriter{}
+	testDigestHandler().ServeHTTP(w, testDigestRequest("Want-Content-Digest", "sha-256=1"))
+	sha := sha256.Sum256([]byte(testDigestBody + "\n"))
+	if "sha-256=:"+base64.StdEncoding.EncodeToString(sha[:])+":" != w.Header().Get("Content-Digest") {
+		t.Fatal(w.Header())
+	}
+}
@@ -0,0 +1,303 @@
+package marshaler
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// encodeOptions control the transformation of a response into a tree of
+// values ready for encoding.  The transformation is only performed when a
+// response's type or the options require it, since encoding/json is faster
+// on its own.
+type encodeOptions struct {
+	principal      *Principal
+	maskFields     bool
+	timeFormat     string
+	humanDurations bool
+	bigNumbers     bool
+	transforming   bool
+}
+
+// prepare returns v transformed according to the options, or v itself if no
+// transformation is necessary.
+func (o *encodeOptions) prepare(v interface{}) (interface{}, error) {
+	if nil == v {
+		return v, nil
+	}
+	rv := reflect.ValueOf(v)
+	if !o.transforming && !typeHasRoles(rv.Type()) {
+		return v, nil
+	}
+	return o.transform(rv)
+}
+
+// FieldMask is the value of fields hidden by their roles tags when the
+// Marshaler's MaskRestrictedFields option is set.
+var FieldMask = "********"
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// transform converts a value into an equivalent tree of orderedObjects,
+// slices, maps, and leaf values that encoding/json encodes as it would have
+// encoded the original value, except as modified by the options.
+func (o *encodeOptions) transform(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	t := v.Type()
+	if timeType == t && "" != o.timeFormat {
+		return formatTime(v.Interface().(time.Time), o.timeFormat), nil
+	}
+	if durationType == t && o.humanDurations {
+		return time.Duration(v.Int()).String(), nil
+	}
+	if o.bigNumbers && isBigNumber(t) {
+		if reflect.Ptr == v.Kind() && v.IsNil() {
+			return nil, nil
+		}
+		return quoteBigNumber(v.Interface())
+	}
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		if reflect.Ptr == v.Kind() && v.IsNil() {
+			return nil, nil
+		}
+		return v.Interface(), nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return o.transform(v.Elem())
+	case reflect.Struct:
+		if reflect.PtrTo(t).Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+			p := reflect.New(t)
+			p.Elem().Set(v)
+			return p.Interface(), nil
+		}
+		obj := orderedObject{}
+		if err := o.transformFields(v, &obj); nil != err {
+			return nil, err
+		}
+		return obj, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := json.Marshal(iter.Key().Interface())
+			if nil != err {
+				return nil, err
+			}
+			var name string
+			if err := json.Unmarshal(key, &name); nil != err {
+				name = string(key) // Integer keys encode as numbers.
+			}
+			value, err := o.transform(iter.Value())
+			if nil != err {
+				return nil, err
+			}
+			m[name] = value
+		}
+		return m, nil
+	case reflect.Slice, reflect.Array:
+		if reflect.Slice == v.Kind() && v.IsNil() {
+			return nil, nil
+		}
+		if reflect.Uint8 == t.Elem().Kind() {
+			return v.Interface(), nil
+		}
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			value, err := o.transform(v.Index(i))
+			if nil != err {
+				return nil, err
+			}
+			s[i] = value
+		}
+		return s, nil
+	case reflect.Int, reflect.Int64:
+		if o.bigNumbers {
+			return strconv.FormatInt(v.Int(), 10), nil
+		}
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		if o.bigNumbers {
+			return strconv.FormatUint(v.Uint(), 10), nil
+		}
+	}
+	return v.Interface(), nil
+}
+
+func (o *encodeOptions) transformFields(v reflect.Value, obj *orderedObject) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, omitempty, ok := jsonFieldName(f)
+		if !ok {
+			continue
+		}
+		fv := v.Field(i)
+		if f.Anonymous && "" == f.Tag.Get("json") {
+			if reflect.Ptr == fv.Kind() {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if reflect.Struct == fv.Kind() {
+				if err := o.transformFields(fv, obj); nil != err {
+					return err
+				}
+				continue
+			}
+		}
+		if omitempty && isEmptyValue(fv) {
+			continue
+		}
+		if roles := f.Tag.Get("roles"); "" != roles && !o.principal.HasRole(strings.Split(roles, ",")...) {
+			if o.maskFields {
+				*obj = append(*obj, objectField{name, FieldMask})
+			}
+			continue
+		}
+		if jsonStringOption(f) && quotable(fv.Kind()) {
+			b, err := json.Marshal(fv.Interface())
+			if nil != err {
+				return err
+			}
+			obj.add(name, string(b))
+			continue
+		}
+		value, err := o.transform(fv)
+		if nil != err {
+			return err
+		}
+		obj.add(name, value)
+	}
+	return nil
+}
+
+// jsonStringOption reports whether a field's json tag has the string option,
+// which quotes the JSON encoding of fields with quotable kinds.
+func jsonStringOption(f reflect.StructField) bool {
+	for _, option := range strings.Split(f.Tag.Get("json"), ",")[1:] {
+		if "string" == option {
+			return true
+		}
+	}
+	return false
+}
+
+func quotable(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return 0 == v.Len()
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return 0 == v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return 0 == v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return 0 == v.Float()
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// orderedObject is a JSON object whose fields are encoded in order, like
+// those of the struct it was transformed from.
+type orderedObject []objectField
+
+type objectField struct {
+	Name  string
+	Value interface{}
+}
+
+// add appends a field unless one of the same name was already added, which
+// mirrors encoding/json's preference for shallower fields.
+func (obj *orderedObject) add(name string, value interface{}) {
+	for _, f := range *obj {
+		if f.Name == name {
+			return
+		}
+	}
+	*obj = append(*obj, objectField{name, value})
+}
+
+func (obj orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range obj {
+		if 0 < i {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(f.Name)
+		if nil != err {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		value, err := json.Marshal(f.Value)
+		if nil != err {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+var roleTypes sync.Map // map[reflect.Type]bool
+
+// typeHasRoles reports whether a type contains any struct fields with roles
+// tags, which require the response to be transformed.
+func typeHasRoles(t reflect.Type) bool {
+	if has, ok := roleTypes.Load(t); ok {
+		return has.(bool)
+	}
+	has := walkTypeHasRoles(t, map[reflect.Type]bool{})
+	roleTypes.Store(t, has)
+	return has
+}
+
+func walkTypeHasRoles(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return walkTypeHasRoles(t.Elem(), seen)
+	case reflect.Interface:
+		return true // The dynamic type can't be known in advance.
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if "" != f.Tag.Get("roles") || walkTypeHasRoles(f.Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
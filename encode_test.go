@@ -0,0 +1,104 @@
+package marshaler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type testRolesResponse struct {
+	Name    string             `json:"name"`
+	Email   string             `json:"email,omitempty" roles:"admin,support"`
+	Salary  int                `json:"salary" roles:"admin"`
+	Friends []*testRolesFriend `json:"friends,omitempty"`
+}
+
+type testRolesFriend struct {
+	Name  string `json:"name"`
+	Phone string `json:"phone" roles:"admin"`
+}
+
+func testRoles(t *testing.T, p *Principal, mask bool) string {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	if nil != p {
+		r = r.WithContext(WithPrincipal(r.Context(), p))
+	}
+	m := Handler(func(u *url.URL, h http.Header) (int, http.Header, *testRolesResponse, error) {
+		return http.StatusOK, nil, &testRolesResponse{
+			Name:    "foo",
+			Email:   "foo@example.com",
+			Salary:  100,
+			Friends: []*testRolesFriend{{"bar", "555-1234"}},
+		}, nil
+	})
+	m.MaskRestrictedFields = mask
+	m.ServeHTTP(w, r)
+	return w.Body.String()
+}
+
+func TestRolesAdmin(t *testing.T) {
+	if body := testRoles(t, &Principal{"alice", []string{"admin"}}, false); "{\"name\":\"foo\",\"email\":\"foo@example.com\",\"salary\":100,\"friends\":[{\"name\":\"bar\",\"phone\":\"555-1234\"}]}\n" != body {
+		t.Fatal(body)
+	}
+}
+
+func TestRolesSupport(t *testing.T) {
+	if body := testRoles(t, &Principal{"bob", []string{"support"}}, false); "{\"name\":\"foo\",\"email\":\"foo@example.com\",\"friends\":[{\"name\":\"bar\"}]}\n" != body {
+		t.Fatal(body)
+	}
+}
+
+func TestRolesAnonymousMasked(t *testing.T) {
+	if body := testRoles(t, nil, true); "{\"name\":\"foo\",\"email\":\"********\",\"salary\":\"********\",\"friends\":[{\"name\":\"bar\",\"phone\":\"********\"}]}\n" != body {
+		t.Fatal(body)
+	}
+}
+
+type testTransformEmbedded struct {
+	A int `json:"a"`
+}
+
+type testTransformResponse struct {
+	testTransformEmbedded
+	B string          `json:"b,omitempty"`
+	C int64           `json:"c,string"`
+	D time.Time       `json:"d"`
+	E map[string]int  `json:"e"`
+	F []byte          `json:"f"`
+	G interface{}     `json:"g"`
+	H *int            `json:"h"`
+	I json.RawMessage `json:"i"`
+	J [2]bool         `json:"j"`
+	K map[int]string  `json:"k"`
+	L context.Context `json:"-"`
+	m string
+}
+
+func TestTransformMatchesEncodingJSON(t *testing.T) {
+	v := &testTransformResponse{
+		testTransformEmbedded: testTransformEmbedded{1},
+		C:                     3,
+		D:                     time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC),
+		E:                     map[string]int{"y": 2, "x": 1},
+		F:                     []byte("foo"),
+		G:                     []interface{}{"<b>", 1.5},
+		I:                     json.RawMessage(`{"raw":true}`),
+		K:                     map[int]string{2: "two"},
+	}
+	expected, _ := json.Marshal(v)
+	tree, err := (&encodeOptions{transforming: true}).prepare(v)
+	if nil != err {
+		t.Fatal(err)
+	}
+	actual, err := json.Marshal(tree)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if string(expected) != string(actual) {
+		t.Fatal(string(actual), string(expected))
+	}
+}
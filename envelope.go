@@ -0,0 +1,65 @@
+package marshaler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// EnvelopeMeta returns the meta object of the envelope around a response,
+// or nil to omit it.
+type EnvelopeMeta func(r *http.Request) interface{}
+
+type envelopeKey struct{}
+
+// Enveloped returns an http.Handler that causes the Marshalers beneath it to
+// wrap their successful responses in a standard envelope:
+//
+//	{"data": ..., "meta": {...}, "request_id": "..."}
+//
+// The meta object comes from the given function, which may be nil, and the
+// request_id from Logged, if the request is being logged.  Sparse fieldsets
+// select fields of data rather than of the envelope.
+func Enveloped(handler http.Handler, meta EnvelopeMeta) http.Handler {
+	if nil == meta {
+		meta = func(*http.Request) interface{} { return nil }
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(
+			r.Context(),
+			envelopeKey{},
+			meta,
+		)))
+	})
+}
+
+type envelope struct {
+	Data      interface{} `json:"data"`
+	Meta      interface{} `json:"meta,omitempty"`
+	RequestID RequestID   `json:"request_id,omitempty"`
+}
+
+// envelop wraps a response in an envelope if the request is Enveloped.
+func envelop(r *http.Request, rs interface{}) (interface{}, bool) {
+	meta, ok := r.Context().Value(envelopeKey{}).(EnvelopeMeta)
+	if !ok {
+		return rs, false
+	}
+	return &envelope{
+		Data:      rs,
+		Meta:      meta(r),
+		RequestID: RequestIDFromContext(r.Context()),
+	}, true
+}
+
+// envelopeFields rewrites a sparse fieldset to select fields of the data in
+// an envelope while keeping the rest of the envelope intact.
+func envelopeFields(fields string) string {
+	var enveloped []string
+	for _, field := range strings.Split(fields, ",") {
+		if field = strings.TrimSpace(field); "" != field {
+			enveloped = append(enveloped, "data."+field)
+		}
+	}
+	return strings.Join(append(enveloped, "meta", "request_id"), ",")
+}
@@ -0,0 +1,37 @@
+package marshaler
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestEnveloped(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo?fields=name", nil)
+	l := Logged(Enveloped(Handler(func(u *url.URL, h http.Header) (int, http.Header, *testRolesFriend, error) {
+		return http.StatusOK, nil, &testRolesFriend{Name: "bar", Phone: "555-1234"}, nil
+	}), func(r *http.Request) interface{} {
+		return map[string]string{"version": "1"}
+	}), nil)
+	l.Logger = log.New(&bytes.Buffer{}, "", 0)
+	l.RequestIDCreator = func(*http.Request) RequestID { return "0123456789abcdef" }
+	l.ServeHTTP(w, r)
+	if "{\"data\":{\"name\":\"bar\"},\"meta\":{\"version\":\"1\"},\"request_id\":\"0123456789abcdef\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestEnvelopedError(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	Enveloped(Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		return 0, nil, nil, NotFound{NewMarshalerError("foo")}
+	}), nil).ServeHTTP(w, r)
+	if !strings.HasPrefix(w.Body.String(), "{\"description\":\"foo\"") {
+		t.Fatal(w.Body.String())
+	}
+}
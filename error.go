@@ -51,7 +51,7 @@ func errorStatusCode(err error) int {
 }
 
 func writeJSONError(w http.ResponseWriter, err error) {
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(errorStatusCode(err))
 	if jsonErr := json.NewEncoder(w).Encode(map[string]string{
 		"description": err.Error(),
@@ -66,3 +66,13 @@ func writePlaintextError(w http.ResponseWriter, err error) {
 	w.WriteHeader(errorStatusCode(err))
 	fmt.Fprintf(w, "%s: %s", errorName(err, "error"), err)
 }
+
+// writeError writes err as JSON to clients that accept it and as plain text
+// to all others.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	if acceptJSON(r) {
+		writeJSONError(w, err)
+	} else {
+		writePlaintextError(w, err)
+	}
+}
@@ -0,0 +1,48 @@
+package marshaler
+
+import (
+	"log"
+	"net/http"
+)
+
+// An ErrorMapper translates an error returned by a handler function into the
+// status code and body of the response, so that domain errors like
+// sql.ErrNoRows can be mapped to HTTP responses in one place.  Returning a
+// status of zero leaves the error to be handled as usual and returning a nil
+// body sends the usual error body with the mapped status.
+type ErrorMapper func(err error) (status int, body interface{})
+
+// DefaultErrorMapper, if not nil, maps the errors of every Marshaler that
+// doesn't have an ErrorMapper of its own.
+var DefaultErrorMapper ErrorMapper
+
+// mapError writes the response an ErrorMapper chose for err and reports
+// whether it did so.
+func (m *Marshaler) mapError(w http.ResponseWriter, err error) bool {
+	mapper := m.ErrorMapper
+	if nil == mapper {
+		mapper = DefaultErrorMapper
+	}
+	if nil == mapper {
+		return false
+	}
+	code, body := mapper(err)
+	if 0 == code {
+		return false
+	}
+	if nil == body {
+		writeJSONError(w, NewHTTPEquivError(err, code))
+		return true
+	}
+	b := getEncodeBuffer()
+	defer putEncodeBuffer(b)
+	if encodeErr := b.encoder.Encode(body); nil != encodeErr {
+		log.Println(encodeErr)
+		writeJSONError(w, encodeErr)
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write(b.Bytes())
+	return true
+}
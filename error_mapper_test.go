@@ -0,0 +1,59 @@
+package marshaler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+var errTestNoRows = errors.New("no rows in result set")
+
+func testErrorMapper(err error) (int, interface{}) {
+	if errTestNoRows == err {
+		return http.StatusNotFound, map[string]string{"message": "not here"}
+	}
+	return 0, nil
+}
+
+func TestErrorMapper(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	m := Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		return 0, nil, nil, errTestNoRows
+	})
+	m.ErrorMapper = testErrorMapper
+	m.ServeHTTP(w, r)
+	if http.StatusNotFound != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if "{\"message\":\"not here\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestDefaultErrorMapperUnmapped(t *testing.T) {
+	DefaultErrorMapper = testErrorMapper
+	defer func() { DefaultErrorMapper = nil }()
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		return 0, nil, nil, errors.New("foo")
+	}).ServeHTTP(w, r)
+	if http.StatusInternalServerError != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
+
+func TestErrorMapperNilBody(t *testing.T) {
+	DefaultErrorMapper = func(err error) (int, interface{}) { return http.StatusConflict, nil }
+	defer func() { DefaultErrorMapper = nil }()
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		return 0, nil, nil, errors.New("foo")
+	}).ServeHTTP(w, r)
+	if http.StatusConflict != w.StatusCode || "{\"description\":\"foo\",\"error\":\"error\"}\n" != w.Body.String() {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+}
@@ -0,0 +1,43 @@
+package marshaler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// ETag returns a strong entity tag computed over the given encoded response
+// body.  The Marshaler uses it to tag the 200 responses it writes to GET
+// requests whose handlers didn't supply an ETag header of their own.
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "\"" + hex.EncodeToString(sum[:16]) + "\""
+}
+
+// etagMatch reports whether the If-None-Match header value ifNoneMatch
+// matches the given entity tag using the weak comparison function from
+// RFC 7232, section 2.3.2.
+func etagMatch(ifNoneMatch, etag string) bool {
+	if "" == ifNoneMatch || "" == etag {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if "*" == candidate || etag == strings.TrimPrefix(candidate, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified reports whether the request's If-None-Match header matches the
+// response's ETag header, in which case a 304 should be sent instead of the
+// response body.
+func notModified(r *http.Request, header http.Header) bool {
+	if "GET" != r.Method && "HEAD" != r.Method {
+		return false
+	}
+	return etagMatch(r.Header.Get("If-None-Match"), header.Get("ETag"))
+}
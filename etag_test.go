@@ -0,0 +1,51 @@
+package marshaler
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestETag(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Accept", "application/json")
+	Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, nil, &testResponse{"bar"}, nil
+	}).ServeHTTP(w, r)
+	if http.StatusOK != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if ETag([]byte("{\"foo\":\"bar\"}\n")) != w.Header().Get("ETag") {
+		t.Fatal(w.Header().Get("ETag"))
+	}
+}
+
+func TestETagNotModified(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Accept", "application/json")
+	r.Header.Set("If-None-Match", "\"baz\", "+ETag([]byte("{\"foo\":\"bar\"}\n")))
+	Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, nil, &testResponse{"bar"}, nil
+	}).ServeHTTP(w, r)
+	if http.StatusNotModified != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if "" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestETagFromHandler(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Accept", "application/json")
+	r.Header.Set("If-None-Match", "W/\"v1\"")
+	Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, http.Header{"Etag": {"\"v1\""}}, &testResponse{"bar"}, nil
+	}).ServeHTTP(w, r)
+	if http.StatusNotModified != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
@@ -0,0 +1,90 @@
+package marshaler
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// A LogEvent is what EventLogged knows about a request once it's been
+// served.  Its headers are copies, with any basic auth password redacted,
+// that receivers may keep, and its Labels are the EventLogger's, which
+// receivers mustn't modify.
+type LogEvent struct {
+	Labels         map[string]string
+	RequestID      RequestID
+	ConnectionID   ConnectionID
+	Start          time.Time
+	Duration       time.Duration
+	RemoteAddr     string
+	Method         string
+	URL            string
+	Proto          string
+	RequestHeader  http.Header
+	Route          string
+	Status         int
+	ResponseHeader http.Header
+	Size           int64
+}
+
+// EventLogger is an http.Handler that sends a LogEvent on a channel for
+// each request to the handler it wraps.  Labels, like those of a
+// MultilineLogger, are given to every LogEvent.
+type EventLogger struct {
+	dropped int64
+	Labels  map[string]string
+	events  chan<- LogEvent
+	handler http.Handler
+}
+
+// EventLogged returns an http.Handler that sends a LogEvent about each
+// request to the given handler on events once it's been served, so that
+// applications can build live dashboards, debugging views, or sinks of
+// their own without parsing log lines.  Sends never block: events that
+// don't fit in the channel's buffer are dropped and counted instead, so
+// the channel should be buffered and drained promptly.  Requests inside
+// Logged keep the RequestID it gave them.
+func EventLogged(handler http.Handler, events chan<- LogEvent) *EventLogger {
+	return &EventLogger{events: events, handler: handler}
+}
+
+// Dropped returns how many events have been dropped because the channel
+// was full.
+func (l *EventLogger) Dropped() int64 {
+	return atomic.LoadInt64(&l.dropped)
+}
+
+func (l *EventLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	requestHeader := r.Header.Clone()
+	if value := requestHeader.Get("Authorization"); "" != value {
+		requestHeader.Set("Authorization", redactBasicAuth(value))
+	}
+	w, record := recordResponse(w)
+	record.KeepHeader = true
+	l.handler.ServeHTTP(w, r)
+	e := LogEvent{
+		Labels:         l.Labels,
+		RequestID:      RequestIDFromContext(r.Context()),
+		ConnectionID:   ConnectionIDFromContext(r.Context()),
+		Start:          start,
+		Duration:       time.Since(start),
+		RemoteAddr:     r.RemoteAddr,
+		Method:         r.Method,
+		URL:            r.URL.RequestURI(),
+		Proto:          r.Proto,
+		RequestHeader:  requestHeader,
+		Route:          record.Route,
+		Status:         http.StatusOK,
+		ResponseHeader: w.Header().Clone(),
+		Size:           record.Size,
+	}
+	if record.WroteHeader {
+		e.Status, e.ResponseHeader = record.StatusCode, record.SentHeader.Clone()
+	}
+	select {
+	case l.events <- e:
+	default:
+		atomic.AddInt64(&l.dropped, 1)
+	}
+}
@@ -0,0 +1,50 @@
+package marshaler
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEventLogged(t *testing.T) {
+	events := make(chan LogEvent, 1)
+	l := EventLogged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "created")
+	}), events)
+	l.Labels = map[string]string{"pod": "a"}
+	r := httptest.NewRequest("POST", "/foo?bar=baz", nil)
+	r.SetBasicAuth("user", "secret")
+	l.ServeHTTP(httptest.NewRecorder(), r)
+	l.ServeHTTP(httptest.NewRecorder(), r)
+	if 1 != l.Dropped() {
+		t.Fatal(l.Dropped())
+	}
+	e := <-events
+	if "POST" != e.Method || "/foo?bar=baz" != e.URL || http.StatusCreated != e.Status || 7 != e.Size {
+		t.Fatalf("%+v", e)
+	}
+	if "a" != e.Labels["pod"] {
+		t.Fatalf("%+v", e)
+	}
+	if "text/plain" != e.ResponseHeader.Get("Content-Type") || "Basic user:[redacted]" != e.RequestHeader.Get("Authorization") {
+		t.Fatalf("%+v", e)
+	}
+	if "" == r.Header.Get("Authorization") || "Basic user:[redacted]" == r.Header.Get("Authorization") {
+		t.Fatal(r.Header)
+	}
+}
+
+func TestEventLoggedInsideLogged(t *testing.T) {
+	events := make(chan LogEvent, 1)
+	l := Logged(EventLogged(http.NotFoundHandler(), events), nil)
+	l.Logger = log.New(io.Discard, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	l.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if e := <-events; "foo" != e.RequestID || http.StatusNotFound != e.Status {
+		t.Fatalf("%+v", e)
+	}
+}
@@ -0,0 +1,238 @@
+package marshaler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MaxExampleBodySize bounds the bytes of each request and response body an
+// ExampleRecorder keeps.
+var MaxExampleBodySize = 4 << 10
+
+// Example is a request and response pair captured by an ExampleRecorder.
+type Example struct {
+	Method, RequestURI, Proto string
+	RequestHeader             http.Header
+	RequestBody               string
+	StatusCode                int
+	ResponseHeader            http.Header
+	ResponseBody              string
+}
+
+// ExampleRecorder captures real traffic as examples for documentation.  Each
+// route keeps the first few exchanges per method, passed through a Redactor
+// so that secrets don't end up in the docs.  Credentials in Authorization
+// headers and the values of Cookie and Set-Cookie headers are always
+// redacted, with or without one.
+type ExampleRecorder struct {
+	mu       sync.Mutex
+	examples map[string][]*Example
+	max      int
+	redactor Redactor
+}
+
+// NewExampleRecorder returns an ExampleRecorder that keeps up to max
+// examples per route and method, redacted by the given Redactor, which may
+// be nil.
+func NewExampleRecorder(redactor Redactor, max int) *ExampleRecorder {
+	return &ExampleRecorder{
+		examples: make(map[string][]*Example),
+		max:      max,
+		redactor: redactor,
+	}
+}
+
+// Record returns an http.Handler that records examples of the given
+// handler's exchanges under the given route, which should be the path as it
+// was registered with OpenAPI, like /widgets/{id}.
+func (e *ExampleRecorder) Record(route string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Method + " " + route
+		if e.full(key) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		requestBody := &limitedBuffer{max: MaxExampleBodySize}
+		if nil != r.Body {
+			r.Body = &teeReadCloser{
+				ReadCloser: r.Body,
+				onRead:     func(p []byte) { requestBody.Write(p) },
+			}
+		}
+		ew := &exampleResponseWriter{
+			ResponseWriter: w,
+			body:           limitedBuffer{max: MaxExampleBodySize},
+		}
+		handler.ServeHTTP(ew, r)
+		if !ew.wroteHeader {
+			ew.code = http.StatusOK
+		}
+		e.add(key, &Example{
+			Method:         r.Method,
+			RequestURI:     e.redact(r.URL.RequestURI()),
+			Proto:          r.Proto,
+			RequestHeader:  e.redactHeader(r.Header),
+			RequestBody:    e.redact(requestBody.String()),
+			StatusCode:     ew.code,
+			ResponseHeader: e.redactHeader(w.Header()),
+			ResponseBody:   e.redact(ew.body.String()),
+		})
+	})
+}
+
+// Examples returns the examples recorded for a method and route.
+func (e *ExampleRecorder) Examples(method, route string) []*Example {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Example(nil), e.examples[method+" "+route]...)
+}
+
+// Markdown writes every recorded example as a Markdown section containing
+// the raw HTTP request and response.
+func (e *ExampleRecorder) Markdown(w io.Writer) error {
+	e.mu.Lock()
+	keys := make([]string, 0, len(e.examples))
+	for key := range e.examples {
+		keys = append(keys, key)
+	}
+	e.mu.Unlock()
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for _, key := range keys {
+		fmt.Fprintf(&buf, "## %s\n", key)
+		method, route := splitExampleKey(key)
+		for _, ex := range e.Examples(method, route) {
+			fmt.Fprintf(&buf, "\n```http\n%s %s %s\n", ex.Method, ex.RequestURI, ex.Proto)
+			writeSortedHeader(&buf, ex.RequestHeader)
+			if "" != ex.RequestBody {
+				fmt.Fprintf(&buf, "\n%s\n", strings.TrimSuffix(ex.RequestBody, "\n"))
+			}
+			fmt.Fprintf(&buf, "```\n\n```http\n%s %d %s\n", ex.Proto, ex.StatusCode, http.StatusText(ex.StatusCode))
+			writeSortedHeader(&buf, ex.ResponseHeader)
+			if "" != ex.ResponseBody {
+				fmt.Fprintf(&buf, "\n%s\n", strings.TrimSuffix(ex.ResponseBody, "\n"))
+			}
+			buf.WriteString("```\n")
+		}
+		buf.WriteString("\n")
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// openAPIExamples returns the request and response bodies recorded for a
+// method and route in the form of OpenAPI Example Objects.
+func (e *ExampleRecorder) openAPIExamples(method, route string) (requests, responses map[string]interface{}) {
+	for i, ex := range e.Examples(method, route) {
+		name := fmt.Sprintf("example%d", i+1)
+		if "" != ex.RequestBody {
+			if nil == requests {
+				requests = map[string]interface{}{}
+			}
+			requests[name] = map[string]interface{}{"value": exampleValue(ex.RequestBody)}
+		}
+		if "" != ex.ResponseBody && http.StatusOK == ex.StatusCode {
+			if nil == responses {
+				responses = map[string]interface{}{}
+			}
+			responses[name] = map[string]interface{}{"value": exampleValue(ex.ResponseBody)}
+		}
+	}
+	return
+}
+
+func (e *ExampleRecorder) full(key string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.examples[key]) >= e.max
+}
+
+func (e *ExampleRecorder) add(key string, ex *Example) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.examples[key]) < e.max {
+		e.examples[key] = append(e.examples[key], ex)
+	}
+}
+
+func (e *ExampleRecorder) redact(s string) string {
+	if nil == e.redactor {
+		return s
+	}
+	return e.redactor(s)
+}
+
+func (e *ExampleRecorder) redactHeader(header http.Header) http.Header {
+	redacted := make(http.Header, len(header))
+	for key, values := range header {
+		for _, value := range values {
+			switch key {
+			case "Authorization":
+				if value = redactBasicAuth(value); !strings.HasPrefix(value, "Basic ") {
+					scheme, _, _ := strings.Cut(value, " ")
+					value = scheme + " [redacted]"
+				}
+			case "Cookie", "Set-Cookie":
+				value = "[redacted]"
+			}
+			redacted[key] = append(redacted[key], e.redact(value))
+		}
+	}
+	return redacted
+}
+
+// exampleValue returns the decoded JSON value of a body, or the body itself
+// if it isn't JSON.
+func exampleValue(body string) interface{} {
+	var v interface{}
+	if err := decodeJSONNumbers([]byte(body), &v); nil != err {
+		return body
+	}
+	return v
+}
+
+func splitExampleKey(key string) (method, route string) {
+	i := strings.Index(key, " ")
+	return key[:i], key[i+1:]
+}
+
+func writeSortedHeader(w io.Writer, header http.Header) {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range header[key] {
+			fmt.Fprintf(w, "%s: %s\n", key, value)
+		}
+	}
+}
+
+type exampleResponseWriter struct {
+	http.ResponseWriter
+	body        limitedBuffer
+	code        int
+	wroteHeader bool
+}
+
+func (w *exampleResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *exampleResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.code = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,78 @@
+package marshaler
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestExampleRecorder(t *testing.T) {
+	e := NewExampleRecorder(func(s string) string {
+		return strings.Replace(s, "secret", "[REDACTED]", -1)
+	}, 1)
+	h := e.Record("/widgets", Handler(func(u *url.URL, h http.Header, rq *testRequest) (int, http.Header, *testResponse, error) {
+		return http.StatusCreated, nil, &testResponse{rq.Foo}, nil
+	}))
+	for _, foo := range []string{"secret", "bar"} {
+		r, _ := http.NewRequest("POST", "http://example.com/widgets", bytes.NewBufferString("{\"foo\":\""+foo+"\"}"))
+		r.Header.Set("Content-Type", "application/json")
+		h.ServeHTTP(&testResponseWriter{}, r)
+	}
+	examples := e.Examples("POST", "/widgets")
+	if 1 != len(examples) {
+		t.Fatal(examples)
+	}
+	if "{\"foo\":\"[REDACTED]\"}" != examples[0].RequestBody || http.StatusCreated != examples[0].StatusCode {
+		t.Fatal(examples[0])
+	}
+	var buf bytes.Buffer
+	e.Markdown(&buf)
+	if !strings.HasPrefix(buf.String(), "## POST /widgets\n\n```http\nPOST /widgets HTTP/1.1\nContent-Type: application/json\n\n{\"foo\":\"[REDACTED]\"}\n```\n\n```http\nHTTP/1.1 201 Created\n") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestExampleRecorderOpenAPI(t *testing.T) {
+	e := NewExampleRecorder(nil, 1)
+	doc := NewOpenAPI("Widgets", "1.0.0")
+	doc.Examples = e
+	h := e.Record("/widgets", doc.Register("GET", "/widgets", Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, nil, &testResponse{"bar"}, nil
+	})))
+	r, _ := http.NewRequest("GET", "http://example.com/widgets", nil)
+	h.ServeHTTP(&testResponseWriter{}, r)
+	content := doc.Document()["paths"].(map[string]interface{})["/widgets"].(map[string]interface{})["get"].(map[string]interface{})["responses"].(map[string]interface{})["200"].(map[string]interface{})["content"].(map[string]interface{})
+	examples := content["application/json"].(map[string]interface{})["examples"].(map[string]interface{})
+	if "bar" != examples["example1"].(map[string]interface{})["value"].(map[string]interface{})["foo"] {
+		t.Fatal(examples)
+	}
+}
+
+func TestExampleRecorderCredentials(t *testing.T) {
+	e := NewExampleRecorder(nil, 2)
+	h := e.Record("/widgets", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+	}))
+	for _, authorization := range []string{"Bearer secret", ""} {
+		r, _ := http.NewRequest("GET", "http://example.com/widgets", nil)
+		if "" == authorization {
+			r.SetBasicAuth("alice", "secret")
+		} else {
+			r.Header.Set("Authorization", authorization)
+		}
+		r.Header.Set("Cookie", "session=secret")
+		h.ServeHTTP(&testResponseWriter{}, r)
+	}
+	var buf bytes.Buffer
+	e.Markdown(&buf)
+	if strings.Contains(buf.String(), "secret") {
+		t.Fatal(buf.String())
+	}
+	for _, line := range []string{"Authorization: Bearer [redacted]\n", "Authorization: Basic alice:[redacted]\n", "Cookie: [redacted]\n", "Set-Cookie: [redacted]\n"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Fatal(buf.String())
+		}
+	}
+}
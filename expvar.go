@@ -0,0 +1,102 @@
+package marshaler
+
+import (
+	"encoding/json"
+	"expvar"
+	"sync"
+	"time"
+)
+
+// ExpvarMetrics is a MetricsSink that publishes per-route counters and
+// latency summaries via expvar, so they're served with the rest of the
+// standard library's /debug/vars.  Wrap each route with both Counted and
+// Timed under the same name to publish both:
+//
+//	metrics := marshaler.NewExpvarMetrics("api")
+//	handler = marshaler.Timed(marshaler.Counted(handler, "users", metrics), "users", metrics)
+type ExpvarMetrics struct {
+	vars *expvar.Map
+	mu   sync.Mutex
+}
+
+// NewExpvarMetrics returns ExpvarMetrics published under the given
+// namespace, reusing the map already published under it, if any.
+func NewExpvarMetrics(namespace string) *ExpvarMetrics {
+	vars, ok := expvar.Get(namespace).(*expvar.Map)
+	if !ok {
+		vars = expvar.NewMap(namespace)
+	}
+	return &ExpvarMetrics{vars: vars}
+}
+
+// Count adds n to the route's request count and to its counts for each
+// label, like class_2xx and method_GET.
+func (m *ExpvarMetrics) Count(name string, n int64, labels map[string]string) {
+	route := m.route(name)
+	route.Add("requests", n)
+	for key, value := range labels {
+		route.Add(key+"_"+value, n)
+	}
+}
+
+// Timing adds d to the route's latency summary.
+func (m *ExpvarMetrics) Timing(name string, d time.Duration, labels map[string]string) {
+	route := m.route(name)
+	m.mu.Lock()
+	summary, ok := route.Get("latency").(*latencySummary)
+	if !ok {
+		summary = &latencySummary{}
+		route.Set("latency", summary)
+	}
+	m.mu.Unlock()
+	summary.observe(d)
+}
+
+func (m *ExpvarMetrics) route(name string) *expvar.Map {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	route, ok := m.vars.Get(name).(*expvar.Map)
+	if !ok {
+		route = new(expvar.Map).Init()
+		m.vars.Set(name, route)
+	}
+	return route
+}
+
+// latencySummary is an expvar.Var summarizing durations in milliseconds.
+type latencySummary struct {
+	mu              sync.Mutex
+	count           int64
+	total, min, max time.Duration
+}
+
+func (s *latencySummary) observe(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if 0 == s.count || d < s.min {
+		s.min = d
+	}
+	if d > s.max {
+		s.max = d
+	}
+	s.count++
+	s.total += d
+}
+
+func (s *latencySummary) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	summary := map[string]interface{}{
+		"count":    s.count,
+		"total_ms": ms(s.total),
+		"min_ms":   ms(s.min),
+		"max_ms":   ms(s.max),
+		"mean_ms":  0.0,
+	}
+	if 0 < s.count {
+		summary["mean_ms"] = ms(s.total) / float64(s.count)
+	}
+	b, _ := json.Marshal(summary)
+	return string(b)
+}
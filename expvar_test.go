@@ -0,0 +1,46 @@
+package marshaler
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// expvarTestRuns numbers each run of TestExpvarMetrics so that each gets a
+// namespace of its own, since expvar never forgets one.
+var expvarTestRuns int
+
+func TestExpvarMetrics(t *testing.T) {
+	expvarTestRuns++
+	namespace := "marshaler_test_" + strconv.Itoa(expvarTestRuns)
+	metrics := NewExpvarMetrics(namespace)
+	h := Timed(Counted(Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, nil, &testResponse{"bar"}, nil
+	}), "foo", metrics), "foo", metrics)
+	for i := 0; i < 2; i++ {
+		r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+		h.ServeHTTP(&testResponseWriter{}, r)
+	}
+	var vars struct {
+		Foo struct {
+			Requests int64 `json:"requests"`
+			Class2xx int64 `json:"class_2xx"`
+			GET      int64 `json:"method_GET"`
+			Latency  struct {
+				Count int64 `json:"count"`
+			} `json:"latency"`
+		} `json:"foo"`
+	}
+	if err := json.Unmarshal([]byte(expvar.Get(namespace).String()), &vars); nil != err {
+		t.Fatal(err)
+	}
+	if 2 != vars.Foo.Requests || 2 != vars.Foo.Class2xx || 2 != vars.Foo.GET || 2 != vars.Foo.Latency.Count {
+		t.Fatal(expvar.Get(namespace).String())
+	}
+	if NewExpvarMetrics(namespace).vars != metrics.vars {
+		t.Fatal("namespace wasn't reused")
+	}
+}
@@ -0,0 +1,93 @@
+package marshaler
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// FieldsParam names the query parameter that limits which fields of a
+// response are encoded, as in ?fields=id,name,owner.email.  Fields of the
+// objects in an array are selected as though the array weren't there, so
+// ?fields=items.id selects the id of each item in a Page.  Setting
+// FieldsParam to the empty string disables sparse fieldsets.
+var FieldsParam = "fields"
+
+// fieldSet is a tree of selected fields.  A nil subtree selects the whole
+// value of its field.
+type fieldSet map[string]fieldSet
+
+func parseFieldSet(fields string) fieldSet {
+	set := fieldSet{}
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if "" == field {
+			continue
+		}
+		node := set
+		names := strings.Split(field, ".")
+		for i, name := range names {
+			sub, ok := node[name]
+			if ok && nil == sub {
+				break // The whole field is already selected.
+			}
+			if i == len(names)-1 {
+				node[name] = nil
+				break
+			}
+			if !ok {
+				sub = fieldSet{}
+				node[name] = sub
+			}
+			node = sub
+		}
+	}
+	return set
+}
+
+// filter returns v, a value decoded from JSON, with only the selected
+// fields of its objects remaining.
+func (set fieldSet) filter(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		filtered := make(map[string]interface{}, len(set))
+		for name, sub := range set {
+			value, ok := v[name]
+			if !ok {
+				continue
+			}
+			if nil == sub {
+				filtered[name] = value
+			} else {
+				filtered[name] = sub.filter(value)
+			}
+		}
+		return filtered
+	case []interface{}:
+		for i, value := range v {
+			v[i] = set.filter(value)
+		}
+		return v
+	}
+	return v
+}
+
+// filterFields re-encodes a JSON body with only the selected fields.
+func filterFields(body []byte, fields string) ([]byte, error) {
+	set := parseFieldSet(fields)
+	if 0 == len(set) {
+		return body, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); nil != err {
+		return nil, err
+	}
+	buf := getEncodeBuffer()
+	defer putEncodeBuffer(buf)
+	if err := buf.encoder.Encode(set.filter(v)); nil != err {
+		return nil, err
+	}
+	return append([]byte(nil), buf.Bytes()...), nil
+}
@@ -0,0 +1,31 @@
+package marshaler
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestFilterFields(t *testing.T) {
+	body, err := filterFields(
+		[]byte(`{"a":1,"b":{"c":2,"d":3},"e":[{"f":4,"g":5}],"h":6}`),
+		"b.c,e.g,h,b.d.x",
+	)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "{\"b\":{\"c\":2,\"d\":3},\"e\":[{\"g\":5}],\"h\":6}\n" != string(body) {
+		t.Fatal(string(body))
+	}
+}
+
+func TestFieldsParam(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo?fields=items.foo", nil)
+	Handler(func(u *url.URL, h http.Header) (int, http.Header, *Page, error) {
+		return http.StatusOK, nil, NewCursorPage([]testResponse{{"bar"}}, "next"), nil
+	}).ServeHTTP(w, r)
+	if "{\"items\":[{\"foo\":\"bar\"}]}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
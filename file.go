@@ -0,0 +1,99 @@
+package marshaler
+
+import (
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// FileResponse is a response type for handler functions that send files.
+// The Marshaler streams Reader to the client as an attachment named Name
+// with the given Content-Type, which defaults to application/octet-stream,
+// and a Content-Length of Size, which may be negative if it's unknown.  If
+// Reader is an io.Closer, it's closed once the response has been sent.  When
+// the request is Logged, the file is logged by name and size rather than
+// byte by byte.
+//
+// If Reader is an io.Seeker and Size is known, GET requests with a Range
+// header are answered 206 Partial Content, subject to If-Range, which is
+// checked against the ETag header and ModTime.
+type FileResponse struct {
+	Name        string
+	ContentType string
+	Reader      io.Reader
+	Size        int64
+	ModTime     time.Time
+}
+
+func (f *FileResponse) serve(w http.ResponseWriter, r *http.Request, code int) {
+	if c, ok := f.Reader.(io.Closer); ok {
+		defer c.Close()
+	}
+	header := w.Header()
+	contentType := f.ContentType
+	if "" == contentType {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	if "" != f.Name {
+		header.Set("Content-Disposition", mime.FormatMediaType(
+			"attachment",
+			map[string]string{"filename": f.Name},
+		))
+	}
+	if !f.ModTime.IsZero() {
+		header.Set("Last-Modified", f.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if 0 <= f.Size {
+		header.Set("Content-Length", strconv.FormatInt(f.Size, 10))
+	} else {
+		header.Del("Content-Length")
+	}
+	length := f.Size
+	seeker, seekable := f.Reader.(io.Seeker)
+	if seekable && 0 <= f.Size && http.StatusOK == code {
+		header.Set("Accept-Ranges", "bytes")
+		if "GET" == r.Method && "" != r.Header.Get("Range") && ifRange(r, header.Get("ETag"), f.ModTime) {
+			ranges, err := parseRange(r.Header.Get("Range"), f.Size)
+			if errUnsatisfiableRange == err {
+				header.Set("Content-Range", "bytes */"+strconv.FormatInt(f.Size, 10))
+				header.Del("Content-Disposition")
+				header.Del("Content-Length")
+				writeError(w, r, RequestedRangeNotSatisfiable{err})
+				return
+			}
+			if 1 == len(ranges) {
+				if _, err := seeker.Seek(ranges[0].start, io.SeekStart); nil != err {
+					header.Del("Content-Disposition")
+					header.Del("Content-Length")
+					writeError(w, r, err)
+					return
+				}
+				code, length = http.StatusPartialContent, ranges[0].length
+				header.Set("Content-Range", ranges[0].contentRange(f.Size))
+				header.Set("Content-Length", strconv.FormatInt(length, 10))
+			}
+		}
+	}
+	if http.StatusPartialContent == code {
+		logBodyMetadata(r, "file %q, %s, %s", f.Name, contentType, header.Get("Content-Range"))
+	} else {
+		logBodyMetadata(r, "file %q, %s, %d bytes", f.Name, contentType, f.Size)
+	}
+	w.WriteHeader(code)
+	if "HEAD" == r.Method {
+		return
+	}
+	var err error
+	if http.StatusPartialContent == code {
+		_, err = io.CopyN(w, f.Reader, length)
+	} else {
+		_, err = io.Copy(w, f.Reader)
+	}
+	if nil != err {
+		log.Println(err)
+	}
+}
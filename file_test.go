@@ -0,0 +1,41 @@
+package marshaler
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFileResponse(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	var buf bytes.Buffer
+	l := Logged(Handler(func(u *url.URL, h http.Header) (int, http.Header, *FileResponse, error) {
+		return http.StatusOK, nil, &FileResponse{
+			Name:        "résumé.txt",
+			ContentType: "text/plain",
+			Reader:      strings.NewReader("secret contents"),
+			Size:        15,
+		}, nil
+	}), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.ServeHTTP(w, r)
+	if "secret contents" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+	if "attachment; filename*=utf-8''r%C3%A9sum%C3%A9.txt" != w.Header().Get("Content-Disposition") {
+		t.Fatal(w.Header().Get("Content-Disposition"))
+	}
+	if "15" != w.Header().Get("Content-Length") || "text/plain" != w.Header().Get("Content-Type") {
+		t.Fatal(w.Header())
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Fatal(buf.String())
+	}
+	if !strings.Contains(buf.String(), "< [file \"résumé.txt\", text/plain, 15 bytes]") {
+		t.Fatal(buf.String())
+	}
+}
@@ -0,0 +1,314 @@
+package marshaler
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultGELFChunkSize is the largest UDP datagram GELF sends by default,
+// small enough to cross networks with an MTU of 1500 without fragmenting.
+// Graylog recommends 8154 on a LAN.
+const DefaultGELFChunkSize = 1420
+
+// DefaultGELFMaxBodySize is the default number of bytes of each request and
+// response body GELFLogged includes in full_message.
+const DefaultGELFMaxBodySize = 1 << 14
+
+// DefaultGELFTimeout is how long GELF waits by default to write a message
+// over TCP, or to redial, before giving up on it.
+const DefaultGELFTimeout = 5 * time.Second
+
+// gelfMaxChunks is the most chunks Graylog reassembles into one message.
+const gelfMaxChunks = 128
+
+// gelfChunkHeaderSize is the length of the header on each chunk.
+const gelfChunkHeaderSize = 12
+
+// ErrGELFMessageTooLarge is returned by GELF.Send for messages that would
+// take more than 128 chunks to send over UDP, which Graylog would discard.
+var ErrGELFMessageTooLarge = errors.New("GELF message too large")
+
+// GELF sends messages in the Graylog Extended Log Format to a Graylog GELF
+// input.  Over UDP, messages longer than ChunkSize, which must be larger
+// than the 12-byte chunk header, are split into chunks that Graylog
+// reassembles.  Over TCP, they're delimited by null bytes and the
+// connection is redialed once if a write fails.  TCP writes block, and so
+// block the request being logged, while Graylog applies backpressure, but
+// for no longer than Timeout if it's positive.  Host names the source of
+// the messages and defaults to the local host name.
+type GELF struct {
+	ChunkSize int
+	Host      string
+	Timeout   time.Duration
+	addr      string
+	conn      net.Conn
+	mu        sync.Mutex
+	network   string
+}
+
+// NewGELF returns a GELF sender connected to the Graylog input at the given
+// address, like graylog:12201, over "udp" or "tcp".
+func NewGELF(network, addr string) (*GELF, error) {
+	if "udp" != network && "tcp" != network {
+		return nil, fmt.Errorf("GELF network %q is not udp or tcp", network)
+	}
+	conn, err := net.DialTimeout(network, addr, DefaultGELFTimeout)
+	if nil != err {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	return &GELF{
+		ChunkSize: DefaultGELFChunkSize,
+		Host:      host,
+		Timeout:   DefaultGELFTimeout,
+		addr:      addr,
+		conn:      conn,
+		network:   network,
+	}, nil
+}
+
+// Close closes the GELF sender's connection.
+func (g *GELF) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.conn.Close()
+}
+
+// Send sends a message, filling in its version and host in a copy of it if
+// they're missing.  Fields other than those GELF defines, like short_message
+// and timestamp, must be named with a leading underscore.
+func (g *GELF) Send(message map[string]interface{}) error {
+	_, hasVersion := message["version"]
+	_, hasHost := message["host"]
+	if !hasVersion || !hasHost {
+		filled := make(map[string]interface{}, len(message)+2)
+		for name, value := range message {
+			filled[name] = value
+		}
+		if !hasVersion {
+			filled["version"] = "1.1"
+		}
+		if !hasHost {
+			filled["host"] = g.Host
+		}
+		message = filled
+	}
+	p, err := json.Marshal(message)
+	if nil != err {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if "tcp" == g.network {
+		p = append(p, 0)
+		if _, err := g.writeTCP(p); nil == err {
+			return nil
+		}
+		g.conn.Close()
+		if g.conn, err = net.DialTimeout(g.network, g.addr, g.Timeout); nil != err {
+			return err
+		}
+		_, err = g.writeTCP(p)
+		return err
+	}
+	return g.sendChunked(p)
+}
+
+// writeTCP writes to the TCP connection, giving up after Timeout.
+func (g *GELF) writeTCP(p []byte) (int, error) {
+	deadline := time.Time{}
+	if 0 < g.Timeout {
+		deadline = time.Now().Add(g.Timeout)
+	}
+	g.conn.SetWriteDeadline(deadline)
+	return g.conn.Write(p)
+}
+
+// sendChunked sends a message over UDP, in chunks headed by the magic bytes
+// 0x1e 0x0f, an 8-byte message ID, and the sequence number and count of the
+// chunk if it won't fit in one datagram.
+func (g *GELF) sendChunked(p []byte) error {
+	size := g.ChunkSize
+	if 0 >= size {
+		size = DefaultGELFChunkSize
+	}
+	if gelfChunkHeaderSize >= size {
+		return fmt.Errorf("GELF chunk size %d isn't larger than the chunk header", size)
+	}
+	if len(p) <= size {
+		_, err := g.conn.Write(p)
+		return err
+	}
+	size -= gelfChunkHeaderSize
+	count := (len(p) + size - 1) / size
+	if gelfMaxChunks < count {
+		return ErrGELFMessageTooLarge
+	}
+	chunk := make([]byte, 12, 12+size)
+	chunk[0], chunk[1] = 0x1e, 0x0f
+	if _, err := io.ReadFull(rand.Reader, chunk[2:10]); nil != err {
+		return err
+	}
+	chunk[11] = byte(count)
+	for i := 0; i < count; i++ {
+		chunk[10] = byte(i)
+		end := (i + 1) * size
+		if len(p) < end {
+			end = len(p)
+		}
+		if _, err := g.conn.Write(append(chunk[:12], p[i*size:end]...)); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// GELFLogger is an http.Handler that sends a GELF message about each
+// request to the handler it wraps.
+type GELFLogger struct {
+	Labels      map[string]string
+	Logger      Logger
+	MaxBodySize int
+	Redactor    Redactor
+	gelf        *GELF
+	handler     http.Handler
+}
+
+// GELFLogged returns an http.Handler that sends a GELF message about each
+// request to the given handler once it's been served.  Its short_message is
+// the request and status lines and its full_message is the request and
+// response in full, with up to MaxBodySize bytes of each body, passed
+// through Redactor if it's not nil.  Custom fields carry the RequestID,
+// method, path, route, status, size, and duration in milliseconds, and
+// responses with 4xx and 5xx statuses are logged at the warning and error
+// levels.  Labels, like those of a MultilineLogger, are sent as custom
+// fields named by an underscore and the label.  Messages that fail to send
+// are logged to Logger.  Requests inside Logged keep the RequestID it gave
+// them.
+func GELFLogged(handler http.Handler, gelf *GELF) *GELFLogger {
+	return &GELFLogger{
+		Logger:      log.New(os.Stdout, "", log.Ltime|log.Lmicroseconds),
+		MaxBodySize: DefaultGELFMaxBodySize,
+		gelf:        gelf,
+		handler:     handler,
+	}
+}
+
+func (l *GELFLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	requestID := RequestIDFromContext(r.Context())
+	if "" == requestID {
+		requestID = NewRequestID()
+	}
+	requestBody := &limitedBuffer{max: l.MaxBodySize}
+	if nil != r.Body && http.NoBody != r.Body && 0 < l.MaxBodySize {
+		body := r.Body
+		defer func() { r.Body = body }()
+		r.Body = &teeReadCloser{
+			ReadCloser: body,
+			onRead:     func(p []byte) { requestBody.Write(p) },
+		}
+	}
+	gw := &gelfResponseWriter{
+		recordingResponseWriter: &recordingResponseWriter{ResponseWriter: w, KeepHeader: true},
+		body:                    &limitedBuffer{max: l.MaxBodySize},
+	}
+	l.handler.ServeHTTP(exposeOptional(gw), r)
+	duration := time.Since(start)
+	code, header := http.StatusOK, gw.Header()
+	if gw.WroteHeader {
+		code, header = gw.StatusCode, gw.SentHeader
+	}
+	requestLine := fmt.Sprintf("%s %s %s", r.Method, r.URL.RequestURI(), r.Proto)
+	statusLine := fmt.Sprintf("%s %d %s", r.Proto, code, http.StatusText(code))
+	var full strings.Builder
+	gelfMessage(&full, requestLine, r.Header, requestBody.Bytes())
+	full.WriteString("\n")
+	gelfMessage(&full, statusLine, header, gw.body.Bytes())
+	level := 6
+	if 500 <= code {
+		level = 3
+	} else if 400 <= code {
+		level = 4
+	}
+	message := map[string]interface{}{
+		"short_message": l.redact(requestLine + " " + statusLine),
+		"full_message":  l.redact(full.String()),
+		"timestamp":     float64(start.UnixNano()) / 1e9,
+		"level":         level,
+		"_request_id":   string(requestID),
+		"_method":       r.Method,
+		"_path":         l.redact(r.URL.Path),
+		"_route":        gw.Route,
+		"_status":       code,
+		"_size":         gw.Size,
+		"_duration":     float64(duration) / float64(time.Millisecond),
+	}
+	for name, value := range l.Labels {
+		if _, ok := message["_"+name]; !ok {
+			message["_"+name] = value
+		}
+	}
+	if err := l.gelf.Send(message); nil != err && nil != l.Logger {
+		l.Logger.Printf("%s GELF %s %s failed: %s", requestID, r.Method, l.redact(r.URL.RequestURI()), err)
+	}
+}
+
+func (l *GELFLogger) redact(s string) string {
+	if nil == l.Redactor {
+		return s
+	}
+	return l.Redactor(s)
+}
+
+// gelfMessage writes a request or response to full_message.
+func gelfMessage(b *strings.Builder, firstLine string, header http.Header, body []byte) {
+	b.WriteString(firstLine + "\n")
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		if !strings.HasPrefix(key, http.TrailerPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range header[key] {
+			if "Authorization" == key {
+				value = redactBasicAuth(value)
+			}
+			b.WriteString(key + ": " + value + "\n")
+		}
+	}
+	b.WriteString("\n")
+	b.Write(body)
+}
+
+// gelfResponseWriter copies up to its maximum of the response body for
+// GELFLogger.
+type gelfResponseWriter struct {
+	*recordingResponseWriter
+	body *limitedBuffer
+}
+
+func (w *gelfResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if w.body.max <= w.body.Len() {
+		return w.recordingResponseWriter.ReadFrom(src)
+	}
+	return w.recordingResponseWriter.ReadFrom(io.TeeReader(src, w.body))
+}
+
+func (w *gelfResponseWriter) Write(p []byte) (int, error) {
+	w.body.Write(p)
+	return w.recordingResponseWriter.Write(p)
+}
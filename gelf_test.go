@@ -0,0 +1,158 @@
+package marshaler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testGELFUDP(t *testing.T) (*GELF, func() []byte) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	g, err := NewGELF("udp", conn.LocalAddr().String())
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { g.Close() })
+	return g, func() []byte {
+		buf := make([]byte, 65536)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if nil != err {
+			t.Fatal(err)
+		}
+		return buf[:n]
+	}
+}
+
+func TestGELFLogged(t *testing.T) {
+	g, read := testGELFUDP(t)
+	g.Host = "example"
+	h := GELFLogged(Handler(func(u *url.URL, h http.Header, rq *testRequest) (int, http.Header, *testResponse, error) {
+		return http.StatusCreated, nil, &testResponse{rq.Foo}, nil
+	}), g)
+	h.Redactor = func(s string) string { return strings.Replace(s, "secret", "[redacted]", -1) }
+	h.Labels = map[string]string{"pod": "a", "status": "ignored"}
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("POST", "https://example.com/foo?bar=secret", strings.NewReader(`{"Foo":"bar"}`))
+	r.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(w, r)
+	var message map[string]interface{}
+	if err := json.Unmarshal(read(), &message); nil != err {
+		t.Fatal(err)
+	}
+	if "1.1" != message["version"] || "example" != message["host"] || 6.0 != message["level"] || 201.0 != message["_status"] || "POST" != message["_method"] || "/foo" != message["_path"] || 16 != len(message["_request_id"].(string)) {
+		t.Fatal(message)
+	}
+	if "POST /foo?bar=[redacted] HTTP/1.1 HTTP/1.1 201 Created" != message["short_message"] {
+		t.Fatal(message["short_message"])
+	}
+	if full := message["full_message"].(string); !strings.Contains(full, "Content-Type: application/json\n\n{\"Foo\":\"bar\"}\nHTTP/1.1 201 Created\nContent-Length: 14\n") || !strings.HasSuffix(full, "\n\n{\"foo\":\"bar\"}\n") {
+		t.Fatal(full)
+	}
+	if "a" != message["_pod"] {
+		t.Fatal(message)
+	}
+	if _, ok := message["_duration"].(float64); !ok {
+		t.Fatal(message)
+	}
+}
+
+func TestGELFChunked(t *testing.T) {
+	g, read := testGELFUDP(t)
+	g.ChunkSize = 112
+	sent := map[string]interface{}{"short_message": strings.Repeat("x", 250)}
+	if err := g.Send(sent); nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(sent) {
+		t.Fatal(sent)
+	}
+	var message []byte
+	for i := 0; i < 3; i++ {
+		chunk := read()
+		if 0x1e != chunk[0] || 0x0f != chunk[1] || byte(i) != chunk[10] || 3 != chunk[11] || 112 < len(chunk) {
+			t.Fatal(i, chunk[:12], len(chunk))
+		}
+		message = append(message, chunk[12:]...)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(message, &m); nil != err {
+		t.Fatal(err)
+	}
+	if strings.Repeat("x", 250) != m["short_message"] {
+		t.Fatal(m)
+	}
+	g.ChunkSize = 20
+	if err := g.Send(map[string]interface{}{"short_message": strings.Repeat("x", 2000)}); ErrGELFMessageTooLarge != err {
+		t.Fatal(err)
+	}
+}
+
+func TestGELFChunkSizeTooSmall(t *testing.T) {
+	g, _ := testGELFUDP(t)
+	g.ChunkSize = 12
+	if err := g.Send(map[string]interface{}{"short_message": "foo"}); nil == err {
+		t.Fatal(err)
+	}
+}
+
+func TestGELFLoggedSendFailure(t *testing.T) {
+	g, _ := testGELFUDP(t)
+	g.ChunkSize = 12
+	var buf bytes.Buffer
+	h := GELFLogged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), g)
+	h.Logger = log.New(&buf, "", 0)
+	r, _ := http.NewRequest("GET", "/foo", nil)
+	h.ServeHTTP(&testResponseWriter{}, r)
+	if s := buf.String(); !strings.Contains(s, " GELF GET /foo failed: GELF chunk size 12 ") {
+		t.Fatal(s)
+	}
+}
+
+func TestGELFTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	g, err := NewGELF("tcp", l.Addr().String())
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	conn, err := l.Accept()
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	g.Send(map[string]interface{}{"short_message": "foo"})
+	g.Send(map[string]interface{}{"short_message": "bar", "level": 3})
+	r := bufio.NewReader(conn)
+	for _, want := range []string{"foo", "bar"} {
+		p, err := r.ReadBytes(0)
+		if nil != err {
+			t.Fatal(err)
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(p[:len(p)-1], &m); nil != err {
+			t.Fatal(err)
+		}
+		if want != m["short_message"] {
+			t.Fatal(m)
+		}
+	}
+	if _, err := NewGELF("unix", "/tmp/gelf"); nil == err {
+		t.Fatal("unix")
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/lhigueragamboa/marshaler
+
+go 1.24
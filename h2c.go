@@ -0,0 +1,306 @@
+package marshaler
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// NewH2CServer returns a Server that serves HTTP/2 without TLS, known as
+// h2c, alongside HTTP/1.1, for services behind load balancers that
+// terminate TLS and speak HTTP/2 to their backends.  Clients must use prior
+// knowledge; the HTTP/1.1 Upgrade: h2c handshake isn't supported by the
+// standard library, so such requests are answered over HTTP/1.1.  The
+// SETTINGS frames each side sends when an h2c connection opens are logged
+// to the Server's Logger, as are any RST_STREAM and GOAWAY frames either
+// side sends later.  A MultilineLogger logs the ID of the stream each
+// request arrived on when it can be told.
+func NewH2CServer(addr string, handler http.Handler) *Server {
+	s := NewServer(addr, handler)
+	s.Protocols = new(http.Protocols)
+	s.Protocols.SetHTTP1(true)
+	s.Protocols.SetUnencryptedHTTP2(true)
+	s.wrapListener = func(l net.Listener) net.Listener {
+		return &h2cListener{Listener: l, logger: s.Logger}
+	}
+	connContext := s.ConnContext
+	s.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		ctx = connContext(ctx, c)
+		if hc, ok := c.(*h2cConn); ok {
+			return context.WithValue(ctx, h2cConnKey{}, hc)
+		}
+		return ctx
+	}
+	return s
+}
+
+type h2cListener struct {
+	net.Listener
+	logger Logger
+}
+
+func (l *h2cListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if nil != err {
+		return nil, err
+	}
+	return &h2cConn{Conn: c, logger: l.logger}, nil
+}
+
+// h2cPreface is the connection preface HTTP/2 clients send first.
+const h2cPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// h2cConn watches the frames each side of a connection sends once it's
+// opened with the HTTP/2 preface, logging the SETTINGS frame each side
+// starts with and any RST_STREAM and GOAWAY frames.  It also keeps track of
+// the streams the client has opened whose handlers haven't yet claimed
+// them, so that a request's stream can be told when there's only one.
+type h2cConn struct {
+	net.Conn
+	logger    Logger
+	mu        sync.Mutex
+	h2        bool
+	http1     bool
+	preface   []byte
+	in, out   h2cFrames
+	lastID    uint32
+	unclaimed map[uint32]struct{}
+}
+
+func (c *h2cConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.http1 || 0 == n {
+		return n, err
+	}
+	if c.h2 {
+		c.in.read(c, p[:n])
+		return n, err
+	}
+	c.preface = append(c.preface, p[:n]...)
+	if len(c.preface) < len(h2cPreface) && strings.HasPrefix(h2cPreface, string(c.preface)) {
+		return n, err
+	}
+	if !bytes.HasPrefix(c.preface, []byte(h2cPreface)) {
+		c.http1, c.preface = true, nil
+		return n, err
+	}
+	c.h2 = true
+	c.in.direction, c.out.direction = ">", "<"
+	c.in.read(c, c.preface[len(h2cPreface):])
+	c.preface = nil
+	return n, err
+}
+
+func (c *h2cConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	if c.h2 {
+		c.out.read(c, p)
+	}
+	c.mu.Unlock()
+	return c.Conn.Write(p)
+}
+
+// claimStream returns the ID of the stream of a request whose handler is
+// starting, if the client's only opened one stream whose handler hasn't
+// claimed it.  Otherwise the request's stream can't be told from the
+// others, since handlers needn't start in the order their streams opened.
+func (c *h2cConn) claimStream() (uint32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if 1 != len(c.unclaimed) {
+		return 0, false
+	}
+	for id := range c.unclaimed {
+		delete(c.unclaimed, id)
+		return id, true
+	}
+	return 0, false
+}
+
+// frame notes a complete frame, of which only as much of the payload as
+// h2cFrames keeps is given.
+func (c *h2cConn) frame(direction string, typ, flags byte, id uint32, payload []byte) {
+	switch typ {
+	case h2cFrameData, h2cFrameHeaders:
+		if ">" == direction && h2cFrameHeaders == typ && c.lastID < id {
+			c.lastID = id
+			if nil == c.unclaimed {
+				c.unclaimed = make(map[uint32]struct{})
+			}
+			c.unclaimed[id] = struct{}{}
+		} else if "<" == direction && 0 != flags&h2cFlagEndStream {
+			delete(c.unclaimed, id)
+		}
+	case h2cFrameRSTStream:
+		if "<" == direction {
+			delete(c.unclaimed, id)
+		}
+		if 4 <= len(payload) {
+			c.logger.Printf("h2c %s %s RST_STREAM stream=%d %s", c.RemoteAddr(), direction, id, h2cErrorName(binary.BigEndian.Uint32(payload)))
+		}
+	case h2cFrameGoAway:
+		if 8 <= len(payload) {
+			c.logger.Printf(
+				"h2c %s %s GOAWAY last_stream=%d %s",
+				c.RemoteAddr(),
+				direction,
+				binary.BigEndian.Uint32(payload)&0x7fffffff,
+				h2cErrorName(binary.BigEndian.Uint32(payload[4:])),
+			)
+		}
+	}
+}
+
+const (
+	h2cFrameData      = 0x0
+	h2cFrameHeaders   = 0x1
+	h2cFrameRSTStream = 0x3
+	h2cFrameSettings  = 0x4
+	h2cFrameGoAway    = 0x7
+
+	h2cFlagEndStream = 0x1
+	h2cFlagAck       = 0x1
+)
+
+// h2cMaxKeptPayload is the most of a SETTINGS frame's payload that's kept
+// to be logged.  The payloads of other frames are kept only as far as
+// they're needed.
+const h2cMaxKeptPayload = 1024
+
+// h2cFrames follows the frames one side of a connection sends, keeping
+// the start of the payloads of those that are logged and skipping the rest.
+type h2cFrames struct {
+	direction string
+	header    []byte
+	payload   []byte
+	remaining int
+	started   bool
+}
+
+// read follows the frames through the next bytes sent, which may begin or
+// end anywhere within them.
+func (f *h2cFrames) read(c *h2cConn, p []byte) {
+	for 0 < len(p) {
+		if len(f.header) < 9 {
+			n := 9 - len(f.header)
+			if len(p) < n {
+				n = len(p)
+			}
+			f.header, p = append(f.header, p[:n]...), p[n:]
+			if len(f.header) < 9 {
+				return
+			}
+			f.remaining = int(f.header[0])<<16 | int(f.header[1])<<8 | int(f.header[2])
+			f.payload = f.payload[:0]
+		}
+		n := f.remaining
+		if len(p) < n {
+			n = len(p)
+		}
+		if keep := f.kept() - len(f.payload); 0 < keep {
+			if n < keep {
+				keep = n
+			}
+			f.payload = append(f.payload, p[:keep]...)
+		}
+		f.remaining, p = f.remaining-n, p[n:]
+		if 0 < f.remaining {
+			return
+		}
+		typ, flags := f.header[3], f.header[4]
+		id := binary.BigEndian.Uint32(f.header[5:]) & 0x7fffffff
+		if !f.started && h2cFrameSettings == typ && 0 == flags&h2cFlagAck {
+			c.logSettings(f.direction, f.payload)
+		}
+		f.started = true
+		c.frame(f.direction, typ, flags, id, f.payload)
+		f.header = f.header[:0]
+	}
+}
+
+// kept returns how much of the current frame's payload to keep.
+func (f *h2cFrames) kept() int {
+	switch f.header[3] {
+	case h2cFrameSettings:
+		if !f.started {
+			return h2cMaxKeptPayload
+		}
+	case h2cFrameRSTStream:
+		return 4
+	case h2cFrameGoAway:
+		return 8
+	}
+	return 0
+}
+
+var h2cErrorNames = []string{
+	"NO_ERROR",
+	"PROTOCOL_ERROR",
+	"INTERNAL_ERROR",
+	"FLOW_CONTROL_ERROR",
+	"SETTINGS_TIMEOUT",
+	"STREAM_CLOSED",
+	"FRAME_SIZE_ERROR",
+	"REFUSED_STREAM",
+	"CANCEL",
+	"COMPRESSION_ERROR",
+	"CONNECT_ERROR",
+	"ENHANCE_YOUR_CALM",
+	"INADEQUATE_SECURITY",
+	"HTTP_1_1_REQUIRED",
+}
+
+func h2cErrorName(code uint32) string {
+	if int(code) < len(h2cErrorNames) {
+		return h2cErrorNames[code]
+	}
+	return fmt.Sprintf("0x%x", code)
+}
+
+var h2cSettingNames = map[uint16]string{
+	1: "HEADER_TABLE_SIZE",
+	2: "ENABLE_PUSH",
+	3: "MAX_CONCURRENT_STREAMS",
+	4: "INITIAL_WINDOW_SIZE",
+	5: "MAX_FRAME_SIZE",
+	6: "MAX_HEADER_LIST_SIZE",
+	8: "ENABLE_CONNECT_PROTOCOL",
+	9: "NO_RFC7540_PRIORITIES",
+}
+
+// logSettings logs the parameters in the payload of a SETTINGS frame.
+func (c *h2cConn) logSettings(direction string, payload []byte) {
+	settings := make([]string, 0, len(payload)/6)
+	for ; 6 <= len(payload); payload = payload[6:] {
+		id, value := binary.BigEndian.Uint16(payload), binary.BigEndian.Uint32(payload[2:])
+		name, ok := h2cSettingNames[id]
+		if !ok {
+			name = fmt.Sprintf("0x%x", id)
+		}
+		settings = append(settings, fmt.Sprintf("%s=%d", name, value))
+	}
+	c.logger.Printf("h2c %s %s SETTINGS %s", c.RemoteAddr(), direction, strings.Join(settings, " "))
+}
+
+type h2cConnKey struct{}
+
+// h2StreamID returns the ID of the stream an h2c request arrived on, if it
+// can be told.  See claimStream.  It's called once per request, since the
+// stream is no longer unclaimed after.
+func h2StreamID(r *http.Request) (uint32, bool) {
+	if 2 != r.ProtoMajor {
+		return 0, false
+	}
+	c, ok := r.Context().Value(h2cConnKey{}).(*h2cConn)
+	if !ok {
+		return 0, false
+	}
+	return c.claimStream()
+}
@@ -0,0 +1,119 @@
+package marshaler
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestH2CServer(t *testing.T) {
+	s := NewH2CServer("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	var buf testSyncBuffer
+	s.Logger = log.New(&buf, "", 0)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	served := make(chan error)
+	go func() { served <- s.Serve(l) }()
+	transport := &http.Transport{Protocols: new(http.Protocols)}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	defer transport.CloseIdleConnections()
+	for _, client := range []*http.Client{{Transport: transport}, {}} {
+		resp, err := client.Get("http://" + l.Addr().String())
+		if nil != err {
+			t.Fatal(err)
+		}
+		var body bytes.Buffer
+		body.ReadFrom(resp.Body)
+		resp.Body.Close()
+		if resp.Proto != body.String() {
+			t.Fatal(resp.Proto, body.String())
+		}
+	}
+	s.Stop()
+	<-served
+	if !strings.Contains(buf.String(), "> SETTINGS ") || !strings.Contains(buf.String(), "< SETTINGS ") || !strings.Contains(buf.String(), "MAX_CONCURRENT_STREAMS=") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestH2CServerStreams(t *testing.T) {
+	var logged testSyncBuffer
+	done := make(chan struct{})
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if "/reset" != r.URL.Path {
+			return
+		}
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		w.Write([]byte("too late"))
+		close(done)
+	}), nil)
+	l.Logger = log.New(&logged, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return RequestID(r.URL.Path[1:]) }
+	s := NewH2CServer("", l)
+	var buf testSyncBuffer
+	s.Logger = log.New(&buf, "", 0)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	served := make(chan error)
+	go func() { served <- s.Serve(ln) }()
+	transport := &http.Transport{Protocols: new(http.Protocols)}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+	resp, err := client.Get("http://" + ln.Addr().String() + "/ok")
+	if nil != err {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	resp, err = client.Get("http://" + ln.Addr().String() + "/reset")
+	if nil != err {
+		t.Fatal(err)
+	}
+	resp.Body.Read(make([]byte, 7))
+	resp.Body.Close()
+	<-done
+	s.Stop()
+	<-served
+	for _, want := range []string{"ok > GET /ok HTTP/2.0\nok h2c stream 1\n", "reset h2c stream 3\n", "reset client reset the stream after 7 bytes"} {
+		if !strings.Contains(logged.String(), want) {
+			t.Fatal(logged.String())
+		}
+	}
+	if strings.Contains(logged.String(), "too late") {
+		t.Fatal(logged.String())
+	}
+	if !strings.Contains(buf.String(), "> RST_STREAM stream=3 CANCEL") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestH2CFramesSplit(t *testing.T) {
+	var buf bytes.Buffer
+	c := &h2cConn{Conn: &net.TCPConn{}, logger: log.New(&buf, "", 0)}
+	frames := h2cFrames{direction: ">"}
+	b := []byte{0, 0, 6, h2cFrameSettings, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 100}
+	b = append(b, 0, 0, 5, h2cFrameHeaders, h2cFlagEndStream, 0, 0, 0, 5, 1, 2, 3, 4, 5)
+	b = append(b, 0, 0, 4, h2cFrameRSTStream, 0, 0, 0, 0, 5, 0, 0, 0, 8)
+	for _, p := range b {
+		c.mu.Lock()
+		frames.read(c, []byte{p})
+		c.mu.Unlock()
+	}
+	if !strings.Contains(buf.String(), "> SETTINGS MAX_CONCURRENT_STREAMS=100\n") || !strings.Contains(buf.String(), "> RST_STREAM stream=5 CANCEL\n") {
+		t.Fatal(buf.String())
+	}
+	if id, ok := c.claimStream(); !ok || 5 != id {
+		t.Fatal(id, ok)
+	}
+}
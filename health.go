@@ -0,0 +1,124 @@
+package marshaler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// A HealthCheck reports whether a dependency, like a database, is ready to
+// serve requests.  It should give up when ctx is done.
+type HealthCheck func(ctx context.Context) error
+
+// HealthStatus is the body of responses from the handlers returned by
+// Healthz and Readyz, with the result of each HealthCheck by name.
+type HealthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Healthz returns an http.Handler that reports the process is alive by
+// responding 200 OK.  Its response bodies aren't logged.
+func Healthz() http.Handler {
+	return quietly(Handler(func(u *url.URL, h http.Header) (int, http.Header, *HealthStatus, error) {
+		return http.StatusOK, nil, &HealthStatus{Status: "ok"}, nil
+	}), "health check")
+}
+
+// Readyz returns an http.Handler that runs the given checks concurrently and
+// responds 200 OK if all of them pass and 503 Service Unavailable with the
+// errors of those that failed if not.  Its response bodies aren't logged.
+func Readyz(checks map[string]HealthCheck) http.Handler {
+	return quietly(Handler(func(u *url.URL, h http.Header, _ interface{}, ctx context.Context) (int, http.Header, *HealthStatus, error) {
+		status := &HealthStatus{Status: "ok", Checks: make(map[string]string, len(checks))}
+		var (
+			mu sync.Mutex
+			wg sync.WaitGroup
+		)
+		for name, check := range checks {
+			wg.Add(1)
+			go func(name string, check HealthCheck) {
+				defer wg.Done()
+				result := "ok"
+				if err := check(ctx); nil != err {
+					result = err.Error()
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				status.Checks[name] = result
+			}(name, check)
+		}
+		wg.Wait()
+		for _, result := range status.Checks {
+			if "ok" != result {
+				status.Status = "unavailable"
+				return http.StatusServiceUnavailable, nil, status, nil
+			}
+		}
+		return http.StatusOK, nil, status, nil
+	}), "readiness check")
+}
+
+// BuildInfo describes the build of the running binary.
+type BuildInfo struct {
+	Path      string `json:"path,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// ReadBuildInfo returns the BuildInfo embedded in the running binary by the
+// Go toolchain.
+func ReadBuildInfo() BuildInfo {
+	info := BuildInfo{GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Path, info.Version = bi.Main.Path, bi.Main.Version
+	for _, setting := range bi.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.Time = setting.Value
+		case "vcs.modified":
+			info.Modified = "true" == setting.Value
+		}
+	}
+	return info
+}
+
+// VersionHandler returns an http.Handler that responds with the given
+// BuildInfo, usually the one returned by ReadBuildInfo.  Its response bodies
+// aren't logged.
+func VersionHandler(info BuildInfo) http.Handler {
+	return quietly(Handler(func(u *url.URL, h http.Header) (int, http.Header, *BuildInfo, error) {
+		return http.StatusOK, nil, &info, nil
+	}), "version")
+}
+
+// HandleHealth registers Healthz, Readyz with the given checks, and
+// VersionHandler with the running binary's BuildInfo at /healthz, /readyz,
+// and /version on the given mux, like an http.ServeMux.
+func HandleHealth(mux interface {
+	Handle(string, http.Handler)
+}, checks map[string]HealthCheck) {
+	mux.Handle("/healthz", Healthz())
+	mux.Handle("/readyz", Readyz(checks))
+	mux.Handle("/version", VersionHandler(ReadBuildInfo()))
+}
+
+// quietly returns an http.Handler that logs the given description in place
+// of the response bodies of the given handler.
+func quietly(handler http.Handler, description string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logBodyMetadata(r, "%s", description)
+		handler.ServeHTTP(w, r)
+	})
+}
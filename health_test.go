@@ -0,0 +1,55 @@
+package marshaler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHealthz(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logged(Healthz(), nil)
+	l.Logger = log.New(&buf, "", 0)
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/healthz", nil)
+	l.ServeHTTP(w, r)
+	if http.StatusOK != w.StatusCode || "{\"status\":\"ok\"}\n" != w.Body.String() {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+	if strings.Contains(buf.String(), "\"status\"") || !strings.Contains(buf.String(), "< [health check]") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	checks := map[string]HealthCheck{
+		"database": func(ctx context.Context) error { return nil },
+	}
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/readyz", nil)
+	Readyz(checks).ServeHTTP(w, r)
+	if http.StatusOK != w.StatusCode || "{\"status\":\"ok\",\"checks\":{\"database\":\"ok\"}}\n" != w.Body.String() {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+	checks["cache"] = func(ctx context.Context) error { return errors.New("connection refused") }
+	w = &testResponseWriter{}
+	Readyz(checks).ServeHTTP(w, r)
+	if http.StatusServiceUnavailable != w.StatusCode || "{\"status\":\"unavailable\",\"checks\":{\"cache\":\"connection refused\",\"database\":\"ok\"}}\n" != w.Body.String() {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+}
+
+func TestHandleHealth(t *testing.T) {
+	mux := http.NewServeMux()
+	HandleHealth(mux, nil)
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/version", nil)
+	mux.ServeHTTP(w, r)
+	if http.StatusOK != w.StatusCode || !strings.Contains(w.Body.String(), "\"go_version\":\"go") {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+}
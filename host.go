@@ -0,0 +1,52 @@
+package marshaler
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HostServeMux is an http.Handler that dispatches requests to the handler
+// registered for their Host header, so that one server may serve several
+// hostnames, each with its own logging and redaction.  Hostnames beginning
+// with "*." match any subdomain, the most specific wildcard winning, and the
+// hostname "*" matches any request not otherwise matched.  All other
+// requests are answered 404 Not Found.
+//
+//	HostServeMux{
+//	    "api.example.com":   Logged(api, nil),
+//	    "admin.example.com": Logged(admin, redactor),
+//	    "*.example.com":     Logged(tenants, nil),
+//	}
+type HostServeMux map[string]http.Handler
+
+func (mux HostServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler, ok := mux.handler(r.Host); ok {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	writeError(w, r, NotFound{errors.New(Message(r, "no such host %s", r.Host))})
+}
+
+func (mux HostServeMux) handler(host string) (http.Handler, bool) {
+	if h, _, err := net.SplitHostPort(host); nil == err {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if handler, ok := mux[host]; ok {
+		return handler, true
+	}
+	for {
+		i := strings.IndexByte(host, '.')
+		if -1 == i {
+			break
+		}
+		host = host[i+1:]
+		if handler, ok := mux["*."+host]; ok {
+			return handler, true
+		}
+	}
+	handler, ok := mux["*"]
+	return handler, ok
+}
@@ -0,0 +1,47 @@
+package marshaler
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHostServeMux(t *testing.T) {
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		})
+	}
+	mux := HostServeMux{
+		"api.example.com":   handler("api"),
+		"*.example.com":     handler("example"),
+		"*.eu.example.com":  handler("eu"),
+		"admin.example.com": handler("admin"),
+	}
+	for host, name := range map[string]string{
+		"api.example.com":      "api",
+		"API.example.com:8080": "api",
+		"admin.example.com.":   "admin",
+		"foo.example.com":      "example",
+		"foo.eu.example.com":   "eu",
+		"foo.bar.example.com":  "example",
+	} {
+		w := &testResponseWriter{}
+		r, _ := http.NewRequest("GET", "http://"+host+"/foo", nil)
+		mux.ServeHTTP(w, r)
+		if name != w.Body.String() {
+			t.Fatal(host, w.Body.String())
+		}
+	}
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.org/foo", nil)
+	mux.ServeHTTP(w, r)
+	if http.StatusNotFound != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	mux["*"] = handler("default")
+	w = &testResponseWriter{}
+	mux.ServeHTTP(w, r)
+	if "default" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
@@ -248,6 +248,22 @@ func (err PreconditionFailed) Name() string { return errorName(err.Err, "") }
 
 func (err PreconditionFailed) StatusCode() int { return http.StatusPreconditionFailed }
 
+type PreconditionRequired struct {
+	Err
+}
+
+func (err PreconditionRequired) Name() string { return errorName(err.Err, "") }
+
+func (err PreconditionRequired) StatusCode() int { return http.StatusPreconditionRequired }
+
+type TooManyRequests struct {
+	Err
+}
+
+func (err TooManyRequests) Name() string { return errorName(err.Err, "") }
+
+func (err TooManyRequests) StatusCode() int { return http.StatusTooManyRequests }
+
 type RequestEntityTooLarge struct {
 	Err
 }
@@ -0,0 +1,250 @@
+package marshaler
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyKeyHeader is the request header that identifies retries of
+// the same request to an Idempotency handler.
+var IdempotencyKeyHeader = "Idempotency-Key"
+
+// Defaults for the MemoryIdempotencyStore created by Idempotent: how long
+// it remembers each response, and how many responses with bodies totalling
+// how many bytes it holds at most.
+var (
+	DefaultIdempotencyTTL     = 24 * time.Hour
+	DefaultIdempotencyEntries = 16384
+	DefaultIdempotencyBytes   = 64 << 20
+)
+
+// DefaultIdempotencyMaxBodySize is the longest body Idempotency reads to
+// fingerprint by default.
+var DefaultIdempotencyMaxBodySize int64 = 1 << 20
+
+// Idempotency is an http.Handler that makes requests with an
+// Idempotency-Key header safe to retry.  The first request with a key is
+// handled as usual and its response stored, unless it's a 5xx error, and
+// retries with the same key are answered with the stored response and an
+// Idempotent-Replayed header.  Retries made while the first request is still
+// in progress are answered 409 Conflict and reuses of a key for a different
+// request 422 Unprocessable Entity.  Keys are scoped to the request's
+// Principal, if any.
+//
+// Bodies of requests with a key are read in full to fingerprint them.
+// Those longer than MaxBodySize are rejected 413 Request Entity Too Large.
+type Idempotency struct {
+	MaxBodySize int64
+	handler     http.Handler
+	store       IdempotencyStore
+}
+
+// Idempotent returns an http.Handler that stores responses to requests with
+// an Idempotency-Key header in the given store so they can be replayed.  If
+// store is nil, responses are held in a MemoryIdempotencyStore for
+// DefaultIdempotencyTTL, bounded by DefaultIdempotencyEntries and
+// DefaultIdempotencyBytes.
+func Idempotent(handler http.Handler, store IdempotencyStore) *Idempotency {
+	if nil == store {
+		store = NewMemoryIdempotencyStore(DefaultIdempotencyTTL, DefaultIdempotencyEntries, DefaultIdempotencyBytes)
+	}
+	return &Idempotency{
+		MaxBodySize: DefaultIdempotencyMaxBodySize,
+		handler:     handler,
+		store:       store,
+	}
+}
+
+func (i *Idempotency) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if "" == key {
+		i.handler.ServeHTTP(w, r)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, i.MaxBodySize+1))
+	if nil != err {
+		writeError(w, r, BadRequest{err})
+		return
+	}
+	if i.MaxBodySize < int64(len(body)) {
+		writeError(w, r, RequestEntityTooLarge{errors.New(Message(
+			r,
+			"request body is longer than %d bytes",
+			i.MaxBodySize,
+		))})
+		return
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	fingerprint := hex.EncodeToString(h.Sum(nil))
+	if principal := PrincipalFromContext(r.Context()); nil != principal {
+		key = principal.Name + "\x00" + key
+	}
+	record, reserved := i.store.Reserve(key, fingerprint)
+	if !reserved {
+		switch {
+		case nil == record || fingerprint != record.Fingerprint:
+			writeError(w, r, NewHTTPEquivError(errors.New(Message(
+				r,
+				"%s was already used for a different request",
+				IdempotencyKeyHeader,
+			)), http.StatusUnprocessableEntity))
+		case nil == record.Response:
+			writeError(w, r, Conflict{errors.New(Message(
+				r,
+				"a request with this %s is in progress",
+				IdempotencyKeyHeader,
+			))})
+		default:
+			copyHeader(w.Header(), record.Response.Header)
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.Response.StatusCode)
+			w.Write(record.Response.Body)
+		}
+		return
+	}
+	b := newResponseBuffer()
+	completed := false
+	defer func() {
+		if !completed {
+			i.store.Release(key)
+		}
+	}()
+	i.handler.ServeHTTP(b, r)
+	if !b.WroteHeader {
+		b.WriteHeader(http.StatusOK)
+	}
+	if b.StatusCode < http.StatusInternalServerError {
+		i.store.Complete(key, &CachedResponse{
+			StatusCode: b.StatusCode,
+			Header:     cloneHeader(b.Header()),
+			Body:       append([]byte(nil), b.Body.Bytes()...),
+			Created:    time.Now(),
+		})
+		completed = true
+	}
+	b.WriteTo(w)
+}
+
+// An IdempotentRecord is an IdempotencyStore's record of the request that
+// first used a key and, once it's complete, its response.
+type IdempotentRecord struct {
+	Fingerprint string
+	Response    *CachedResponse
+}
+
+// An IdempotencyStore records the requests and responses of an Idempotency
+// handler.  Implementations must be safe for concurrent use and, to
+// deduplicate requests across servers, must make Reserve atomic across
+// them.
+type IdempotencyStore interface {
+
+	// Reserve records a request with the given key and fingerprint as in
+	// progress and returns true, unless the key is already reserved, in
+	// which case it returns the existing record and false.
+	Reserve(key, fingerprint string) (*IdempotentRecord, bool)
+
+	// Complete stores the response to the request that reserved the key.
+	Complete(key string, rs *CachedResponse)
+
+	// Release forgets the key so that the request may be retried.
+	Release(key string)
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore that keeps records in
+// memory, forgetting each some time after it was reserved or, when either of
+// its bounds is exceeded, the oldest first.  Responses too big to fit at all
+// aren't stored, leaving their requests free to be retried.
+type MemoryIdempotencyStore struct {
+	mu                   sync.Mutex
+	entries              map[string]*list.Element
+	order                *list.List
+	size                 int
+	ttl                  time.Duration
+	maxEntries, maxBytes int
+}
+
+// NewMemoryIdempotencyStore returns a MemoryIdempotencyStore that keeps each
+// record for ttl, holding at most maxEntries records with response bodies
+// totalling at most maxBytes.
+func NewMemoryIdempotencyStore(ttl time.Duration, maxEntries, maxBytes int) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+	}
+}
+
+type memoryIdempotencyEntry struct {
+	key     string
+	record  IdempotentRecord
+	expires time.Time
+}
+
+func (s *MemoryIdempotencyStore) Reserve(key, fingerprint string) (*IdempotentRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for e := s.order.Front(); nil != e && now.After(e.Value.(*memoryIdempotencyEntry).expires); e = s.order.Front() {
+		s.remove(e)
+	}
+	if e, ok := s.entries[key]; ok {
+		record := e.Value.(*memoryIdempotencyEntry).record
+		return &record, false
+	}
+	s.entries[key] = s.order.PushBack(&memoryIdempotencyEntry{
+		key:     key,
+		record:  IdempotentRecord{Fingerprint: fingerprint},
+		expires: now.Add(s.ttl),
+	})
+	for s.order.Len() > s.maxEntries {
+		s.remove(s.order.Front())
+	}
+	return nil, true
+}
+
+func (s *MemoryIdempotencyStore) Complete(key string, rs *CachedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	if len(rs.Body) > s.maxBytes {
+		s.remove(e)
+		return
+	}
+	e.Value.(*memoryIdempotencyEntry).record.Response = rs
+	s.size += len(rs.Body)
+	for s.size > s.maxBytes {
+		s.remove(s.order.Front())
+	}
+}
+
+func (s *MemoryIdempotencyStore) Release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		s.remove(e)
+	}
+}
+
+func (s *MemoryIdempotencyStore) remove(e *list.Element) {
+	entry := s.order.Remove(e).(*memoryIdempotencyEntry)
+	delete(s.entries, entry.key)
+	if nil != entry.record.Response {
+		s.size -= len(entry.record.Response.Body)
+	}
+}
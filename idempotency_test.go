@@ -0,0 +1,143 @@
+package marshaler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testIdempotentRequest(key, body string) *http.Request {
+	r, _ := http.NewRequest("POST", "http://example.com/foo", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Idempotency-Key", key)
+	return r
+}
+
+func TestIdempotent(t *testing.T) {
+	calls := 0
+	h := Idempotent(Handler(func(u *url.URL, h http.Header, rq *testRequest) (int, http.Header, *testResponse, error) {
+		calls++
+		return http.StatusCreated, nil, &testResponse{rq.Foo}, nil
+	}), nil)
+	for i := 0; i < 2; i++ {
+		w := &testResponseWriter{}
+		h.ServeHTTP(w, testIdempotentRequest("k", `{"foo":"bar"}`))
+		if http.StatusCreated != w.StatusCode || "{\"foo\":\"bar\"}\n" != w.Body.String() {
+			t.Fatal(w.StatusCode, w.Body.String())
+		}
+		if (1 == i) != ("true" == w.Header().Get("Idempotent-Replayed")) {
+			t.Fatal(i, w.Header())
+		}
+	}
+	if 1 != calls {
+		t.Fatal(calls)
+	}
+	w := &testResponseWriter{}
+	h.ServeHTTP(w, testIdempotentRequest("k", `{"foo":"baz"}`))
+	if http.StatusUnprocessableEntity != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	w = &testResponseWriter{}
+	h.ServeHTTP(w, testIdempotentRequest("k", `{"foo":"bar"}`).WithContext(WithPrincipal(context.Background(), &Principal{Name: "alice"})))
+	if http.StatusCreated != w.StatusCode || "" != w.Header().Get("Idempotent-Replayed") || 2 != calls {
+		t.Fatal(w.StatusCode, w.Header(), calls)
+	}
+}
+
+func TestIdempotentConcurrent(t *testing.T) {
+	started, finish := make(chan bool), make(chan bool)
+	h := Idempotent(Handler(func(u *url.URL, h http.Header, rq *testRequest) (int, http.Header, *testResponse, error) {
+		started <- true
+		<-finish
+		return http.StatusCreated, nil, &testResponse{rq.Foo}, nil
+	}), nil)
+	done := make(chan bool)
+	go func() {
+		h.ServeHTTP(&testResponseWriter{}, testIdempotentRequest("k", `{"foo":"bar"}`))
+		done <- true
+	}()
+	<-started
+	w := &testResponseWriter{}
+	h.ServeHTTP(w, testIdempotentRequest("k", `{"foo":"bar"}`))
+	close(finish)
+	<-done
+	if http.StatusConflict != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
+
+func TestIdempotentServerError(t *testing.T) {
+	calls := 0
+	h := Idempotent(Handler(func(u *url.URL, h http.Header, rq *testRequest) (int, http.Header, *testResponse, error) {
+		calls++
+		return http.StatusServiceUnavailable, nil, nil, testNamedError("down")
+	}), nil)
+	for i := 0; i < 2; i++ {
+		w := &testResponseWriter{}
+		h.ServeHTTP(w, testIdempotentRequest("k", `{"foo":"bar"}`))
+		if http.StatusServiceUnavailable != w.StatusCode {
+			t.Fatal(w.StatusCode)
+		}
+	}
+	if 2 != calls {
+		t.Fatal(calls)
+	}
+}
+
+func TestIdempotentMaxBodySize(t *testing.T) {
+	h := Idempotent(Handler(func(u *url.URL, h http.Header, rq *testRequest) (int, http.Header, *testResponse, error) {
+		return http.StatusCreated, nil, &testResponse{rq.Foo}, nil
+	}), nil)
+	h.MaxBodySize = 8
+	w := &testResponseWriter{}
+	h.ServeHTTP(w, testIdempotentRequest("k", `{"foo":"bar"}`))
+	if http.StatusRequestEntityTooLarge != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	w = &testResponseWriter{}
+	h.ServeHTTP(w, testIdempotentRequest("k", `{}`))
+	if http.StatusCreated != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
+
+func TestMemoryIdempotencyStoreExpiry(t *testing.T) {
+	s := NewMemoryIdempotencyStore(time.Millisecond, 10, 10)
+	if _, ok := s.Reserve("k", "f"); !ok {
+		t.Fatal(ok)
+	}
+	if _, ok := s.Reserve("k", "f"); ok {
+		t.Fatal(ok)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if _, ok := s.Reserve("k", "f"); !ok {
+		t.Fatal(ok)
+	}
+}
+
+func TestMemoryIdempotencyStoreBounds(t *testing.T) {
+	s := NewMemoryIdempotencyStore(time.Hour, 2, 4)
+	for _, key := range []string{"a", "b", "c"} {
+		if _, ok := s.Reserve(key, "f"); !ok {
+			t.Fatal(key, ok)
+		}
+	}
+	if _, ok := s.Reserve("a", "f"); !ok {
+		t.Fatal("a wasn't evicted")
+	}
+	s.Complete("c", &CachedResponse{Body: []byte("abc")})
+	s.Complete("a", &CachedResponse{Body: []byte("de")})
+	if _, ok := s.Reserve("c", "f"); !ok {
+		t.Fatal("c wasn't evicted")
+	}
+	if record, ok := s.Reserve("a", "f"); ok || "de" != string(record.Response.Body) {
+		t.Fatal(record, ok)
+	}
+	s.Complete("c", &CachedResponse{Body: []byte("fghij")})
+	if _, ok := s.Reserve("c", "f"); !ok {
+		t.Fatal("too big a response was stored")
+	}
+}
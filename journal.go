@@ -0,0 +1,188 @@
+package marshaler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultJournalSocket is where systemd-journald listens for entries sent
+// with its native protocol.
+const DefaultJournalSocket = "/run/systemd/journal/socket"
+
+// Journal writes entries with structured fields straight to the systemd
+// journal over journald's native protocol, one datagram per entry, so that
+// journalctl can filter by any of them.  Identifier is each entry's
+// SYSLOG_IDENTIFIER and defaults to the program's name.  Entries too large
+// for one datagram, which is usually about 200KiB, fail to send.
+type Journal struct {
+	Identifier string
+	conn       net.Conn
+}
+
+// NewJournal returns a Journal connected to journald's socket at the given
+// path, or DefaultJournalSocket if it's empty.
+func NewJournal(path string) (*Journal, error) {
+	if "" == path {
+		path = DefaultJournalSocket
+	}
+	conn, err := net.Dial("unixgram", path)
+	if nil != err {
+		return nil, err
+	}
+	return &Journal{
+		Identifier: filepath.Base(os.Args[0]),
+		conn:       conn,
+	}, nil
+}
+
+// Close closes the Journal's connection.
+func (j *Journal) Close() error {
+	return j.conn.Close()
+}
+
+// Send writes an entry with the given fields, adding SYSLOG_IDENTIFIER to a
+// copy of them if it's missing.  Field names must be made of uppercase
+// letters, digits, and underscores and mustn't start with an underscore,
+// which journald reserves for fields of its own.  An entry should have a
+// MESSAGE and may have a PRIORITY from 0, emergency, to 7, debug.
+func (j *Journal) Send(fields map[string]string) error {
+	names := make([]string, 0, len(fields)+1)
+	for name := range fields {
+		if !validJournalField(name) {
+			return fmt.Errorf("invalid journal field name %q", name)
+		}
+		names = append(names, name)
+	}
+	if _, ok := fields["SYSLOG_IDENTIFIER"]; !ok && "" != j.Identifier {
+		identified := make(map[string]string, len(fields)+1)
+		for name, value := range fields {
+			identified[name] = value
+		}
+		identified["SYSLOG_IDENTIFIER"] = j.Identifier
+		fields = identified
+		names = append(names, "SYSLOG_IDENTIFIER")
+	}
+	sort.Strings(names)
+	var b bytes.Buffer
+	for _, name := range names {
+		value := fields[name]
+		b.WriteString(name)
+		if !strings.Contains(value, "\n") {
+			b.WriteByte('=')
+			b.WriteString(value)
+			b.WriteByte('\n')
+			continue
+		}
+		b.WriteByte('\n')
+		binary.Write(&b, binary.LittleEndian, uint64(len(value)))
+		b.WriteString(value)
+		b.WriteByte('\n')
+	}
+	_, err := j.conn.Write(b.Bytes())
+	return err
+}
+
+// validJournalField reports whether name may name a field sent to journald.
+func validJournalField(name string) bool {
+	if "" == name || '_' == name[0] || 64 < len(name) {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; !('A' <= c && c <= 'Z' || '0' <= c && c <= '9' || '_' == c) {
+			return false
+		}
+	}
+	return true
+}
+
+// JournalLogger is an http.Handler that writes an entry to the systemd
+// journal about each request to the handler it wraps.
+type JournalLogger struct {
+	Labels   map[string]string
+	Redactor Redactor
+	handler  http.Handler
+	journal  *Journal
+}
+
+// JournalLogged returns an http.Handler that writes an entry to journal
+// about each request to the given handler once it's been served.  Its
+// MESSAGE is the request and status lines, and the fields REQUEST_ID,
+// HTTP_METHOD, HTTP_PATH, HTTP_STATUS, HTTP_ROUTE, HTTP_SIZE, and
+// HTTP_DURATION_MS describe it, so that, say,
+//
+//	journalctl HTTP_STATUS=500
+//
+// finds the requests that failed.  Responses with 4xx and 5xx statuses are
+// given the warning and error priorities.  The path is passed through
+// Redactor if it's not nil.  Labels, like those of a MultilineLogger, are
+// written as fields named LABEL_ and the label in uppercase, with characters
+// journald doesn't allow replaced by underscores.  Requests inside Logged
+// keep the RequestID it gave them.
+func JournalLogged(handler http.Handler, journal *Journal) *JournalLogger {
+	return &JournalLogger{handler: handler, journal: journal}
+}
+
+func (l *JournalLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	requestID := RequestIDFromContext(r.Context())
+	if "" == requestID {
+		requestID = NewRequestID()
+	}
+	w, record := recordResponse(w)
+	l.handler.ServeHTTP(w, r)
+	code := record.StatusCode
+	if !record.WroteHeader {
+		code = http.StatusOK
+	}
+	priority := "6"
+	if 500 <= code {
+		priority = "3"
+	} else if 400 <= code {
+		priority = "4"
+	}
+	path, uri := r.URL.Path, r.URL.RequestURI()
+	if nil != l.Redactor {
+		path, uri = l.Redactor(path), l.Redactor(uri)
+	}
+	fields := map[string]string{
+		"MESSAGE":          fmt.Sprintf("%s %s %s %d %s", r.Method, uri, r.Proto, code, http.StatusText(code)),
+		"PRIORITY":         priority,
+		"REQUEST_ID":       string(requestID),
+		"HTTP_METHOD":      r.Method,
+		"HTTP_PATH":        path,
+		"HTTP_STATUS":      strconv.Itoa(code),
+		"HTTP_SIZE":        strconv.FormatInt(record.Size, 10),
+		"HTTP_DURATION_MS": strconv.FormatFloat(float64(time.Since(start))/float64(time.Millisecond), 'f', 3, 64),
+	}
+	if "" != record.Route {
+		fields["HTTP_ROUTE"] = record.Route
+	}
+	for name, value := range l.Labels {
+		if name = journalLabelField(name); validJournalField(name) {
+			fields[name] = value
+		}
+	}
+	l.journal.Send(fields)
+}
+
+// journalLabelField returns the name of the journal field for a label.
+func journalLabelField(label string) string {
+	return "LABEL_" + strings.Map(func(r rune) rune {
+		if 'a' <= r && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+			return r
+		}
+		return '_'
+	}, label)
+}
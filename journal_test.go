@@ -0,0 +1,85 @@
+package marshaler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testJournal(t *testing.T) (*Journal, func() []byte) {
+	path := filepath.Join(t.TempDir(), "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if nil != err {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	j, err := NewJournal(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.Close() })
+	return j, func() []byte {
+		buf := make([]byte, 65536)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		if nil != err {
+			t.Fatal(err)
+		}
+		return buf[:n]
+	}
+}
+
+func TestJournalSend(t *testing.T) {
+	j, read := testJournal(t)
+	j.Identifier = "test"
+	fields := map[string]string{"MESSAGE": "two\nlines", "PRIORITY": "6"}
+	if err := j.Send(fields); nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(fields) {
+		t.Fatal(fields)
+	}
+	var want bytes.Buffer
+	want.WriteString("MESSAGE\n")
+	binary.Write(&want, binary.LittleEndian, uint64(9))
+	want.WriteString("two\nlines\nPRIORITY=6\nSYSLOG_IDENTIFIER=test\n")
+	if got := read(); !bytes.Equal(want.Bytes(), got) {
+		t.Fatalf("%q", got)
+	}
+	for _, name := range []string{"_PID", "message", ""} {
+		if err := j.Send(map[string]string{name: "x"}); nil == err {
+			t.Fatal(name)
+		}
+	}
+}
+
+func TestJournalLogged(t *testing.T) {
+	j, read := testJournal(t)
+	h := JournalLogged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("down"))
+	}), j)
+	h.Labels = map[string]string{"pod-name": "a"}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/foo?bar=baz", nil))
+	got := string(read())
+	for _, want := range []string{
+		"MESSAGE=GET /foo?bar=baz HTTP/1.1 503 Service Unavailable\n",
+		"PRIORITY=3\n",
+		"HTTP_METHOD=GET\n",
+		"HTTP_PATH=/foo\n",
+		"HTTP_STATUS=503\n",
+		"HTTP_SIZE=4\n",
+		"REQUEST_ID=",
+		"LABEL_POD_NAME=a\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("%q", got)
+		}
+	}
+}
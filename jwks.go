@@ -0,0 +1,165 @@
+package marshaler
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Defaults for the JWKSs returned by NewJWKS.
+var (
+	DefaultJWKSMinRefresh = time.Minute
+	DefaultJWKSRefresh    = time.Hour
+	DefaultJWKSTimeout    = 10 * time.Second
+)
+
+// JWKS is a KeySource that fetches a JSON Web Key Set from a URL, as
+// published by OpenID Connect providers, refetching it every Refresh and
+// whenever a token names a key it doesn't have so that keys may be rotated.
+// Tokens naming unknown keys cause at most one fetch every MinRefresh, and
+// concurrent callers wait for the fetch already underway rather than start
+// their own, so bogus key IDs can't be used to hammer the provider.  RSA
+// and EC keys are supported.  Symmetric oct keys are ignored, since anyone
+// who can read a published secret can sign tokens with it; HMAC keys
+// belong in JWTKeys.
+type JWKS struct {
+	URL        string
+	Client     *http.Client
+	MinRefresh time.Duration
+	Refresh    time.Duration
+	attempted  time.Time
+	fetched    time.Time
+	fetching   chan struct{}
+	keys       map[string]interface{}
+	mu         sync.Mutex
+}
+
+// NewJWKS returns a JWKS that fetches the key set at the given URL.
+func NewJWKS(url string) *JWKS {
+	return &JWKS{
+		URL:        url,
+		Client:     &http.Client{Timeout: DefaultJWKSTimeout},
+		MinRefresh: DefaultJWKSMinRefresh,
+		Refresh:    DefaultJWKSRefresh,
+	}
+}
+
+func (s *JWKS) Key(kid, alg string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[kid]
+	if ok && s.Refresh >= time.Since(s.fetched) {
+		return key, nil
+	}
+	if nil != s.fetching {
+		fetching := s.fetching
+		s.mu.Unlock()
+		<-fetching
+		s.mu.Lock()
+	} else if time.Since(s.attempted) >= s.MinRefresh {
+		if err := s.refetch(); nil != err && !ok {
+			return nil, err
+		}
+	}
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// refetch fetches the key set without holding the lock, which must be held
+// when it's called and is held again when it returns.
+func (s *JWKS) refetch() error {
+	s.attempted = time.Now()
+	fetching := make(chan struct{})
+	s.fetching = fetching
+	s.mu.Unlock()
+	keys, err := s.fetch()
+	s.mu.Lock()
+	s.fetching = nil
+	close(fetching)
+	if nil != err {
+		return err
+	}
+	s.keys, s.fetched = keys, time.Now()
+	return nil
+}
+
+func (s *JWKS) fetch() (map[string]interface{}, error) {
+	resp, err := s.Client.Get(s.URL)
+	if nil != err {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if http.StatusOK != resp.StatusCode {
+		return nil, fmt.Errorf("fetching %s: %s", s.URL, resp.Status)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); nil != err {
+		return nil, err
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if key, err := jwk.publicKey(); nil == err {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (jwk jsonWebKey) publicKey() (interface{}, error) {
+	var (
+		ints []*big.Int
+		err  error
+	)
+	decode := func(fields ...string) {
+		for _, field := range fields {
+			b, decodeErr := base64.RawURLEncoding.DecodeString(field)
+			if nil != decodeErr {
+				err = decodeErr
+			}
+			ints = append(ints, new(big.Int).SetBytes(b))
+		}
+	}
+	switch jwk.Kty {
+	case "RSA":
+		if decode(jwk.N, jwk.E); nil != err {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: ints[0], E: int(ints[1].Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{
+			"P-256": elliptic.P256(),
+			"P-384": elliptic.P384(),
+			"P-521": elliptic.P521(),
+		}
+		curve, ok := curves[jwk.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		if decode(jwk.X, jwk.Y); nil != err {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: ints[0], Y: ints[1]}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
@@ -0,0 +1,257 @@
+package marshaler
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Claims are the claims of a verified JSON Web Token.
+type Claims map[string]interface{}
+
+// Subject returns the token's sub claim.
+func (c Claims) Subject() string {
+	s, _ := c["sub"].(string)
+	return s
+}
+
+// Strings returns a claim that's either a string or an array of strings as
+// a slice, splitting strings on spaces as OAuth 2.0 scope claims are.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		s := make([]string, 0, len(v))
+		for _, e := range v {
+			if str, ok := e.(string); ok {
+				s = append(s, str)
+			}
+		}
+		return s
+	}
+	return nil
+}
+
+type claimsKey struct{}
+
+// ClaimsFromContext returns the Claims of the JSON Web Token that
+// authenticated a request or nil if the request wasn't authenticated by
+// JWTAuth.
+func ClaimsFromContext(ctx context.Context) Claims {
+	c, _ := ctx.Value(claimsKey{}).(Claims)
+	return c
+}
+
+// A KeySource supplies the keys that verify JSON Web Tokens by the key ID
+// and algorithm in the token's header.  HMAC keys are []byte, RSA keys
+// *rsa.PublicKey, and ECDSA keys *ecdsa.PublicKey.
+type KeySource interface {
+	Key(kid, alg string) (interface{}, error)
+}
+
+// JWTKeys is a KeySource of a fixed set of keys by key ID.  The key with the
+// empty ID verifies tokens without one.
+type JWTKeys map[string]interface{}
+
+func (keys JWTKeys) Key(kid, alg string) (interface{}, error) {
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// DefaultJWTLeeway is the clock skew JWTAuth allows for when checking the
+// exp, nbf, and iat claims.
+var DefaultJWTLeeway = time.Minute
+
+// JWTAuthenticator is an http.Handler that authenticates requests by the
+// JSON Web Token in their Authorization header's Bearer credentials before
+// passing them to the handler it wraps with the token's Claims and a
+// Principal in the request's context.  The Principal is named by the sub
+// claim and has the roles in the RolesClaim, so that the Marshaler's
+// role-based field filtering applies.  Tokens must be signed with HS256,
+// RS256, or ES256 or their longer variants, must not be expired, and must
+// name the Audience and Issuer if they're set.  Requests without a valid
+// token are rejected 401 Unauthorized with a WWW-Authenticate challenge and,
+// if Roles is set, requests whose Principal has none of them are rejected
+// 403 Forbidden.
+type JWTAuthenticator struct {
+	Audience   string
+	Issuer     string
+	Leeway     time.Duration
+	RolesClaim string
+	Roles      []string
+	handler    http.Handler
+	keys       KeySource
+	now        func() time.Time
+}
+
+// JWTAuth returns an http.Handler that authenticates requests to the given
+// handler by JSON Web Tokens verified with the keys from the given source.
+func JWTAuth(handler http.Handler, keys KeySource) *JWTAuthenticator {
+	return &JWTAuthenticator{
+		Leeway:     DefaultJWTLeeway,
+		RolesClaim: "roles",
+		handler:    handler,
+		keys:       keys,
+		now:        time.Now,
+	}
+}
+
+func (a *JWTAuthenticator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold("Bearer", scheme) || "" == token {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, r, Unauthorized{errors.New(Message(r, "bearer token required"))})
+		return
+	}
+	claims, err := a.verify(strings.TrimSpace(token))
+	if nil != err {
+		w.Header().Set("WWW-Authenticate", "Bearer error=\"invalid_token\", error_description="+strconv.Quote(err.Error()))
+		writeError(w, r, Unauthorized{errors.New(Message(r, "invalid bearer token: %s", err))})
+		return
+	}
+	principal := &Principal{Name: claims.Subject(), Roles: claims.Strings(a.RolesClaim)}
+	r = r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims))
+	authenticated(w, r, a.handler, principal, a.Roles)
+}
+
+// verify checks a token's signature and claims, returning the claims.
+func (a *JWTAuthenticator) verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if 3 != len(parts) {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); nil != err {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if nil != err {
+		return nil, errors.New("malformed signature")
+	}
+	key, err := a.keys.Key(header.Kid, header.Alg)
+	if nil != err {
+		return nil, err
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], sig); nil != err {
+		return nil, err
+	}
+	var claims Claims
+	if err := decodeJWTSegment(parts[1], &claims); nil != err {
+		return nil, err
+	}
+	return claims, a.checkClaims(claims)
+}
+
+func (a *JWTAuthenticator) checkClaims(claims Claims) error {
+	now := a.now()
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(a.Leeway)) {
+		return errors.New("token is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0).Add(-a.Leeway)) {
+		return errors.New("token is not yet valid")
+	}
+	if iat, ok := claims["iat"].(float64); ok && now.Before(time.Unix(int64(iat), 0).Add(-a.Leeway)) {
+		return errors.New("token was issued in the future")
+	}
+	if "" != a.Issuer {
+		if iss, _ := claims["iss"].(string); a.Issuer != iss {
+			return errors.New("token has the wrong issuer")
+		}
+	}
+	if "" != a.Audience {
+		found := false
+		for _, aud := range claims.Strings("aud") {
+			found = found || a.Audience == aud
+		}
+		if !found {
+			return errors.New("token has the wrong audience")
+		}
+	}
+	return nil
+}
+
+func decodeJWTSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if nil != err {
+		return errors.New("malformed token")
+	}
+	if err := json.Unmarshal(b, v); nil != err {
+		return errors.New("malformed token")
+	}
+	return nil
+}
+
+var jwtHashes = map[string]crypto.Hash{
+	"256": crypto.SHA256,
+	"384": crypto.SHA384,
+	"512": crypto.SHA512,
+}
+
+// verifyJWTSignature verifies a signature by algorithm, refusing keys of the
+// wrong type so that, for example, an RSA public key can't be used as an
+// HMAC secret.
+func verifyJWTSignature(alg string, key interface{}, signed string, sig []byte) error {
+	hash, ok := jwtHashes[strings.TrimLeft(alg, "HRSE")]
+	if !ok || 5 != len(alg) {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+	invalid := errors.New("invalid signature")
+	switch alg[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+		if !ok {
+			return errors.New("wrong key type")
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return invalid
+		}
+	case "RS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("wrong key type")
+		}
+		if nil != rsa.VerifyPKCS1v15(pub, hash, digest, sig) {
+			return invalid
+		}
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("wrong key type")
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if 2*size != len(sig) {
+			return invalid
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return invalid
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package marshaler
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testJWT(t *testing.T, alg, kid string, key interface{}, claims Claims) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if nil != err {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func testJWTAuth(keys KeySource) *JWTAuthenticator {
+	return JWTAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := PrincipalFromContext(r.Context())
+		fmt.Fprintf(w, "%s %v %v", p.Name, p.Roles, ClaimsFromContext(r.Context())["iss"])
+	}), keys)
+}
+
+func testServeJWT(a *JWTAuthenticator, token string) *testResponseWriter {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Header.Set("Accept", "application/json")
+	a.ServeHTTP(w, r)
+	return w
+}
+
+func TestJWTAuth(t *testing.T) {
+	secret := []byte("secret")
+	a := testJWTAuth(JWTKeys{"": secret})
+	a.Issuer, a.Audience = "example", "api"
+	w := testServeJWT(a, testJWT(t, "HS256", "", secret, Claims{
+		"sub":   "foo",
+		"iss":   "example",
+		"aud":   []string{"api", "web"},
+		"roles": []string{"admin"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}))
+	if "foo [admin] example" != w.Body.String() {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+}
+
+func TestJWTAuthInvalid(t *testing.T) {
+	secret := []byte("secret")
+	a := testJWTAuth(JWTKeys{"": secret})
+	a.Audience = "api"
+	for token, description := range map[string]string{
+		testJWT(t, "HS256", "", []byte("wrong"), Claims{"aud": "api"}):                                  "invalid signature",
+		testJWT(t, "HS256", "", secret, Claims{"aud": "api", "exp": time.Now().Add(-time.Hour).Unix()}): "token is expired",
+		testJWT(t, "HS256", "", secret, Claims{"aud": "web"}):                                           "token has the wrong audience",
+		testJWT(t, "HS256", "other", secret, Claims{"aud": "api"}):                                      "unknown key \"other\"",
+		testJWT(t, "none", "", secret, Claims{"aud": "api"}):                                            "unsupported algorithm \"none\"",
+	} {
+		w := testServeJWT(a, token)
+		if http.StatusUnauthorized != w.StatusCode {
+			t.Fatal(description, w.StatusCode)
+		}
+		var body map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &body); nil != err {
+			t.Fatal(err)
+		}
+		if "invalid bearer token: "+description != body["description"] {
+			t.Fatal(body)
+		}
+	}
+}
+
+func TestJWTAuthKeyConfusion(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	a := testJWTAuth(JWTKeys{"": &key.PublicKey})
+	if w := testServeJWT(a, testJWT(t, "RS256", "", key, Claims{"sub": "foo"})); "foo [] <nil>" != w.Body.String() {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+	if w := testServeJWT(a, testJWT(t, "HS256", "", key.PublicKey.N.Bytes(), Claims{"sub": "foo"})); http.StatusUnauthorized != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "n": b64(rsaKey.N.Bytes()), "e": "AQAB"},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+		}})
+	}))
+	defer s.Close()
+	a := testJWTAuth(NewJWKS(s.URL))
+	if w := testServeJWT(a, testJWT(t, "RS256", "rsa", rsaKey, Claims{"sub": "foo"})); "foo [] <nil>" != w.Body.String() {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+	if w := testServeJWT(a, testJWT(t, "ES256", "ec", ecKey, Claims{"sub": "bar", "scope": "read write"})); "bar [] <nil>" != w.Body.String() {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+}
+
+func TestJWKSUnknownKey(t *testing.T) {
+	var fetches int32
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		time.Sleep(10 * time.Millisecond)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "foo", "n": base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()), "e": "AQAB"},
+			{"kty": "oct", "kid": "secret", "k": "c2VjcmV0"},
+		}})
+	}))
+	defer s.Close()
+	jwks := NewJWKS(s.URL)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			jwks.Key("foo", "RS256")
+		}()
+	}
+	wg.Wait()
+	for _, kid := range []string{"bar", "secret", "bar", "secret"} {
+		if _, err := jwks.Key(kid, "HS256"); nil == err {
+			t.Fatal(kid)
+		}
+	}
+	if key, err := jwks.Key("foo", "RS256"); nil != err || 0 != rsaKey.N.Cmp(key.(*rsa.PublicKey).N) {
+		t.Fatal(key, err)
+	}
+	if 1 != atomic.LoadInt32(&fetches) {
+		t.Fatal(fetches)
+	}
+}
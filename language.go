@@ -0,0 +1,84 @@
+package marshaler
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// LanguageNegotiator is an http.Handler that chooses the response language
+// from the request's Accept-Language header and the languages it supports.
+// The chosen language is available to handlers via Language.
+type LanguageNegotiator struct {
+	handler   http.Handler
+	languages []string
+}
+
+// Localized returns an http.Handler that negotiates among the given language
+// tags, the first of which is the default, before calling the given handler.
+// Handlers may override the Content-Language header it sets.
+func Localized(handler http.Handler, languages ...string) *LanguageNegotiator {
+	if 0 == len(languages) {
+		panic(NewMarshalerError("no languages given"))
+	}
+	return &LanguageNegotiator{
+		handler:   handler,
+		languages: languages,
+	}
+}
+
+func (n *LanguageNegotiator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	language := NegotiateLanguage(r.Header.Get("Accept-Language"), n.languages)
+	w.Header().Set("Content-Language", language)
+	addVary(w.Header(), "Accept-Language")
+	n.handler.ServeHTTP(w, r.WithContext(WithLanguage(r.Context(), language)))
+}
+
+// NegotiateLanguage returns the supported language tag that best matches the
+// given Accept-Language header, falling back to the first supported tag.
+// A range like "en" matches "en-US" and a range like "en-GB" matches "en".
+func NegotiateLanguage(acceptLanguage string, supported []string) string {
+	type languageRange struct {
+		tag string
+		q   float64
+	}
+	var ranges []languageRange
+	for _, field := range strings.Split(acceptLanguage, ",") {
+		if tag, q := qualityValue(field); "" != tag && 0 < q {
+			ranges = append(ranges, languageRange{tag, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+	for _, lr := range ranges {
+		if "*" == lr.tag {
+			break
+		}
+		for _, language := range supported {
+			if strings.EqualFold(lr.tag, language) {
+				return language
+			}
+		}
+		for _, language := range supported {
+			l := strings.ToLower(language)
+			if strings.HasPrefix(l, lr.tag+"-") || strings.HasPrefix(lr.tag, l+"-") {
+				return language
+			}
+		}
+	}
+	return supported[0]
+}
+
+type languageKey struct{}
+
+// WithLanguage returns a copy of ctx carrying the given language tag.
+func WithLanguage(ctx context.Context, language string) context.Context {
+	return context.WithValue(ctx, languageKey{}, language)
+}
+
+// Language returns the language tag negotiated for a request, or the empty
+// string if none was.
+func Language(ctx context.Context) string {
+	language, _ := ctx.Value(languageKey{}).(string)
+	return language
+}
@@ -0,0 +1,42 @@
+package marshaler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestNegotiateLanguage(t *testing.T) {
+	supported := []string{"en-US", "fr", "pt-BR"}
+	for accept, language := range map[string]string{
+		"":                      "en-US",
+		"de":                    "en-US",
+		"fr-CA, en;q=0.5":       "fr",
+		"en;q=0.5, pt-br;q=0.8": "pt-BR",
+		"fr;q=0, pt":            "pt-BR",
+		"*":                     "en-US",
+	} {
+		if l := NegotiateLanguage(accept, supported); language != l {
+			t.Fatal(accept, l)
+		}
+	}
+}
+
+func TestLocalized(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Accept-Language", "fr")
+	Localized(Handler(func(u *url.URL, h http.Header, _ interface{}, c context.Context) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, nil, &testResponse{Language(c)}, nil
+	}), "en", "fr").ServeHTTP(w, r)
+	if "{\"foo\":\"fr\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+	if "fr" != w.Header().Get("Content-Language") {
+		t.Fatal(w.Header().Get("Content-Language"))
+	}
+	if "Accept-Language" != w.Header().Get("Vary") {
+		t.Fatal(w.Header().Get("Vary"))
+	}
+}
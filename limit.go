@@ -0,0 +1,101 @@
+package marshaler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultQueueTimeout is how long a ConcurrencyLimiter lets a request wait
+// for a slot before giving up on it.
+var DefaultQueueTimeout = 10 * time.Second
+
+// ConcurrencyLimiter is an http.Handler that tracks the requests executing
+// in the handler it wraps and, if MaxConcurrent is positive, caps them.
+// Requests beyond the cap wait in a queue of at most MaxQueue for up to
+// QueueTimeout and those that don't get a slot are answered 503 Service
+// Unavailable.  A ConcurrencyLimiter is an expvar.Var, so its counts may be
+// published, and rejections are counted in Sink, if it's not nil.
+type ConcurrencyLimiter struct {
+	MaxQueue     int
+	QueueTimeout time.Duration
+	Sink         MetricsSink
+	handler      http.Handler
+	slots        chan struct{}
+	inFlight     int64
+	queued       int64
+}
+
+// Limited returns an http.Handler that lets at most maxConcurrent requests
+// execute in the given handler at once, or any number if maxConcurrent is
+// zero, queueing at most maxQueue more.
+func Limited(handler http.Handler, maxConcurrent, maxQueue int) *ConcurrencyLimiter {
+	l := &ConcurrencyLimiter{
+		MaxQueue:     maxQueue,
+		QueueTimeout: DefaultQueueTimeout,
+		handler:      handler,
+	}
+	if 0 < maxConcurrent {
+		l.slots = make(chan struct{}, maxConcurrent)
+	}
+	return l
+}
+
+// InFlight returns the number of requests executing in the handler.
+func (l *ConcurrencyLimiter) InFlight() int {
+	return int(atomic.LoadInt64(&l.inFlight))
+}
+
+// Queued returns the number of requests waiting to execute.
+func (l *ConcurrencyLimiter) Queued() int {
+	return int(atomic.LoadInt64(&l.queued))
+}
+
+// String implements expvar.Var.
+func (l *ConcurrencyLimiter) String() string {
+	return fmt.Sprintf("{\"in_flight\": %d, \"queued\": %d}", l.InFlight(), l.Queued())
+}
+
+func (l *ConcurrencyLimiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if nil != l.slots {
+		if err := l.acquire(r); nil != err {
+			if nil != l.Sink {
+				l.Sink.Count("requests_rejected", 1, map[string]string{"method": r.Method})
+			}
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, err)
+			return
+		}
+		defer func() { <-l.slots }()
+	}
+	atomic.AddInt64(&l.inFlight, 1)
+	defer atomic.AddInt64(&l.inFlight, -1)
+	l.handler.ServeHTTP(w, r)
+}
+
+// acquire takes a slot, waiting in the queue if there's room in it.
+func (l *ConcurrencyLimiter) acquire(r *http.Request) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if queued := atomic.AddInt64(&l.queued, 1); int64(l.MaxQueue) < queued {
+		atomic.AddInt64(&l.queued, -1)
+		return ServiceUnavailable{errors.New(Message(r, "server is overloaded"))}
+	}
+	defer atomic.AddInt64(&l.queued, -1)
+	timer := time.NewTimer(l.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		logRequestLine(r, "gave up waiting for a slot after %v", l.QueueTimeout)
+		return ServiceUnavailable{errors.New(Message(r, "server is overloaded"))}
+	case <-r.Context().Done():
+		return r.Context().Err()
+	}
+}
@@ -0,0 +1,72 @@
+package marshaler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLimited(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	l := Limited(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}), 1, 1)
+	sink := &testMetricsSink{}
+	l.Sink = sink
+	serve := func() *testResponseWriter {
+		w := &testResponseWriter{}
+		r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+		l.ServeHTTP(w, r)
+		return w
+	}
+	first, second := make(chan *testResponseWriter), make(chan *testResponseWriter)
+	go func() { first <- serve() }()
+	<-started
+	go func() { second <- serve() }()
+	for 1 != l.Queued() {
+		time.Sleep(time.Millisecond)
+	}
+	if 1 != l.InFlight() {
+		t.Fatal(l.InFlight())
+	}
+	var counts map[string]int
+	if err := json.Unmarshal([]byte(l.String()), &counts); nil != err || 1 != counts["in_flight"] || 1 != counts["queued"] {
+		t.Fatal(l.String(), err)
+	}
+	if w := serve(); http.StatusServiceUnavailable != w.StatusCode || "1" != w.Header().Get("Retry-After") {
+		t.Fatal(w.StatusCode, w.Header())
+	}
+	if 1 != len(sink.metrics) || "requests_rejected" != sink.metrics[0].name {
+		t.Fatal(sink.metrics)
+	}
+	release <- struct{}{}
+	if w := <-first; http.StatusNoContent != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	<-started
+	release <- struct{}{}
+	if w := <-second; http.StatusNoContent != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
+
+func TestLimitedQueueTimeout(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	l := Limited(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}), 1, 1)
+	l.QueueTimeout = time.Millisecond
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	go l.ServeHTTP(&testResponseWriter{}, r)
+	<-started
+	w := &testResponseWriter{}
+	l.ServeHTTP(w, r)
+	close(release)
+	if http.StatusServiceUnavailable != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
@@ -0,0 +1,57 @@
+package marshaler
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Link is a typed link to a related resource, serialized into a Link
+// response header as described by RFC 8288.
+type Link struct {
+	URL   string
+	Rel   string
+	Type  string
+	Title string
+}
+
+// LinkWithQuery returns a Link to the given URL with one query parameter
+// replaced, which is convenient for linking to the next or previous page.
+func LinkWithQuery(u *url.URL, rel, key, value string) Link {
+	copied := *u
+	query := copied.Query()
+	query.Set(key, value)
+	copied.RawQuery = query.Encode()
+	return Link{URL: copied.String(), Rel: rel}
+}
+
+// String returns the link in the format of a Link header field value.
+func (l Link) String() string {
+	s := "<" + l.URL + ">; rel=" + strconv.Quote(l.Rel)
+	if "" != l.Type {
+		s += "; type=" + strconv.Quote(l.Type)
+	}
+	if "" != l.Title {
+		s += "; title=" + strconv.Quote(l.Title)
+	}
+	return s
+}
+
+// A Linker is a response type that declares its related resources.  The
+// Marshaler adds its links to the response's Link header.
+type Linker interface {
+	Links() []Link
+}
+
+// AddLinks adds the given links to the Link header.
+func AddLinks(header http.Header, links ...Link) {
+	if 0 == len(links) {
+		return
+	}
+	values := make([]string, len(links))
+	for i, link := range links {
+		values[i] = link.String()
+	}
+	header.Add("Link", strings.Join(values, ", "))
+}
@@ -0,0 +1,41 @@
+package marshaler
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestLink(t *testing.T) {
+	l := Link{URL: "/foo", Rel: "self", Title: "a \"foo\""}
+	if "</foo>; rel=\"self\"; title=\"a \\\"foo\\\"\"" != l.String() {
+		t.Fatal(l.String())
+	}
+}
+
+func TestLinkWithQuery(t *testing.T) {
+	u, _ := url.Parse("/foo?cursor=a&limit=2")
+	if l := LinkWithQuery(u, "next", "cursor", "b"); "/foo?cursor=b&limit=2" != l.URL {
+		t.Fatal(l.URL)
+	}
+}
+
+func TestLinker(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	Handler(func(u *url.URL, h http.Header) (int, http.Header, *Page, error) {
+		return http.StatusOK, nil, &Page{
+			Items: []string{},
+			Related: []Link{
+				{URL: "/foo", Rel: "self"},
+				LinkWithQuery(u, "next", "cursor", "b"),
+			},
+		}, nil
+	}).ServeHTTP(w, r)
+	if "</foo>; rel=\"self\", <http://example.com/foo?cursor=b>; rel=\"next\"" != w.Header().Get("Link") {
+		t.Fatal(w.Header().Get("Link"))
+	}
+	if "{\"items\":[]}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
@@ -0,0 +1,128 @@
+package marshaler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A LogFormat is how MultilineLogger marks and separates the parts of the
+// lines it logs, for downstream parsers that expect delimiters other than
+// the defaults.  Empty fields take the default, shown in the comments.
+//
+// LinePrefix, if it's not nil, is called once per request and what it
+// returns begins every line logged about that request, before the
+// RequestID, so that each line can stand alone, say with the method and
+// path of the request.
+type LogFormat struct {
+	RequestMarker   string // ">"
+	ResponseMarker  string // "<"
+	Separator       string // " " between the RequestID, marker, and fields
+	HeaderSeparator string // ": " between header names and values
+	LinePrefix      func(r *http.Request) string
+}
+
+// logMarks are the strings the lines about a request are built from,
+// worked out from the LogFormat when the request arrives.
+type logMarks struct {
+	lead          string // LinePrefix and RequestID
+	in, out       string // marker with a separator on each side
+	inEnd, outEnd string // separator and marker that end a section
+	sep, header   string
+}
+
+// defaultLogMarks are the logMarks of a nil LogFormat, less the lead.
+var defaultLogMarks = logMarks{
+	in:     " > ",
+	out:    " < ",
+	inEnd:  " >",
+	outEnd: " <",
+	sep:    " ",
+	header: ": ",
+}
+
+// marks returns the logMarks for lines about r, which has the given
+// RequestID.  Only custom formats cost any allocations.
+func (f *LogFormat) marks(r *http.Request, requestID RequestID) logMarks {
+	m := defaultLogMarks
+	m.lead = string(requestID)
+	if nil == f {
+		return m
+	}
+	in, out := f.RequestMarker, f.ResponseMarker
+	if "" == in {
+		in = ">"
+	}
+	if "" == out {
+		out = "<"
+	}
+	if "" != f.Separator {
+		m.sep = f.Separator
+	}
+	if "" != f.HeaderSeparator {
+		m.header = f.HeaderSeparator
+	}
+	m.in, m.out = m.sep+in+m.sep, m.sep+out+m.sep
+	m.inEnd, m.outEnd = m.sep+in, m.sep+out
+	if nil != f.LinePrefix {
+		m.lead = f.LinePrefix(r) + m.lead
+	}
+	return m
+}
+
+// formatLabels formats labels as name=value pairs sorted by name and joined
+// by sep, quoting values that are empty or contain spaces, quotes, or sep.
+func formatLabels(labels map[string]string, sep string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for i, name := range names {
+		if 0 < i {
+			b.WriteString(sep)
+		}
+		value := labels[name]
+		if "" == value || strings.ContainsAny(value, " \"") || strings.Contains(value, sep) {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(value)
+	}
+	return b.String()
+}
+
+// logMarkedLine logs a line like logRequestLine but marked as being about
+// the request or, if response is set, the response.
+func logMarkedLine(r *http.Request, response bool, format string, v ...interface{}) {
+	w, ok := r.Context().Value(loggerResponseWriterKey{}).(*multilineLoggerResponseWriter)
+	if !ok || !w.logs(LogStatusLines) {
+		return
+	}
+	var b []byte
+	w.logLine(&b, w.lead, w.marker(response), fmt.Sprintf(format, v...))
+}
+
+// logMarkedHeader logs a header line like logMarkedLine, with what's given
+// before the header's name.
+func logMarkedHeader(r *http.Request, response bool, what, name, value string) {
+	w, ok := r.Context().Value(loggerResponseWriterKey{}).(*multilineLoggerResponseWriter)
+	if !ok || !w.logs(LogStatusLines) {
+		return
+	}
+	var b []byte
+	w.logLine(&b, w.lead, w.marker(response), what, name, w.header, value)
+}
+
+// marker returns the marker, with separators, of lines about the request
+// or, if response is set, the response.
+func (m *logMarks) marker(response bool) string {
+	if response {
+		return m.out
+	}
+	return m.in
+}
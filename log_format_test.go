@@ -0,0 +1,77 @@
+package marshaler
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLoggedFormat(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "pong")
+	}), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	l.Format = &LogFormat{
+		RequestMarker:   "REQ",
+		ResponseMarker:  "RES",
+		Separator:       "|",
+		HeaderSeparator: "=",
+		LinePrefix:      func(r *http.Request) string { return r.Method + " " + r.URL.Path + " " },
+	}
+	r, _ := http.NewRequest("POST", "http://example.com/foo", strings.NewReader("ping"))
+	l.ServeHTTP(&testResponseWriter{}, r)
+	want := "POST /foo foo|REQ|POST|/foo|HTTP/1.1\n" +
+		"POST /foo foo|REQ\n" +
+		"POST /foo foo|REQ|ping\n" +
+		"POST /foo foo|RES|HTTP/1.1|200|OK\n" +
+		"POST /foo foo|RES|Content-Type=text/plain\n" +
+		"POST /foo foo|RES\n" +
+		"POST /foo foo|RES|pong\n"
+	if want != buf.String() {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestLoggedFormatDefaults(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+		w.WriteHeader(http.StatusOK)
+	}), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	l.Format = &LogFormat{ResponseMarker: "<<"}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	l.ServeHTTP(&testResponseWriter{}, r)
+	want := "foo > GET /foo HTTP/1.1\n" +
+		"foo >\n" +
+		"foo << HTTP/1.1 204 No Content\n" +
+		"foo <<\n" +
+		"foo superfluous WriteHeader(200) ignored; already wrote 204\n"
+	if want != buf.String() {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestLoggedLabels(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logged(http.NotFoundHandler(), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	l.Level = LogStatusLines
+	l.Labels = map[string]string{"zone": "us-east-1a", "pod": "web-1", "worker": "3", "note": "a b"}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	l.ServeHTTP(&testResponseWriter{}, r)
+	want := "note=\"a b\" pod=web-1 worker=3 zone=us-east-1a foo > GET /foo HTTP/1.1\n" +
+		"note=\"a b\" pod=web-1 worker=3 zone=us-east-1a foo < HTTP/1.1 404 Not Found\n"
+	if want != buf.String() {
+		t.Fatal(buf.String())
+	}
+}
@@ -1,11 +1,22 @@
 package marshaler
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 type Logger interface {
@@ -18,9 +29,64 @@ type Logger interface {
 // MultilineLogger is an http.Handler that logs requests and responses,
 // complete with paths, statuses, headers, and bodies.  Sensitive information
 // may be redacted by a user-defined function.
+//
+// Level, or RequestLevel if it's set, limits what's logged about each
+// request.  Lines that won't be logged aren't formatted, so logging less is
+// correspondingly cheaper.
+//
+// NoBody leaves the request body and the writing of the response alone,
+// logging the response's status and headers after the handler returns,
+// for services that can't afford more than a line or two per request.
+// Bodies aren't logged, whatever the level, and neither are superfluous
+// calls to WriteHeader.
+//
+// SortHeaders logs headers in order of their names rather than in map
+// order, which costs a little more.  See also Deterministic.
+//
+// At LogBodySummaries, bodies are never logged, only their Content-Types,
+// sizes, and SHA-256 digests, for services that mustn't log payloads.  The
+// digest of a response copied from a file costs the use of sendfile.
+//
+// MaxBodySize, if it's positive, limits how many bytes of each body are
+// logged, the rest being noted in a line after the handler returns.  If
+// there's a BodySpiller, bodies that are too long are written to files in
+// full and that line names the file and the body's SHA-256 digest.
+//
+// Requests that arrived on a connection with a ConnectionID, as those
+// served by a Server do, are followed by a line giving it, so that requests
+// made over the same connection can be grouped.
+//
+// Range headers and the responses to them are summarized at LogHeaders in a
+// line of key=value pairs after the headers: the ranges requested and the
+// range satisfied, its length, and the total size, so that partial content
+// can be audited.
+//
+// Labels, like the pod, worker, or availability zone, begin every line as
+// name=value pairs, sorted by name, so that lines can be told apart without
+// enrichment by whatever collects them.  They're formatted once, on the
+// first request, so they must be set before serving.
+//
+// Format, if it's set, changes the markers and separators of each line and
+// may prefix each with more about the request.
+//
+// If Logger is a BytesLogger, lines are logged as byte slices so that bodies
+// needn't be copied into strings, redacted by BytesRedactor instead of the
+// Redactor if it's set.  If it isn't and there is a Redactor, lines are
+// logged as strings so they can be redacted.
 type MultilineLogger struct {
 	Logger           Logger
+	BodySpiller      *BodySpiller
+	BytesRedactor    BytesRedactor
+	Format           *LogFormat
+	Labels           map[string]string
+	Level            LogLevel
+	MaxBodySize      int
+	NoBody           bool
+	SortHeaders      bool
+	RequestLevel     func(r *http.Request) LogLevel
 	handler          http.Handler
+	labels           string
+	labelsOnce       sync.Once
 	redactor         Redactor
 	RequestIDCreator RequestIDCreator
 }
@@ -33,10 +99,23 @@ func Logged(handler http.Handler, redactor Redactor) *MultilineLogger {
 		Logger:           log.New(os.Stdout, "", log.Ltime|log.Lmicroseconds),
 		handler:          handler,
 		redactor:         redactor,
+		Level:            LogBodies,
 		RequestIDCreator: requestIDCreator,
 	}
 }
 
+// A LogLevel is how much MultilineLogger logs about a request.  Each level
+// logs everything the ones below it do.
+type LogLevel int
+
+const (
+	LogNothing       LogLevel = iota
+	LogStatusLines            // request and status lines and warnings
+	LogHeaders                // request and response headers and trailers
+	LogBodySummaries          // Content-Type, size, and digest of each body
+	LogBodies                 // request and response bodies or their sizes
+)
+
 // Output overrides log.Logger's Output method, calling our redactor first.
 func (l *MultilineLogger) Output(calldepth int, s string) error {
 	if nil != l.redactor {
@@ -64,30 +143,182 @@ func (l *MultilineLogger) Println(v ...interface{}) {
 // output and pass through to the underlying http.Handler.
 func (l *MultilineLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	requestID := l.RequestIDCreator(r)
-	l.Printf(
-		"%s > %s %s %s",
-		requestID,
-		r.Method,
-		r.URL.RequestURI(),
-		r.Proto,
-	)
-	for key, values := range r.Header {
-		for _, value := range values {
-			l.Printf("%s > %s: %s", requestID, key, value)
+	trackRequestID(r, requestID)
+	level := l.Level
+	if nil != l.RequestLevel {
+		level = l.RequestLevel(r)
+	}
+	if l.NoBody && LogHeaders < level {
+		level = LogHeaders
+	}
+	lw := &multilineLoggerResponseWriter{
+		recordingResponseWriter: &recordingResponseWriter{ResponseWriter: w},
+		MultilineLogger:         l,
+		request:                 r,
+		requestID:               requestID,
+		level:                   level,
+		lines:                   getLogBuffers(),
+		logMarks:                l.Format.marks(r, requestID),
+	}
+	l.labelsOnce.Do(func() {
+		if 0 < len(l.Labels) {
+			l.labels = formatLabels(l.Labels, lw.sep) + lw.sep
+		}
+	})
+	if "" != l.labels {
+		lw.lead = l.labels + lw.lead
+	}
+	defer putLogBuffers(lw.lines)
+	id, lead := string(requestID), lw.lead
+	streamID, streamKnown := h2StreamID(r)
+	if lw.logs(LogStatusLines) {
+		l.logLine(&lw.lines.in, lead, lw.in, r.Method, lw.sep, r.URL.RequestURI(), lw.sep, r.Proto)
+		if 2 == r.ProtoMajor {
+			lw.logHTTP2(streamID, streamKnown)
+		}
+		if connectionID := ConnectionIDFromContext(r.Context()); "" != connectionID {
+			l.logLine(&lw.lines.in, lead, lw.sep, "connection ", string(connectionID))
+		}
+	}
+	if lw.logs(LogHeaders) {
+		l.eachHeader(r.Header, func(key, value string) {
+			if "Authorization" == key {
+				value = redactBasicAuth(value)
+			}
+			l.logLine(&lw.lines.in, lead, lw.in, key, lw.header, value)
+		})
+		if value := r.Header.Get("Range"); "" != value {
+			l.logLine(&lw.lines.in, lead, lw.in, "range ", describeRangeRequest(value))
+		}
+		l.logLine(&lw.lines.in, lead, lw.inEnd)
+	}
+	if lw.logs(LogBodies) {
+		r.Body = &teeReadCloser{
+			ReadCloser: r.Body,
+			onRead: func(p []byte) {
+				if nil == r.Context().Err() {
+					lw.logBodyChunk(&lw.requestBody, &lw.lines.in, lw.in, p)
+				}
+			},
 		}
+	} else if lw.logs(LogBodySummaries) {
+		r.Body = &teeReadCloser{ReadCloser: r.Body, onRead: lw.requestSummary.write}
 	}
-	l.Println(requestID, ">")
-	r.Body = &multilineLoggerReadCloser{
-		ReadCloser:      r.Body,
-		MultilineLogger: l,
-		requestID:       requestID,
+	ctx := context.WithValue(r.Context(), requestIDKey{}, requestID)
+	ctx = context.WithValue(ctx, loggerResponseWriterKey{}, lw)
+	attachResponseRecord(ctx, lw.recordingResponseWriter)
+	if l.NoBody {
+		lw.KeepHeader = lw.KeepHeader || lw.logs(LogHeaders)
+		l.serve(exposeOptional(lw.recordingResponseWriter), r, ctx, id)
+		if !lw.disconnected() {
+			code, header := http.StatusOK, lw.Header()
+			if lw.WroteHeader {
+				code, header = lw.StatusCode, lw.SentHeader
+			}
+			lw.logResponseHeader(code, header)
+			lw.logTrailers()
+		}
+		return
+	}
+	l.serve(exposeOptional(lw), r, ctx, id)
+	lw.logBodyRemainder(&lw.requestBody, lw.in)
+	lw.logBodySummary(&lw.requestSummary, lw.in, r.Header)
+	if !lw.disconnected() {
+		lw.logBodyRemainder(&lw.responseBody, lw.out)
+		lw.logBodySummary(&lw.responseSummary, lw.out, lw.Header())
+		lw.logTrailers()
+	}
+}
+
+// serve calls the handler with the RequestID as a runtime/pprof label so
+// CPU profiles can be sliced by request, and by route if a mux like
+// TrieServeMux adds it.
+func (l *MultilineLogger) serve(w http.ResponseWriter, r *http.Request, ctx context.Context, id string) {
+	pprof.Do(ctx, pprof.Labels("request_id", id), func(ctx context.Context) {
+		l.handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// eachHeader calls f with each header value, in the order of the header
+// names if SortHeaders is set.
+func (l *MultilineLogger) eachHeader(header http.Header, f func(name, value string)) {
+	if !l.SortHeaders {
+		for name, values := range header {
+			for _, value := range values {
+				f(name, value)
+			}
+		}
+		return
+	}
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			f(name, value)
+		}
 	}
-	l.handler.ServeHTTP(&multilineLoggerResponseWriter{
-		ResponseWriter:  w,
-		MultilineLogger: l,
-		request:         r,
-		requestID:       requestID,
-	}, r)
+}
+
+// Deterministic makes what's logged the same from run to run, for tests of
+// services using Logged.  RequestIDs are sequential, headers are sorted, and
+// times are DeterministicTime.  Loggers other than WriterLoggers are
+// replaced by WriterLoggers writing to the same io.Writer if they're
+// log.Loggers, losing their prefixes.
+func (l *MultilineLogger) Deterministic() {
+	l.RequestIDCreator = SequentialRequestIDCreator()
+	l.SortHeaders = true
+	switch logger := l.Logger.(type) {
+	case *WriterLogger:
+		logger.Clock = FixedClock(DeterministicTime)
+	case *log.Logger:
+		wl := NewWriterLogger(logger.Writer())
+		if 0 == logger.Flags()&(log.Ldate|log.Ltime|log.Lmicroseconds) {
+			wl.TimeFormat = ""
+		}
+		wl.Clock = FixedClock(DeterministicTime)
+		l.Logger = wl
+	}
+}
+
+// logLine logs the concatenation of parts, building it in buf, which is
+// reused from line to line, so that the only allocation per line is the
+// string passed to Output.
+func (l *MultilineLogger) logLine(buf *[]byte, parts ...string) {
+	b := (*buf)[:0]
+	for _, part := range parts {
+		b = append(b, part...)
+	}
+	*buf = b
+	l.output(b)
+}
+
+// logBody logs a chunk of a body after prefix, building the line in buf like
+// logLine.  A trailing newline is dropped since Output adds one.
+func (l *MultilineLogger) logBody(buf *[]byte, id, prefix string, p []byte) {
+	if 0 < len(p) && '\n' == p[len(p)-1] {
+		p = p[:len(p)-1]
+	}
+	b := append((*buf)[:0], id...)
+	b = append(b, prefix...)
+	b = append(b, p...)
+	*buf = b
+	l.output(b)
+}
+
+// output logs a line built by logLine or logBody, as a byte slice if the
+// Logger is a BytesLogger and it can be redacted as one.
+func (l *MultilineLogger) output(b []byte) {
+	if bl, ok := l.Logger.(BytesLogger); ok && (nil == l.redactor || nil != l.BytesRedactor) {
+		if nil != l.BytesRedactor {
+			b = l.BytesRedactor(b)
+		}
+		bl.OutputBytes(4, b)
+		return
+	}
+	l.Output(4, string(b))
 }
 
 // A Redactor is a function that takes and returns a string.  It is called
@@ -107,66 +338,300 @@ func requestIDCreator(r *http.Request) RequestID {
 	return NewRequestID()
 }
 
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the RequestID given to a request by Logged,
+// or the empty string if the request isn't being logged.
+func RequestIDFromContext(ctx context.Context) RequestID {
+	requestID, _ := ctx.Value(requestIDKey{}).(RequestID)
+	return requestID
+}
+
 // NewRequestID returns a new 16-character random RequestID.
 func NewRequestID() RequestID {
 	return RequestID(RandomBase62Bytes(16))
 }
 
-type multilineLoggerReadCloser struct {
-	io.ReadCloser
+// SequentialRequestIDCreator returns a RequestIDCreator that gives requests
+// 16-digit RequestIDs counting up from 0000000000000001.
+func SequentialRequestIDCreator() RequestIDCreator {
+	var n int64
+	return func(r *http.Request) RequestID {
+		return RequestID(fmt.Sprintf("%016d", atomic.AddInt64(&n, 1)))
+	}
+}
+
+type multilineLoggerResponseWriter struct {
+	*recordingResponseWriter
 	*MultilineLogger
-	requestID RequestID
+	request      *http.Request
+	requestID    RequestID
+	level        LogLevel
+	bodyMetadata string
+	disconnect   bool
+	lines        *logBuffers
+	logMarks
+	requestBody  spilledBody
+	responseBody spilledBody
+
+	requestSummary, responseSummary bodySummary
 }
 
-func (r *multilineLoggerReadCloser) Read(p []byte) (int, error) {
-	n, err := r.ReadCloser.Read(p)
-	if 0 < n {
-		r.Println(r.requestID, ">", string(p[:n]))
+type loggerResponseWriterKey struct{}
+
+// logBodyMetadata logs a description of the response body in place of the
+// body itself if the request is being logged.
+func logBodyMetadata(r *http.Request, format string, v ...interface{}) {
+	w, ok := r.Context().Value(loggerResponseWriterKey{}).(*multilineLoggerResponseWriter)
+	if !ok || !w.logs(LogBodies) {
+		return
+	}
+	w.bodyMetadata = fmt.Sprintf(format, v...)
+	if w.WroteHeader {
+		var b []byte
+		w.logLine(&b, w.lead, w.out, "[", w.bodyMetadata, "]")
 	}
-	return n, err
 }
 
-type multilineLoggerResponseWriter struct {
-	http.Flusher
-	http.ResponseWriter
-	*MultilineLogger
-	request     *http.Request
-	requestID   RequestID
-	wroteHeader bool
+// logRequestLine logs a line under the request's RequestID if the request
+// is being logged.
+func logRequestLine(r *http.Request, format string, v ...interface{}) {
+	w, ok := r.Context().Value(loggerResponseWriterKey{}).(*multilineLoggerResponseWriter)
+	if !ok || !w.logs(LogStatusLines) {
+		return
+	}
+	var b []byte
+	w.logLine(&b, w.lead, w.sep, fmt.Sprintf(format, v...))
+}
+
+// logs reports whether lines of the given level are logged.
+func (w *multilineLoggerResponseWriter) logs(level LogLevel) bool {
+	return level <= w.level
 }
 
-func (w *multilineLoggerResponseWriter) Flush() {
-	if f, ok := w.ResponseWriter.(http.Flusher); ok {
-		f.Flush()
+// disconnected reports whether the client has gone away, or reset the
+// request's stream if it's HTTP/2, in which case logging stops after a line
+// saying how much of the response was written.
+func (w *multilineLoggerResponseWriter) disconnected() bool {
+	if w.disconnect {
+		return true
 	}
+	if !errors.Is(w.request.Context().Err(), context.Canceled) {
+		return false
+	}
+	w.disconnect = true
+	if !w.logs(LogStatusLines) {
+		return true
+	}
+	if 2 == w.request.ProtoMajor {
+		w.logLine(&w.lines.out, w.lead, w.sep, "client reset the stream after ", strconv.FormatInt(w.Size, 10), " bytes of the response")
+		return true
+	}
+	w.logLine(&w.lines.out, w.lead, w.sep, "client disconnected after ", strconv.FormatInt(w.Size, 10), " bytes of the response")
+	return true
+}
+
+// logHTTP2 logs whether an HTTP/2 request arrived with TLS, as h2, or
+// without, as h2c, and on which stream if that can be told.
+func (w *multilineLoggerResponseWriter) logHTTP2(streamID uint32, streamKnown bool) {
+	protocol := "h2c"
+	if nil != w.request.TLS {
+		protocol = "h2"
+	}
+	if streamKnown {
+		w.logLine(&w.lines.in, w.lead, w.sep, protocol, " stream ", strconv.FormatUint(uint64(streamID), 10))
+		return
+	}
+	w.logLine(&w.lines.in, w.lead, w.sep, protocol)
+}
+
+// logTrailers logs the trailers the handler set once it's returned, both
+// those declared in the Trailer header and those named with
+// http.TrailerPrefix, as net/http sends them.
+func (w *multilineLoggerResponseWriter) logTrailers() {
+	if !w.WroteHeader || !w.logs(LogHeaders) {
+		return
+	}
+	header := w.Header()
+	for _, name := range splitHeader(header, "Trailer") {
+		for _, value := range header.Values(name) {
+			w.logLine(&w.lines.out, w.lead, w.out, "trailer ", http.CanonicalHeaderKey(name), w.header, value)
+		}
+	}
+	w.eachHeader(header, func(name, value string) {
+		if strings.HasPrefix(name, http.TrailerPrefix) {
+			w.logLine(&w.lines.out, w.lead, w.out, "trailer ", strings.TrimPrefix(name, http.TrailerPrefix), w.header, value)
+		}
+	})
+}
+
+// push logs the target and pushes it to the client.  It's only exposed as
+// http.Pusher when the connection supports HTTP/2 server push.
+func (w *multilineLoggerResponseWriter) push(target string, opts *http.PushOptions) error {
+	if w.logs(LogHeaders) {
+		w.logLine(&w.lines.out, w.lead, w.out, "push ", target)
+	}
+	return w.recordingResponseWriter.push(target, opts)
+}
+
+// ReadFrom passes the copy through so that copies from files may still use
+// sendfile, logging the size of the body in place of the body itself.  When
+// bodies are summarized, the copy is read through the digest instead.
+func (w *multilineLoggerResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !w.WroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.level == LogBodySummaries && !w.disconnected() {
+		src = io.TeeReader(src, &w.responseSummary)
+	}
+	n, err := w.recordingResponseWriter.ReadFrom(src)
+	if "" == w.bodyMetadata && !w.disconnected() && w.logs(LogBodies) {
+		w.logLine(&w.lines.out, w.lead, w.out, "[", strconv.FormatInt(n, 10), " bytes]")
+	}
+	return n, err
 }
 
 func (w *multilineLoggerResponseWriter) Write(p []byte) (int, error) {
-	if !w.wroteHeader {
+	if !w.WroteHeader {
 		w.WriteHeader(http.StatusOK)
 	}
-	if len(p) > 0 && '\n' == p[len(p)-1] {
-		w.Println(w.requestID, "<", string(p[:len(p)-1]))
-	} else {
-		w.Println(w.requestID, "<", string(p))
+	if "" != w.bodyMetadata || w.disconnected() || !w.logs(LogBodies) {
+		if w.level == LogBodySummaries && !w.disconnected() {
+			w.responseSummary.write(p)
+		}
+		return w.recordingResponseWriter.Write(p)
 	}
-	return w.ResponseWriter.Write(p)
+	w.logBodyChunk(&w.responseBody, &w.lines.out, w.out, p)
+	return w.recordingResponseWriter.Write(p)
 }
 
-func (w *multilineLoggerResponseWriter) WriteHeader(code int) {
-	w.wroteHeader = true
-	w.Printf(
-		"%s < %s %d %s",
-		w.requestID,
-		w.request.Proto,
-		code,
-		http.StatusText(code),
+// logBodyChunk logs a chunk of a body, or as much of it as MaxBodySize
+// allows, spilling the rest if there's a BodySpiller.
+func (w *multilineLoggerResponseWriter) logBodyChunk(body *spilledBody, buf *[]byte, prefix string, p []byte) {
+	if 0 < w.MaxBodySize {
+		direction := "response"
+		if &w.requestBody == body {
+			direction = "request"
+		}
+		if p = body.write(w.MultilineLogger, w.requestID, direction, p); 0 == len(p) {
+			return
+		}
+	}
+	w.logBody(buf, w.lead, prefix, p)
+}
+
+// logBodyRemainder logs how much of a body was too long to log, and where
+// it was spilled, once the handler's returned.
+func (w *multilineLoggerResponseWriter) logBodyRemainder(body *spilledBody, marker string) {
+	if 0 >= w.MaxBodySize {
+		return
+	}
+	if description, ok := body.close(w.MultilineLogger); ok {
+		w.logLine(&w.lines.out, w.lead, marker, "[", description, "]")
+	}
+}
+
+// logBodySummary logs the Content-Type, size, and SHA-256 digest of a body
+// that was summarized rather than logged, once the handler's returned.
+func (w *multilineLoggerResponseWriter) logBodySummary(body *bodySummary, marker string, header http.Header) {
+	if nil == body.hash {
+		return
+	}
+	contentType := header.Get("Content-Type")
+	if "" == contentType {
+		contentType = "unknown type"
+	}
+	w.logLine(
+		&w.lines.out,
+		w.lead,
+		marker,
+		"[",
+		contentType,
+		", ",
+		strconv.FormatInt(body.n, 10),
+		" bytes, sha256=",
+		hex.EncodeToString(body.hash.Sum(nil)),
+		"]",
 	)
-	for name, values := range w.Header() {
-		for _, value := range values {
-			w.Printf("%s < %s: %s", w.requestID, name, value)
+}
+
+// bodySummary counts and digests a body in place of logging it.  Its hash
+// is nil until the body's first byte.
+type bodySummary struct {
+	hash hash.Hash
+	n    int64
+}
+
+func (b *bodySummary) Write(p []byte) (int, error) {
+	b.write(p)
+	return len(p), nil
+}
+
+func (b *bodySummary) write(p []byte) {
+	if 0 == len(p) {
+		return
+	}
+	if nil == b.hash {
+		b.hash = sha256.New()
+	}
+	b.hash.Write(p)
+	b.n += int64(len(p))
+}
+
+// WriteHeader logs the status and headers.  Calls after the header's been
+// written are logged as a warning with both status codes and otherwise
+// ignored rather than passed on for net/http to complain about without
+// saying which request it was.
+func (w *multilineLoggerResponseWriter) WriteHeader(code int) {
+	if w.WroteHeader {
+		if !w.logs(LogStatusLines) {
+			return
 		}
+		w.logLine(
+			&w.lines.out,
+			w.lead,
+			w.sep,
+			"superfluous WriteHeader(",
+			strconv.Itoa(code),
+			") ignored; already wrote ",
+			strconv.Itoa(w.StatusCode),
+		)
+		return
+	}
+	if !w.disconnected() {
+		w.logResponseHeader(code, w.Header())
+	}
+	w.recordingResponseWriter.WriteHeader(code)
+}
+
+// logResponseHeader logs the status line and, depending on the level, the
+// headers of the response.
+func (w *multilineLoggerResponseWriter) logResponseHeader(code int, header http.Header) {
+	if !w.logs(LogStatusLines) {
+		return
+	}
+	b := append(w.lines.out[:0], w.lead...)
+	b = append(b, w.out...)
+	b = append(b, w.request.Proto...)
+	b = append(b, w.sep...)
+	b = strconv.AppendInt(b, int64(code), 10)
+	b = append(b, w.sep...)
+	b = append(b, http.StatusText(code)...)
+	w.lines.out = b
+	w.output(b)
+	if !w.logs(LogHeaders) {
+		return
+	}
+	w.eachHeader(header, func(name, value string) {
+		if !strings.HasPrefix(name, http.TrailerPrefix) {
+			w.logLine(&w.lines.out, w.lead, w.out, name, w.header, value)
+		}
+	})
+	if "" != w.request.Header.Get("Range") || "" != header.Get("Content-Range") {
+		w.logLine(&w.lines.out, w.lead, w.out, "range ", describeRangeResponse(code, header))
+	}
+	w.logLine(&w.lines.out, w.lead, w.outEnd)
+	if "" != w.bodyMetadata {
+		w.logLine(&w.lines.out, w.lead, w.out, "[", w.bodyMetadata, "]")
 	}
-	w.Println(w.requestID, "<")
-	w.ResponseWriter.WriteHeader(code)
 }
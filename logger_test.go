@@ -0,0 +1,404 @@
+package marshaler
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testPusherResponseWriter struct {
+	testResponseWriter
+	pushed []string
+}
+
+func (w *testPusherResponseWriter) Push(target string, opts *http.PushOptions) error {
+	w.pushed = append(w.pushed, target)
+	return nil
+}
+
+func TestLoggedPush(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pusher, ok := w.(http.Pusher)
+		if !ok {
+			t.Fatal("not a Pusher")
+		}
+		if err := pusher.Push("/app.js", nil); nil != err {
+			t.Fatal(err)
+		}
+	}), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	w := &testPusherResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	l.ServeHTTP(w, r)
+	if 1 != len(w.pushed) || "/app.js" != w.pushed[0] {
+		t.Fatal(w.pushed)
+	}
+	if !strings.Contains(buf.String(), "foo < push /app.js") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestLoggedOptionalInterfaces(t *testing.T) {
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Pusher); ok {
+			t.Fatal("Pusher")
+		}
+		if _, ok := w.(http.Flusher); ok {
+			t.Fatal("Flusher")
+		}
+		if _, ok := w.(http.Hijacker); ok {
+			t.Fatal("Hijacker")
+		}
+	}), nil)
+	l.Logger = log.New(&bytes.Buffer{}, "", 0)
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	l.ServeHTTP(&testResponseWriter{}, r)
+}
+
+type testReaderFromResponseWriter struct {
+	testResponseWriter
+	readFrom bool
+}
+
+func (w *testReaderFromResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.readFrom = true
+	return w.Body.ReadFrom(src)
+}
+
+func TestLoggedReadFrom(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, struct{ io.Reader }{strings.NewReader("secret contents")})
+	}), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	w := &testReaderFromResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	l.ServeHTTP(w, r)
+	if !w.readFrom || "secret contents" != w.Body.String() {
+		t.Fatal(w.readFrom, w.Body.String())
+	}
+	if strings.Contains(buf.String(), "secret") || !strings.Contains(buf.String(), "foo < [15 bytes]") {
+		t.Fatal(buf.String())
+	}
+	plain := &testResponseWriter{}
+	l.ServeHTTP(plain, r)
+	if "secret contents" != plain.Body.String() {
+		t.Fatal(plain.Body.String())
+	}
+}
+
+func TestLoggedResponseController(t *testing.T) {
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("not a Flusher")
+		}
+		if _, ok := w.(http.Hijacker); !ok {
+			t.Error("not a Hijacker")
+		}
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(time.Now().Add(time.Minute)); nil != err {
+			t.Error(err)
+		}
+		if err := rc.EnableFullDuplex(); nil != err {
+			t.Error(err)
+		}
+		io.WriteString(w, "ok")
+	}), nil)
+	l.Logger = log.New(io.Discard, "", 0)
+	s := httptest.NewServer(l)
+	defer s.Close()
+	res, err := http.Get(s.URL)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if "ok" != string(body) {
+		t.Fatal(string(body))
+	}
+}
+
+func TestLoggedSuperfluousWriteHeader(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.WriteHeader(http.StatusInternalServerError)
+	}), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	l.ServeHTTP(w, r)
+	if http.StatusCreated != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if !strings.Contains(buf.String(), "foo superfluous WriteHeader(500) ignored; already wrote 201") {
+		t.Fatal(buf.String())
+	}
+	if 1 != strings.Count(buf.String(), "foo < HTTP/1.1") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestLoggedResponseRecord(t *testing.T) {
+	var inner *ResponseRecord
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner = ResponseRecordFromContext(r.Context())
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusAccepted)
+		w.Header().Set("X-Too-Late", "true")
+		io.WriteString(w, "accepted")
+	}), nil)
+	l.Logger = log.New(io.Discard, "", 0)
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r, record := WithResponseRecord(r)
+	if 0 != record.StatusCode() || nil != record.Header() {
+		t.Fatal(record.StatusCode(), record.Header())
+	}
+	l.ServeHTTP(&testResponseWriter{}, r)
+	if record != inner {
+		t.Fatal(inner)
+	}
+	if http.StatusAccepted != record.StatusCode() || 8 != record.Size() {
+		t.Fatal(record.StatusCode(), record.Size())
+	}
+	if "text/plain" != record.Header().Get("Content-Type") || "" != record.Header().Get("X-Too-Late") {
+		t.Fatal(record.Header())
+	}
+}
+
+func TestLoggedTrailers(t *testing.T) {
+	var buf testSyncBuffer
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "body")
+		w.Header().Set("X-Checksum", "abc")
+		w.Header().Set(http.TrailerPrefix+"X-Count", "1")
+	}), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	s := httptest.NewServer(l)
+	defer s.Close()
+	res, err := http.Get(s.URL)
+	if nil != err {
+		t.Fatal(err)
+	}
+	io.ReadAll(res.Body)
+	res.Body.Close()
+	if "abc" != res.Trailer.Get("X-Checksum") || "1" != res.Trailer.Get("X-Count") {
+		t.Fatal(res.Trailer)
+	}
+	if !strings.Contains(buf.String(), "foo < Trailer: X-Checksum\n") {
+		t.Fatal(buf.String())
+	}
+	if !strings.Contains(buf.String(), "foo < body\nfoo < trailer X-Checksum: abc\n") {
+		t.Fatal(buf.String())
+	}
+	if !strings.Contains(buf.String(), "foo < trailer X-Count: 1\n") {
+		t.Fatal(buf.String())
+	}
+}
+
+func BenchmarkLogged(b *testing.B) {
+	benchmarkLogged(b, func(l *MultilineLogger) {})
+}
+
+func benchmarkLogged(b *testing.B, configure func(l *MultilineLogger)) {
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "{\"foo\":\"bar\"}\n")
+	}), nil)
+	l.Logger = log.New(io.Discard, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	configure(l)
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Accept", "application/json")
+	r.Header.Set("User-Agent", "benchmark")
+	r.Header.Set("X-Forwarded-For", "192.0.2.1")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.ServeHTTP(&testResponseWriter{}, r)
+	}
+}
+
+func TestLoggedLevels(t *testing.T) {
+	for level, want := range map[LogLevel]string{
+		LogNothing:     "",
+		LogStatusLines: "foo > POST /foo HTTP/1.1\nfoo < HTTP/1.1 200 OK\n",
+		LogHeaders:     "foo > POST /foo HTTP/1.1\nfoo > Accept: text/plain\nfoo >\nfoo < HTTP/1.1 200 OK\nfoo < Content-Type: text/plain\nfoo <\n",
+		LogBodySummaries: "foo > POST /foo HTTP/1.1\nfoo > Accept: text/plain\nfoo >\nfoo < HTTP/1.1 200 OK\nfoo < Content-Type: text/plain\nfoo <\n" +
+			"foo > [unknown type, 4 bytes, sha256=758d61f26a44448384e5c4468a0dcb7a2abe456067b0f7b505bc28b9411fe931]\n",
+		LogBodies: "foo > POST /foo HTTP/1.1\nfoo > Accept: text/plain\nfoo >\nfoo > ping\nfoo < HTTP/1.1 200 OK\nfoo < Content-Type: text/plain\nfoo <\nfoo < [pong]\n",
+	} {
+		var buf bytes.Buffer
+		l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "text/plain")
+			logBodyMetadata(r, "%s", "pong")
+			w.WriteHeader(http.StatusOK)
+		}), nil)
+		l.Logger = log.New(&buf, "", 0)
+		l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+		l.Level = LogNothing
+		l.RequestLevel = func(r *http.Request) LogLevel { return level }
+		r, _ := http.NewRequest("POST", "http://example.com/foo", strings.NewReader("ping"))
+		r.Header.Set("Accept", "text/plain")
+		l.ServeHTTP(&testResponseWriter{}, r)
+		if want != buf.String() {
+			t.Fatal(level, buf.String())
+		}
+	}
+}
+
+func TestLoggedBodySummaries(t *testing.T) {
+	for name, write := range map[string]func(w http.ResponseWriter){
+		"Write":    func(w http.ResponseWriter) { io.WriteString(w, "pong") },
+		"ReadFrom": func(w http.ResponseWriter) { w.(io.ReaderFrom).ReadFrom(strings.NewReader("pong")) },
+	} {
+		var buf bytes.Buffer
+		l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "text/plain")
+			write(w)
+		}), nil)
+		l.Logger = log.New(&buf, "", 0)
+		l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+		l.Level = LogBodySummaries
+		r, _ := http.NewRequest("POST", "http://example.com/foo", strings.NewReader("ping"))
+		r.Header.Set("Content-Type", "application/octet-stream")
+		w := &testResponseWriter{}
+		l.ServeHTTP(w, r)
+		if "pong" != w.Body.String() {
+			t.Fatal(name, w.Body.String())
+		}
+		if strings.Contains(buf.String(), "ping") || strings.Contains(buf.String(), "pong") {
+			t.Fatal(name, buf.String())
+		}
+		for _, want := range []string{
+			"foo > [application/octet-stream, 4 bytes, sha256=758d61f26a44448384e5c4468a0dcb7a2abe456067b0f7b505bc28b9411fe931]\n",
+			"foo < [text/plain, 4 bytes, sha256=9795c5ff8937f23526ccb207a5684c1fc94a7854e19c021b39d944e51f5baef2]\n",
+		} {
+			if !strings.Contains(buf.String(), want) {
+				t.Fatal(name, buf.String())
+			}
+		}
+	}
+}
+
+func TestLoggedNoBody(t *testing.T) {
+	var buf bytes.Buffer
+	var body io.ReadCloser
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = r.Body
+		if _, ok := w.(*multilineLoggerResponseWriter); ok {
+			t.Fatal("Write intercepted")
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "pong")
+		w.Header().Set("X-Too-Late", "true")
+	}), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	l.NoBody = true
+	r, _ := http.NewRequest("POST", "http://example.com/foo", strings.NewReader("ping"))
+	w := &testResponseWriter{}
+	l.ServeHTTP(w, r)
+	if r.Body != body {
+		t.Fatal("request body wrapped")
+	}
+	if "pong" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+	if "foo > POST /foo HTTP/1.1\nfoo >\nfoo < HTTP/1.1 200 OK\nfoo < Content-Type: text/plain\nfoo <\n" != buf.String() {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestLoggedProfilerLabels(t *testing.T) {
+	mux := NewTrieServeMux()
+	mux.Handle("GET", "/users/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, _ := pprof.Label(r.Context(), "request_id"); "foo" != id {
+			t.Fatal(id)
+		}
+		if route, _ := pprof.Label(r.Context(), "route"); "/users/{id}" != route {
+			t.Fatal(route)
+		}
+	}))
+	l := Logged(mux, nil)
+	l.Logger = log.New(io.Discard, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	r, _ := http.NewRequest("GET", "http://example.com/users/1", nil)
+	l.ServeHTTP(&testResponseWriter{}, r)
+}
+
+func BenchmarkLoggedStatusLines(b *testing.B) {
+	benchmarkLogged(b, func(l *MultilineLogger) { l.Level = LogStatusLines })
+}
+
+func BenchmarkLoggedNoBody(b *testing.B) {
+	benchmarkLogged(b, func(l *MultilineLogger) { l.NoBody = true })
+}
+
+func BenchmarkLoggedMarshaler(b *testing.B) {
+	l := Logged(Handler(func(u *url.URL, h http.Header, rq *testRequest) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, nil, &testResponse{rq.Foo}, nil
+	}), nil)
+	l.Logger = log.New(io.Discard, "", 0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r, _ := http.NewRequest("POST", "http://example.com/foo", strings.NewReader(`{"foo":"bar"}`))
+		r.Header.Set("Content-Type", "application/json")
+		l.ServeHTTP(&testResponseWriter{}, r)
+	}
+}
+
+func TestLoggedDeterministic(t *testing.T) {
+	run := func() string {
+		var buf bytes.Buffer
+		l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, name := range []string{"X-C", "X-A", "X-B", "X-D"} {
+				w.Header().Set(name, "1")
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}), nil)
+		l.Logger = log.New(&buf, "", log.Ltime|log.Lmicroseconds)
+		l.Deterministic()
+		for i := 0; i < 2; i++ {
+			r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+			r.Header.Set("Accept", "*/*")
+			r.Header.Set("User-Agent", "test")
+			l.ServeHTTP(&testResponseWriter{}, r)
+		}
+		return buf.String()
+	}
+	got := run()
+	if run() != got {
+		t.Fatal(got)
+	}
+	want := "00:00:00.000000 0000000000000002 > GET /foo HTTP/1.1\n" +
+		"00:00:00.000000 0000000000000002 > Accept: */*\n" +
+		"00:00:00.000000 0000000000000002 > User-Agent: test\n" +
+		"00:00:00.000000 0000000000000002 >\n" +
+		"00:00:00.000000 0000000000000002 < HTTP/1.1 204 No Content\n" +
+		"00:00:00.000000 0000000000000002 < X-A: 1\n" +
+		"00:00:00.000000 0000000000000002 < X-B: 1\n" +
+		"00:00:00.000000 0000000000000002 < X-C: 1\n" +
+		"00:00:00.000000 0000000000000002 < X-D: 1\n" +
+		"00:00:00.000000 0000000000000002 <\n"
+	if !strings.HasSuffix(got, want) {
+		t.Fatal(got)
+	}
+}
@@ -0,0 +1,90 @@
+package marshaler
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaintenanceRetryAfter is how long clients are told to wait while
+// a Maintenance handler is enabled.
+var DefaultMaintenanceRetryAfter = 5 * time.Minute
+
+// Maintenance is an http.Handler that, while enabled, answers all requests
+// 503 Service Unavailable with a Retry-After header instead of passing them
+// to the handler it wraps, except requests for paths beginning with one of
+// the Paths, like health checks, or from client addresses in the IPs
+// ranges, like operators'.  It may be enabled and disabled while serving, so
+// that deploys and migrations needn't redeploy configuration.
+type Maintenance struct {
+	RetryAfter     time.Duration
+	Paths          []string
+	IPs            []*net.IPNet
+	TrustedProxies []*net.IPNet
+	handler        http.Handler
+	mu             sync.RWMutex
+	enabled        bool
+	message        string
+}
+
+// MaintenanceMode returns a disabled Maintenance handler wrapping the given
+// handler.
+func MaintenanceMode(handler http.Handler) *Maintenance {
+	return &Maintenance{
+		RetryAfter: DefaultMaintenanceRetryAfter,
+		handler:    handler,
+	}
+}
+
+// Enable starts answering requests 503 with the given message.
+func (m *Maintenance) Enable(message string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enabled, m.message = true, message
+}
+
+// Disable resumes passing requests to the wrapped handler.
+func (m *Maintenance) Disable() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enabled = false
+}
+
+// Enabled reports whether maintenance mode is enabled.
+func (m *Maintenance) Enabled() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.enabled
+}
+
+func (m *Maintenance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.RLock()
+	enabled, message := m.enabled, m.message
+	m.mu.RUnlock()
+	if !enabled || m.exempt(r) {
+		m.handler.ServeHTTP(w, r)
+		return
+	}
+	if "" == message {
+		message = Message(r, "down for maintenance")
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(m.RetryAfter/time.Second)))
+	writeError(w, r, ServiceUnavailable{errors.New(message)})
+}
+
+func (m *Maintenance) exempt(r *http.Request) bool {
+	for _, path := range m.Paths {
+		if strings.HasPrefix(r.URL.Path, path) {
+			return true
+		}
+	}
+	if 0 == len(m.IPs) {
+		return false
+	}
+	ip := resolveClientIP(r, m.TrustedProxies)
+	return nil != ip && containsIP(m.IPs, ip)
+}
@@ -0,0 +1,47 @@
+package marshaler
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	m := MaintenanceMode(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	m.Paths = []string{"/healthz"}
+	m.IPs = MustParseCIDRs("10.0.0.0/8")
+	serve := func(path, remoteAddr string) *testResponseWriter {
+		w := &testResponseWriter{}
+		r, _ := http.NewRequest("GET", "http://example.com"+path, nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("Accept", "application/json")
+		m.ServeHTTP(w, r)
+		return w
+	}
+	if w := serve("/foo", "192.0.2.1:1234"); http.StatusNoContent != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	m.Enable("")
+	w := serve("/foo", "192.0.2.1:1234")
+	if http.StatusServiceUnavailable != w.StatusCode || "300" != w.Header().Get("Retry-After") {
+		t.Fatal(w.StatusCode, w.Header())
+	}
+	if "{\"description\":\"down for maintenance\",\"error\":\"marshaler.ServiceUnavailable\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+	if w := serve("/healthz", "192.0.2.1:1234"); http.StatusNoContent != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if w := serve("/foo", "10.0.0.1:1234"); http.StatusNoContent != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	m.Enable("migrating the database")
+	if w := serve("/foo", "192.0.2.1:1234"); "{\"description\":\"migrating the database\",\"error\":\"marshaler.ServiceUnavailable\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+	m.Disable()
+	if w := serve("/foo", "192.0.2.1:1234"); http.StatusNoContent != w.StatusCode || m.Enabled() {
+		t.Fatal(w.StatusCode)
+	}
+}
@@ -6,13 +6,65 @@ import (
 	"log"
 	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
 // Marshaler is an http.Handler that unmarshals JSON input, handles the request
 // via a function, and marshals JSON output.  It refuses to answer requests
-// without an Accept header that includes the application/json content type.
+// without an Accept header that includes the application/json content type
+// or the media type of a registered Codec, like BSONType.
+//
+// Response struct fields tagged with roles, like
+//
+//	Email string `json:"email" roles:"admin,support"`
+//
+// are only encoded if the request's Principal has one of the roles.
+//
+// Request struct fields tagged with query, path, header, or cookie, like
+//
+//	Limit  int    `query:"limit" default:"20"`
+//	User   int    `path:"user_id"`
+//	Tenant string `header:"X-Tenant-ID,required"`
+//	Token  string `cookie:"session"`
+//
+// are bound from the query string, the path parameters matched by a
+// pattern-matching mux, the request headers, or the request cookies, even for
+// requests without bodies.
 type Marshaler struct {
+
+	// MaskRestrictedFields causes fields hidden by their roles tags to be
+	// encoded with the value FieldMask rather than omitted.
+	MaskRestrictedFields bool
+
+	// ErrorMapper, if not nil, maps the errors returned by the handler
+	// function in place of DefaultErrorMapper.
+	ErrorMapper ErrorMapper
+
+	// TimeFormat, if not empty, is the format of time.Time values in
+	// requests and responses: UnixSeconds, UnixMilliseconds, or a layout
+	// like time.RFC1123 for time.Format.
+	TimeFormat string
+
+	// HumanDurations causes time.Duration values in requests and responses
+	// to be encoded as strings like "1m30s" rather than as nanoseconds.
+	HumanDurations bool
+
+	// BigNumbersAsStrings causes int, int64, uint, uint64, and registered
+	// big number values in responses to be encoded as JSON strings, which
+	// JavaScript clients can parse without losing precision, and accepts
+	// them as strings in requests.
+	BigNumbersAsStrings bool
+
+	// Canonical causes responses to be encoded as canonical JSON like
+	// MarshalCanonical encodes them, so that equal responses are always
+	// byte-for-byte identical.
+	Canonical bool
+
+	// Validator, if not nil, validates request structs after they're
+	// unmarshaled and bound in place of DefaultValidator.
+	Validator Validator
+
 	v reflect.Value
 }
 
@@ -21,7 +73,9 @@ type Marshaler struct {
 //
 //     func(*url.URL, http.Header, *Request) (int, http.Header, *Response)
 //
-// where Request and Response may be any struct type of your choosing.
+// where Request and Response may be any struct type of your choosing.  The
+// request argument may be omitted and a fourth argument of type
+// context.Context may follow it to receive the request's context.
 func Handler(i interface{}) *Marshaler {
 	t := reflect.TypeOf(i)
 	if reflect.Func != t.Kind() {
@@ -45,6 +99,12 @@ func Handler(i interface{}) *Marshaler {
 			t.In(1),
 		))
 	}
+	if 4 == t.NumIn() && "context.Context" != t.In(3).String() {
+		panic(NewMarshalerError(
+			"type of fourth argument was %v, not context.Context",
+			t.In(3),
+		))
+	}
 	if 4 != t.NumOut() {
 		panic(NewMarshalerError("output arity was %v, not 4", t.NumOut()))
 	}
@@ -72,24 +132,47 @@ func Handler(i interface{}) *Marshaler {
 			t.Out(3),
 		))
 	}
-	return &Marshaler{reflect.ValueOf(i)}
+	return &Marshaler{v: reflect.ValueOf(i)}
 }
 
 // ServeHTTP unmarshals JSON input, handles the request via the function, and
 // marshals JSON output.
 func (m *Marshaler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	wHeader := w.Header()
-	if !acceptJSON(r) {
+	mediaType, codec, ok := negotiateCodec(r)
+	want := "application/json"
+	if streamedType == m.v.Type().Out(2) {
+		mediaType, codec, ok, want = "", nil, acceptNDJSON(r), "application/x-ndjson"
+	}
+	if !ok {
 		wHeader.Set("Content-Type", "text/plain")
 		w.WriteHeader(http.StatusNotAcceptable)
-		fmt.Fprintf(
-			w,
-			"\"%s\" does not contain \"application/json\"",
+		fmt.Fprint(w, Message(
+			r,
+			"\"%s\" does not contain \"%s\"",
 			r.Header.Get("Accept"),
-		)
+			want,
+		))
 		return
 	}
-	wHeader.Set("Content-Type", "application/json")
+	if !acceptCharset(r) {
+		wHeader.Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusNotAcceptable)
+		fmt.Fprint(w, Message(
+			r,
+			"\"%s\" does not contain \"utf-8\"",
+			r.Header.Get("Accept-Charset"),
+		))
+		return
+	}
+	if nil != codec {
+		wHeader.Set("Content-Type", mediaType)
+	} else {
+		wHeader.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	if 0 < len(codecs) {
+		addVary(wHeader, "Accept")
+	}
 	var rq reflect.Value
 	if 2 < m.v.Type().NumIn() {
 		in2 := m.v.Type().In(2)
@@ -100,47 +183,88 @@ func (m *Marshaler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			// json.Unmarshal won't work on a non-pointer destination. We
 			// add a level indirection here, then deref it before .Call()
 			rq = reflect.New(in2)
+		} else if reflect.Chan == in2.Kind() {
+			rq = reflect.MakeChan(reflect.ChanOf(reflect.BothDir, in2.Elem()), 0)
 		} else {
 			rq = reflect.New(in2.Elem())
 		}
 	} else {
 		rq = nilRequest
 	}
-	if "PATCH" == r.Method || "POST" == r.Method || "PUT" == r.Method {
+	var stream *recordStream
+	if reflect.Chan == rq.Kind() {
+		var err error
+		if stream, err = streamRecords(w, r, rq); nil != err {
+			writeJSONError(w, err)
+			return
+		}
+		defer stream.Stop()
+	} else if "PATCH" == r.Method || "POST" == r.Method || "PUT" == r.Method {
 		if rq == nilRequest {
-			writeJSONError(w, NewMarshalerError(
+			writeJSONError(w, MarshalerError(Message(
+				r,
 				"empty interface is not suitable for %s request bodies",
 				r.Method,
-			))
+			)))
 			return
 		}
-		if !strings.HasPrefix(
+		patchType := patchContentType(r.Header.Get("Content-Type"))
+		requestCodec := requestCodec(r)
+		if patch, ok := rq.Interface().(*Patch); ok {
+			if "" == patchType {
+				writeJSONError(w, NewHTTPEquivError(MarshalerError(Message(
+					r,
+					"Content-Type header is %s, not %s or %s",
+					r.Header.Get("Content-Type"),
+					JSONPatchType,
+					MergePatchType,
+				)), http.StatusUnsupportedMediaType))
+				return
+			}
+			patch.ContentType = patchType
+		} else if nil == requestCodec && ("" != patchType || !strings.HasPrefix(
 			r.Header.Get("Content-Type"),
 			"application/json",
-		) {
-			writeJSONError(w, NewHTTPEquivError(NewMarshalerError(
+		)) {
+			writeJSONError(w, NewHTTPEquivError(MarshalerError(Message(
+				r,
 				"Content-Type header is %s, not application/json",
 				r.Header.Get("Content-Type"),
-			), http.StatusUnsupportedMediaType))
+			)), http.StatusUnsupportedMediaType))
 			return
 		}
-		decoder := reflect.ValueOf(json.NewDecoder(r.Body))
-		out := decoder.MethodByName("Decode").Call([]reflect.Value{rq})
-		if !out[0].IsNil() {
-			writeJSONError(w, NewHTTPEquivError(
-				out[0].Interface().(error),
-				http.StatusBadRequest,
-			))
+		var err error
+		if nil != requestCodec {
+			err = decodeCodec(r, requestCodec, rq.Interface())
+		} else {
+			err = m.decodeJSON(r, rq)
+		}
+		if nil != err {
+			writeJSONError(w, err)
 			return
 		}
 		r.Body.Close()
-	} else if nilRequest != rq {
+	} else if _, ok := rq.Interface().(PageParser); !ok && nilRequest != rq && !requestHasBindings(rq) {
 		log.Printf(
 			"%s request body isn't an empty interface; this is weird and is being ignored\n",
 			r.Method,
 		)
 	}
-	if reflect.Slice == rq.Elem().Kind() || reflect.Map == rq.Elem().Kind() {
+	if err := bindRequest(r, rq); nil != err {
+		writeJSONError(w, BadRequest{err})
+		return
+	}
+	if pageParser, ok := rq.Interface().(PageParser); ok {
+		if err := pageParser.ParsePage(r.URL.Query()); nil != err {
+			writeJSONError(w, BadRequest{err})
+			return
+		}
+	}
+	if errs := m.validate(rq); nil != errs {
+		writeValidationErrors(w, errs)
+		return
+	}
+	if reflect.Ptr == rq.Kind() && (reflect.Slice == rq.Elem().Kind() || reflect.Map == rq.Elem().Kind()) {
 		rq = rq.Elem()
 	}
 	var out []reflect.Value
@@ -156,14 +280,30 @@ func (m *Marshaler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			reflect.ValueOf(r.Header),
 			rq,
 		})
+	case 4:
+		out = m.v.Call([]reflect.Value{
+			reflect.ValueOf(r.URL),
+			reflect.ValueOf(r.Header),
+			rq,
+			reflect.ValueOf(r.Context()),
+		})
 	default:
 		panic(m.v.Type())
 	}
+	if nil != stream {
+		if err := stream.Err(); nil != err {
+			writeJSONError(w, BadRequest{err})
+			return
+		}
+	}
 	code := int(out[0].Int())
 	header := out[1].Interface().(http.Header)
 	rs := out[2].Interface()
 	if !out[3].IsNil() {
 		err := out[3].Interface().(error)
+		if m.mapError(w, err) {
+			return
+		}
 		if _, ok := err.(HTTPEquivError); ok {
 			writeJSONError(w, err)
 		} else {
@@ -179,12 +319,122 @@ func (m *Marshaler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
-	w.WriteHeader(code)
+	if file, ok := rs.(*FileResponse); ok && nil != file {
+		file.serve(w, r, code)
+		return
+	}
+	if streamed, ok := rs.(Streamed); ok && nil != streamed {
+		streamed.serve(w, r, code)
+		return
+	}
+	if linker, ok := rs.(Linker); ok && (out[2].Kind() != reflect.Ptr || !out[2].IsNil()) {
+		AddLinks(wHeader, linker.Links()...)
+	}
+	if setter, ok := rs.(CookieSetter); ok && (out[2].Kind() != reflect.Ptr || !out[2].IsNil()) {
+		SetCookies(wHeader, setter.Cookies()...)
+	}
+	body := getEncodeBuffer()
+	defer putEncodeBuffer(body)
 	if nil != rs && http.StatusNoContent != code && (out[2].Kind() != reflect.Ptr || !out[2].IsNil()) {
-		if err := json.NewEncoder(w).Encode(rs); nil != err {
+		opts := &encodeOptions{
+			principal:      PrincipalFromContext(r.Context()),
+			maskFields:     m.MaskRestrictedFields,
+			timeFormat:     m.TimeFormat,
+			humanDurations: m.HumanDurations,
+			bigNumbers:     m.BigNumbersAsStrings,
+			transforming:   "" != m.TimeFormat || m.HumanDurations || m.BigNumbersAsStrings,
+		}
+		prepared, err := opts.prepare(rs)
+		prepared, enveloped := envelop(r, prepared)
+		if nil == err && nil != codec {
+			var b []byte
+			if typed, ok := codec.(TypedCodec); ok {
+				b, err = typed.MarshalType(reflect.TypeOf(rs), prepared)
+			} else {
+				b, err = codec.Marshal(prepared)
+			}
+			if nil == err {
+				body.Write(b)
+			}
+		} else if nil == err {
+			err = body.encoder.Encode(prepared)
+		}
+		if nil != err {
 			log.Println(err)
+			writeJSONError(w, err)
+			return
+		}
+		if fields := r.URL.Query().Get(FieldsParam); nil == codec && "" != FieldsParam && "" != fields {
+			if enveloped {
+				fields = envelopeFields(fields)
+			}
+			filtered, err := filterFields(body.Bytes(), fields)
+			if nil != err {
+				log.Println(err)
+				writeJSONError(w, err)
+				return
+			}
+			body.Reset()
+			body.Write(filtered)
+		}
+		if m.Canonical && nil == codec {
+			canonical, err := Canonicalize(body.Bytes())
+			if nil != err {
+				log.Println(err)
+				writeJSONError(w, err)
+				return
+			}
+			body.Reset()
+			body.Write(canonical)
+		}
+		if http.StatusOK == code && ("GET" == r.Method || "HEAD" == r.Method) && "" == wHeader.Get("ETag") {
+			wHeader.Set("ETag", ETag(body.Bytes()))
+		}
+		wHeader.Set("Content-Length", strconv.Itoa(body.Len()))
+	}
+	if http.StatusOK == code && notModified(r, wHeader) {
+		wHeader.Del("Content-Length")
+		wHeader.Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(code)
+
+	// HEAD requests are answered exactly as GET requests would be, right
+	// down to the Content-Length, but without the body.
+	if 0 < body.Len() && "HEAD" != r.Method {
+		if _, err := w.Write(body.Bytes()); nil != err {
+			log.Println(err)
+		}
+	}
+}
+
+// decodeJSON unmarshals a JSON request body into rq.
+func (m *Marshaler) decodeJSON(r *http.Request, rq reflect.Value) error {
+	body, err := charsetReader(r)
+	if nil != err {
+		return NewHTTPEquivError(err, http.StatusUnsupportedMediaType)
+	}
+	opts := &decodeOptions{
+		timeFormat:     m.TimeFormat,
+		humanDurations: m.HumanDurations,
+		bigNumbers:     m.BigNumbersAsStrings,
+	}
+	if _, ok := rq.Interface().(*Patch); !ok && opts.normalizing() {
+		if err := opts.decode(body, rq.Interface()); nil != err {
+			return NewHTTPEquivError(err, http.StatusBadRequest)
+		}
+	} else {
+		decoder := reflect.ValueOf(json.NewDecoder(body))
+		out := decoder.MethodByName("Decode").Call([]reflect.Value{rq})
+		if !out[0].IsNil() {
+			return NewHTTPEquivError(
+				out[0].Interface().(error),
+				http.StatusBadRequest,
+			)
 		}
 	}
+	return nil
 }
 
 // MarshalerError is the response body for some 500 responses and panics
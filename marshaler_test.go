@@ -2,6 +2,7 @@ package marshaler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -30,6 +31,12 @@ func TestHandlerPanicIn1(t *testing.T) {
 	testHandlerPanic(func(u *url.URL, h, rq interface{}) {}, t)
 }
 
+func TestHandlerPanicIn3(t *testing.T) {
+	testHandlerPanic(func(u *url.URL, h http.Header, rq *testRequest, c interface{}) (int, http.Header, *testResponse, error) {
+		return 0, nil, nil, nil
+	}, t)
+}
+
 func TestHandlerPanicNumOut(t *testing.T) {
 	testHandlerPanic(func(u *url.URL, h http.Header) {}, t)
 	testHandlerPanic(func(u *url.URL, h http.Header) int {
@@ -267,6 +274,41 @@ func TestHandlerShortGET(t *testing.T) {
 	}
 }
 
+func TestHEAD(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("HEAD", "http://example.com/foo", nil)
+	r.Header.Set("Accept", "application/json")
+	Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, nil, &testResponse{"bar"}, nil
+	}).ServeHTTP(w, r)
+	if http.StatusOK != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if "14" != w.Header().Get("Content-Length") {
+		t.Fatal(w.Header().Get("Content-Length"))
+	}
+	if "" == w.Header().Get("ETag") {
+		t.Fatal(w.Header())
+	}
+	if "" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestContext(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r = r.WithContext(context.WithValue(r.Context(), testContextKey{}, "bar"))
+	Handler(func(u *url.URL, h http.Header, _ interface{}, c context.Context) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, nil, &testResponse{c.Value(testContextKey{}).(string)}, nil
+	}).ServeHTTP(w, r)
+	if "{\"foo\":\"bar\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+type testContextKey struct{}
+
 func Test500OnMisconfiguredPost(t *testing.T) {
 	w := &testResponseWriter{}
 	r, _ := http.NewRequest("POST", "http://example.com/foo", bytes.NewBufferString("anything"))
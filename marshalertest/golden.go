@@ -0,0 +1,181 @@
+package marshalertest
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// UpdateGoldenEnv names the environment variable which, when set to anything
+// but the empty string, makes AssertGolden write golden files instead of
+// comparing against them.
+const UpdateGoldenEnv = "MARSHALERTEST_UPDATE"
+
+var timestamp = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} )?\d{2}:\d{2}:\d{2}(\.\d+)? `)
+
+// NormalizeLog makes the output of Logged comparable from run to run.
+// Timestamps at the start of lines have their digits zeroed, RequestIDs are
+// renamed request-1, request-2, and so on in the order the requests were
+// first logged, wherever they appear, and the headers of each request and
+// response are sorted since Logged logs them in map order.
+func NormalizeLog(log string) string {
+	lines := strings.Split(strings.TrimSuffix(log, "\n"), "\n")
+	ids := make(requestIDs)
+	var order []string
+	seen := map[string]bool{}
+	for i, line := range lines {
+		if prefix := timestamp.FindString(line); "" != prefix {
+			lines[i] = zeroDigits(prefix) + line[len(prefix):]
+		}
+		if requestID, _, _, ok := splitLogLine(ids, lines[i]); ok && !seen[requestID] {
+			seen[requestID] = true
+			order = append(order, requestID)
+		}
+	}
+	sortHeaders(ids, lines)
+	s := strings.Join(lines, "\n") + "\n"
+	pairs := make([]string, 0, 2*len(order))
+	for i, requestID := range order {
+		pairs = append(pairs, requestID, "request-"+strconv.Itoa(i+1))
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
+
+// AssertGolden fails the test if got differs from the contents of the
+// golden file at path, showing the lines that differ.  When the environment
+// variable named by UpdateGoldenEnv is set, it writes got to the golden
+// file instead.
+func AssertGolden(t testing.TB, path, got string) {
+	t.Helper()
+	if "" != os.Getenv(UpdateGoldenEnv) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); nil != err {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); nil != err {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if nil != err {
+		t.Fatalf("%s; set %s=1 to create it", err, UpdateGoldenEnv)
+	}
+	if string(want) != got {
+		t.Fatalf(
+			"%s differs from golden file; set %s=1 to update it:\n%s",
+			path,
+			UpdateGoldenEnv,
+			diff(string(want), got),
+		)
+	}
+}
+
+// AssertGolden compares the normalized lines logged so far against the
+// golden file at path like the AssertGolden function.
+func (l *Logger) AssertGolden(t testing.TB, path string) {
+	t.Helper()
+	AssertGolden(t, path, NormalizeLog(l.String()))
+}
+
+// splitLogLine splits a line logged by Logged about a request or response,
+// after any timestamp, Labels, and LinePrefix, into its RequestID, its
+// direction, > or <, and the rest.
+func splitLogLine(ids requestIDs, line string) (requestID, direction, rest string, ok bool) {
+	_, requestID, line = ids.split(line[len(timestamp.FindString(line)):])
+	direction, rest, _ = strings.Cut(line, " ")
+	if ">" != direction && "<" != direction {
+		return "", "", "", false
+	}
+	return requestID, direction, rest, true
+}
+
+// sortHeaders sorts the headers following each request and status line,
+// which end at the line with nothing after the direction.
+func sortHeaders(ids requestIDs, lines []string) {
+	requests := map[string]bool{}
+	for i := 0; i < len(lines); i++ {
+		requestID, direction, rest, ok := splitLogLine(ids, lines[i])
+		if !ok {
+			continue
+		}
+		if ">" == direction && requests[requestID] {
+			continue
+		}
+		requests[requestID] = true
+		if "<" == direction && !strings.HasPrefix(rest, "HTTP/") {
+			continue
+		}
+		j := i + 1
+		for ; j < len(lines); j++ {
+			id, d, rest, ok := splitLogLine(ids, lines[j])
+			if !ok || requestID != id || direction != d || "" == rest {
+				break
+			}
+		}
+		if j == len(lines) {
+			continue
+		}
+		if id, d, rest, _ := splitLogLine(ids, lines[j]); requestID != id || direction != d || "" != rest {
+			continue
+		}
+		headers := lines[i+1 : j]
+		sort.SliceStable(headers, func(a, b int) bool {
+			_, _, ra, _ := splitLogLine(ids, headers[a])
+			_, _, rb, _ := splitLogLine(ids, headers[b])
+			return ra < rb
+		})
+		i = j
+	}
+}
+
+func zeroDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if '0' <= r && r <= '9' {
+			return '0'
+		}
+		return r
+	}, s)
+}
+
+// diff returns the lines of want and got, prefixed by "- " if they're only
+// in want, "+ " if they're only in got, and "  " if they're in both.
+func diff(want, got string) string {
+	a := strings.Split(want, "\n")
+	b := strings.Split(got, "\n")
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; 0 <= i; i-- {
+		for j := len(b) - 1; 0 <= j; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out.WriteString("- " + a[i] + "\n")
+			i++
+		default:
+			out.WriteString("+ " + b[j] + "\n")
+			j++
+		}
+	}
+	return out.String()
+}
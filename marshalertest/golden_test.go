@@ -0,0 +1,90 @@
+package marshalertest
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeLog(t *testing.T) {
+	log := strings.Join([]string{
+		"12:34:56.789012 abc > GET /foo HTTP/1.1",
+		"12:34:56.789013 abc > User-Agent: test",
+		"12:34:56.789013 abc > Accept: */*",
+		"12:34:56.789014 abc >",
+		"12:34:56.789015 abc < HTTP/1.1 500 Internal Server Error",
+		"12:34:56.789015 abc < X-B: 1",
+		"12:34:56.789015 abc < X-A: 2",
+		"12:34:56.789016 abc <",
+		"12:34:56.789017 abc < {\"request_id\":\"abc\"}",
+		"12:34:56.789018 xyz > GET /bar HTTP/1.1",
+		"12:34:56.789019 xyz >",
+		"12:34:57.000000 draining 1 requests",
+	}, "\n")
+	want := strings.Join([]string{
+		"00:00:00.000000 request-1 > GET /foo HTTP/1.1",
+		"00:00:00.000000 request-1 > Accept: */*",
+		"00:00:00.000000 request-1 > User-Agent: test",
+		"00:00:00.000000 request-1 >",
+		"00:00:00.000000 request-1 < HTTP/1.1 500 Internal Server Error",
+		"00:00:00.000000 request-1 < X-A: 2",
+		"00:00:00.000000 request-1 < X-B: 1",
+		"00:00:00.000000 request-1 <",
+		"00:00:00.000000 request-1 < {\"request_id\":\"request-1\"}",
+		"00:00:00.000000 request-2 > GET /bar HTTP/1.1",
+		"00:00:00.000000 request-2 >",
+		"00:00:00.000000 draining 1 requests",
+	}, "\n") + "\n"
+	if got := NormalizeLog(log); want != got {
+		t.Fatal(diff(want, got))
+	}
+}
+
+func TestNormalizeLogLabels(t *testing.T) {
+	log := strings.Join([]string{
+		"12:34:56.789012 pod=a abc > GET /foo HTTP/1.1",
+		"12:34:56.789013 pod=a abc > User-Agent: test",
+		"12:34:56.789013 pod=a abc > Accept: */*",
+		"12:34:56.789014 pod=a abc >",
+	}, "\n")
+	want := strings.Join([]string{
+		"00:00:00.000000 pod=a request-1 > GET /foo HTTP/1.1",
+		"00:00:00.000000 pod=a request-1 > Accept: */*",
+		"00:00:00.000000 pod=a request-1 > User-Agent: test",
+		"00:00:00.000000 pod=a request-1 >",
+	}, "\n") + "\n"
+	if got := NormalizeLog(log); want != got {
+		t.Fatal(diff(want, got))
+	}
+}
+
+func TestAssertGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "foo.golden")
+	h, l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte("foo"))
+	}), nil)
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	h.ServeHTTP(&testResponseWriter{header: http.Header{}}, r)
+	t.Setenv(UpdateGoldenEnv, "1")
+	l.AssertGolden(t, path)
+	t.Setenv(UpdateGoldenEnv, "")
+	l.AssertGolden(t, path)
+	AssertGolden(t, path, strings.Join([]string{
+		"request-1 > GET /foo HTTP/1.1",
+		"request-1 >",
+		"request-1 < HTTP/1.1 200 OK",
+		"request-1 < Cache-Control: no-store",
+		"request-1 < Content-Type: text/plain",
+		"request-1 <",
+		"request-1 < foo",
+	}, "\n")+"\n")
+}
+
+func TestDiff(t *testing.T) {
+	if got := diff("a\nb\nc", "a\nc\nd"); "  a\n- b\n  c\n+ d\n" != got {
+		t.Fatal(got)
+	}
+}
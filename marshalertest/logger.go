@@ -0,0 +1,215 @@
+// Package marshalertest provides utilities for testing services built with
+// marshaler, beginning with a Logger that captures what Logged logs.
+package marshalertest
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lhigueragamboa/marshaler"
+)
+
+// A Line is one line logged by Logged, split into its Lead, the Labels or
+// LinePrefix that come before the RequestID, if any, the RequestID, and the
+// rest.
+type Line struct {
+	Lead      string
+	RequestID marshaler.RequestID
+	Text      string
+}
+
+func (l Line) String() string {
+	if "" == l.RequestID {
+		return l.Lead + l.Text
+	}
+	return l.Lead + string(l.RequestID) + " " + l.Text
+}
+
+// Logger is a marshaler.Logger that keeps the lines logged to it in memory,
+// to be queried by tests.  It's safe for concurrent use.
+type Logger struct {
+	ids   requestIDs
+	lines []Line
+	mu    sync.Mutex
+}
+
+// Logged returns an http.Handler that logs to a new Logger, which it also
+// returns.
+func Logged(handler http.Handler, redactor marshaler.Redactor) (*marshaler.MultilineLogger, *Logger) {
+	l := &Logger{}
+	ml := marshaler.Logged(handler, redactor)
+	ml.Logger = l
+	return ml, l
+}
+
+// Output records s, in which Logged puts the RequestID first or after its
+// Labels and LinePrefix.
+func (l *Logger) Output(calldepth int, s string) error {
+	s = strings.TrimSuffix(s, "\n")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if nil == l.ids {
+		l.ids = make(requestIDs)
+	}
+	lead, requestID, text := l.ids.split(s)
+	l.lines = append(l.lines, Line{lead, marshaler.RequestID(requestID), text})
+	return nil
+}
+
+// OutputBytes records p, making Logger a marshaler.BytesLogger.
+func (l *Logger) OutputBytes(calldepth int, p []byte) error {
+	return l.Output(calldepth, string(p))
+}
+
+// Print is identical to log.Logger's Print.
+func (l *Logger) Print(v ...interface{}) {
+	l.Output(2, fmt.Sprint(v...))
+}
+
+// Printf is identical to log.Logger's Printf.
+func (l *Logger) Printf(format string, v ...interface{}) {
+	l.Output(2, fmt.Sprintf(format, v...))
+}
+
+// Println is identical to log.Logger's Println.
+func (l *Logger) Println(v ...interface{}) {
+	l.Output(2, fmt.Sprintln(v...))
+}
+
+// Lines returns the lines logged so far.
+func (l *Logger) Lines() []Line {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Line(nil), l.lines...)
+}
+
+// RequestIDs returns the RequestIDs of the requests logged so far, in the
+// order they were first logged.
+func (l *Logger) RequestIDs() []marshaler.RequestID {
+	var requestIDs []marshaler.RequestID
+	seen := map[marshaler.RequestID]bool{}
+	for _, line := range l.Lines() {
+		if "" != line.RequestID && !seen[line.RequestID] {
+			seen[line.RequestID] = true
+			requestIDs = append(requestIDs, line.RequestID)
+		}
+	}
+	return requestIDs
+}
+
+// Request returns the text of the lines logged about the request with the
+// given RequestID.
+func (l *Logger) Request(requestID marshaler.RequestID) []string {
+	var text []string
+	for _, line := range l.Lines() {
+		if requestID == line.RequestID {
+			text = append(text, line.Text)
+		}
+	}
+	return text
+}
+
+// Find returns the RequestID of the first request any of whose lines
+// contain substr, or the empty string if there isn't one.
+func (l *Logger) Find(substr string) marshaler.RequestID {
+	for _, line := range l.Lines() {
+		if strings.Contains(line.Text, substr) {
+			return line.RequestID
+		}
+	}
+	return ""
+}
+
+// Reset forgets the lines logged so far.
+func (l *Logger) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ids, l.lines = nil, nil
+}
+
+// String returns the lines logged so far as they would have been logged.
+func (l *Logger) String() string {
+	var b strings.Builder
+	for _, line := range l.Lines() {
+		b.WriteString(line.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// AssertLogged fails the test unless some line contains substr, like
+// "POST /users" or "< HTTP/1.1 201 Created", and returns the RequestID of
+// the request it was logged about.
+func (l *Logger) AssertLogged(t testing.TB, substr string) marshaler.RequestID {
+	t.Helper()
+	for _, line := range l.Lines() {
+		if strings.Contains(line.Text, substr) {
+			return line.RequestID
+		}
+	}
+	t.Fatalf("%q not logged in:\n%s", substr, l)
+	return ""
+}
+
+// AssertNotLogged fails the test if any line contains substr, which is
+// useful for checking that secrets are redacted.
+func (l *Logger) AssertNotLogged(t testing.TB, substr string) {
+	t.Helper()
+	for _, line := range l.Lines() {
+		if strings.Contains(line.String(), substr) {
+			t.Fatalf("%q logged in:\n%s", substr, l)
+		}
+	}
+}
+
+// AssertRequestLogged fails the test unless a line about the request with
+// the given RequestID contains substr.
+func (l *Logger) AssertRequestLogged(t testing.TB, requestID marshaler.RequestID, substr string) {
+	t.Helper()
+	for _, text := range l.Request(requestID) {
+		if strings.Contains(text, substr) {
+			return
+		}
+	}
+	t.Fatalf("%q not logged about %s in:\n%s", substr, requestID, l)
+}
+
+// requestLine matches the line Logged begins each request with, capturing
+// the RequestID before its marker, after any Labels or LinePrefix.
+var requestLine = regexp.MustCompile(`(?:^| )([^ ]+) [^ ]+ [A-Z]+ [^ ]+ HTTP/[0-9.]+$`)
+
+// requestIDs finds the RequestIDs of lines logged by Logged, learning each
+// from the line that begins its request.
+type requestIDs map[string]bool
+
+// split splits a line into what comes before its RequestID, the RequestID,
+// and the rest.  Lines without a known RequestID, like those logged about
+// requests before their request lines, are taken to begin with one.
+func (ids requestIDs) split(line string) (lead, requestID, rest string) {
+	if m := requestLine.FindStringSubmatch(line); nil != m {
+		ids[m[1]] = true
+	}
+	for i := 0; i < len(line); {
+		end := strings.IndexByte(line[i:], ' ')
+		if 0 > end {
+			end = len(line)
+		} else {
+			end += i
+		}
+		if ids[line[i:end]] {
+			if end < len(line) {
+				rest = line[end+1:]
+			}
+			return line[:i], line[i:end], rest
+		}
+		i = end + 1
+	}
+	if i := strings.IndexByte(line, ' '); 0 < i {
+		return "", line[:i], line[i+1:]
+	}
+	return "", line, ""
+}
@@ -0,0 +1,78 @@
+package marshalertest
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/lhigueragamboa/marshaler"
+)
+
+func TestLogger(t *testing.T) {
+	n := 0
+	h, l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	}), func(s string) string {
+		return strings.Replace(s, "hunter2", "[redacted]", -1)
+	})
+	h.RequestIDCreator = func(r *http.Request) marshaler.RequestID {
+		n++
+		return marshaler.RequestID([]string{"", "first", "second"}[n])
+	}
+	for _, body := range []string{"hunter2", "{}"} {
+		r, _ := http.NewRequest("POST", "http://example.com/users", strings.NewReader(body))
+		h.ServeHTTP(&testResponseWriter{header: http.Header{}}, r)
+	}
+	if requestIDs := l.RequestIDs(); 2 != len(requestIDs) || "first" != requestIDs[0] || "second" != requestIDs[1] {
+		t.Fatal(requestIDs)
+	}
+	if requestID := l.AssertLogged(t, "POST /users"); "first" != requestID {
+		t.Fatal(requestID)
+	}
+	l.AssertNotLogged(t, "hunter2")
+	l.AssertRequestLogged(t, "second", "< {}")
+	if requestID := l.Find("< {}"); "second" != requestID {
+		t.Fatal(requestID)
+	}
+	if lines := l.Request("second"); "> POST /users HTTP/1.1" != lines[0] || "< HTTP/1.1 201 Created" != lines[3] {
+		t.Fatal(lines)
+	}
+	if !strings.HasPrefix(l.String(), "first > POST /users HTTP/1.1\nfirst >\n") {
+		t.Fatal(l.String())
+	}
+	l.Reset()
+	if 0 != len(l.Lines()) {
+		t.Fatal(l.Lines())
+	}
+}
+
+func TestLoggerLabels(t *testing.T) {
+	h, l := Logged(http.NotFoundHandler(), nil)
+	h.RequestIDCreator = func(r *http.Request) marshaler.RequestID { return "first" }
+	h.Labels = map[string]string{"pod": "a", "note": "a b"}
+	h.Format = &marshaler.LogFormat{LinePrefix: func(r *http.Request) string { return r.Method + " " }}
+	r, _ := http.NewRequest("GET", "http://example.com/users", nil)
+	h.ServeHTTP(&testResponseWriter{header: http.Header{}}, r)
+	if requestIDs := l.RequestIDs(); 1 != len(requestIDs) || "first" != requestIDs[0] {
+		t.Fatal(requestIDs)
+	}
+	if lines := l.Request("first"); "> GET /users HTTP/1.1" != lines[0] {
+		t.Fatal(lines)
+	}
+	if !strings.HasPrefix(l.String(), "note=\"a b\" pod=a GET first > GET /users HTTP/1.1\n") {
+		t.Fatal(l.String())
+	}
+}
+
+type testResponseWriter struct {
+	header http.Header
+}
+
+func (w *testResponseWriter) Header() http.Header { return w.header }
+
+func (w *testResponseWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+func (w *testResponseWriter) WriteHeader(code int) {}
@@ -0,0 +1,178 @@
+package marshalertest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lhigueragamboa/marshaler"
+)
+
+// NewMockServer starts an httptest.Server that answers the operations in
+// an OpenAPI document, for consumer-driven contract tests and frontend
+// development against services that aren't running.  The caller should
+// Close it when finished.
+//
+//	doc := marshaler.NewOpenAPI("Widgets", "1.0.0")
+//	doc.Register("GET", "/widgets/{id}", marshaler.Handler(getWidget))
+//	s := marshalertest.NewMockServer(doc.Document())
+//	defer s.Close()
+func NewMockServer(document map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(MockHandler(document))
+}
+
+// MockHandler returns an http.Handler that answers each operation in an
+// OpenAPI document with its first successful response, whose body is the
+// first example of its JSON content, if there is one, or else the zero value
+// of its schema: objects with their required properties, empty arrays,
+// empty strings, zeros, and false.  Requests for undescribed paths are
+// answered 404 Not Found and those for undescribed methods 405 Method Not
+// Allowed, by a marshaler.TrieServeMux.
+func MockHandler(document map[string]interface{}) http.Handler {
+	mux := marshaler.NewTrieServeMux()
+	paths, _ := document["paths"].(map[string]interface{})
+	for path, item := range paths {
+		item, _ := item.(map[string]interface{})
+		for method, operation := range item {
+			operation, ok := operation.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			mux.Handle(strings.ToUpper(method), path, mockOperation(document, operation))
+		}
+	}
+	return mux
+}
+
+func mockOperation(document, operation map[string]interface{}) http.Handler {
+	responses, _ := operation["responses"].(map[string]interface{})
+	codes := make([]string, 0, len(responses))
+	for code := range responses {
+		if strings.HasPrefix(code, "2") {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	code, response := http.StatusNoContent, map[string]interface{}(nil)
+	if 0 < len(codes) {
+		code, _ = strconv.Atoi(strings.Replace(codes[0], "XX", "00", 1))
+		response, _ = resolveMock(document, responses[codes[0]]).(map[string]interface{})
+	}
+	content, _ := response["content"].(map[string]interface{})
+	mediaType, ok := content["application/json"].(map[string]interface{})
+	if !ok {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		})
+	}
+	body, _ := json.Marshal(mockExample(document, mediaType))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(code)
+		w.Write(append(body, '\n'))
+	})
+}
+
+// mockExample returns the first example of a Media Type Object or the zero
+// value of its schema.
+func mockExample(document, mediaType map[string]interface{}) interface{} {
+	if example, ok := mediaType["example"]; ok {
+		return example
+	}
+	if examples, ok := mediaType["examples"].(map[string]interface{}); ok && 0 < len(examples) {
+		names := make([]string, 0, len(examples))
+		for name := range examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if example, ok := resolveMock(document, examples[names[0]]).(map[string]interface{}); ok {
+			return example["value"]
+		}
+	}
+	return mockValue(document, mediaType["schema"], map[string]bool{})
+}
+
+// mockValue returns the zero value of a Schema Object.  Objects referred to
+// while they're already being built are null rather than recursing forever.
+func mockValue(document map[string]interface{}, schema interface{}, building map[string]bool) interface{} {
+	if object, ok := schema.(map[string]interface{}); ok {
+		if ref, ok := object["$ref"].(string); ok {
+			if building[ref] {
+				return nil
+			}
+			building[ref] = true
+			defer delete(building, ref)
+		}
+	}
+	s, _ := resolveMock(document, schema).(map[string]interface{})
+	if example, ok := s["example"]; ok {
+		return example
+	}
+	if enum, ok := s["enum"].([]interface{}); ok && 0 < len(enum) {
+		return enum[0]
+	}
+	switch s["type"] {
+	case "object":
+		object := map[string]interface{}{}
+		properties, _ := s["properties"].(map[string]interface{})
+		for _, name := range mockStrings(s["required"]) {
+			object[name] = mockValue(document, properties[name], building)
+		}
+		return object
+	case "array":
+		return []interface{}{}
+	case "string":
+		if "date-time" == s["format"] {
+			return "0001-01-01T00:00:00Z"
+		}
+		return ""
+	case "integer", "number":
+		return 0
+	case "boolean":
+		return false
+	}
+	return nil
+}
+
+// resolveMock follows a Reference Object within the document.
+func resolveMock(document map[string]interface{}, value interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		ref, ok := object["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#/") {
+			return value
+		}
+		value = interface{}(document)
+		for _, name := range strings.Split(ref[2:], "/") {
+			name = strings.Replace(strings.Replace(name, "~1", "/", -1), "~0", "~", -1)
+			object, _ := value.(map[string]interface{})
+			value = object[name]
+		}
+	}
+	return nil
+}
+
+// mockStrings returns the strings in a list that may be a []string if the
+// document came from marshaler.OpenAPI or a []interface{} if it was
+// decoded from JSON.
+func mockStrings(value interface{}) []string {
+	switch list := value.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		s := make([]string, 0, len(list))
+		for _, v := range list {
+			if v, ok := v.(string); ok {
+				s = append(s, v)
+			}
+		}
+		return s
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package marshalertest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/lhigueragamboa/marshaler"
+)
+
+type testWidget struct {
+	ID       int           `json:"id"`
+	Name     string        `json:"name,omitempty"`
+	Created  time.Time     `json:"created"`
+	Parent   *testWidget   `json:"parent"`
+	Children []*testWidget `json:"children"`
+}
+
+func TestMockServer(t *testing.T) {
+	doc := marshaler.NewOpenAPI("Widgets", "1.0.0")
+	doc.Register("GET", "/widgets/{id}", marshaler.Handler(func(u *url.URL, h http.Header) (int, http.Header, *testWidget, error) {
+		return http.StatusOK, nil, nil, nil
+	}))
+	doc.Register("DELETE", "/widgets/{id}", marshaler.Handler(func(u *url.URL, h http.Header) (int, http.Header, interface{}, error) {
+		return http.StatusNoContent, nil, nil, nil
+	}))
+	s := NewMockServer(doc.Document())
+	defer s.Close()
+	for _, c := range []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{"GET", "/widgets/1", 200, "{\"children\":[],\"created\":\"0001-01-01T00:00:00Z\",\"id\":0}\n"},
+		{"DELETE", "/widgets/1", 200, ""},
+		{"PUT", "/widgets/1", 405, ""},
+		{"GET", "/gadgets/1", 404, ""},
+	} {
+		r, _ := http.NewRequest(c.method, s.URL+c.path, nil)
+		res, err := http.DefaultClient.Do(r)
+		if nil != err {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if c.code != res.StatusCode || (200 == c.code && c.body != string(body)) {
+			t.Fatal(c, res.StatusCode, string(body))
+		}
+	}
+}
+
+func TestMockHandlerExamples(t *testing.T) {
+	h := MockHandler(map[string]interface{}{"paths": map[string]interface{}{
+		"/widgets": map[string]interface{}{"post": map[string]interface{}{
+			"responses": map[string]interface{}{"201": map[string]interface{}{
+				"content": map[string]interface{}{"application/json": map[string]interface{}{
+					"examples": map[string]interface{}{
+						"b": map[string]interface{}{"value": "second"},
+						"a": map[string]interface{}{"value": map[string]interface{}{"id": 1}},
+					},
+				}},
+			}},
+		}},
+	}})
+	r, _ := http.NewRequest("POST", "http://example.com/widgets", nil)
+	e := Record(h, r)
+	if http.StatusCreated != e.Response.StatusCode || "{\"id\":1}\n" != string(e.Response.Body) {
+		t.Fatal(e.Response.StatusCode, string(e.Response.Body))
+	}
+}
+
+func TestMockHandlerParameterNames(t *testing.T) {
+	ok := map[string]interface{}{"responses": map[string]interface{}{"204": map[string]interface{}{}}}
+	h := MockHandler(map[string]interface{}{"paths": map[string]interface{}{
+		"/users/{id}":           map[string]interface{}{"get": ok},
+		"/users/{userId}/posts": map[string]interface{}{"get": ok},
+	}})
+	for _, path := range []string{"/users/1", "/users/1/posts"} {
+		r, _ := http.NewRequest("GET", "http://example.com"+path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if http.StatusNoContent != w.Code {
+			t.Fatal(path, w.Code)
+		}
+	}
+}
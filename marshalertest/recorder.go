@@ -0,0 +1,304 @@
+package marshalertest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An Exchange is a request and the response a handler gave it, complete
+// with bodies, trailers, and timing.  It can be serialized as JSON and
+// replayed against a handler later to see whether the response changed.
+type Exchange struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+	Started  time.Time        `json:"started"`
+	Duration time.Duration    `json:"duration"`
+}
+
+// A RecordedRequest is the request half of an Exchange.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Proto  string      `json:"proto"`
+	Host   string      `json:"host,omitempty"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+// A RecordedResponse is the response half of an Exchange.  Header is as it
+// was when the status was written and Trailer as it was when the handler
+// returned.
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body,omitempty"`
+	Trailer    http.Header `json:"trailer,omitempty"`
+}
+
+// NewRequest returns an http.Request like the one that was recorded.
+func (rr *RecordedRequest) NewRequest() *http.Request {
+	r := httptest.NewRequest(rr.Method, rr.URL, bytes.NewReader(rr.Body))
+	if "" != rr.Proto {
+		r.Proto = rr.Proto
+		r.ProtoMajor, r.ProtoMinor, _ = http.ParseHTTPVersion(rr.Proto)
+	}
+	if "" != rr.Host {
+		r.Host = rr.Host
+	}
+	for name, values := range rr.Header {
+		r.Header[name] = append([]string(nil), values...)
+	}
+	return r
+}
+
+// Recorder is an http.ResponseWriter that records the response written to
+// it, including trailers, which net/http/httptest.ResponseRecorder only
+// does partially.
+type Recorder struct {
+	Response    RecordedResponse
+	header      http.Header
+	wroteHeader bool
+}
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{header: http.Header{}}
+}
+
+func (w *Recorder) Header() http.Header {
+	return w.header
+}
+
+func (w *Recorder) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.Response.Body = append(w.Response.Body, p...)
+	return len(p), nil
+}
+
+func (w *Recorder) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.Response.StatusCode = code
+	w.Response.Header = w.header.Clone()
+}
+
+// Flush marks the header as written, as flushing a real response does.
+func (w *Recorder) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// finish records the implicit 200 OK of handlers that write nothing and
+// the trailers the handler set.
+func (w *Recorder) finish() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	for _, name := range strings.Split(strings.Join(w.header.Values("Trailer"), ","), ",") {
+		if name = http.CanonicalHeaderKey(strings.TrimSpace(name)); "" != name {
+			w.addTrailer(name, w.header.Values(name))
+		}
+	}
+	for name, values := range w.header {
+		if strings.HasPrefix(name, http.TrailerPrefix) {
+			w.addTrailer(http.CanonicalHeaderKey(strings.TrimPrefix(name, http.TrailerPrefix)), values)
+		}
+	}
+}
+
+func (w *Recorder) addTrailer(name string, values []string) {
+	if 0 == len(values) {
+		return
+	}
+	if nil == w.Response.Trailer {
+		w.Response.Trailer = http.Header{}
+	}
+	w.Response.Trailer[name] = append([]string(nil), values...)
+}
+
+// Record serves r with handler and returns the Exchange.
+func Record(handler http.Handler, r *http.Request) *Exchange {
+	e, r := newExchange(r)
+	w := NewRecorder()
+	handler.ServeHTTP(w, r)
+	w.finish()
+	e.Response = w.Response
+	e.Duration = time.Since(e.Started)
+	return e
+}
+
+// Recording returns an http.Handler that passes requests through to
+// handler and calls record with each Exchange after the handler returns,
+// for capturing traffic to replay in tests.  Request and response bodies
+// are held in memory.
+func Recording(handler http.Handler, record func(*Exchange)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e, r := newExchange(r)
+		rw := &teeRecorder{ResponseWriter: w, Recorder: NewRecorder()}
+		rw.Recorder.header = w.Header()
+		handler.ServeHTTP(rw, r)
+		rw.Recorder.finish()
+		e.Response = rw.Recorder.Response
+		e.Duration = time.Since(e.Started)
+		record(e)
+	})
+}
+
+type teeRecorder struct {
+	http.ResponseWriter
+	*Recorder
+}
+
+func (w *teeRecorder) Header() http.Header {
+	return w.ResponseWriter.Header()
+}
+
+func (w *teeRecorder) Write(p []byte) (int, error) {
+	w.Recorder.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *teeRecorder) WriteHeader(code int) {
+	w.Recorder.WriteHeader(code)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *teeRecorder) Flush() {
+	w.Recorder.Flush()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// newExchange begins an Exchange by reading the request's body, returning
+// a request with a fresh copy of it.
+func newExchange(r *http.Request) (*Exchange, *http.Request) {
+	var body []byte
+	if nil != r.Body && http.NoBody != r.Body {
+		body, _ = io.ReadAll(r.Body)
+		r.Body.Close()
+		r = r.Clone(r.Context())
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return &Exchange{
+		Request: RecordedRequest{
+			Method: r.Method,
+			URL:    r.URL.String(),
+			Proto:  r.Proto,
+			Host:   r.Host,
+			Header: r.Header.Clone(),
+			Body:   body,
+		},
+		Started: time.Now(),
+	}, r
+}
+
+// Replay serves the recorded request again with handler and returns the
+// new Exchange, which may be compared to the original with Diff.
+func Replay(handler http.Handler, e *Exchange) *Exchange {
+	return Record(handler, e.Request.NewRequest())
+}
+
+// DefaultIgnoredHeaders are the headers Diff ignores unless told otherwise
+// because they're expected to differ from one response to the next.
+var DefaultIgnoredHeaders = []string{"Date", "X-Request-Id"}
+
+// Diff describes how the response of another Exchange differs from this
+// one's, ignoring the named headers, or DefaultIgnoredHeaders if none are
+// named.  It returns the empty string if they're the same.
+func (e *Exchange) Diff(other *Exchange, ignoreHeaders ...string) string {
+	if 0 == len(ignoreHeaders) {
+		ignoreHeaders = DefaultIgnoredHeaders
+	}
+	ignored := map[string]bool{}
+	for _, name := range ignoreHeaders {
+		ignored[http.CanonicalHeaderKey(name)] = true
+	}
+	var b strings.Builder
+	if e.Response.StatusCode != other.Response.StatusCode {
+		fmt.Fprintf(&b, "status: %d != %d\n", e.Response.StatusCode, other.Response.StatusCode)
+	}
+	diffHeaders(&b, "header", e.Response.Header, other.Response.Header, ignored)
+	diffHeaders(&b, "trailer", e.Response.Trailer, other.Response.Trailer, ignored)
+	if !bytes.Equal(e.Response.Body, other.Response.Body) {
+		fmt.Fprintf(&b, "body:\n%s", diff(string(e.Response.Body), string(other.Response.Body)))
+	}
+	return b.String()
+}
+
+func diffHeaders(b *strings.Builder, what string, a, z http.Header, ignored map[string]bool) {
+	names := map[string]bool{}
+	for name := range a {
+		names[name] = true
+	}
+	for name := range z {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		if !ignored[name] {
+			sorted = append(sorted, name)
+		}
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		if av, zv := strings.Join(a[name], ", "), strings.Join(z[name], ", "); av != zv {
+			fmt.Fprintf(b, "%s %s: %q != %q\n", what, name, av, zv)
+		}
+	}
+}
+
+// WriteExchange writes an Exchange as a line of JSON, the format
+// ReadExchanges reads.
+func WriteExchange(w io.Writer, e *Exchange) error {
+	return json.NewEncoder(w).Encode(e)
+}
+
+// ReadExchanges reads Exchanges written by WriteExchange, one per line.
+func ReadExchanges(r io.Reader) ([]*Exchange, error) {
+	var exchanges []*Exchange
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	for {
+		e := &Exchange{}
+		if err := decoder.Decode(e); io.EOF == err {
+			return exchanges, nil
+		} else if nil != err {
+			return exchanges, err
+		}
+		exchanges = append(exchanges, e)
+	}
+}
+
+// ExchangeLog collects Exchanges from Recording, safe for concurrent use.
+type ExchangeLog struct {
+	exchanges []*Exchange
+	mu        sync.Mutex
+}
+
+// Record appends an Exchange and may be passed to Recording.
+func (l *ExchangeLog) Record(e *Exchange) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.exchanges = append(l.exchanges, e)
+}
+
+// Exchanges returns the Exchanges recorded so far.
+func (l *ExchangeLog) Exchanges() []*Exchange {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]*Exchange(nil), l.exchanges...)
+}
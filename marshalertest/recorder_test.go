@@ -0,0 +1,73 @@
+package marshalertest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testEchoHandler(suffix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Trailer", "X-Checksum")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(append(body, suffix...))
+		w.Header().Set("X-Checksum", "abc")
+		w.Header().Set(http.TrailerPrefix+"X-Count", "1")
+	})
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	r := httptest.NewRequest("POST", "http://example.com/echo", strings.NewReader("ping"))
+	r.Header.Set("X-Foo", "bar")
+	e := Record(testEchoHandler(""), r)
+	if "POST" != e.Request.Method || "ping" != string(e.Request.Body) || "bar" != e.Request.Header.Get("X-Foo") {
+		t.Fatal(e.Request)
+	}
+	if http.StatusCreated != e.Response.StatusCode || "ping" != string(e.Response.Body) {
+		t.Fatal(e.Response)
+	}
+	if "abc" != e.Response.Trailer.Get("X-Checksum") || "1" != e.Response.Trailer.Get("X-Count") {
+		t.Fatal(e.Response.Trailer)
+	}
+	var buf bytes.Buffer
+	if err := WriteExchange(&buf, e); nil != err {
+		t.Fatal(err)
+	}
+	exchanges, err := ReadExchanges(&buf)
+	if nil != err || 1 != len(exchanges) {
+		t.Fatal(exchanges, err)
+	}
+	if diff := e.Diff(Replay(testEchoHandler(""), exchanges[0])); "" != diff {
+		t.Fatal(diff)
+	}
+	if diff := e.Diff(Replay(testEchoHandler("!"), exchanges[0])); "body:\n- ping\n+ ping!\n" != diff {
+		t.Fatal(diff)
+	}
+}
+
+func TestRecording(t *testing.T) {
+	var log ExchangeLog
+	s := httptest.NewServer(Recording(testEchoHandler(""), log.Record))
+	defer s.Close()
+	res, err := http.Post(s.URL+"/echo", "text/plain", strings.NewReader("ping"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if "ping" != string(body) || "abc" != res.Trailer.Get("X-Checksum") {
+		t.Fatal(string(body), res.Trailer)
+	}
+	exchanges := log.Exchanges()
+	if 1 != len(exchanges) || "ping" != string(exchanges[0].Request.Body) || "ping" != string(exchanges[0].Response.Body) {
+		t.Fatal(exchanges)
+	}
+	if "abc" != exchanges[0].Response.Trailer.Get("X-Checksum") {
+		t.Fatal(exchanges[0].Response.Trailer)
+	}
+}
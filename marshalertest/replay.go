@@ -0,0 +1,45 @@
+package marshalertest
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ReplayAll replays exchanges against handler like Replay, with up to
+// concurrency requests in flight, or 1 if it's not positive, and at most
+// rate requests per second, if it's positive.  It calls f with each original
+// Exchange and its replay as they finish, one at a time, and returns once
+// all have.
+func ReplayAll(handler http.Handler, exchanges []*Exchange, concurrency int, rate float64, f func(original, replayed *Exchange)) {
+	if 1 > concurrency {
+		concurrency = 1
+	}
+	var tick <-chan time.Time
+	if 0 < rate {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, concurrency)
+	)
+	for i, e := range exchanges {
+		if nil != tick && 0 < i {
+			<-tick
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(e *Exchange) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			replayed := Replay(handler, e)
+			mu.Lock()
+			defer mu.Unlock()
+			f(e, replayed)
+		}(e)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,49 @@
+package marshalertest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReplayAll(t *testing.T) {
+	var exchanges []*Exchange
+	for _, path := range []string{"/a", "/b", "/c", "/d"} {
+		exchanges = append(exchanges, Record(http.NotFoundHandler(), httptest.NewRequest("GET", path, nil)))
+	}
+	var inFlight, most int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if "/c" == r.URL.Path {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.NotFound(w, r)
+	})
+	var differed []string
+	start := time.Now()
+	ReplayAll(handler, exchanges, 2, 200, func(original, replayed *Exchange) {
+		if original.Response.StatusCode != replayed.Response.StatusCode {
+			differed = append(differed, replayed.Request.URL)
+		}
+	})
+	if 1 != len(differed) || "/c" != differed[0] {
+		t.Fatal(differed)
+	}
+	if 2 != atomic.LoadInt32(&most) {
+		t.Fatal(most)
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Fatal(elapsed)
+	}
+}
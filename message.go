@@ -0,0 +1,70 @@
+package marshaler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	catalogsMu sync.RWMutex
+	catalogs   = map[string]map[string]string{}
+)
+
+// RegisterMessages adds translations of the messages in the error responses
+// this package produces to the catalog for a language.  Messages are keyed
+// by their English format strings, like
+//
+//	marshaler.RegisterMessages("fr", map[string]string{
+//	    "Content-Type header is %s, not application/json": "l'en-tête Content-Type est %s, pas application/json",
+//	})
+func RegisterMessages(language string, messages map[string]string) {
+	catalogsMu.Lock()
+	defer catalogsMu.Unlock()
+	language = strings.ToLower(language)
+	catalog, ok := catalogs[language]
+	if !ok {
+		catalog = make(map[string]string, len(messages))
+		catalogs[language] = catalog
+	}
+	for format, translation := range messages {
+		catalog[format] = translation
+	}
+}
+
+// Message formats a message in the language of the response to a request,
+// which is the one chosen by Localized or else the best match for the
+// Accept-Language header among the registered catalogs.  Messages without a
+// translation are formatted in English.
+func Message(r *http.Request, format string, v ...interface{}) string {
+	catalogsMu.RLock()
+	defer catalogsMu.RUnlock()
+	if 0 < len(catalogs) {
+		if catalog := messageCatalog(r); nil != catalog {
+			if translation, ok := catalog[format]; ok {
+				format = translation
+			}
+		}
+	}
+	return fmt.Sprintf(format, v...)
+}
+
+func messageCatalog(r *http.Request) map[string]string {
+	language := Language(r.Context())
+	if "" == language {
+		languages := []string{"en"}
+		for l := range catalogs {
+			languages = append(languages, l)
+		}
+		language = NegotiateLanguage(r.Header.Get("Accept-Language"), languages)
+	}
+	language = strings.ToLower(language)
+	if catalog, ok := catalogs[language]; ok {
+		return catalog
+	}
+	if i := strings.Index(language, "-"); 0 < i {
+		return catalogs[language[:i]]
+	}
+	return nil
+}
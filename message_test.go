@@ -0,0 +1,43 @@
+package marshaler
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestMessage(t *testing.T) {
+	RegisterMessages("fr", map[string]string{
+		"Content-Type header is %s, not application/json": "l'en-tête Content-Type est %s, pas application/json",
+	})
+	defer func() { delete(catalogs, "fr") }()
+	h := Handler(func(u *url.URL, h http.Header, rq *testRequest) (int, http.Header, *testResponse, error) {
+		return http.StatusNoContent, nil, nil, nil
+	})
+	for language, expected := range map[string]string{
+		"fr-CA":        "{\"description\":\"l'en-tête Content-Type est text/plain, pas application/json\",\"error\":\"marshaler.MarshalerError\"}\n",
+		"de, en;q=0.5": "{\"description\":\"Content-Type header is text/plain, not application/json\",\"error\":\"marshaler.MarshalerError\"}\n",
+	} {
+		w := &testResponseWriter{}
+		r, _ := http.NewRequest("POST", "http://example.com/foo", bytes.NewBufferString("{}"))
+		r.Header.Set("Content-Type", "text/plain")
+		r.Header.Set("Accept-Language", language)
+		h.ServeHTTP(w, r)
+		if http.StatusUnsupportedMediaType != w.StatusCode || expected != w.Body.String() {
+			t.Fatal(language, w.StatusCode, w.Body.String())
+		}
+	}
+}
+
+func TestMessageLocalized(t *testing.T) {
+	RegisterMessages("fr", map[string]string{"%s not allowed; try %s": "%s interdit ; essayez %s"})
+	defer func() { delete(catalogs, "fr") }()
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("PUT", "http://example.com/foo", nil)
+	r.Header.Set("Accept", "text/plain")
+	Localized(Methods{"GET": OptionsHandler{}}, "fr", "en").ServeHTTP(w, r)
+	if "marshaler.MethodNotAllowed: PUT interdit ; essayez GET, HEAD, OPTIONS" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
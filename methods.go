@@ -0,0 +1,40 @@
+package marshaler
+
+import "net/http"
+
+// Methods is an http.Handler that dispatches requests to the handler
+// registered for their method.  HEAD requests fall back to the GET handler,
+// OPTIONS requests are answered from the registered methods, and all other
+// requests are answered 405 Method Not Allowed.
+//
+//	Logged(Methods{
+//	    "GET":  Handler(getUser),
+//	    "POST": Handler(postUser),
+//	}, nil)
+type Methods map[string]http.Handler
+
+func (m Methods) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler, ok := m[r.Method]; ok {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	if "HEAD" == r.Method {
+		if handler, ok := m["GET"]; ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+	}
+	if "OPTIONS" == r.Method {
+		OptionsHandler{m.methods()}.ServeHTTP(w, r)
+		return
+	}
+	MethodNotAllowedHandler{m.methods()}.ServeHTTP(w, r)
+}
+
+func (m Methods) methods() []string {
+	methods := make([]string, 0, len(m))
+	for method := range m {
+		methods = append(methods, method)
+	}
+	return methods
+}
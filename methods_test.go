@@ -0,0 +1,41 @@
+package marshaler
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestMethods(t *testing.T) {
+	m := Methods{
+		"GET": Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+			return http.StatusOK, nil, &testResponse{"bar"}, nil
+		}),
+		"DELETE": Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+			return http.StatusNoContent, nil, nil, nil
+		}),
+	}
+	for method, code := range map[string]int{
+		"GET":     http.StatusOK,
+		"HEAD":    http.StatusOK,
+		"DELETE":  http.StatusNoContent,
+		"OPTIONS": http.StatusNoContent,
+		"PUT":     http.StatusMethodNotAllowed,
+	} {
+		w := &testResponseWriter{}
+		r, _ := http.NewRequest(method, "http://example.com/foo", nil)
+		m.ServeHTTP(w, r)
+		if code != w.StatusCode {
+			t.Fatal(method, w.StatusCode)
+		}
+	}
+}
+
+func TestMethodsAllow(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("PUT", "http://example.com/foo", nil)
+	Methods{"POST": OptionsHandler{}}.ServeHTTP(w, r)
+	if "OPTIONS, POST" != w.Header().Get("Allow") {
+		t.Fatal(w.Header().Get("Allow"))
+	}
+}
@@ -0,0 +1,134 @@
+package marshaler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// A MetricsSink receives the measurements made by metrics middleware like
+// Timed and Counted.  Measurements are named for the routes they measure and
+// labeled with the request method and response status.  Implementations
+// must be safe for concurrent use.
+type MetricsSink interface {
+	Count(name string, n int64, labels map[string]string)
+	Timing(name string, d time.Duration, labels map[string]string)
+}
+
+// Counter is an http.Handler that counts the requests to the handler it
+// wraps.
+type Counter struct {
+	handler http.Handler
+	name    string
+	sink    MetricsSink
+}
+
+// Counted returns an http.Handler that counts the requests to the given
+// handler in sink under the given name, labeled with the request method and
+// the response's status class, like 2xx or 5xx.
+func Counted(handler http.Handler, name string, sink MetricsSink) *Counter {
+	return &Counter{
+		handler: handler,
+		name:    name,
+		sink:    sink,
+	}
+}
+
+func (c *Counter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, record := recordResponse(w)
+	c.handler.ServeHTTP(w, r)
+	labels := metricLabels(r, record)
+	labels["class"] = statusClass(labels["status"])
+	delete(labels, "status")
+	c.sink.Count(metricName(c.name, record), 1, labels)
+}
+
+// Timer is an http.Handler that measures how long the handler it wraps
+// takes to respond.
+type Timer struct {
+	handler http.Handler
+	name    string
+	sink    MetricsSink
+}
+
+// Timed returns an http.Handler that records the duration of each request
+// to the given handler in sink under the given name, which usually
+// identifies the route.  An empty name stands for the route matched by a
+// TrieServeMux.  When wrapped by Logged, the status it records is the status
+// that was logged.
+func Timed(handler http.Handler, name string, sink MetricsSink) *Timer {
+	return &Timer{
+		handler: handler,
+		name:    name,
+		sink:    sink,
+	}
+}
+
+func (t *Timer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	w, record := recordResponse(w)
+	t.handler.ServeHTTP(w, r)
+	t.sink.Timing(metricName(t.name, record), time.Since(start), metricLabels(r, record))
+}
+
+// metricName names a measurement for the route matched by a mux like
+// TrieServeMux if it wasn't given a name of its own.
+func metricName(name string, record *recordingResponseWriter) string {
+	if "" == name {
+		return record.Route
+	}
+	return name
+}
+
+// StatusClientClosedRequest is the status code, borrowed from nginx, that
+// metrics record for requests whose clients disconnected before the response
+// was complete.
+const StatusClientClosedRequest = 499
+
+// metricMethods are the methods labelled as themselves.  net/http accepts
+// any token as a method, so others are labelled OTHER lest clients create
+// unbounded series.
+var metricMethods = map[string]bool{
+	http.MethodConnect: true,
+	http.MethodDelete:  true,
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPatch:   true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodTrace:   true,
+}
+
+// metricLabels labels a measurement with the request's method, or OTHER if
+// it's not a standard one, the response's status code, or
+// StatusClientClosedRequest if the client disconnected, and the variant a
+// Canary chose, if any.
+func metricLabels(r *http.Request, record *recordingResponseWriter) map[string]string {
+	status := http.StatusOK
+	if record.WroteHeader {
+		status = record.StatusCode
+	}
+	if errors.Is(r.Context().Err(), context.Canceled) {
+		status = StatusClientClosedRequest
+	}
+	method := r.Method
+	if !metricMethods[method] {
+		method = "OTHER"
+	}
+	labels := map[string]string{
+		"method": method,
+		"status": strconv.Itoa(status),
+	}
+	if "" != record.Variant {
+		labels["variant"] = record.Variant
+	}
+	return labels
+}
+
+// statusClass returns the class of a status code, like 2xx.
+func statusClass(status string) string {
+	return status[:1] + "xx"
+}
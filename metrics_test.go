@@ -0,0 +1,129 @@
+package marshaler
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testMetric struct {
+	name   string
+	d      time.Duration
+	labels map[string]string
+}
+
+type testMetricsSink struct {
+	sync.Mutex
+	metrics []testMetric
+}
+
+func (s *testMetricsSink) Count(name string, n int64, labels map[string]string) {
+	s.Lock()
+	defer s.Unlock()
+	s.metrics = append(s.metrics, testMetric{name, time.Duration(n), labels})
+}
+
+func (s *testMetricsSink) Timing(name string, d time.Duration, labels map[string]string) {
+	s.Lock()
+	defer s.Unlock()
+	s.metrics = append(s.metrics, testMetric{name, d, labels})
+}
+
+func TestTimed(t *testing.T) {
+	sink := &testMetricsSink{}
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	Timed(Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		time.Sleep(time.Millisecond)
+		return http.StatusNotFound, nil, nil, testNamedError("foo")
+	}), "foo.get", sink).ServeHTTP(w, r)
+	if 1 != len(sink.metrics) {
+		t.Fatal(sink.metrics)
+	}
+	m := sink.metrics[0]
+	if "foo.get" != m.name || m.d < time.Millisecond || "GET" != m.labels["method"] || "404" != m.labels["status"] {
+		t.Fatal(m)
+	}
+}
+
+func TestTimedLogged(t *testing.T) {
+	sink := &testMetricsSink{}
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	var buf bytes.Buffer
+	l := Logged(Timed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("foo"))
+		w.WriteHeader(http.StatusTeapot)
+	}), "foo.get", sink), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.ServeHTTP(w, r)
+	if "200" != sink.metrics[0].labels["status"] || !bytes.Contains(buf.Bytes(), []byte("< HTTP/1.1 200 OK")) {
+		t.Fatal(sink.metrics, buf.String())
+	}
+}
+
+func TestCounted(t *testing.T) {
+	sink := &testMetricsSink{}
+	h := Counted(Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		if "/fail" == u.Path {
+			return http.StatusServiceUnavailable, nil, nil, testNamedError("foo")
+		}
+		return http.StatusOK, nil, &testResponse{"bar"}, nil
+	}), "foo", sink)
+	for _, path := range []string{"/foo", "/fail"} {
+		r, _ := http.NewRequest("GET", "http://example.com"+path, nil)
+		h.ServeHTTP(&testResponseWriter{}, r)
+	}
+	if 2 != len(sink.metrics) {
+		t.Fatal(sink.metrics)
+	}
+	if m := sink.metrics[0]; "foo" != m.name || 1 != m.d || "GET" != m.labels["method"] || "2xx" != m.labels["class"] || "" != m.labels["status"] {
+		t.Fatal(m)
+	}
+	if m := sink.metrics[1]; "5xx" != m.labels["class"] {
+		t.Fatal(m)
+	}
+}
+
+func TestCountedUnknownMethod(t *testing.T) {
+	sink := &testMetricsSink{}
+	h := Counted(http.NotFoundHandler(), "foo", sink)
+	for _, method := range []string{"GET", "BREW", "X-RANDOM"} {
+		r, _ := http.NewRequest(method, "http://example.com/foo", nil)
+		h.ServeHTTP(&testResponseWriter{}, r)
+	}
+	for i, want := range []string{"GET", "OTHER", "OTHER"} {
+		if want != sink.metrics[i].labels["method"] {
+			t.Fatal(sink.metrics)
+		}
+	}
+}
+
+func TestTimedClientDisconnected(t *testing.T) {
+	sink := &testMetricsSink{}
+	ctx, cancel := context.WithCancel(context.Background())
+	r, _ := http.NewRequestWithContext(ctx, "GET", "http://example.com/foo", nil)
+	var buf bytes.Buffer
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first"))
+		cancel()
+		w.Write([]byte("second"))
+	}), nil)
+	l.Logger = log.New(&buf, "", 0)
+	Timed(l, "foo.get", sink).ServeHTTP(&testResponseWriter{}, r)
+	if "499" != sink.metrics[0].labels["status"] {
+		t.Fatal(sink.metrics)
+	}
+	if !strings.Contains(buf.String(), "first") || strings.Contains(buf.String(), "second") {
+		t.Fatal(buf.String())
+	}
+	if 1 != strings.Count(buf.String(), "client disconnected after 5 bytes of the response") {
+		t.Fatal(buf.String())
+	}
+}
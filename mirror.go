@@ -0,0 +1,158 @@
+package marshaler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults for the Mirrors returned by Mirrored.
+var (
+	DefaultMirrorMaxBodySize int64 = 1 << 20
+	DefaultMirrorMaxInFlight int64 = 64
+	DefaultMirrorTimeout           = 10 * time.Second
+)
+
+// A Sampler decides whether a request should be mirrored.
+type Sampler func(r *http.Request) bool
+
+// SamplePercent returns a Sampler that chooses percent of requests at
+// random.
+func SamplePercent(percent float64) Sampler {
+	return func(r *http.Request) bool {
+		return rand.Float64()*100 < percent
+	}
+}
+
+// Mirror is an http.Handler that serves requests from a primary handler
+// while replaying copies of them to a mirror handler, for trying a new
+// implementation against production traffic.  Mirrored requests are served
+// asynchronously and their responses discarded, so they never delay or
+// affect the client's response.  Failures of the mirror, 5xx responses and
+// panics, are logged to Logger.
+//
+// Bodies are buffered so that both handlers may read them, so requests
+// with bodies longer than MaxBodySize aren't mirrored.  Neither are requests
+// that arrive while MaxInFlight mirrored requests are still being served.
+// Mirrored requests are cancelled after Timeout rather than when the client
+// goes away.
+type Mirror struct {
+	Logger      Logger
+	MaxBodySize int64
+	MaxInFlight int64
+	Timeout     time.Duration
+	inFlight    int64
+	mirror      http.Handler
+	primary     http.Handler
+	sampler     Sampler
+}
+
+// Mirrored returns an http.Handler that serves requests from primary and
+// mirrors those chosen by sampler, or all of them if it's nil, to mirror.
+func Mirrored(primary, mirror http.Handler, sampler Sampler) *Mirror {
+	return &Mirror{
+		Logger:      log.New(os.Stdout, "", log.Ltime|log.Lmicroseconds),
+		MaxBodySize: DefaultMirrorMaxBodySize,
+		MaxInFlight: DefaultMirrorMaxInFlight,
+		Timeout:     DefaultMirrorTimeout,
+		mirror:      mirror,
+		primary:     primary,
+		sampler:     sampler,
+	}
+}
+
+func (m *Mirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if nil != m.sampler && !m.sampler(r) {
+		m.primary.ServeHTTP(w, r)
+		return
+	}
+	var body []byte
+	if nil != r.Body && http.NoBody != r.Body {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, m.MaxBodySize+1))
+		rest := r.Body
+		r = r.Clone(r.Context())
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(body), rest), rest}
+		if nil != err || m.MaxBodySize < int64(len(body)) {
+			m.primary.ServeHTTP(w, r)
+			return
+		}
+	}
+	if atomic.AddInt64(&m.inFlight, 1) <= m.MaxInFlight {
+		ctx, cancel := context.WithTimeout(mirrorContext(r.Context()), m.Timeout)
+		mr := r.Clone(ctx)
+		mr.Body = http.NoBody
+		if nil != body {
+			mr.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		go m.serveMirror(mr, cancel)
+	} else {
+		atomic.AddInt64(&m.inFlight, -1)
+	}
+	m.primary.ServeHTTP(w, r)
+}
+
+// mirrorContext returns a context for a mirrored request that keeps the
+// values of the original's, like its RequestID, but not its cancellation or
+// the state Logged and Server keep about the original, which the mirror
+// mustn't touch.
+func mirrorContext(ctx context.Context) context.Context {
+	ctx = context.WithoutCancel(ctx)
+	ctx = context.WithValue(ctx, loggerResponseWriterKey{}, nil)
+	ctx = context.WithValue(ctx, responseRecordKey{}, nil)
+	return context.WithValue(ctx, inFlightKey{}, nil)
+}
+
+// serveMirror serves a copy of a request from the mirror, discarding the
+// response.
+func (m *Mirror) serveMirror(mr *http.Request, cancel context.CancelFunc) {
+	defer atomic.AddInt64(&m.inFlight, -1)
+	defer cancel()
+	w := &mirrorResponseWriter{header: http.Header{}}
+	defer func() {
+		if v := recover(); nil != v {
+			m.logFailure(mr, fmt.Sprintf("panic: %v", v))
+		} else if 500 <= w.code {
+			m.logFailure(mr, fmt.Sprintf("%d %s", w.code, http.StatusText(w.code)))
+		}
+	}()
+	m.mirror.ServeHTTP(w, mr)
+}
+
+func (m *Mirror) logFailure(r *http.Request, failure string) {
+	if requestID := RequestIDFromContext(r.Context()); "" != requestID {
+		m.Logger.Printf("%s mirror %s %s failed: %s", requestID, r.Method, r.URL.RequestURI(), failure)
+		return
+	}
+	m.Logger.Printf("mirror %s %s failed: %s", r.Method, r.URL.RequestURI(), failure)
+}
+
+// mirrorResponseWriter discards the mirror's response but for its status.
+type mirrorResponseWriter struct {
+	code   int
+	header http.Header
+}
+
+func (w *mirrorResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *mirrorResponseWriter) Write(p []byte) (int, error) {
+	if 0 == w.code {
+		w.code = http.StatusOK
+	}
+	return len(p), nil
+}
+
+func (w *mirrorResponseWriter) WriteHeader(code int) {
+	if 0 == w.code {
+		w.code = code
+	}
+}
@@ -0,0 +1,101 @@
+package marshaler
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMirrored(t *testing.T) {
+	mirrored := make(chan string, 1)
+	var buf testSyncBuffer
+	m := Mirrored(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mirrored <- r.Method + " " + r.URL.Path + " " + string(body)
+		w.WriteHeader(http.StatusInternalServerError)
+	}), nil)
+	m.Logger = log.New(&buf, "", 0)
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("POST", "/foo", strings.NewReader("bar"))
+	m.ServeHTTP(w, r)
+	if "bar" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+	select {
+	case s := <-mirrored:
+		if "POST /foo bar" != s {
+			t.Fatal(s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("not mirrored")
+	}
+	for i := 0; i < 100 && "" == buf.String(); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if "mirror POST /foo failed: 500 Internal Server Error\n" != buf.String() {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestMirroredPanic(t *testing.T) {
+	var buf testSyncBuffer
+	m := Mirrored(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	}), nil)
+	m.Logger = log.New(&buf, "", 0)
+	l := Logged(m, nil)
+	l.Logger = log.New(&bytes.Buffer{}, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "/", http.NoBody)
+	l.ServeHTTP(w, r)
+	if http.StatusNoContent != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	for i := 0; i < 100 && "" == buf.String(); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if "foo mirror GET / failed: panic: oops\n" != buf.String() {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestMirroredSkipped(t *testing.T) {
+	mirrored := make(chan bool, 1)
+	m := Mirrored(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrored <- true
+	}), func(r *http.Request) bool { return "GET" != r.Method })
+	m.MaxBodySize = 3
+	for _, r := range []*http.Request{
+		httptestRequest("GET", "/", ""),
+		httptestRequest("POST", "/", "toolong"),
+	} {
+		w := &testResponseWriter{}
+		m.ServeHTTP(w, r)
+		if "POST" == r.Method && "toolong" != w.Body.String() {
+			t.Fatal(w.Body.String())
+		}
+	}
+	select {
+	case <-mirrored:
+		t.Fatal("mirrored")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func httptestRequest(method, target, body string) *http.Request {
+	r, _ := http.NewRequest(method, target, strings.NewReader(body))
+	return r
+}
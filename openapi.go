@@ -0,0 +1,431 @@
+package marshaler
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenAPI describes the handlers registered with it as an OpenAPI 3
+// document, which it serves as JSON when used as an http.Handler.  Request
+// and response schemas are derived by reflecting on the functions of
+// marshaled handlers so the document can't drift from the code.
+//
+//	doc := marshaler.NewOpenAPI("Widgets", "1.0.0")
+//	mux.Handle("/widgets", doc.Register("GET", "/widgets", marshaler.Handler(listWidgets)))
+//	mux.Handle("/openapi.json", doc)
+type OpenAPI struct {
+	Title, Version string
+
+	// Examples, if not nil, supplies request and response examples for the
+	// routes it has recorded.
+	Examples *ExampleRecorder
+
+	mu         sync.Mutex
+	operations []*openAPIOperation
+}
+
+type openAPIOperation struct {
+	Method, Path string
+	Handler      http.Handler
+}
+
+// NewOpenAPI returns an OpenAPI document with the given title and version.
+func NewOpenAPI(title, version string) *OpenAPI {
+	return &OpenAPI{Title: title, Version: version}
+}
+
+// Register records that handler answers requests with the given method for
+// the given path, which may contain {parameters}, and returns handler.  If
+// handler is a Methods, each of its handlers is registered and method is
+// ignored.
+func (o *OpenAPI) Register(method, path string, handler http.Handler) http.Handler {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if methods, ok := handler.(Methods); ok {
+		for method, h := range methods {
+			o.operations = append(o.operations, &openAPIOperation{method, path, h})
+		}
+	} else {
+		o.operations = append(o.operations, &openAPIOperation{method, path, handler})
+	}
+	return handler
+}
+
+// ServeHTTP responds with the document as JSON.
+func (o *OpenAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !acceptJSON(r) {
+		writePlaintextError(w, NotAcceptable{NewMarshalerError(
+			"\"%s\" does not contain \"application/json\"",
+			r.Header.Get("Accept"),
+		)})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(o.Document()); nil != err {
+		writeJSONError(w, err)
+	}
+}
+
+// Document returns the OpenAPI document as a value that encodes to JSON.
+func (o *OpenAPI) Document() map[string]interface{} {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	g := &openAPIGenerator{schemas: map[string]interface{}{}, names: map[reflect.Type]string{}}
+	g.schemas["Error"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"description": map[string]interface{}{"type": "string"},
+			"error":       map[string]interface{}{"type": "string"},
+		},
+		"required": []string{"description", "error"},
+	}
+	paths := map[string]interface{}{}
+	for _, op := range o.operations {
+		item, ok := paths[op.Path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[op.Path] = item
+		}
+		operation := g.operation(op)
+		if nil != o.Examples {
+			addOpenAPIExamples(operation, o.Examples, op)
+		}
+		item[strings.ToLower(op.Method)] = operation
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   o.Title,
+			"version": o.Version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+		},
+	}
+}
+
+type openAPIGenerator struct {
+	schemas map[string]interface{}
+	names   map[reflect.Type]string
+}
+
+func (g *openAPIGenerator) operation(op *openAPIOperation) map[string]interface{} {
+	parameters := pathParameters(op.Path)
+	operation := map[string]interface{}{
+		"responses": map[string]interface{}{
+			"default": map[string]interface{}{
+				"description": "error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"},
+					},
+				},
+			},
+		},
+	}
+	m, ok := op.Handler.(*Marshaler)
+	if !ok {
+		if 0 < len(parameters) {
+			operation["parameters"] = parameters
+		}
+		return operation
+	}
+	t := m.v.Type()
+	if 2 < t.NumIn() {
+		in2 := t.In(2)
+		parameters = append(parameters, g.requestParameters(in2)...)
+		if body := g.requestBody(op.Method, in2); nil != body {
+			operation["requestBody"] = body
+		}
+	}
+	if 0 < len(parameters) {
+		operation["parameters"] = parameters
+	}
+	response := map[string]interface{}{"description": "success"}
+	if out2 := t.Out(2); reflect.TypeOf(Streamed(nil)) == out2 {
+		response["content"] = map[string]interface{}{
+			"application/x-ndjson": map[string]interface{}{"schema": map[string]interface{}{}},
+		}
+	} else if !(reflect.Interface == out2.Kind() && 0 == out2.NumMethod()) {
+		response["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": g.schema(out2)},
+		}
+	}
+	operation["responses"].(map[string]interface{})["200"] = response
+	return operation
+}
+
+func (g *openAPIGenerator) requestBody(method string, t reflect.Type) map[string]interface{} {
+	if "PATCH" != method && "POST" != method && "PUT" != method {
+		return nil
+	}
+	var content map[string]interface{}
+	switch {
+	case reflect.TypeOf(&Patch{}) == t:
+		content = map[string]interface{}{
+			JSONPatchType: map[string]interface{}{"schema": map[string]interface{}{
+				"type":  "array",
+				"items": g.schema(reflect.TypeOf(PatchOperation{})),
+			}},
+			MergePatchType: map[string]interface{}{"schema": map[string]interface{}{"type": "object"}},
+		}
+	case reflect.Chan == t.Kind():
+		content = map[string]interface{}{
+			"application/x-ndjson": map[string]interface{}{"schema": g.schema(t.Elem())},
+		}
+	case reflect.Interface == t.Kind() && 0 == t.NumMethod():
+		return nil
+	default:
+		content = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": g.schema(t)},
+		}
+	}
+	return map[string]interface{}{"required": true, "content": content}
+}
+
+// requestParameters describes the query parameters a request type takes.
+func (g *openAPIGenerator) requestParameters(t reflect.Type) []interface{} {
+	for reflect.Ptr == t.Kind() {
+		t = t.Elem()
+	}
+	if reflect.Struct != t.Kind() {
+		return nil
+	}
+	var names []string
+	if _, ok := t.FieldByName("OffsetPage"); ok {
+		names = []string{"offset", "limit"}
+	} else if _, ok := t.FieldByName("CursorPage"); ok {
+		names = []string{"cursor", "limit"}
+	}
+	parameters := bindingParameters(t)
+	for _, name := range names {
+		typ := "integer"
+		if "cursor" == name {
+			typ = "string"
+		}
+		parameters = append(parameters, map[string]interface{}{
+			"name":   name,
+			"in":     "query",
+			"schema": map[string]interface{}{"type": typ},
+		})
+	}
+	return parameters
+}
+
+// bindingParameters describes the parameters bound into a request struct's
+// tagged fields, except path parameters, which are described by the path.
+func bindingParameters(t reflect.Type) []interface{} {
+	var parameters []interface{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && reflect.Struct == f.Type.Kind() {
+			parameters = append(parameters, bindingParameters(f.Type)...)
+			continue
+		}
+		for _, source := range bindingSources {
+			tag, ok := f.Tag.Lookup(source.tag)
+			if !ok || "path" == source.tag {
+				continue
+			}
+			name, required := parseBindingTag(tag)
+			ft := f.Type
+			for reflect.Ptr == ft.Kind() {
+				ft = ft.Elem()
+			}
+			schema := map[string]interface{}{"type": "string"}
+			switch {
+			case durationType == ft, reflect.PtrTo(ft).Implements(textUnmarshalerType):
+			case reflect.Slice == ft.Kind():
+				schema = map[string]interface{}{"type": "array", "items": parameterSchema(ft.Elem())}
+			default:
+				schema = parameterSchema(ft)
+			}
+			if def, ok := f.Tag.Lookup("default"); ok {
+				schema["default"] = def
+			}
+			parameter := map[string]interface{}{
+				"name":   name,
+				"in":     source.tag,
+				"schema": schema,
+			}
+			if required {
+				parameter["required"] = true
+			}
+			parameters = append(parameters, parameter)
+		}
+	}
+	return parameters
+}
+
+func parameterSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{"type": "string"}
+}
+
+func pathParameters(path string) []interface{} {
+	var parameters []interface{}
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     segment[1 : len(segment)-1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	return parameters
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+)
+
+// schema returns the Schema Object for a type, adding named struct types to
+// the components and referring to them there.
+func (g *openAPIGenerator) schema(t reflect.Type) map[string]interface{} {
+	for reflect.Ptr == t.Kind() {
+		t = t.Elem()
+	}
+	switch {
+	case timeType == t:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Float32:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if reflect.Uint8 == t.Elem().Kind() && reflect.Slice == t.Kind() {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if "" == t.Name() {
+			return g.structSchema(t)
+		}
+		name, ok := g.names[t]
+		if !ok {
+			name = g.name(t)
+			g.names[t] = name
+			g.schemas[name] = nil // Placeholder for recursive types.
+			g.schemas[name] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+// name returns a component name for a named type, qualifying it with its
+// package name if another type has already taken the bare name.
+func (g *openAPIGenerator) name(t reflect.Type) string {
+	name := t.Name()
+	if _, taken := g.schemas[name]; taken {
+		name = strings.Replace(t.String(), ".", "_", -1)
+	}
+	return name
+}
+
+func (g *openAPIGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	g.structProperties(t, properties, &required)
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if 0 < len(required) {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (g *openAPIGenerator) structProperties(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, omitempty, ok := jsonFieldName(f)
+		if !ok {
+			continue
+		}
+		if f.Anonymous && "" == f.Tag.Get("json") {
+			ft := f.Type
+			if reflect.Ptr == ft.Kind() {
+				ft = ft.Elem()
+			}
+			if reflect.Struct == ft.Kind() {
+				g.structProperties(ft, properties, required)
+				continue
+			}
+		}
+		properties[name] = g.schema(f.Type)
+		if !omitempty && reflect.Ptr != f.Type.Kind() {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// jsonFieldName returns the name encoding/json uses for a struct field and
+// whether it has the omitempty option, or false if the field isn't encoded.
+func jsonFieldName(f reflect.StructField) (name string, omitempty bool, ok bool) {
+	if "" != f.PkgPath && !f.Anonymous {
+		return "", false, false
+	}
+	tag := f.Tag.Get("json")
+	if "-" == tag {
+		return "", false, false
+	}
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if "" == name {
+		name = f.Name
+	}
+	for _, option := range parts[1:] {
+		if "omitempty" == option {
+			omitempty = true
+		}
+	}
+	return name, omitempty, true
+}
+
+// addOpenAPIExamples adds recorded examples to the JSON request body and 200
+// response of an operation.
+func addOpenAPIExamples(operation map[string]interface{}, e *ExampleRecorder, op *openAPIOperation) {
+	requests, responses := e.openAPIExamples(op.Method, op.Path)
+	if body, ok := operation["requestBody"].(map[string]interface{}); ok && nil != requests {
+		if mediaType, ok := body["content"].(map[string]interface{})["application/json"].(map[string]interface{}); ok {
+			mediaType["examples"] = requests
+		}
+	}
+	response, _ := operation["responses"].(map[string]interface{})["200"].(map[string]interface{})
+	if content, ok := response["content"].(map[string]interface{}); ok && nil != responses {
+		if mediaType, ok := content["application/json"].(map[string]interface{}); ok {
+			mediaType["examples"] = responses
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package marshaler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+type testOpenAPIWidget struct {
+	ID       int                  `json:"id"`
+	Name     string               `json:"name,omitempty"`
+	Children []*testOpenAPIWidget `json:"children"`
+	secret   string
+}
+
+func TestOpenAPI(t *testing.T) {
+	doc := NewOpenAPI("Widgets", "1.0.0")
+	doc.Register("", "/widgets/{id}", Methods{
+		"GET": Handler(func(u *url.URL, h http.Header) (int, http.Header, *testOpenAPIWidget, error) {
+			return http.StatusOK, nil, nil, nil
+		}),
+		"PUT": Handler(func(u *url.URL, h http.Header, rq *testOpenAPIWidget) (int, http.Header, *testOpenAPIWidget, error) {
+			return http.StatusOK, nil, nil, nil
+		}),
+	})
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/openapi.json", nil)
+	doc.ServeHTTP(w, r)
+	var v struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name, In string
+			}
+			RequestBody *struct{}
+			Responses   map[string]struct {
+				Content map[string]struct {
+					Schema map[string]interface{}
+				}
+			}
+		}
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]interface{}
+				Required   []string
+			}
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &v); nil != err {
+		t.Fatal(err)
+	}
+	get := v.Paths["/widgets/{id}"]["get"]
+	if 1 != len(get.Parameters) || "id" != get.Parameters[0].Name || "path" != get.Parameters[0].In {
+		t.Fatal(get.Parameters)
+	}
+	if nil != get.RequestBody {
+		t.Fatal(get.RequestBody)
+	}
+	if "#/components/schemas/testOpenAPIWidget" != get.Responses["200"].Content["application/json"].Schema["$ref"] {
+		t.Fatal(get.Responses)
+	}
+	if nil == v.Paths["/widgets/{id}"]["put"].RequestBody {
+		t.Fatal(v.Paths["/widgets/{id}"]["put"])
+	}
+	widget := v.Components.Schemas["testOpenAPIWidget"]
+	if 3 != len(widget.Properties) || 2 != len(widget.Required) {
+		t.Fatal(widget)
+	}
+}
@@ -0,0 +1,107 @@
+package marshaler
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Bounds applied to the limit parameter of paginated requests.
+var (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// A PageParser is a request type that takes pagination parameters from the
+// query string.  The Marshaler calls ParsePage before calling the handler
+// function and responds 400 Bad Request if it returns an error.  Embedding
+// OffsetPage or CursorPage in a request struct implements PageParser.
+type PageParser interface {
+	ParsePage(query url.Values) error
+}
+
+// OffsetPage holds the offset and limit parameters of a request for a page
+// of results.
+type OffsetPage struct {
+	Offset int `json:"-"`
+	Limit  int `json:"-"`
+}
+
+// ParsePage parses the offset and limit query parameters.
+func (p *OffsetPage) ParsePage(query url.Values) (err error) {
+	if p.Offset, err = pageParam(query, "offset", 0); nil != err {
+		return
+	}
+	if 0 > p.Offset {
+		return fmt.Errorf("offset %d is negative", p.Offset)
+	}
+	p.Limit, err = pageLimit(query)
+	return
+}
+
+// CursorPage holds the cursor and limit parameters of a request for a page
+// of results.
+type CursorPage struct {
+	Cursor string `json:"-"`
+	Limit  int    `json:"-"`
+}
+
+// ParsePage parses the cursor and limit query parameters.
+func (p *CursorPage) ParsePage(query url.Values) (err error) {
+	p.Cursor = query.Get("cursor")
+	p.Limit, err = pageLimit(query)
+	return
+}
+
+// Page is the response envelope for a page of results.  NextCursor is
+// empty on the last page and Total is omitted when it's unknown.  Related
+// links are sent in the Link header rather than the body.
+type Page struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	Total      int         `json:"total,omitempty"`
+	Related    []Link      `json:"-"`
+}
+
+// Links implements the Linker interface.
+func (p *Page) Links() []Link {
+	return p.Related
+}
+
+// NewCursorPage returns a Page of items followed by the given cursor.
+func NewCursorPage(items interface{}, nextCursor string) *Page {
+	return &Page{Items: items, NextCursor: nextCursor}
+}
+
+// NewOffsetPage returns a Page of items from a result set of the given total
+// size whose cursor is the offset of the following page, if there is one.
+func NewOffsetPage(items interface{}, p OffsetPage, total int) *Page {
+	page := &Page{Items: items, Total: total}
+	if next := p.Offset + p.Limit; next < total {
+		page.NextCursor = strconv.Itoa(next)
+	}
+	return page
+}
+
+func pageLimit(query url.Values) (int, error) {
+	limit, err := pageParam(query, "limit", DefaultPageLimit)
+	if nil != err {
+		return 0, err
+	}
+	if 1 > limit || MaxPageLimit < limit {
+		return 0, fmt.Errorf("limit %d is not between 1 and %d", limit, MaxPageLimit)
+	}
+	return limit, nil
+}
+
+func pageParam(query url.Values, name string, fallback int) (int, error) {
+	s := query.Get(name)
+	if "" == s {
+		return fallback, nil
+	}
+	i, err := strconv.Atoi(s)
+	if nil != err {
+		return 0, fmt.Errorf("%s %q is not an integer", name, s)
+	}
+	return i, nil
+}
@@ -0,0 +1,44 @@
+package marshaler
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+type testPageRequest struct {
+	OffsetPage
+}
+
+func TestOffsetPage(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo?offset=2&limit=2", nil)
+	Handler(func(u *url.URL, h http.Header, rq *testPageRequest) (int, http.Header, *Page, error) {
+		items := []string{"a", "b", "c", "d", "e"}
+		return http.StatusOK, nil, NewOffsetPage(items[rq.Offset:rq.Offset+rq.Limit], rq.OffsetPage, len(items)), nil
+	}).ServeHTTP(w, r)
+	if "{\"items\":[\"c\",\"d\"],\"next_cursor\":\"4\",\"total\":5}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestOffsetPageBadLimit(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo?limit=1000", nil)
+	Handler(func(u *url.URL, h http.Header, rq *testPageRequest) (int, http.Header, *Page, error) {
+		return http.StatusOK, nil, nil, nil
+	}).ServeHTTP(w, r)
+	if http.StatusBadRequest != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
+
+func TestCursorPage(t *testing.T) {
+	var p CursorPage
+	if err := p.ParsePage(url.Values{"cursor": {"abc"}}); nil != err {
+		t.Fatal(err)
+	}
+	if "abc" != p.Cursor || DefaultPageLimit != p.Limit {
+		t.Fatal(p)
+	}
+}
@@ -0,0 +1,320 @@
+package marshaler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Media types of the patch documents a Patch may hold.
+const (
+	JSONPatchType  = "application/json-patch+json"
+	MergePatchType = "application/merge-patch+json"
+)
+
+// Patch is a request type for PATCH handlers that accepts either a JSON
+// Patch (RFC 6902) or a JSON Merge Patch (RFC 7396) document.  The Marshaler
+// responds 400 Bad Request to malformed patches before calling the handler,
+// which applies the patch to its current value by calling Apply.
+//
+//	func(u *url.URL, h http.Header, rq *marshaler.Patch) (int, http.Header, *Widget, error) {
+//	    widget := loadWidget(u)
+//	    if err := rq.Apply(widget); nil != err {
+//	        return 0, nil, nil, err
+//	    }
+//	    ...
+//	}
+type Patch struct {
+	ContentType string
+	Operations  []PatchOperation
+	Merge       json.RawMessage
+}
+
+// PatchOperation is a single operation of a JSON Patch.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// UnmarshalJSON parses and validates a patch document according to the
+// Patch's ContentType, which the Marshaler sets from the request.
+func (p *Patch) UnmarshalJSON(data []byte) error {
+	if JSONPatchType != p.ContentType {
+		p.Merge = append(json.RawMessage(nil), data...)
+		return nil
+	}
+	if err := json.Unmarshal(data, &p.Operations); nil != err {
+		return err
+	}
+	for i, op := range p.Operations {
+		if err := op.validate(); nil != err {
+			return fmt.Errorf("operation %d: %s", i, err)
+		}
+	}
+	return nil
+}
+
+func (op PatchOperation) validate() error {
+	if _, err := parsePointer(op.Path); nil != err {
+		return err
+	}
+	switch op.Op {
+	case "add", "replace", "test":
+		if nil == op.Value {
+			return fmt.Errorf("%s requires a value", op.Op)
+		}
+	case "move", "copy":
+		if _, err := parsePointer(op.From); nil != err {
+			return err
+		}
+	case "remove":
+	default:
+		return fmt.Errorf("unknown op %q", op.Op)
+	}
+	return nil
+}
+
+// Apply applies the patch to v, which must be a pointer to the current value
+// of the resource.  Failed test operations return a 409 Conflict error and
+// other failures a 422 Unprocessable Entity error, either of which may be
+// returned directly from the handler.  v is not modified if Apply fails.
+func (p *Patch) Apply(v interface{}) error {
+	current, err := json.Marshal(v)
+	if nil != err {
+		return err
+	}
+	var doc interface{}
+	if err := decodeJSONNumbers(current, &doc); nil != err {
+		return err
+	}
+	if JSONPatchType == p.ContentType {
+		for i, op := range p.Operations {
+			if doc, err = op.apply(doc); nil != err {
+				if _, ok := err.(HTTPEquivError); ok {
+					return err
+				}
+				return NewHTTPEquivError(
+					fmt.Errorf("operation %d: %s", i, err),
+					http.StatusUnprocessableEntity,
+				)
+			}
+		}
+	} else {
+		var merge interface{}
+		if err := decodeJSONNumbers(p.Merge, &merge); nil != err {
+			return NewHTTPEquivError(err, http.StatusUnprocessableEntity)
+		}
+		doc = mergePatch(doc, merge)
+	}
+	patched, err := json.Marshal(doc)
+	if nil != err {
+		return err
+	}
+	value := reflect.New(reflect.TypeOf(v).Elem())
+	if err := json.Unmarshal(patched, value.Interface()); nil != err {
+		return NewHTTPEquivError(err, http.StatusUnprocessableEntity)
+	}
+	reflect.ValueOf(v).Elem().Set(value.Elem())
+	return nil
+}
+
+func (op PatchOperation) apply(doc interface{}) (interface{}, error) {
+	path, _ := parsePointer(op.Path)
+	switch op.Op {
+	case "add", "replace", "test":
+		var value interface{}
+		if err := decodeJSONNumbers(op.Value, &value); nil != err {
+			return nil, err
+		}
+		switch op.Op {
+		case "add":
+			return pointerSet(doc, path, value, true)
+		case "replace":
+			if _, err := pointerGet(doc, path); nil != err {
+				return nil, err
+			}
+			return pointerSet(doc, path, value, false)
+		}
+		current, err := pointerGet(doc, path)
+		if nil != err {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, Conflict{fmt.Errorf("test of %s failed", op.Path)}
+		}
+		return doc, nil
+	case "remove":
+		return pointerRemove(doc, path)
+	}
+	from, _ := parsePointer(op.From)
+	value, err := pointerGet(doc, from)
+	if nil != err {
+		return nil, err
+	}
+	if "move" == op.Op {
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("can't move %s into itself", op.From)
+		}
+		if doc, err = pointerRemove(doc, from); nil != err {
+			return nil, err
+		}
+	} else {
+		var copied interface{}
+		b, _ := json.Marshal(value)
+		decodeJSONNumbers(b, &copied)
+		value = copied
+	}
+	return pointerSet(doc, path, value, true)
+}
+
+// mergePatch applies a JSON Merge Patch to a decoded document.
+func mergePatch(doc, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	docObject, ok := doc.(map[string]interface{})
+	if !ok {
+		docObject = map[string]interface{}{}
+	}
+	for name, value := range patchObject {
+		if nil == value {
+			delete(docObject, name)
+		} else {
+			docObject[name] = mergePatch(docObject[name], value)
+		}
+	}
+	return docObject
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if "" == pointer {
+		return nil, nil
+	}
+	if '/' != pointer[0] {
+		return nil, fmt.Errorf("path %q doesn't begin with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			value, ok := v[token]
+			if !ok {
+				return nil, fmt.Errorf("%s not found", token)
+			}
+			doc = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(v)-1)
+			if nil != err {
+				return nil, err
+			}
+			doc = v[i]
+		default:
+			return nil, fmt.Errorf("%s not found", token)
+		}
+	}
+	return doc, nil
+}
+
+// pointerSet sets the value at path, inserting into arrays if insert is true
+// and replacing their elements otherwise, and returns the modified document.
+func pointerSet(doc interface{}, path []string, value interface{}, insert bool) (interface{}, error) {
+	if 0 == len(path) {
+		return value, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if nil != err {
+		return nil, err
+	}
+	token := path[len(path)-1]
+	switch v := parent.(type) {
+	case map[string]interface{}:
+		v[token] = value
+		return doc, nil
+	case []interface{}:
+		if !insert {
+			i, err := arrayIndex(token, len(v)-1)
+			if nil != err {
+				return nil, err
+			}
+			v[i] = value
+			return doc, nil
+		}
+		i := len(v)
+		if "-" != token {
+			if i, err = arrayIndex(token, len(v)); nil != err {
+				return nil, err
+			}
+		}
+		v = append(v, nil)
+		copy(v[i+1:], v[i:])
+		v[i] = value
+		return pointerSet(doc, path[:len(path)-1], v, false)
+	}
+	return nil, fmt.Errorf("%s not found", token)
+}
+
+func pointerRemove(doc interface{}, path []string) (interface{}, error) {
+	if 0 == len(path) {
+		return nil, fmt.Errorf("can't remove the whole document")
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if nil != err {
+		return nil, err
+	}
+	token := path[len(path)-1]
+	switch v := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := v[token]; !ok {
+			return nil, fmt.Errorf("%s not found", token)
+		}
+		delete(v, token)
+		return doc, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(v)-1)
+		if nil != err {
+			return nil, err
+		}
+		return pointerSet(doc, path[:len(path)-1], append(v[:i], v[i+1:]...), false)
+	}
+	return nil, fmt.Errorf("%s not found", token)
+}
+
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if nil != err || 0 > i || max < i || (1 < len(token) && '0' == token[0]) {
+		return 0, fmt.Errorf("index %s out of range", token)
+	}
+	return i, nil
+}
+
+func decodeJSONNumbers(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// patchContentType returns the patch media type of a request's Content-Type
+// header, or the empty string if it isn't one.
+func patchContentType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if JSONPatchType == mediaType || MergePatchType == mediaType {
+		return mediaType
+	}
+	return ""
+}
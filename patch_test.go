@@ -0,0 +1,100 @@
+package marshaler
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+type testPatchResource struct {
+	Foo  string   `json:"foo"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+func TestJSONPatch(t *testing.T) {
+	p := &Patch{ContentType: JSONPatchType}
+	if err := p.UnmarshalJSON([]byte(`[
+		{"op": "test", "path": "/foo", "value": "bar"},
+		{"op": "replace", "path": "/foo", "value": "baz"},
+		{"op": "add", "path": "/tags/0", "value": "a"},
+		{"op": "add", "path": "/tags/-", "value": "c"},
+		{"op": "copy", "from": "/tags/1", "path": "/tags/1"}
+	]`)); nil != err {
+		t.Fatal(err)
+	}
+	v := &testPatchResource{"bar", []string{"b"}}
+	if err := p.Apply(v); nil != err {
+		t.Fatal(err)
+	}
+	if "baz" != v.Foo || 4 != len(v.Tags) || "a" != v.Tags[0] || "b" != v.Tags[1] || "b" != v.Tags[2] || "c" != v.Tags[3] {
+		t.Fatal(v)
+	}
+}
+
+func TestJSONPatchTestFailed(t *testing.T) {
+	p := &Patch{ContentType: JSONPatchType}
+	p.UnmarshalJSON([]byte(`[{"op": "test", "path": "/foo", "value": "baz"}, {"op": "remove", "path": "/foo"}]`))
+	v := &testPatchResource{Foo: "bar"}
+	err := p.Apply(v)
+	if http.StatusConflict != errorStatusCode(err) {
+		t.Fatal(err)
+	}
+	if "bar" != v.Foo {
+		t.Fatal(v)
+	}
+}
+
+func TestJSONPatchMalformed(t *testing.T) {
+	for _, patch := range []string{
+		`{}`,
+		`[{"op": "frob", "path": "/foo"}]`,
+		`[{"op": "add", "path": "/foo"}]`,
+		`[{"op": "remove", "path": "foo"}]`,
+	} {
+		p := &Patch{ContentType: JSONPatchType}
+		if err := p.UnmarshalJSON([]byte(patch)); nil == err {
+			t.Fatal(patch)
+		}
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("PATCH", "http://example.com/foo", bytes.NewBufferString(`{"foo": "baz", "tags": null}`))
+	r.Header.Set("Content-Type", MergePatchType)
+	Handler(func(u *url.URL, h http.Header, rq *Patch) (int, http.Header, *testPatchResource, error) {
+		v := &testPatchResource{"bar", []string{"a"}}
+		if err := rq.Apply(v); nil != err {
+			return 0, nil, nil, err
+		}
+		return http.StatusOK, nil, v, nil
+	}).ServeHTTP(w, r)
+	if "{\"foo\":\"baz\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestPatchUnsupportedMediaType(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("PATCH", "http://example.com/foo", bytes.NewBufferString(`{}`))
+	r.Header.Set("Content-Type", "application/json")
+	Handler(func(u *url.URL, h http.Header, rq *Patch) (int, http.Header, *testPatchResource, error) {
+		return http.StatusNoContent, nil, nil, nil
+	}).ServeHTTP(w, r)
+	if http.StatusUnsupportedMediaType != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
+
+func TestJSONPatchMalformedRequest(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("PATCH", "http://example.com/foo", bytes.NewBufferString(`[{"op": "frob", "path": "/foo"}]`))
+	r.Header.Set("Content-Type", JSONPatchType)
+	Handler(func(u *url.URL, h http.Header, rq *Patch) (int, http.Header, *testPatchResource, error) {
+		return http.StatusNoContent, nil, nil, nil
+	}).ServeHTTP(w, r)
+	if http.StatusBadRequest != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
@@ -0,0 +1,77 @@
+package marshaler
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// Tuning for the pool of buffers the Marshaler encodes responses into.  New
+// buffers start with InitialBufferSize bytes of capacity and buffers that
+// have grown beyond MaxPooledBufferSize are left for the garbage collector
+// rather than pinning their memory in the pool.
+var (
+	InitialBufferSize   = 1 << 10
+	MaxPooledBufferSize = 1 << 16
+)
+
+// encodeBuffer is a buffer paired with a JSON encoder that writes to it so
+// that both may be reused together.  json.Decoder can't be reset to read
+// from a new source so decoders are not pooled.
+type encodeBuffer struct {
+	bytes.Buffer
+	encoder *json.Encoder
+}
+
+var encodeBufferPool = sync.Pool{
+	New: func() interface{} {
+		b := &encodeBuffer{}
+		b.Grow(InitialBufferSize)
+		b.encoder = json.NewEncoder(&b.Buffer)
+		return b
+	},
+}
+
+func getEncodeBuffer() *encodeBuffer {
+	b := encodeBufferPool.Get().(*encodeBuffer)
+	b.Reset()
+	return b
+}
+
+func putEncodeBuffer(b *encodeBuffer) {
+	if MaxPooledBufferSize < b.Cap() {
+		return
+	}
+	encodeBufferPool.Put(b)
+}
+
+// MaxPooledLogBufferSize bounds the line buffers Logged keeps for reuse;
+// larger ones, grown by logging large bodies, are left for the garbage
+// collector.
+var MaxPooledLogBufferSize = 1 << 16
+
+// logBuffers are the line buffers Logged builds the lines about a request
+// and its response in.
+type logBuffers struct {
+	in, out []byte
+}
+
+var logBuffersPool = sync.Pool{
+	New: func() interface{} {
+		return &logBuffers{}
+	},
+}
+
+func getLogBuffers() *logBuffers {
+	return logBuffersPool.Get().(*logBuffers)
+}
+
+func putLogBuffers(b *logBuffers) {
+	if MaxPooledLogBufferSize < cap(b.in) {
+		b.in = nil
+	}
+	if MaxPooledLogBufferSize < cap(b.out) {
+		b.out = nil
+	}
+	logBuffersPool.Put(b)
+}
@@ -0,0 +1,56 @@
+package marshaler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestEncodeBufferReset(t *testing.T) {
+	b := getEncodeBuffer()
+	b.encoder.Encode("foo")
+	putEncodeBuffer(b)
+	b = getEncodeBuffer()
+	defer putEncodeBuffer(b)
+	if 0 != b.Len() {
+		t.Fatal(b.String())
+	}
+	b.encoder.Encode("bar")
+	if "\"bar\"\n" != b.String() {
+		t.Fatal(b.String())
+	}
+}
+
+func BenchmarkMarshalerGET(b *testing.B) {
+	m := Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, nil, &testResponse{"bar"}, nil
+	})
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m.ServeHTTP(&testResponseWriter{}, r)
+	}
+}
+
+func TestLogBuffersMaxSize(t *testing.T) {
+	b := getLogBuffers()
+	b.in = make([]byte, 0, MaxPooledLogBufferSize+1)
+	b.out = make([]byte, 0, 16)
+	putLogBuffers(b)
+	if nil != b.in || 16 != cap(b.out) {
+		t.Fatal(cap(b.in), cap(b.out))
+	}
+}
+
+func BenchmarkMarshalerPOST(b *testing.B) {
+	m := Handler(func(u *url.URL, h http.Header, rq *testRequest) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, nil, &testResponse{rq.Foo}, nil
+	})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r, _ := http.NewRequest("POST", "http://example.com/foo", strings.NewReader(`{"foo":"bar"}`))
+		r.Header.Set("Content-Type", "application/json")
+		m.ServeHTTP(&testResponseWriter{}, r)
+	}
+}
@@ -0,0 +1,79 @@
+package marshaler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Preconditions are the conditions a client placed on an update via the
+// If-Match and If-Unmodified-Since headers.
+type Preconditions struct {
+	IfMatch           []string
+	IfUnmodifiedSince time.Time
+}
+
+// ParsePreconditions parses the If-Match and If-Unmodified-Since headers.
+// Unparseable dates are ignored as RFC 7232 requires.
+func ParsePreconditions(header http.Header) Preconditions {
+	var p Preconditions
+	for _, value := range header["If-Match"] {
+		for _, etag := range strings.Split(value, ",") {
+			if etag = strings.TrimSpace(etag); "" != etag {
+				p.IfMatch = append(p.IfMatch, etag)
+			}
+		}
+	}
+	if t, err := http.ParseTime(header.Get("If-Unmodified-Since")); nil == err {
+		p.IfUnmodifiedSince = t
+	}
+	return p
+}
+
+// Empty reports whether the client sent no preconditions.
+func (p Preconditions) Empty() bool {
+	return 0 == len(p.IfMatch) && p.IfUnmodifiedSince.IsZero()
+}
+
+// Check evaluates the preconditions against the current entity tag and
+// modification time of a resource, either of which may be zero if the
+// resource doesn't have one, and returns a PreconditionFailed error if they
+// don't hold.  An If-Match header takes precedence over If-Unmodified-Since.
+func (p Preconditions) Check(etag string, lastModified time.Time) error {
+	if 0 < len(p.IfMatch) {
+		for _, candidate := range p.IfMatch {
+			if "*" == candidate && "" != etag {
+				return nil
+			}
+			if candidate == etag && !strings.HasPrefix(etag, "W/") {
+				return nil
+			}
+		}
+		return PreconditionFailed{fmt.Errorf(
+			"If-Match %s does not match ETag %s",
+			strings.Join(p.IfMatch, ", "),
+			etag,
+		)}
+	}
+	if !p.IfUnmodifiedSince.IsZero() && !lastModified.IsZero() &&
+		lastModified.Truncate(time.Second).After(p.IfUnmodifiedSince) {
+		return PreconditionFailed{fmt.Errorf(
+			"modified at %s, after If-Unmodified-Since %s",
+			lastModified.UTC().Format(http.TimeFormat),
+			p.IfUnmodifiedSince.UTC().Format(http.TimeFormat),
+		)}
+	}
+	return nil
+}
+
+// RequirePreconditions is like Check but first returns a
+// PreconditionRequired error if the client sent no preconditions, for
+// endpoints that refuse blind updates.
+func (p Preconditions) RequirePreconditions(etag string, lastModified time.Time) error {
+	if p.Empty() {
+		return PreconditionRequired{errors.New("If-Match or If-Unmodified-Since is required")}
+	}
+	return p.Check(etag, lastModified)
+}
@@ -0,0 +1,48 @@
+package marshaler
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestPreconditionsIfMatch(t *testing.T) {
+	p := ParsePreconditions(http.Header{"If-Match": {"\"a\", \"b\""}})
+	if err := p.Check("\"b\"", time.Time{}); nil != err {
+		t.Fatal(err)
+	}
+	if err := p.Check("\"c\"", time.Time{}); http.StatusPreconditionFailed != errorStatusCode(err) {
+		t.Fatal(err)
+	}
+	if err := p.Check("W/\"b\"", time.Time{}); nil == err {
+		t.Fatal("weak ETag matched")
+	}
+}
+
+func TestPreconditionsIfUnmodifiedSince(t *testing.T) {
+	since := time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := ParsePreconditions(http.Header{"If-Unmodified-Since": {since.Format(http.TimeFormat)}})
+	if err := p.Check("", since.Add(500*time.Millisecond)); nil != err {
+		t.Fatal(err)
+	}
+	if err := p.Check("", since.Add(time.Hour)); nil == err {
+		t.Fatal("modified")
+	}
+}
+
+func TestRequirePreconditions(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("PUT", "http://example.com/foo", bytes.NewBufferString("{}"))
+	r.Header.Set("Content-Type", "application/json")
+	Handler(func(u *url.URL, h http.Header, rq *testRequest) (int, http.Header, *testResponse, error) {
+		if err := ParsePreconditions(h).RequirePreconditions("\"a\"", time.Time{}); nil != err {
+			return 0, nil, nil, err
+		}
+		return http.StatusNoContent, nil, nil, nil
+	}).ServeHTTP(w, r)
+	if http.StatusPreconditionRequired != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
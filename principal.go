@@ -0,0 +1,40 @@
+package marshaler
+
+import "context"
+
+// Principal is the authenticated identity behind a request.  Authentication
+// middleware puts it in the request's context, the logger records its Name,
+// and the Marshaler consults its Roles to filter response fields.
+type Principal struct {
+	Name  string
+	Roles []string
+}
+
+// HasRole reports whether the principal has any of the given roles.
+func (p *Principal) HasRole(roles ...string) bool {
+	if nil == p {
+		return false
+	}
+	for _, role := range roles {
+		for _, r := range p.Roles {
+			if r == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the given Principal.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the Principal carried by ctx or nil if the
+// request wasn't authenticated.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
@@ -0,0 +1,258 @@
+package marshaler
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default buckets of the histograms kept by PrometheusMetrics.
+var (
+	DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	DefaultSizeBuckets     = []float64{100, 1000, 10000, 100000, 1e6, 1e7}
+)
+
+// PrometheusMetrics collects metrics and serves them in the Prometheus text
+// exposition format, usually at /metrics.  Handlers wrapped by Instrumented
+// are measured by request count, duration, size, and response size labeled
+// with method, route, and status, as well as by the number of requests in
+// flight.  PrometheusMetrics is also a MetricsSink, which exposes counts as
+// counters and timings as histograms.
+type PrometheusMetrics struct {
+	Namespace       string
+	DurationBuckets []float64
+	SizeBuckets     []float64
+
+	mu       sync.Mutex
+	families map[string]*prometheusFamily
+}
+
+// NewPrometheusMetrics returns PrometheusMetrics whose metric names begin
+// with the given namespace, if it's not empty.
+func NewPrometheusMetrics(namespace string) *PrometheusMetrics {
+	return &PrometheusMetrics{
+		Namespace:       namespace,
+		DurationBuckets: DefaultDurationBuckets,
+		SizeBuckets:     DefaultSizeBuckets,
+		families:        make(map[string]*prometheusFamily),
+	}
+}
+
+type prometheusFamily struct {
+	name, help, kind string
+	buckets          []float64
+	series           map[string]*prometheusSeries
+}
+
+type prometheusSeries struct {
+	labels string
+	value  float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Count adds n to the counter with the given name and labels.
+func (m *PrometheusMetrics) Count(name string, n int64, labels map[string]string) {
+	m.add(name, "counter", "", nil, labels, float64(n))
+}
+
+// Timing observes d in seconds in the histogram with the given name and
+// labels.
+func (m *PrometheusMetrics) Timing(name string, d time.Duration, labels map[string]string) {
+	m.observe(name+"_seconds", "", m.DurationBuckets, labels, d.Seconds())
+}
+
+func (m *PrometheusMetrics) add(name, kind, help string, buckets []float64, labels map[string]string, n float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.series(name, kind, help, buckets, labels).value += n
+}
+
+func (m *PrometheusMetrics) observe(name, help string, buckets []float64, labels map[string]string, v float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.series(name, "histogram", help, buckets, labels)
+	for i, le := range buckets {
+		if v <= le {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// series returns the series with the given labels in the named family,
+// creating either as necessary.  The caller must hold the lock.
+func (m *PrometheusMetrics) series(name, kind, help string, buckets []float64, labels map[string]string) *prometheusSeries {
+	name = prometheusName(name)
+	if "" != m.Namespace {
+		name = prometheusName(m.Namespace) + "_" + name
+	}
+	f, ok := m.families[name]
+	if !ok {
+		f = &prometheusFamily{
+			name:    name,
+			help:    help,
+			kind:    kind,
+			buckets: buckets,
+			series:  make(map[string]*prometheusSeries),
+		}
+		m.families[name] = f
+	}
+	key := prometheusLabels(labels)
+	s, ok := f.series[key]
+	if !ok {
+		s = &prometheusSeries{labels: key, counts: make([]uint64, len(f.buckets))}
+		f.series[key] = s
+	}
+	return s
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	m.mu.Lock()
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := m.families[name]
+		if "" != f.help {
+			fmt.Fprintf(&b, "# HELP %s %s\n", f.name, f.help)
+		}
+		fmt.Fprintf(&b, "# TYPE %s %s\n", f.name, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if "histogram" != f.kind {
+				fmt.Fprintf(&b, "%s%s %s\n", f.name, braces(s.labels), prometheusFloat(s.value))
+				continue
+			}
+			for i, le := range f.buckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, braces(joinLabels(s.labels, `le="`+prometheusFloat(le)+`"`)), s.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, braces(joinLabels(s.labels, `le="+Inf"`)), s.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", f.name, braces(s.labels), prometheusFloat(s.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", f.name, braces(s.labels), s.count)
+		}
+	}
+	m.mu.Unlock()
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Instrument is an http.Handler that measures the handler it wraps into
+// PrometheusMetrics.
+type Instrument struct {
+	handler http.Handler
+	route   string
+	metrics *PrometheusMetrics
+}
+
+// Instrumented returns an http.Handler that measures requests to the given
+// handler into metrics, labeled with the given route or, if it's empty, the
+// route matched by a TrieServeMux.
+func Instrumented(handler http.Handler, route string, metrics *PrometheusMetrics) *Instrument {
+	return &Instrument{
+		handler: handler,
+		route:   route,
+		metrics: metrics,
+	}
+}
+
+func (i *Instrument) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m := i.metrics
+	inFlight := map[string]string{"route": i.route}
+	m.add("http_requests_in_flight", "gauge", "Requests currently being served.", nil, inFlight, 1)
+	defer m.add("http_requests_in_flight", "gauge", "Requests currently being served.", nil, inFlight, -1)
+	var requestSize int64
+	if nil != r.Body {
+		r.Body = &teeReadCloser{
+			ReadCloser: r.Body,
+			onRead:     func(p []byte) { requestSize += int64(len(p)) },
+		}
+	}
+	start := time.Now()
+	w, record := recordResponse(w)
+	i.handler.ServeHTTP(w, r)
+	labels := metricLabels(r, record)
+	labels["route"] = i.route
+	if "" == i.route {
+		labels["route"] = record.Route
+	}
+	m.add("http_requests_total", "counter", "Requests served.", nil, labels, 1)
+	m.observe("http_request_duration_seconds", "Time taken to serve requests.", m.DurationBuckets, labels, time.Since(start).Seconds())
+	m.observe("http_response_size_bytes", "Sizes of response bodies.", m.SizeBuckets, labels, float64(record.Size))
+	if requestSize < r.ContentLength {
+		requestSize = r.ContentLength
+	}
+	delete(labels, "status")
+	m.observe("http_request_size_bytes", "Sizes of request bodies.", m.SizeBuckets, labels, float64(requestSize))
+}
+
+// prometheusName replaces the characters not allowed in metric and label
+// names with underscores.
+func prometheusName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || '_' == r || ':' == r {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// prometheusLabels formats labels sorted by name, which also makes the
+// result suitable as a key.
+func prometheusLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	for i, name := range names {
+		pairs[i] = prometheusName(name) + `="` + replacer.Replace(labels[name]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func joinLabels(labels, label string) string {
+	if "" == labels {
+		return label
+	}
+	return labels + "," + label
+}
+
+func braces(labels string) string {
+	if "" == labels {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func prometheusFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,63 @@
+package marshaler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstrumented(t *testing.T) {
+	metrics := NewPrometheusMetrics("api")
+	metrics.DurationBuckets = []float64{1}
+	metrics.SizeBuckets = []float64{10, 100}
+	h := Instrumented(Handler(func(u *url.URL, h http.Header, rq *testRequest) (int, http.Header, *testResponse, error) {
+		return http.StatusCreated, nil, &testResponse{rq.Foo}, nil
+	}), "/foo", metrics)
+	r, _ := http.NewRequest("POST", "http://example.com/foo", strings.NewReader(`{"foo":"bar"}`))
+	r.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(&testResponseWriter{}, r)
+	w := &testResponseWriter{}
+	r, _ = http.NewRequest("GET", "http://example.com/metrics", nil)
+	metrics.ServeHTTP(w, r)
+	if "text/plain; version=0.0.4; charset=utf-8" != w.Header().Get("Content-Type") {
+		t.Fatal(w.Header())
+	}
+	for _, line := range []string{
+		"# TYPE api_http_requests_total counter\n",
+		`api_http_requests_total{method="POST",route="/foo",status="201"} 1` + "\n",
+		"# HELP api_http_request_duration_seconds Time taken to serve requests.\n",
+		`api_http_request_duration_seconds_bucket{method="POST",route="/foo",status="201",le="1"} 1` + "\n",
+		`api_http_request_duration_seconds_bucket{method="POST",route="/foo",status="201",le="+Inf"} 1` + "\n",
+		`api_http_request_duration_seconds_count{method="POST",route="/foo",status="201"} 1` + "\n",
+		`api_http_request_size_bytes_bucket{method="POST",route="/foo",le="10"} 0` + "\n",
+		`api_http_request_size_bytes_bucket{method="POST",route="/foo",le="100"} 1` + "\n",
+		`api_http_request_size_bytes_sum{method="POST",route="/foo"} 13` + "\n",
+		`api_http_response_size_bytes_sum{method="POST",route="/foo",status="201"} 14` + "\n",
+		`api_http_requests_in_flight{route="/foo"} 0` + "\n",
+	} {
+		if !strings.Contains(w.Body.String(), line) {
+			t.Fatal(line, w.Body.String())
+		}
+	}
+}
+
+func TestPrometheusMetricsSink(t *testing.T) {
+	metrics := NewPrometheusMetrics("")
+	metrics.DurationBuckets = []float64{0.5}
+	Timed(http.NotFoundHandler(), "foo.get", metrics).ServeHTTP(&testResponseWriter{}, &http.Request{Method: "GET"})
+	metrics.Count("foo.count", 2, map[string]string{"quote": `"`})
+	metrics.Timing("foo.get", time.Second, map[string]string{"method": "GET", "status": "404"})
+	var b strings.Builder
+	metrics.WriteTo(&b)
+	for _, line := range []string{
+		`foo_count{quote="\""} 2` + "\n",
+		`foo_get_seconds_bucket{method="GET",status="404",le="0.5"} 1` + "\n",
+		`foo_get_seconds_count{method="GET",status="404"} 2` + "\n",
+	} {
+		if !strings.Contains(b.String(), line) {
+			t.Fatal(line, b.String())
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package marshaler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+// RequestIDHeader is the header in which Proxy sends the RequestID of each
+// proxied request upstream.
+var RequestIDHeader = "X-Request-ID"
+
+// Proxy is an http.Handler that forwards requests to an upstream server
+// with httputil.ReverseProxy.  When wrapped by Logged, the upstream request
+// carries the RequestID in the RequestIDHeader and the upstream exchange is
+// logged under the same RequestID as the client's, through the same
+// redactor.  Requests are made with Transport, which may be a
+// CircuitBreaker, or http.DefaultTransport if it's nil, and failures are
+// answered 502 Bad Gateway.
+type Proxy struct {
+	Transport http.RoundTripper
+	proxy     *httputil.ReverseProxy
+}
+
+// ReverseProxy returns an http.Handler that forwards requests to the given
+// target as httputil.NewSingleHostReverseProxy does.
+func ReverseProxy(target *url.URL) *Proxy {
+	p := &Proxy{proxy: httputil.NewSingleHostReverseProxy(target)}
+	director := p.proxy.Director
+	p.proxy.Director = func(r *http.Request) {
+		director(r)
+		if requestID := RequestIDFromContext(r.Context()); "" != requestID {
+			r.Header.Set(RequestIDHeader, string(requestID))
+		}
+	}
+	p.proxy.Transport = proxyTransport{p}
+	p.proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		logRequestLine(r, "upstream error: %v", err)
+		if _, ok := err.(HTTPEquivError); !ok {
+			err = BadGateway{errors.New(Message(r, "upstream unavailable"))}
+		}
+		writeError(w, r, err)
+	}
+	return p
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.proxy.ServeHTTP(w, r)
+}
+
+// proxyTransport logs the upstream exchange of a request being logged.
+type proxyTransport struct {
+	p *Proxy
+}
+
+func (t proxyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	transport := t.p.Transport
+	if nil == transport {
+		transport = http.DefaultTransport
+	}
+	logMarkedLine(r, false, "upstream %s %s %s", r.Method, r.URL, r.Proto)
+	for key, values := range r.Header {
+		for _, value := range values {
+			if "Authorization" == key {
+				value = redactBasicAuth(value)
+			}
+			logMarkedHeader(r, false, "upstream ", key, value)
+		}
+	}
+	resp, err := transport.RoundTrip(r)
+	if nil != err {
+		return nil, err
+	}
+	logMarkedLine(r, true, "upstream %s %s", resp.Proto, resp.Status)
+	for key, values := range resp.Header {
+		for _, value := range values {
+			logMarkedHeader(r, true, "upstream ", key, value)
+		}
+	}
+	return resp, nil
+}
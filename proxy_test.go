@@ -0,0 +1,67 @@
+package marshaler
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReverseProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Secret", "hunter2")
+		w.Write([]byte(r.Header.Get("X-Request-ID") + " " + r.URL.Path))
+	}))
+	defer upstream.Close()
+	target, _ := url.Parse(upstream.URL)
+	var buf bytes.Buffer
+	l := Logged(ReverseProxy(target), func(s string) string {
+		return strings.Replace(s, "hunter2", "[redacted]", -1)
+	})
+	l.Logger = log.New(&buf, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "http://example.com/bar", nil)
+	r.Header.Set("Authorization", "Bearer hunter2")
+	l.ServeHTTP(w, r)
+	if "foo /bar" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+	for _, line := range []string{
+		"foo > upstream GET " + upstream.URL + "/bar HTTP/1.1",
+		"foo > upstream X-Request-Id: foo",
+		"foo > upstream Authorization: Bearer [redacted]",
+		"foo < upstream HTTP/1.1 200 OK",
+		"foo < upstream X-Secret: [redacted]",
+		"foo < X-Secret: [redacted]",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Fatal(line, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestReverseProxyCircuitOpen(t *testing.T) {
+	target, _ := url.Parse("http://127.0.0.1:1")
+	p := ReverseProxy(target)
+	b := NewCircuitBreaker("upstream", nil)
+	b.MinRequests = 1
+	b.Logger = log.New(&bytes.Buffer{}, "", 0)
+	b.Cooldown = time.Hour
+	p.Transport = b
+	for _, code := range []int{http.StatusBadGateway, http.StatusServiceUnavailable} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "http://example.com/bar", nil)
+		p.ServeHTTP(w, r)
+		if code != w.Code {
+			t.Fatal(w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package marshaler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// byteRange is a satisfiable range of bytes [start, start+length).
+type byteRange struct {
+	start, length int64
+}
+
+func (br byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", br.start, br.start+br.length-1, size)
+}
+
+var errUnsatisfiableRange = errors.New("range not satisfiable")
+
+// parseRange parses a Range header for a representation of the given size.
+// It returns no ranges if the header is absent or malformed, in which case
+// it should be ignored, and errUnsatisfiableRange if none of its ranges
+// overlap the representation.
+func parseRange(s string, size int64) ([]byteRange, error) {
+	if !strings.HasPrefix(s, "bytes=") {
+		return nil, nil
+	}
+	var ranges []byteRange
+	for _, spec := range strings.Split(s[len("bytes="):], ",") {
+		spec = strings.TrimSpace(spec)
+		i := strings.Index(spec, "-")
+		if 0 > i {
+			return nil, nil
+		}
+		first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+		var br byteRange
+		if "" == first {
+			n, err := strconv.ParseInt(last, 10, 64)
+			if nil != err || 0 > n {
+				return nil, nil
+			}
+			if n > size {
+				n = size
+			}
+			br = byteRange{size - n, n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if nil != err || 0 > start {
+				return nil, nil
+			}
+			end := size - 1
+			if "" != last {
+				if end, err = strconv.ParseInt(last, 10, 64); nil != err || end < start {
+					return nil, nil
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+			br = byteRange{start, end - start + 1}
+		}
+		if 0 < br.length && br.start < size {
+			ranges = append(ranges, br)
+		}
+	}
+	if 0 == len(ranges) {
+		return nil, errUnsatisfiableRange
+	}
+	return ranges, nil
+}
+
+// describeRangeRequest describes the ranges requested by a Range header
+// for logging, normalized as first-last, first-, or -suffix.
+func describeRangeRequest(s string) string {
+	if !strings.HasPrefix(s, "bytes=") {
+		return "unit=" + strconv.Quote(strings.SplitN(s, "=", 2)[0]) + " ignored"
+	}
+	specs := strings.Split(s[len("bytes="):], ",")
+	for i, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		j := strings.Index(spec, "-")
+		if 0 > j {
+			return "malformed " + strconv.Quote(s)
+		}
+		first, last := strings.TrimSpace(spec[:j]), strings.TrimSpace(spec[j+1:])
+		for _, n := range []string{first, last} {
+			if _, err := strconv.ParseUint(n, 10, 63); "" != n && nil != err {
+				return "malformed " + strconv.Quote(s)
+			}
+		}
+		if "" == first && "" == last {
+			return "malformed " + strconv.Quote(s)
+		}
+		specs[i] = first + "-" + last
+	}
+	return "requested=" + strings.Join(specs, ",")
+}
+
+// describeRangeResponse describes how a response with the given status and
+// header satisfied a Range request, for logging: the range of bytes sent,
+// how many, and the size of the whole representation, if it's known.
+func describeRangeResponse(code int, header http.Header) string {
+	contentRange := header.Get("Content-Range")
+	switch {
+	case http.StatusPartialContent == code && "" == contentRange:
+		return "satisfied=multipart"
+	case http.StatusRequestedRangeNotSatisfiable == code:
+		if total := strings.TrimPrefix(contentRange, "bytes */"); total != contentRange {
+			return "unsatisfiable total=" + total
+		}
+		return "unsatisfiable"
+	case http.StatusPartialContent != code:
+		return "ignored status=" + strconv.Itoa(code)
+	}
+	spec, total, ok := strings.Cut(strings.TrimPrefix(contentRange, "bytes "), "/")
+	first, last, ok2 := strings.Cut(spec, "-")
+	start, err := strconv.ParseInt(first, 10, 64)
+	end, err2 := strconv.ParseInt(last, 10, 64)
+	if !ok || !ok2 || nil != err || nil != err2 || end < start {
+		return "satisfied=malformed " + strconv.Quote(contentRange)
+	}
+	if "*" == total {
+		total = "unknown"
+	}
+	return fmt.Sprintf("satisfied=%d-%d length=%d total=%s", start, end, end-start+1, total)
+}
+
+// ifRange reports whether the If-Range header, if any, matches the current
+// ETag or modification time so that a Range header may be honored.
+func ifRange(r *http.Request, etag string, modTime time.Time) bool {
+	value := r.Header.Get("If-Range")
+	if "" == value {
+		return true
+	}
+	if strings.HasPrefix(value, "\"") || strings.HasPrefix(value, "W/") {
+		return value == etag && !strings.HasPrefix(etag, "W/")
+	}
+	t, err := http.ParseTime(value)
+	return nil == err && !modTime.IsZero() && modTime.Truncate(time.Second).Equal(t)
+}
@@ -0,0 +1,126 @@
+package marshaler
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRange(t *testing.T) {
+	for s, expected := range map[string]string{
+		"bytes=0-4":     "bytes 0-4/10",
+		"bytes=5-":      "bytes 5-9/10",
+		"bytes=-3":      "bytes 7-9/10",
+		"bytes=8-100":   "bytes 8-9/10",
+		"bytes=-100":    "bytes 0-9/10",
+		"bytes=4-2":     "",
+		"items=0-4":     "",
+		"bytes=0-1,3-4": "bytes 0-1/10",
+	} {
+		ranges, err := parseRange(s, 10)
+		if nil != err {
+			t.Fatal(s, err)
+		}
+		if "" == expected && 0 != len(ranges) || "" != expected && expected != ranges[0].contentRange(10) {
+			t.Fatal(s, ranges)
+		}
+	}
+	if _, err := parseRange("bytes=10-", 10); errUnsatisfiableRange != err {
+		t.Fatal(err)
+	}
+}
+
+func testFileRange(t *testing.T, rangeHeader, ifRangeHeader string) *testResponseWriter {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Range", rangeHeader)
+	if "" != ifRangeHeader {
+		r.Header.Set("If-Range", ifRangeHeader)
+	}
+	Handler(func(u *url.URL, h http.Header) (int, http.Header, *FileResponse, error) {
+		return http.StatusOK, http.Header{"Etag": {"\"v1\""}}, &FileResponse{
+			Name:    "foo.txt",
+			Reader:  strings.NewReader("0123456789"),
+			Size:    10,
+			ModTime: time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC),
+		}, nil
+	}).ServeHTTP(w, r)
+	return w
+}
+
+func TestFileRange(t *testing.T) {
+	w := testFileRange(t, "bytes=2-4", "\"v1\"")
+	if http.StatusPartialContent != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if "234" != w.Body.String() || "3" != w.Header().Get("Content-Length") || "bytes 2-4/10" != w.Header().Get("Content-Range") {
+		t.Fatal(w.Body.String(), w.Header())
+	}
+	if "bytes" != w.Header().Get("Accept-Ranges") {
+		t.Fatal(w.Header())
+	}
+}
+
+func TestFileRangeIfRangeMismatch(t *testing.T) {
+	w := testFileRange(t, "bytes=2-4", "Wed, 01 Jan 2014 00:00:01 GMT")
+	if http.StatusOK != w.StatusCode || "0123456789" != w.Body.String() {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+}
+
+func TestFileRangeNotSatisfiable(t *testing.T) {
+	w := testFileRange(t, "bytes=20-", "")
+	if http.StatusRequestedRangeNotSatisfiable != w.StatusCode || "bytes */10" != w.Header().Get("Content-Range") {
+		t.Fatal(w.StatusCode, w.Header())
+	}
+}
+
+func TestDescribeRange(t *testing.T) {
+	for s, expected := range map[string]string{
+		"bytes=0-4":         "requested=0-4",
+		"bytes= 0-1, 5-,-3": "requested=0-1,5-,-3",
+		"bytes=a-4":         `malformed "bytes=a-4"`,
+		"bytes=-":           `malformed "bytes=-"`,
+		"items=0-4":         `unit="items" ignored`,
+	} {
+		if description := describeRangeRequest(s); expected != description {
+			t.Fatal(s, description)
+		}
+	}
+	for expected, header := range map[string]http.Header{
+		"satisfied=2-4 length=3 total=10":      {"Content-Range": {"bytes 2-4/10"}},
+		"satisfied=2-4 length=3 total=unknown": {"Content-Range": {"bytes 2-4/*"}},
+		"satisfied=multipart":                  {"Content-Type": {"multipart/byteranges"}},
+		`satisfied=malformed "bytes 4-2/10"`:   {"Content-Range": {"bytes 4-2/10"}},
+	} {
+		if description := describeRangeResponse(http.StatusPartialContent, header); expected != description {
+			t.Fatal(header, description)
+		}
+	}
+	if description := describeRangeResponse(http.StatusRequestedRangeNotSatisfiable, http.Header{"Content-Range": {"bytes */10"}}); "unsatisfiable total=10" != description {
+		t.Fatal(description)
+	}
+	if description := describeRangeResponse(http.StatusOK, nil); "ignored status=200" != description {
+		t.Fatal(description)
+	}
+}
+
+func TestLoggedRange(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logged(Handler(func(u *url.URL, h http.Header) (int, http.Header, *FileResponse, error) {
+		return http.StatusOK, nil, &FileResponse{Reader: strings.NewReader("0123456789"), Size: 10}, nil
+	}), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	l.Level = LogHeaders
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Range", "bytes=2-4")
+	l.ServeHTTP(&testResponseWriter{}, r)
+	if !strings.Contains(buf.String(), "foo > range requested=2-4\nfoo >\n") || !strings.Contains(buf.String(), "foo < range satisfied=2-4 length=3 total=10\nfoo <\n") {
+		t.Fatal(buf.String())
+	}
+}
@@ -0,0 +1,158 @@
+package marshaler
+
+import (
+	"container/list"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A RateLimitKeyer extracts the key that a request's rate is limited by,
+// like the client's IP address or API key.  Requests with an empty key are
+// not limited.
+type RateLimitKeyer func(r *http.Request) string
+
+// ClientIP is a RateLimitKeyer that limits each client IP address.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if nil != err {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// HeaderKeyer returns a RateLimitKeyer that limits each value of the named
+// header, like an API key.
+func HeaderKeyer(name string) RateLimitKeyer {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// A RateLimit allows Burst requests at once, replenished at Rate per
+// second.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// A RateLimitStore holds the token buckets of a RateLimiter.  Take must be
+// atomic, across servers if the limit is to be enforced across them.
+type RateLimitStore interface {
+
+	// Take takes a token from the bucket for the key, which is refilled
+	// according to the limit, and reports whether there was one, how many
+	// tokens remain, and how long until the next token is added.
+	Take(key string, limit RateLimit, now time.Time) (ok bool, remaining int, wait time.Duration)
+}
+
+// RateLimiter is an http.Handler that limits the rate of requests to the
+// handler it wraps with a token bucket per key.  Limited requests are
+// answered 429 Too Many Requests with a Retry-After header.  All responses
+// carry the RateLimit-Limit, RateLimit-Remaining, and RateLimit-Reset
+// headers.
+type RateLimiter struct {
+	handler http.Handler
+	keyer   RateLimitKeyer
+	limit   RateLimit
+	store   RateLimitStore
+}
+
+// DefaultRateLimitKeys is the number of token buckets kept by the
+// MemoryRateLimitStore created by RateLimited.
+var DefaultRateLimitKeys = 65536
+
+// RateLimited returns an http.Handler that limits the rate of requests with
+// each key to the given handler.  If store is nil, buckets are held in a
+// MemoryRateLimitStore of DefaultRateLimitKeys buckets.
+func RateLimited(handler http.Handler, keyer RateLimitKeyer, limit RateLimit, store RateLimitStore) *RateLimiter {
+	if nil == store {
+		store = NewMemoryRateLimitStore(DefaultRateLimitKeys)
+	}
+	return &RateLimiter{
+		handler: handler,
+		keyer:   keyer,
+		limit:   limit,
+		store:   store,
+	}
+}
+
+func (l *RateLimiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := l.keyer(r)
+	if "" == key {
+		l.handler.ServeHTTP(w, r)
+		return
+	}
+	ok, remaining, wait := l.store.Take(key, l.limit, time.Now())
+	seconds := strconv.Itoa(int(math.Ceil(wait.Seconds())))
+	header := w.Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(l.limit.Burst))
+	header.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	header.Set("RateLimit-Reset", seconds)
+	if !ok {
+		header.Set("Retry-After", seconds)
+		writeError(w, r, TooManyRequests{errors.New(Message(
+			r,
+			"rate limit exceeded; retry in %s seconds",
+			seconds,
+		))})
+		return
+	}
+	l.handler.ServeHTTP(w, r)
+}
+
+// MemoryRateLimitStore is a RateLimitStore that keeps token buckets in
+// memory, forgetting the least recently used when it holds too many.
+type MemoryRateLimitStore struct {
+	mu         sync.Mutex
+	buckets    map[string]*list.Element
+	lru        *list.List
+	maxBuckets int
+}
+
+// NewMemoryRateLimitStore returns a MemoryRateLimitStore that holds at most
+// maxBuckets token buckets.
+func NewMemoryRateLimitStore(maxBuckets int) *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:    make(map[string]*list.Element),
+		lru:        list.New(),
+		maxBuckets: maxBuckets,
+	}
+}
+
+type tokenBucket struct {
+	key     string
+	tokens  float64
+	updated time.Time
+}
+
+func (s *MemoryRateLimitStore) Take(key string, limit RateLimit, now time.Time) (bool, int, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b *tokenBucket
+	if e, ok := s.buckets[key]; ok {
+		s.lru.MoveToFront(e)
+		b = e.Value.(*tokenBucket)
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+		b.updated = now
+	} else {
+		b = &tokenBucket{key: key, tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = s.lru.PushFront(b)
+		for s.lru.Len() > s.maxBuckets {
+			delete(s.buckets, s.lru.Remove(s.lru.Back()).(*tokenBucket).key)
+		}
+	}
+	ok := 1 <= b.tokens
+	if ok {
+		b.tokens--
+	}
+	var wait time.Duration
+	if b.tokens < 1 && 0 < limit.Rate {
+		wait = time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	}
+	return ok, int(b.tokens), wait
+}
@@ -0,0 +1,71 @@
+package marshaler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimited(t *testing.T) {
+	h := RateLimited(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}), HeaderKeyer("X-API-Key"), RateLimit{Rate: 1, Burst: 2}, nil)
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("X-API-Key", "foo")
+	r.Header.Set("Accept", "application/json")
+	for i, remaining := range []string{"1", "0"} {
+		w := &testResponseWriter{}
+		h.ServeHTTP(w, r)
+		if http.StatusNoContent != w.StatusCode {
+			t.Fatal(i, w.StatusCode)
+		}
+		if "2" != w.Header().Get("RateLimit-Limit") || remaining != w.Header().Get("RateLimit-Remaining") {
+			t.Fatal(i, w.Header())
+		}
+	}
+	w := &testResponseWriter{}
+	h.ServeHTTP(w, r)
+	if http.StatusTooManyRequests != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if "1" != w.Header().Get("Retry-After") || "1" != w.Header().Get("RateLimit-Reset") {
+		t.Fatal(w.Header())
+	}
+	if "{\"description\":\"rate limit exceeded; retry in 1 seconds\",\"error\":\"marshaler.TooManyRequests\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+	r.Header.Set("X-API-Key", "bar")
+	w = &testResponseWriter{}
+	h.ServeHTTP(w, r)
+	if http.StatusNoContent != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	s := NewMemoryRateLimitStore(1)
+	limit := RateLimit{Rate: 2, Burst: 1}
+	now := time.Now()
+	if ok, _, _ := s.Take("foo", limit, now); !ok {
+		t.Fatal("first take")
+	}
+	ok, _, wait := s.Take("foo", limit, now)
+	if ok || 500*time.Millisecond != wait {
+		t.Fatal(ok, wait)
+	}
+	if ok, _, _ := s.Take("foo", limit, now.Add(500*time.Millisecond)); !ok {
+		t.Fatal("refilled take")
+	}
+	s.Take("bar", limit, now)
+	if ok, _, _ := s.Take("foo", limit, now.Add(500*time.Millisecond)); !ok {
+		t.Fatal("evicted take")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	if "192.0.2.1" != ClientIP(r) {
+		t.Fatal(ClientIP(r))
+	}
+}
@@ -0,0 +1,252 @@
+package marshaler
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+)
+
+// recordingResponseWriter passes a response through to the
+// http.ResponseWriter it wraps, recording its status code and size, the
+// route a mux like TrieServeMux matched, and the variant a Canary chose.
+// It's shared by the logger and the metrics middleware so that they agree on
+// what was sent.
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	Route       string
+	Variant     string
+	StatusCode  int
+	Size        int64
+	WroteHeader bool
+	KeepHeader  bool
+	SentHeader  http.Header
+}
+
+func (w *recordingResponseWriter) flush() {
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *recordingResponseWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+func (w *recordingResponseWriter) push(target string, opts *http.PushOptions) error {
+	return w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// Unwrap returns the http.ResponseWriter it wraps so that
+// http.ResponseController can reach methods like SetWriteDeadline through
+// the middleware.
+func (w *recordingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *recordingResponseWriter) Write(p []byte) (int, error) {
+	if !w.WroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.Size += int64(n)
+	return n, err
+}
+
+// ReadFrom copies from src with the io.ReaderFrom of the
+// http.ResponseWriter it wraps, if it has one, so that copies from files may
+// still use sendfile.
+func (w *recordingResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !w.WroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	var (
+		n   int64
+		err error
+	)
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(struct{ io.Writer }{w.ResponseWriter}, src)
+	}
+	w.Size += n
+	return n, err
+}
+
+func (w *recordingResponseWriter) WriteHeader(code int) {
+	if !w.WroteHeader {
+		w.StatusCode = code
+		w.WroteHeader = true
+		if w.KeepHeader {
+			w.SentHeader = cloneHeader(w.Header())
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recordingResponseWriter) responseRecord() *recordingResponseWriter {
+	return w
+}
+
+// A responseRecorder is an http.ResponseWriter that's already recording the
+// response, like the one passed to handlers wrapped by Logged.
+type responseRecorder interface {
+	responseRecord() *recordingResponseWriter
+}
+
+// recordResponse returns an http.ResponseWriter that records the response
+// and its record, reusing the record of a responseRecorder.
+func recordResponse(w http.ResponseWriter) (http.ResponseWriter, *recordingResponseWriter) {
+	if recorder, ok := w.(responseRecorder); ok {
+		return w, recorder.responseRecord()
+	}
+	rw := &recordingResponseWriter{ResponseWriter: w}
+	return exposeOptional(rw), rw
+}
+
+// A ResponseRecord describes the response Logged passed through: its status
+// code, its size, and its headers as they were when the status was written.
+// Middleware outside Logged can read it once the handler returns instead of
+// wrapping the http.ResponseWriter again itself.
+type ResponseRecord struct {
+	w *recordingResponseWriter
+}
+
+type responseRecordKey struct{}
+
+// WithResponseRecord returns a shallow copy of r whose context carries an
+// empty ResponseRecord, which Logged fills in when it serves the copy.
+func WithResponseRecord(r *http.Request) (*http.Request, *ResponseRecord) {
+	record := &ResponseRecord{}
+	return r.WithContext(context.WithValue(r.Context(), responseRecordKey{}, record)), record
+}
+
+// ResponseRecordFromContext returns the ResponseRecord of the response to a
+// request being logged or given one by WithResponseRecord, or nil.
+func ResponseRecordFromContext(ctx context.Context) *ResponseRecord {
+	if record, ok := ctx.Value(responseRecordKey{}).(*ResponseRecord); ok {
+		return record
+	}
+	if w, ok := ctx.Value(loggerResponseWriterKey{}).(*multilineLoggerResponseWriter); ok {
+		return &ResponseRecord{w.recordingResponseWriter}
+	}
+	return nil
+}
+
+// attachResponseRecord attaches the ResponseRecord WithResponseRecord put in
+// the request's context, if there is one, to w.  Headers are only
+// snapshotted for such records since they're only of interest once the
+// handler's returned.
+func attachResponseRecord(ctx context.Context, w *recordingResponseWriter) {
+	if record, ok := ctx.Value(responseRecordKey{}).(*ResponseRecord); ok && nil == record.w {
+		record.w = w
+		w.KeepHeader = true
+	}
+}
+
+// StatusCode returns the status code written, or 0 if none has been.
+func (rr *ResponseRecord) StatusCode() int {
+	if nil == rr.w {
+		return 0
+	}
+	return rr.w.StatusCode
+}
+
+// Size returns the number of bytes of the body written.
+func (rr *ResponseRecord) Size() int64 {
+	if nil == rr.w {
+		return 0
+	}
+	return rr.w.Size
+}
+
+// Header returns a copy of the headers as they were when the status was
+// written, or nil if it hasn't been.  ResponseRecords that didn't come from
+// WithResponseRecord return a copy of the headers as they are now.
+func (rr *ResponseRecord) Header() http.Header {
+	if nil == rr.w || !rr.w.WroteHeader {
+		return nil
+	}
+	if nil == rr.w.SentHeader {
+		return cloneHeader(rr.w.Header())
+	}
+	return cloneHeader(rr.w.SentHeader)
+}
+
+// An optionalResponseWriter wraps an http.ResponseWriter and can pass
+// through the optional interfaces it implements.
+type optionalResponseWriter interface {
+	http.ResponseWriter
+	io.ReaderFrom
+	responseRecorder
+	Unwrap() http.ResponseWriter
+	flush()
+	hijack() (net.Conn, *bufio.ReadWriter, error)
+	push(target string, opts *http.PushOptions) error
+}
+
+type flusher struct{ w optionalResponseWriter }
+
+func (f flusher) Flush() { f.w.flush() }
+
+type hijacker struct{ w optionalResponseWriter }
+
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) { return h.w.hijack() }
+
+type pusher struct{ w optionalResponseWriter }
+
+func (p pusher) Push(target string, opts *http.PushOptions) error { return p.w.push(target, opts) }
+
+// exposeOptional returns w implementing exactly those of http.Flusher,
+// http.Hijacker, and http.Pusher that the http.ResponseWriter it wraps
+// implements, so that handlers checking for them aren't told a feature is
+// available when it isn't.
+func exposeOptional(w optionalResponseWriter) http.ResponseWriter {
+	inner := w.Unwrap()
+	_, isFlusher := inner.(http.Flusher)
+	_, isHijacker := inner.(http.Hijacker)
+	_, isPusher := inner.(http.Pusher)
+	f, h, p := flusher{w}, hijacker{w}, pusher{w}
+	switch {
+	case isFlusher && isHijacker && isPusher:
+		return struct {
+			optionalResponseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{w, f, h, p}
+	case isFlusher && isHijacker:
+		return struct {
+			optionalResponseWriter
+			http.Flusher
+			http.Hijacker
+		}{w, f, h}
+	case isFlusher && isPusher:
+		return struct {
+			optionalResponseWriter
+			http.Flusher
+			http.Pusher
+		}{w, f, p}
+	case isHijacker && isPusher:
+		return struct {
+			optionalResponseWriter
+			http.Hijacker
+			http.Pusher
+		}{w, h, p}
+	case isFlusher:
+		return struct {
+			optionalResponseWriter
+			http.Flusher
+		}{w, f}
+	case isHijacker:
+		return struct {
+			optionalResponseWriter
+			http.Hijacker
+		}{w, h}
+	case isPusher:
+		return struct {
+			optionalResponseWriter
+			http.Pusher
+		}{w, p}
+	}
+	return w
+}
@@ -0,0 +1,80 @@
+package marshaler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// A PanicHandler is called with the value and stack of each panic recovered
+// by a Recoverer, for reporting to an error tracking service.
+type PanicHandler func(r *http.Request, v interface{}, stack []byte)
+
+// Recoverer is an http.Handler that recovers from panics in the handler it
+// wraps, responding 500 Internal Server Error with the request's RequestID so
+// that the response can be matched with the server's logs.
+type Recoverer struct {
+	OnPanic PanicHandler
+	handler http.Handler
+}
+
+// Recovered returns an http.Handler that converts panics in the given
+// handler into structured 500 responses.  It doesn't require Logged; requests
+// that aren't being logged are given a new RequestID.  Panics with
+// http.ErrAbortHandler are allowed to abort the response as usual, and
+// panics after the header has been written, when it's too late to respond
+// 500, abort it too so that the client doesn't take a truncated response
+// for a whole one.
+func Recovered(handler http.Handler) *Recoverer {
+	return &Recoverer{handler: handler}
+}
+
+func (rc *Recoverer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, rw := recordResponse(w)
+	defer func() {
+		v := recover()
+		if nil == v {
+			return
+		}
+		if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+			panic(v)
+		}
+		stack := debug.Stack()
+		requestID := RequestIDFromContext(r.Context())
+		if "" == requestID {
+			requestID = NewRequestID()
+		}
+		if nil != rc.OnPanic {
+			rc.OnPanic(r, v, stack)
+		}
+		logRequestLine(r, "panic: %v", v)
+		if rw.WroteHeader {
+			panic(http.ErrAbortHandler)
+		}
+		writePanicError(w, r, requestID)
+	}()
+	rc.handler.ServeHTTP(w, r)
+}
+
+// writePanicError writes a 500 Internal Server Error that names the request
+// but, unlike other errors, not the panic, which may expose internals.
+func writePanicError(w http.ResponseWriter, r *http.Request, requestID RequestID) {
+	err := InternalServerError{errors.New(Message(r, "internal server error"))}
+	if !acceptJSON(r) {
+		writePlaintextError(w, err)
+		fmt.Fprintf(w, " (request %s)", requestID)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(err.StatusCode())
+	if jsonErr := json.NewEncoder(w).Encode(struct {
+		Description string    `json:"description"`
+		Error       string    `json:"error"`
+		RequestID   RequestID `json:"request_id"`
+	}{err.Error(), errorName(err, "error"), requestID}); nil != jsonErr {
+		log.Printf("Error marshalling error response into JSON output: %s", jsonErr)
+	}
+}
@@ -0,0 +1,93 @@
+package marshaler
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecovered(t *testing.T) {
+	var (
+		value interface{}
+		stack []byte
+	)
+	rc := Recovered(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("secret")
+	}))
+	rc.OnPanic = func(r *http.Request, v interface{}, s []byte) {
+		value, stack = v, s
+	}
+	var buf bytes.Buffer
+	l := Logged(rc, nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Accept", "application/json")
+	l.ServeHTTP(w, r)
+	if http.StatusInternalServerError != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if "{\"description\":\"internal server error\",\"error\":\"marshaler.InternalServerError\",\"request_id\":\"foo\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+	if "secret" != value || !bytes.Contains(stack, []byte("TestRecovered")) {
+		t.Fatal(value, string(stack))
+	}
+	if !strings.Contains(buf.String(), "foo panic: secret") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestRecoveredWithoutLogger(t *testing.T) {
+	rc := Recovered(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("secret")
+	}))
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Accept", "text/plain")
+	rc.ServeHTTP(w, r)
+	if http.StatusInternalServerError != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if !strings.HasPrefix(w.Body.String(), "marshaler.InternalServerError: internal server error (request ") || strings.Contains(w.Body.String(), "secret") {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestRecoveredAfterWriteHeader(t *testing.T) {
+	rc := Recovered(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("secret")
+	}))
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	defer func() {
+		if v := recover(); http.ErrAbortHandler != v {
+			t.Fatal(v)
+		}
+		if http.StatusAccepted != w.StatusCode || 0 != w.Body.Len() {
+			t.Fatal(w.StatusCode, w.Body.String())
+		}
+	}()
+	rc.ServeHTTP(w, r)
+	t.Fatal("didn't abort")
+}
+
+func TestRecoveredOptionalInterfaces(t *testing.T) {
+	w := httptest.NewRecorder()
+	Recovered(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("not a Flusher")
+		}
+		w.Write([]byte("partial"))
+		f.Flush()
+	})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if !w.Flushed {
+		t.Fatal("not flushed")
+	}
+}
@@ -0,0 +1,60 @@
+package marshaler
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// responseBuffer is an http.ResponseWriter that holds a complete response in
+// memory so it can be inspected, stored, or discarded before it's written to
+// the client.
+type responseBuffer struct {
+	Body        bytes.Buffer
+	StatusCode  int
+	WroteHeader bool
+	header      http.Header
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: make(http.Header)}
+}
+
+func (w *responseBuffer) Header() http.Header {
+	if nil == w.header {
+		w.header = make(http.Header)
+	}
+	return w.header
+}
+
+func (w *responseBuffer) Write(p []byte) (int, error) {
+	if !w.WroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.Body.Write(p)
+}
+
+func (w *responseBuffer) WriteHeader(code int) {
+	if w.WroteHeader {
+		return
+	}
+	w.StatusCode = code
+	w.WroteHeader = true
+}
+
+// WriteTo copies the buffered response to another http.ResponseWriter.
+func (w *responseBuffer) WriteTo(rw http.ResponseWriter) (int64, error) {
+	copyHeader(rw.Header(), w.Header())
+	if !w.WroteHeader {
+		w.StatusCode = http.StatusOK
+	}
+	rw.WriteHeader(w.StatusCode)
+	n, err := rw.Write(w.Body.Bytes())
+	return int64(n), err
+}
+
+// copyHeader replaces each header in dst with its values from src.
+func copyHeader(dst, src http.Header) {
+	for key, values := range src {
+		dst[key] = append([]string(nil), values...)
+	}
+}
@@ -0,0 +1,193 @@
+package marshaler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultDrainTimeout is how long a Server waits for in-flight requests to
+// finish when it's shutting down.
+var DefaultDrainTimeout = 30 * time.Second
+
+// Server is an http.Server that shuts down gracefully on SIGTERM or SIGINT:
+// it stops accepting connections, waits up to DrainTimeout for in-flight
+// requests to finish, logging the RequestIDs of those that remain every
+// second, closes any that haven't by then, and finally calls each of its
+// Flushers so that buffered logs aren't lost.  Each connection it accepts is
+// given a ConnectionID.
+type Server struct {
+	http.Server
+	DrainTimeout time.Duration
+	Logger       Logger
+	Flushers     []func() error
+	Signals      []os.Signal
+
+	mu           sync.Mutex
+	inFlight     map[*inFlightRequest]struct{}
+	stop         chan struct{}
+	stopOnce     sync.Once
+	wrapListener func(net.Listener) net.Listener
+}
+
+// NewServer returns a Server that serves the given handler at the given
+// address.
+func NewServer(addr string, handler http.Handler) *Server {
+	s := &Server{
+		DrainTimeout: DefaultDrainTimeout,
+		Logger:       log.New(os.Stdout, "", log.Ltime|log.Lmicroseconds),
+		Signals:      []os.Signal{syscall.SIGTERM, os.Interrupt},
+		inFlight:     make(map[*inFlightRequest]struct{}),
+		stop:         make(chan struct{}),
+	}
+	s.Addr = addr
+	s.ConnContext = ConnectionIDContext
+	s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f := &inFlightRequest{}
+		s.mu.Lock()
+		s.inFlight[f] = struct{}{}
+		s.mu.Unlock()
+		defer func() {
+			s.mu.Lock()
+			delete(s.inFlight, f)
+			s.mu.Unlock()
+		}()
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), inFlightKey{}, f)))
+	})
+	return s
+}
+
+// ListenAndServe listens on the Server's address and serves until it has
+// shut down.
+func (s *Server) ListenAndServe() error {
+	if nil == s.wrapListener {
+		return s.serve(s.Server.ListenAndServe)
+	}
+	addr := s.Addr
+	if "" == addr {
+		addr = ":http"
+	}
+	l, err := net.Listen("tcp", addr)
+	if nil != err {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve serves connections accepted from l until the Server has shut down.
+func (s *Server) Serve(l net.Listener) error {
+	if nil != s.wrapListener {
+		l = s.wrapListener(l)
+	}
+	return s.serve(func() error { return s.Server.Serve(l) })
+}
+
+// Stop shuts the Server down as if it had received a signal.
+func (s *Server) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+func (s *Server) serve(serve func() error) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), s.Signals...)
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() { errs <- serve() }()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	case <-s.stop:
+	}
+	err := s.drain()
+	for _, flush := range s.Flushers {
+		if flushErr := flush(); nil == err {
+			err = flushErr
+		}
+	}
+	if serveErr := <-errs; !errors.Is(serveErr, http.ErrServerClosed) && nil == err {
+		err = serveErr
+	}
+	return err
+}
+
+// drain shuts the server down, waiting for in-flight requests until the
+// DrainTimeout passes and then closing their connections.
+func (s *Server) drain() error {
+	s.Logger.Printf("draining %d requests", s.outstanding())
+	ctx, cancel := context.WithTimeout(context.Background(), s.DrainTimeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- s.Shutdown(ctx) }()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			if errors.Is(err, context.DeadlineExceeded) {
+				s.Logger.Printf("drain deadline passed; closing %s", s.outstandingIDs())
+				return s.Close()
+			}
+			if nil == err {
+				s.Logger.Printf("drained")
+			}
+			return err
+		case <-ticker.C:
+			s.Logger.Printf("waiting for %s", s.outstandingIDs())
+		}
+	}
+}
+
+func (s *Server) outstanding() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.inFlight)
+}
+
+// outstandingIDs describes the in-flight requests by RequestID, for those
+// that are being logged.
+func (s *Server) outstandingIDs() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.inFlight))
+	for f := range s.inFlight {
+		if id := f.RequestID(); "" != id {
+			ids = append(ids, string(id))
+		}
+	}
+	sort.Strings(ids)
+	return fmt.Sprintf("%d requests %s", len(s.inFlight), strings.Join(ids, " "))
+}
+
+type inFlightKey struct{}
+
+// inFlightRequest is a request being served by a Server, which learns its
+// RequestID once Logged has given it one.
+type inFlightRequest struct {
+	mu        sync.Mutex
+	requestID RequestID
+}
+
+func (f *inFlightRequest) RequestID() RequestID {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requestID
+}
+
+// trackRequestID tells the Server serving a request its RequestID.
+func trackRequestID(r *http.Request, requestID RequestID) {
+	if f, ok := r.Context().Value(inFlightKey{}).(*inFlightRequest); ok {
+		f.mu.Lock()
+		f.requestID = requestID
+		f.mu.Unlock()
+	}
+}
@@ -0,0 +1,106 @@
+package marshaler
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testSyncBuffer struct {
+	sync.Mutex
+	bytes.Buffer
+}
+
+func (b *testSyncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func (b *testSyncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.String()
+}
+
+func TestServerDrain(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	}), nil)
+	l.Logger = log.New(&bytes.Buffer{}, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	s := NewServer("", l)
+	var buf testSyncBuffer
+	s.Logger = log.New(&buf, "", 0)
+	flushed := false
+	s.Flushers = append(s.Flushers, func() error {
+		flushed = true
+		return nil
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	served := make(chan error)
+	go func() { served <- s.Serve(listener) }()
+	responses := make(chan string)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if nil != err {
+			responses <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		var body bytes.Buffer
+		body.ReadFrom(resp.Body)
+		responses <- body.String()
+	}()
+	<-started
+	s.Stop()
+	time.Sleep(1100 * time.Millisecond)
+	close(release)
+	if body := <-responses; "done" != body {
+		t.Fatal(body)
+	}
+	if err := <-served; nil != err {
+		t.Fatal(err)
+	}
+	if !flushed {
+		t.Fatal("not flushed")
+	}
+	if !strings.Contains(buf.String(), "draining 1 requests") || !strings.Contains(buf.String(), "waiting for 1 requests foo") || !strings.Contains(buf.String(), "drained") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestServerDrainTimeout(t *testing.T) {
+	started := make(chan struct{})
+	s := NewServer("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	}))
+	s.DrainTimeout = 10 * time.Millisecond
+	var buf testSyncBuffer
+	s.Logger = log.New(&buf, "", 0)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	served := make(chan error)
+	go func() { served <- s.Serve(listener) }()
+	go http.Get("http://" + listener.Addr().String())
+	<-started
+	s.Stop()
+	<-served
+	if !strings.Contains(buf.String(), "drain deadline passed; closing 1 requests") {
+		t.Fatal(buf.String())
+	}
+}
@@ -0,0 +1,296 @@
+package marshaler
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A SIEMFormat is an event format understood by security information and
+// event management systems.
+type SIEMFormat int
+
+const (
+	// CEF is ArcSight's Common Event Format, version 0.
+	CEF SIEMFormat = iota
+
+	// LEEF is QRadar's Log Event Extended Format, version 1.0.
+	LEEF
+)
+
+// DefaultSIEMVendor, DefaultSIEMProduct, and DefaultSIEMVersion identify
+// the device in the headers of the events SIEMLogged logs unless the
+// SIEMLogger's Vendor, Product, and Version are set.
+var (
+	DefaultSIEMVendor  = "lhigueragamboa"
+	DefaultSIEMProduct = "marshaler"
+	DefaultSIEMVersion = "1.0"
+)
+
+// SIEMLogger is an http.Handler that logs an event in a SIEMFormat for
+// each request to the handler it wraps.
+type SIEMLogger struct {
+	Format   SIEMFormat
+	Labels   map[string]string
+	Logger   Logger
+	Product  string
+	Redactor Redactor
+	Vendor   string
+	Version  string
+	handler  http.Handler
+}
+
+// SIEMLogged returns an http.Handler that logs one line per request to the
+// given handler, in CEF or LEEF, so the access log can be ingested by
+// ArcSight, QRadar, and other SIEMs without a translation layer.  Request
+// metadata is mapped to the standard fields of each format: the client's
+// address and port, user, host, URL, method, user agent, bytes in and out,
+// and time, with the status as the event ID and 4xx and 5xx responses given
+// higher severities, and authentication failures higher still.  The URL is
+// passed through Redactor if it's not nil.  The RequestID, route, and
+// duration go in custom fields, and Labels, like those of a
+// MultilineLogger, follow as extensions named by the label, sorted by name.
+// Lines are logged without a prefix of their own, so Logger, which is
+// usually a syslog writer, shouldn't add a timestamp either.
+func SIEMLogged(handler http.Handler, format SIEMFormat, logger Logger) *SIEMLogger {
+	return &SIEMLogger{
+		Format:  format,
+		Logger:  logger,
+		Product: DefaultSIEMProduct,
+		Vendor:  DefaultSIEMVendor,
+		Version: DefaultSIEMVersion,
+		handler: handler,
+	}
+}
+
+func (l *SIEMLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	w, record := recordResponse(w)
+	l.handler.ServeHTTP(w, r)
+	code := record.StatusCode
+	if !record.WroteHeader {
+		code = http.StatusOK
+	}
+	e := &siemEvent{
+		code:      code,
+		duration:  time.Since(start),
+		labels:    l.Labels,
+		r:         r,
+		redactor:  l.Redactor,
+		requestID: RequestIDFromContext(r.Context()),
+		route:     record.Route,
+		size:      record.Size,
+		start:     start,
+	}
+	if LEEF == l.Format {
+		l.Logger.Output(2, e.leef(l.Vendor, l.Product, l.Version))
+	} else {
+		l.Logger.Output(2, e.cef(l.Vendor, l.Product, l.Version))
+	}
+}
+
+// siemEvent is what SIEMLogger knows about a request once it's been served.
+type siemEvent struct {
+	code      int
+	duration  time.Duration
+	labels    map[string]string
+	r         *http.Request
+	redactor  Redactor
+	requestID RequestID
+	route     string
+	size      int64
+	start     time.Time
+}
+
+// cef formats the event in CEF, whose headers escape pipes and backslashes
+// and whose extensions escape equals signs, backslashes, and newlines.
+func (e *siemEvent) cef(vendor, product, version string) string {
+	header := strings.NewReplacer(`\`, `\\`, "|", `\|`, "\r", " ", "\n", " ")
+	value := strings.NewReplacer(`\`, `\\`, "=", `\=`, "\r", `\r`, "\n", `\n`)
+	var b strings.Builder
+	b.WriteString("CEF:0")
+	for _, field := range []string{
+		vendor,
+		product,
+		version,
+		strconv.Itoa(e.code),
+		e.r.Method + " " + http.StatusText(e.code),
+		strconv.Itoa(e.severity()),
+	} {
+		b.WriteString("|" + header.Replace(field))
+	}
+	b.WriteString("|")
+	sep := ""
+	e.each(cefKeys, "", func(key, v string) {
+		b.WriteString(sep + key + "=" + value.Replace(v))
+		sep = " "
+	})
+	return b.String()
+}
+
+// leef formats the event in LEEF 1.0, whose attributes are separated by
+// tabs, which are replaced by spaces in values, as are newlines.
+func (e *siemEvent) leef(vendor, product, version string) string {
+	header := strings.NewReplacer(`\`, `\\`, "|", `\|`, "\r", " ", "\n", " ")
+	value := strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+	var b strings.Builder
+	b.WriteString("LEEF:1.0")
+	for _, field := range []string{vendor, product, version, strconv.Itoa(e.code)} {
+		b.WriteString("|" + header.Replace(field))
+	}
+	b.WriteString("|")
+	sep := ""
+	e.each(leefKeys, "Jan 02 2006 15:04:05.000 MST", func(key, v string) {
+		b.WriteString(sep + key + "=" + value.Replace(v))
+		sep = "\t"
+	})
+	return b.String()
+}
+
+// siemField names the fields each format uses for the event's attributes.
+type siemField int
+
+const (
+	siemTime siemField = iota
+	siemSeverity
+	siemSource
+	siemSourcePort
+	siemUser
+	siemHost
+	siemURL
+	siemMethod
+	siemUserAgent
+	siemBytesIn
+	siemBytesOut
+	siemStatus
+	siemProtocol
+	siemRequestID
+	siemRoute
+	siemDuration
+	siemFields
+)
+
+var cefKeys = [siemFields][]string{
+	siemTime:       {"rt"},
+	siemSource:     {"src"},
+	siemSourcePort: {"spt"},
+	siemUser:       {"suser"},
+	siemHost:       {"dhost"},
+	siemURL:        {"request"},
+	siemMethod:     {"requestMethod"},
+	siemUserAgent:  {"requestClientApplication"},
+	siemBytesIn:    {"in"},
+	siemBytesOut:   {"out"},
+	siemStatus:     {"outcome"},
+	siemProtocol:   {"app"},
+	siemRequestID:  {"externalId"},
+	siemRoute:      {"cs1Label", "route", "cs1"},
+	siemDuration:   {"cn1Label", "durationMs", "cn1"},
+}
+
+var leefKeys = [siemFields][]string{
+	siemTime:       {"devTimeFormat", "MMM dd yyyy HH:mm:ss.SSS z", "devTime"},
+	siemSeverity:   {"sev"},
+	siemSource:     {"src"},
+	siemSourcePort: {"srcPort"},
+	siemUser:       {"usrName"},
+	siemHost:       {"identHostName"},
+	siemURL:        {"url"},
+	siemMethod:     {"requestMethod"},
+	siemUserAgent:  {"userAgent"},
+	siemBytesIn:    {"srcBytes"},
+	siemBytesOut:   {"dstBytes"},
+	siemStatus:     {"status"},
+	siemProtocol:   {"proto"},
+	siemRequestID:  {"requestId"},
+	siemRoute:      {"route"},
+	siemDuration:   {"durationMs"},
+}
+
+// each calls f with the key and value of each of the event's attributes,
+// skipping those that are empty or that the format has no key for, with
+// the time in the given format or in milliseconds since the epoch if it's
+// empty.  Keys given as a label key, label, and value key, like CEF's
+// custom fields, are passed as two attributes.  Labels come last.
+func (e *siemEvent) each(keys [siemFields][]string, timeFormat string, f func(key, value string)) {
+	host, port, err := net.SplitHostPort(e.r.RemoteAddr)
+	if nil != err {
+		host = e.r.RemoteAddr
+	}
+	user := ""
+	if p := PrincipalFromContext(e.r.Context()); nil != p {
+		user = p.Name
+	} else if username, _, ok := e.r.BasicAuth(); ok {
+		user = username
+	}
+	bytesIn := ""
+	if 0 <= e.r.ContentLength {
+		bytesIn = strconv.FormatInt(e.r.ContentLength, 10)
+	}
+	url := *e.r.URL
+	url.Host = e.r.Host
+	if "" == url.Scheme {
+		url.Scheme = "http"
+		if nil != e.r.TLS {
+			url.Scheme = "https"
+		}
+	}
+	var values [siemFields]string
+	values[siemTime] = strconv.FormatInt(e.start.UnixNano()/int64(time.Millisecond), 10)
+	if "" != timeFormat {
+		values[siemTime] = e.start.Format(timeFormat)
+	}
+	values[siemSeverity] = strconv.Itoa(e.severity())
+	values[siemSource] = host
+	values[siemSourcePort] = port
+	values[siemUser] = user
+	values[siemHost] = e.r.Host
+	values[siemURL] = url.String()
+	if nil != e.redactor {
+		values[siemURL] = e.redactor(values[siemURL])
+	}
+	values[siemMethod] = e.r.Method
+	values[siemUserAgent] = e.r.UserAgent()
+	values[siemBytesIn] = bytesIn
+	values[siemBytesOut] = strconv.FormatInt(e.size, 10)
+	values[siemStatus] = strconv.Itoa(e.code)
+	values[siemProtocol] = e.r.Proto
+	values[siemRequestID] = string(e.requestID)
+	values[siemRoute] = e.route
+	values[siemDuration] = strconv.FormatFloat(float64(e.duration)/float64(time.Millisecond), 'f', 3, 64)
+	for i, value := range values {
+		if "" == value || 0 == len(keys[i]) {
+			continue
+		}
+		if key := keys[i]; 3 == len(key) {
+			f(key[0], key[1])
+			f(key[2], value)
+		} else {
+			f(key[0], value)
+		}
+	}
+	names := make([]string, 0, len(e.labels))
+	for name := range e.labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f(name, e.labels[name])
+	}
+}
+
+// severity rates the event from 0 to 10 in CEF and 1 to 10 in LEEF.
+func (e *siemEvent) severity() int {
+	switch {
+	case http.StatusUnauthorized == e.code || http.StatusForbidden == e.code:
+		return 7
+	case 500 <= e.code:
+		return 6
+	case 400 <= e.code:
+		return 4
+	}
+	return 1
+}
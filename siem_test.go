@@ -0,0 +1,83 @@
+package marshaler
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func testSIEMLogged(t *testing.T, format SIEMFormat, code int) string {
+	var buf bytes.Buffer
+	h := SIEMLogged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+		w.Write([]byte("hello"))
+	}), format, log.New(&buf, "", 0))
+	h.Vendor = "Acme|Corp"
+	r, _ := http.NewRequest("POST", "/foo?a=b", strings.NewReader("{}"))
+	r.Host = "example.com"
+	r.RemoteAddr = "192.0.2.1:54321"
+	r.Header.Set("User-Agent", "test\tagent")
+	r.SetBasicAuth("alice", "secret")
+	h.ServeHTTP(&testResponseWriter{}, r)
+	return buf.String()
+}
+
+func TestSIEMLoggedCEF(t *testing.T) {
+	line := testSIEMLogged(t, CEF, http.StatusForbidden)
+	if !strings.HasPrefix(line, `CEF:0|Acme\|Corp|marshaler|1.0|403|POST Forbidden|7|rt=`) {
+		t.Fatal(line)
+	}
+	if !strings.Contains(line, " src=192.0.2.1 spt=54321 suser=alice dhost=example.com request=http://example.com/foo?a\\=b requestMethod=POST requestClientApplication=test\tagent in=2 out=5 outcome=403 app=HTTP/1.1 cn1Label=durationMs cn1=") {
+		t.Fatal(line)
+	}
+	if strings.Contains(line, "secret") || strings.Contains(line, "cs1=") || strings.Contains(line, "externalId") {
+		t.Fatal(line)
+	}
+}
+
+func TestSIEMLoggedLEEF(t *testing.T) {
+	line := testSIEMLogged(t, LEEF, http.StatusInternalServerError)
+	if !strings.HasPrefix(line, "LEEF:1.0|Acme\\|Corp|marshaler|1.0|500|devTimeFormat=MMM dd yyyy HH:mm:ss.SSS z\tdevTime=") {
+		t.Fatal(line)
+	}
+	if !strings.Contains(line, "\tsev=6\tsrc=192.0.2.1\tsrcPort=54321\tusrName=alice\tidentHostName=example.com\turl=http://example.com/foo?a=b\trequestMethod=POST\tuserAgent=test agent\tsrcBytes=2\tdstBytes=5\tstatus=500\tproto=HTTP/1.1\tdurationMs=") {
+		t.Fatal(line)
+	}
+}
+
+func TestSIEMLoggedRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logged(SIEMLogged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), CEF, log.New(&buf, "", 0)), nil)
+	l.Logger = log.New(&bytes.Buffer{}, "", 0)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	r, _ := http.NewRequest("GET", "/", nil)
+	l.ServeHTTP(&testResponseWriter{}, r)
+	if line := buf.String(); !strings.Contains(line, "|200|GET OK|1|") || !strings.Contains(line, " out=0 outcome=200 ") || !strings.Contains(line, " externalId=foo ") {
+		t.Fatal(line)
+	}
+}
+
+func TestSIEMLoggedLabels(t *testing.T) {
+	var buf bytes.Buffer
+	h := SIEMLogged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), CEF, log.New(&buf, "", 0))
+	h.Labels = map[string]string{"zone": "b", "pod": "a=1"}
+	r, _ := http.NewRequest("GET", "/", nil)
+	h.ServeHTTP(&testResponseWriter{}, r)
+	if line := strings.TrimSuffix(buf.String(), "\n"); !strings.HasSuffix(line, ` pod=a\=1 zone=b`) {
+		t.Fatal(line)
+	}
+}
+
+func TestSIEMLoggedRedactor(t *testing.T) {
+	var buf bytes.Buffer
+	h := SIEMLogged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), LEEF, log.New(&buf, "", 0))
+	h.Redactor = RedactQuery("token")
+	r, _ := http.NewRequest("GET", "/foo?token=secret", nil)
+	r.Host = "example.com"
+	h.ServeHTTP(&testResponseWriter{}, r)
+	if line := buf.String(); strings.Contains(line, "secret") || !strings.Contains(line, "\turl=http://example.com/foo?token=[redacted]\t") {
+		t.Fatal(line)
+	}
+}
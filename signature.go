@@ -0,0 +1,119 @@
+package marshaler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSignatureTolerance is how far a signed request's timestamp may be
+// from the current time before SignatureVerifier rejects it as a replay.
+var DefaultSignatureTolerance = 5 * time.Minute
+
+// DefaultSignatureMaxBodySize is the longest body SignatureVerifier reads
+// to verify by default.
+var DefaultSignatureMaxBodySize int64 = 1 << 20
+
+// SignatureVerifier is an http.Handler that verifies HMAC-SHA256 signatures
+// of requests, as sent by webhooks, before passing them to the handler it
+// wraps.  The signature in the Header is the hex-encoded HMAC of the
+// timestamp in the TimestampHeader, a period, and the body, optionally
+// prefixed with "sha256=".  Requests with a missing or stale timestamp or a
+// missing or invalid signature are rejected 401 Unauthorized.  Any of
+// several secrets may have signed the request so that secrets may be
+// rotated.
+//
+// Bodies are read in full and verified before the handler sees them, so
+// that it never acts on a forged request.  Those longer than MaxBodySize are
+// rejected 413 Request Entity Too Large.
+type SignatureVerifier struct {
+	Header          string
+	TimestampHeader string
+	MaxBodySize     int64
+	Tolerance       time.Duration
+	handler         http.Handler
+	secrets         [][]byte
+}
+
+// Signed returns an http.Handler that verifies request signatures made with
+// any of the given secrets before passing requests to the given handler.
+func Signed(handler http.Handler, secrets ...[]byte) *SignatureVerifier {
+	return &SignatureVerifier{
+		Header:          "X-Signature",
+		TimestampHeader: "X-Signature-Timestamp",
+		MaxBodySize:     DefaultSignatureMaxBodySize,
+		Tolerance:       DefaultSignatureTolerance,
+		handler:         handler,
+		secrets:         secrets,
+	}
+}
+
+func (v *SignatureVerifier) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	timestamp := r.Header.Get(v.TimestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if nil != err {
+		writeError(w, r, Unauthorized{errors.New(Message(r, "%s header is missing or malformed", v.TimestampHeader))})
+		return
+	}
+	if skew := time.Since(time.Unix(seconds, 0)); v.Tolerance < skew || skew < -v.Tolerance {
+		writeError(w, r, Unauthorized{errors.New(Message(r, "%s header is too old or too new", v.TimestampHeader))})
+		return
+	}
+	signature, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get(v.Header), "sha256="))
+	if nil != err || 0 == len(signature) {
+		writeError(w, r, Unauthorized{errors.New(Message(r, "%s header is missing or malformed", v.Header))})
+		return
+	}
+	var body []byte
+	if nil != r.Body && http.NoBody != r.Body {
+		if body, err = io.ReadAll(io.LimitReader(r.Body, v.MaxBodySize+1)); nil != err {
+			writeError(w, r, BadRequest{err})
+			return
+		}
+		if v.MaxBodySize < int64(len(body)) {
+			writeError(w, r, RequestEntityTooLarge{errors.New(Message(
+				r,
+				"request body is longer than %d bytes",
+				v.MaxBodySize,
+			))})
+			return
+		}
+	}
+	if !v.verify(timestamp, body, signature) {
+		writeError(w, r, Unauthorized{errors.New(Message(r, "%s header doesn't match the request", v.Header))})
+		return
+	}
+	if nil != r.Body {
+		r.Body = readCloser{bytes.NewReader(body), r.Body}
+	}
+	v.handler.ServeHTTP(w, r)
+}
+
+// verify reports whether any of the secrets signed the timestamp and body.
+func (v *SignatureVerifier) verify(timestamp string, body, signature []byte) bool {
+	for _, secret := range v.secrets {
+		mac := hmac.New(sha256.New, secret)
+		io.WriteString(mac, timestamp+".")
+		mac.Write(body)
+		if hmac.Equal(signature, mac.Sum(nil)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the signature SignatureVerifier expects of a request with the
+// given timestamp and body, for clients and tests.
+func Sign(secret []byte, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	io.WriteString(mac, strconv.FormatInt(timestamp.Unix(), 10)+".")
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
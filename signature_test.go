@@ -0,0 +1,73 @@
+package marshaler
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func testSignedRequest(secret []byte, timestamp time.Time, body string) *http.Request {
+	r, _ := http.NewRequest("POST", "http://example.com/foo", bytes.NewBufferString(body))
+	r.Header.Set("X-Signature-Timestamp", strconv.FormatInt(timestamp.Unix(), 10))
+	r.Header.Set("X-Signature", "sha256="+Sign(secret, timestamp, []byte(body)))
+	return r
+}
+
+func TestSigned(t *testing.T) {
+	v := Signed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if nil != err {
+			t.Fatal(err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(body)
+	}), []byte("old"), []byte("new"))
+	w := &testResponseWriter{}
+	v.ServeHTTP(w, testSignedRequest([]byte("new"), time.Now(), "{\"foo\":\"bar\"}"))
+	if http.StatusAccepted != w.StatusCode || "{\"foo\":\"bar\"}" != w.Body.String() {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+}
+
+func TestSignedMismatch(t *testing.T) {
+	v := Signed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler called")
+	}), []byte("secret"))
+	r := testSignedRequest([]byte("secret"), time.Now(), "{\"foo\":\"bar\"}")
+	r.Body = io.NopCloser(bytes.NewBufferString("{\"foo\":\"baz\"}"))
+	r.Header.Set("Accept", "application/json")
+	w := &testResponseWriter{}
+	v.ServeHTTP(w, r)
+	if http.StatusUnauthorized != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if "{\"description\":\"X-Signature header doesn't match the request\",\"error\":\"marshaler.Unauthorized\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestSignedStale(t *testing.T) {
+	v := Signed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler called")
+	}), []byte("secret"))
+	w := &testResponseWriter{}
+	v.ServeHTTP(w, testSignedRequest([]byte("secret"), time.Now().Add(-time.Hour), ""))
+	if http.StatusUnauthorized != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
+
+func TestSignedTooLarge(t *testing.T) {
+	v := Signed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler called")
+	}), []byte("secret"))
+	v.MaxBodySize = 4
+	w := &testResponseWriter{}
+	v.ServeHTTP(w, testSignedRequest([]byte("secret"), time.Now(), "{\"foo\":\"bar\"}"))
+	if http.StatusRequestEntityTooLarge != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
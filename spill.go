@@ -0,0 +1,195 @@
+package marshaler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBodySpillerMaxAge is how long a BodySpiller keeps the files it
+// writes unless told otherwise.
+const DefaultBodySpillerMaxAge = 7 * 24 * time.Hour
+
+// DefaultBodySpillerMaxFileSize is the most bytes of a body a BodySpiller
+// writes to a file unless told otherwise.
+const DefaultBodySpillerMaxFileSize int64 = 64 << 20
+
+// bodySpillerPruneInterval is how often a BodySpiller prunes old files as it
+// writes new ones.
+const bodySpillerPruneInterval = time.Minute
+
+// BodySpiller writes bodies too large for MultilineLogger to log in full to
+// files in Dir, or the temporary directory if it's empty, so that whole
+// payloads remain available for incident analysis without bloating the log.
+// Files are named for the RequestID and direction, and are readable only
+// by their owner since they aren't redacted.  Files older than MaxAge are
+// removed, as are the oldest files beyond MaxFiles if it's positive, when
+// Prune is called and every so often as new files are written.  Bodies are
+// truncated after MaxFileSize bytes if it's positive so that one huge
+// upload can't fill the disk.
+type BodySpiller struct {
+	Dir         string
+	MaxAge      time.Duration
+	MaxFileSize int64
+	MaxFiles    int
+	mu          sync.Mutex
+	pruned      time.Time
+}
+
+// NewBodySpiller returns a BodySpiller that writes up to
+// DefaultBodySpillerMaxFileSize bytes of each body to files in dir and keeps
+// them for DefaultBodySpillerMaxAge.
+func NewBodySpiller(dir string) *BodySpiller {
+	return &BodySpiller{
+		Dir:         dir,
+		MaxAge:      DefaultBodySpillerMaxAge,
+		MaxFileSize: DefaultBodySpillerMaxFileSize,
+	}
+}
+
+// Prune removes spilled bodies older than MaxAge and, if MaxFiles is
+// positive, the oldest of those beyond MaxFiles.  Other files in the
+// directory are left alone.
+func (s *BodySpiller) Prune() error {
+	s.mu.Lock()
+	s.pruned = time.Now()
+	s.mu.Unlock()
+	paths, err := filepath.Glob(filepath.Join(s.dir(), "marshaler-*.body"))
+	if nil != err {
+		return err
+	}
+	type spilled struct {
+		path    string
+		modTime time.Time
+	}
+	files := make([]spilled, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if nil != err {
+			continue
+		}
+		if 0 < s.MaxAge && s.MaxAge < time.Since(info.ModTime()) {
+			os.Remove(path)
+			continue
+		}
+		files = append(files, spilled{path, info.ModTime()})
+	}
+	if 0 >= s.MaxFiles || len(files) <= s.MaxFiles {
+		return nil
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files[:len(files)-s.MaxFiles] {
+		os.Remove(f.path)
+	}
+	return nil
+}
+
+func (s *BodySpiller) dir() string {
+	if "" == s.Dir {
+		return os.TempDir()
+	}
+	return s.Dir
+}
+
+// create creates a file for a body of the given request, pruning old files
+// first if it's been a while.
+func (s *BodySpiller) create(requestID RequestID, direction string) (*os.File, error) {
+	s.mu.Lock()
+	prune := bodySpillerPruneInterval < time.Since(s.pruned)
+	s.mu.Unlock()
+	if prune {
+		s.Prune()
+	}
+	name := strings.NewReplacer("/", "_", string(os.PathSeparator), "_", "*", "_").Replace(string(requestID))
+	return os.CreateTemp(s.dir(), "marshaler-"+name+"-"+direction+"-*.body")
+}
+
+// spilledBody tracks how much of a body MultilineLogger has logged and, if
+// it's too long to log in full and there's a BodySpiller, the file it's
+// spilled to.  The part that was logged is kept in memory until the body
+// proves too long so the file may begin with it.  Spilling stops once the
+// file reaches the BodySpiller's MaxFileSize.
+type spilledBody struct {
+	err       error
+	file      *os.File
+	hash      hash.Hash
+	logged    []byte
+	max       int64
+	n         int64
+	spilled   int64
+	truncated bool
+}
+
+// write records a chunk of the body, returning the part of it that should
+// be logged and spilling the rest, along with the part logged so far, if
+// there's a BodySpiller.
+func (b *spilledBody) write(l *MultilineLogger, requestID RequestID, direction string, p []byte) []byte {
+	room := int64(l.MaxBodySize) - b.n
+	b.n += int64(len(p))
+	if int64(len(p)) <= room {
+		if nil != l.BodySpiller {
+			b.logged = append(b.logged, p...)
+		}
+		return p
+	}
+	if 0 > room {
+		room = 0
+	}
+	if nil != l.BodySpiller && nil == b.err {
+		if nil == b.file {
+			if b.file, b.err = l.BodySpiller.create(requestID, direction); nil == b.err {
+				b.hash, b.max = sha256.New(), l.BodySpiller.MaxFileSize
+				b.spill(b.logged)
+				b.logged = nil
+			}
+		}
+		b.spill(p)
+	}
+	return p[:room]
+}
+
+func (b *spilledBody) spill(p []byte) {
+	if nil != b.err || b.truncated {
+		return
+	}
+	if 0 < b.max && b.max-b.spilled < int64(len(p)) {
+		p, b.truncated = p[:b.max-b.spilled], true
+	}
+	b.spilled += int64(len(p))
+	b.hash.Write(p)
+	_, b.err = b.file.Write(p)
+}
+
+// close closes the file the body was spilled to, if any, and describes how
+// much of the body went unlogged and where to find it.
+func (b *spilledBody) close(l *MultilineLogger) (string, bool) {
+	if b.n <= int64(l.MaxBodySize) {
+		return "", false
+	}
+	description := strconv.FormatInt(b.n-int64(l.MaxBodySize), 10) + " more bytes not logged"
+	if nil == b.file {
+		if nil != b.err {
+			description += "; spilling failed: " + b.err.Error()
+		}
+		return description, true
+	}
+	if err := b.file.Close(); nil == b.err {
+		b.err = err
+	}
+	if nil != b.err {
+		os.Remove(b.file.Name())
+		return description + "; spilling failed: " + b.err.Error(), true
+	}
+	description += "; spilled to " + b.file.Name() + " sha256=" + hex.EncodeToString(b.hash.Sum(nil))
+	if b.truncated {
+		description += "; truncated after " + strconv.FormatInt(b.spilled, 10) + " bytes"
+	}
+	return description, true
+}
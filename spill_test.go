@@ -0,0 +1,117 @@
+package marshaler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggedMaxBodySize(t *testing.T) {
+	var buf bytes.Buffer
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("hello "))
+		w.Write([]byte("world"))
+	}), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.MaxBodySize = 8
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	r, _ := http.NewRequest("POST", "/", strings.NewReader("tiny"))
+	l.ServeHTTP(&testResponseWriter{}, r)
+	if s := buf.String(); !strings.Contains(s, "foo > tiny\n") || !strings.Contains(s, "foo < hello \nfoo < wo\nfoo < [3 more bytes not logged]\n") || strings.Contains(s, "foo > [") {
+		t.Fatal(s)
+	}
+}
+
+func TestLoggedBodySpiller(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	body := strings.Repeat("0123456789", 100)
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(struct{ io.Writer }{w}, r.Body)
+	}), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.MaxBodySize = 16
+	l.BodySpiller = NewBodySpiller(dir)
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	r, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+	l.ServeHTTP(&testResponseWriter{}, r)
+	sum := sha256.Sum256([]byte(body))
+	for _, direction := range []string{"request", "response"} {
+		paths, _ := filepath.Glob(filepath.Join(dir, "marshaler-foo-"+direction+"-*.body"))
+		if 1 != len(paths) {
+			t.Fatal(direction, paths)
+		}
+		if p, _ := os.ReadFile(paths[0]); body != string(p) {
+			t.Fatal(direction, string(p))
+		}
+		if !strings.Contains(buf.String(), "[984 more bytes not logged; spilled to "+paths[0]+" sha256="+hex.EncodeToString(sum[:])+"]") {
+			t.Fatal(buf.String())
+		}
+	}
+	if !strings.Contains(buf.String(), "foo > 0123456789012345\n") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestBodySpillerPrune(t *testing.T) {
+	dir := t.TempDir()
+	s := NewBodySpiller(dir)
+	s.MaxAge = time.Hour
+	s.MaxFiles = 2
+	old := time.Now().Add(-2 * time.Hour)
+	for i, name := range []string{"marshaler-a-request-1.body", "marshaler-b-request-2.body", "marshaler-c-request-3.body", "marshaler-d-request-4.body", "other.body"} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, nil, 0600)
+		mtime := time.Now().Add(time.Duration(i-5) * time.Minute)
+		if 0 == i {
+			mtime = old
+		}
+		os.Chtimes(path, mtime, mtime)
+	}
+	if err := s.Prune(); nil != err {
+		t.Fatal(err)
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "*"))
+	for i := range paths {
+		paths[i] = filepath.Base(paths[i])
+	}
+	if "marshaler-c-request-3.body marshaler-d-request-4.body other.body" != strings.Join(paths, " ") {
+		t.Fatal(paths)
+	}
+}
+
+func TestLoggedBodySpillerMaxFileSize(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	l := Logged(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}), nil)
+	l.Logger = log.New(&buf, "", 0)
+	l.MaxBodySize = 16
+	l.BodySpiller = NewBodySpiller(dir)
+	l.BodySpiller.MaxFileSize = 100
+	l.RequestIDCreator = func(r *http.Request) RequestID { return "foo" }
+	body := strings.Repeat("0123456789", 100)
+	r, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+	l.ServeHTTP(&testResponseWriter{}, r)
+	paths, _ := filepath.Glob(filepath.Join(dir, "marshaler-foo-request-*.body"))
+	if 1 != len(paths) {
+		t.Fatal(paths)
+	}
+	if p, _ := os.ReadFile(paths[0]); body[:100] != string(p) {
+		t.Fatal(string(p))
+	}
+	sum := sha256.Sum256([]byte(body[:100]))
+	if !strings.Contains(buf.String(), "[984 more bytes not logged; spilled to "+paths[0]+" sha256="+hex.EncodeToString(sum[:])+"; truncated after 100 bytes]") {
+		t.Fatal(buf.String())
+	}
+}
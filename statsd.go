@@ -0,0 +1,96 @@
+package marshaler
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsD is a MetricsSink that sends counts and timings to a StatsD server
+// over UDP, one packet per measurement.  If DogStatsD is true, labels are
+// sent as DogStatsD tags, as Datadog's agent expects; otherwise their
+// values, sorted by label name, are appended to the metric name, since
+// plain StatsD has no tags.  Names are prefixed with Prefix.
+type StatsD struct {
+	Prefix    string
+	DogStatsD bool
+	mu        sync.Mutex
+	conn      net.Conn
+}
+
+// NewStatsD returns a StatsD sink that sends to the server at the given UDP
+// address, like localhost:8125.
+func NewStatsD(addr, prefix string) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if nil != err {
+		return nil, err
+	}
+	return &StatsD{Prefix: prefix, conn: conn}, nil
+}
+
+// Close closes the StatsD sink's connection.
+func (s *StatsD) Close() error {
+	return s.conn.Close()
+}
+
+func (s *StatsD) Count(name string, n int64, labels map[string]string) {
+	s.send(name, strconv.FormatInt(n, 10), "c", labels)
+}
+
+func (s *StatsD) Timing(name string, d time.Duration, labels map[string]string) {
+	s.send(name, strconv.FormatFloat(d.Seconds()*1000, 'f', -1, 64), "ms", labels)
+}
+
+func (s *StatsD) send(name, value, kind string, labels map[string]string) {
+	var b strings.Builder
+	b.WriteString(statsdName(s.Prefix + name))
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if !s.DogStatsD {
+		for _, key := range keys {
+			b.WriteString(".")
+			b.WriteString(statsdName(labels[key]))
+		}
+	}
+	b.WriteString(":" + value + "|" + kind)
+	if s.DogStatsD && 0 < len(keys) {
+		b.WriteString("|#")
+		for i, key := range keys {
+			if 0 < i {
+				b.WriteString(",")
+			}
+			b.WriteString(statsdTag(key) + ":" + statsdTag(labels[key]))
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn.Write([]byte(b.String()))
+}
+
+// statsdName replaces the characters StatsD reserves, as well as slashes
+// and braces from route patterns, with underscores.
+func statsdName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', '/', '{', '}', ' ':
+			return '_'
+		}
+		return r
+	}, strings.Trim(name, "/"))
+}
+
+func statsdTag(tag string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', ' ':
+			return '_'
+		}
+		return r
+	}, tag)
+}
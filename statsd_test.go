@@ -0,0 +1,50 @@
+package marshaler
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func testStatsD(t *testing.T, dogStatsD bool) (*StatsD, func() string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	s, err := NewStatsD(conn.LocalAddr().String(), "app.")
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	s.DogStatsD = dogStatsD
+	return s, func() string {
+		buf := make([]byte, 1024)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if nil != err {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+}
+
+func TestStatsD(t *testing.T) {
+	s, read := testStatsD(t, false)
+	s.Count("/users/{id}", 1, map[string]string{"method": "GET", "class": "2xx"})
+	if packet := read(); "app._users__id_.2xx.GET:1|c" != packet {
+		t.Fatal(packet)
+	}
+	s.Timing("foo", 1500*time.Microsecond, nil)
+	if packet := read(); "app.foo:1.5|ms" != packet {
+		t.Fatal(packet)
+	}
+}
+
+func TestDogStatsD(t *testing.T) {
+	s, read := testStatsD(t, true)
+	s.Timing("foo", 2*time.Millisecond, map[string]string{"method": "GET", "status": "200"})
+	if packet := read(); "app.foo:2|ms|#method:GET,status:200" != packet {
+		t.Fatal(packet)
+	}
+}
@@ -0,0 +1,135 @@
+package marshaler
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// recordStream decodes the records of a request body and sends them on a
+// channel, which a handler function receives in place of a request struct:
+//
+//	func(u *url.URL, h http.Header, rq <-chan *Record) (int, http.Header, *Response, error)
+//
+// The channel is unbuffered so records are only read from the client as fast
+// as the handler consumes them.  The body may be NDJSON or a JSON array.  If
+// decoding fails, the channel is closed early and the Marshaler responds 400
+// Bad Request once the handler returns.
+type recordStream struct {
+	body     io.Closer
+	ch       reflect.Value
+	done     chan struct{}
+	finished chan struct{}
+	err      error
+	rc       *http.ResponseController
+}
+
+// streamRecords starts decoding the request body onto the channel ch.
+func streamRecords(w http.ResponseWriter, r *http.Request, ch reflect.Value) (*recordStream, error) {
+	s := &recordStream{
+		body:     r.Body,
+		ch:       ch,
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+		rc:       http.NewResponseController(w),
+	}
+	if "PATCH" != r.Method && "POST" != r.Method && "PUT" != r.Method {
+		ch.Close()
+		close(s.finished)
+		return s, nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if "application/json" != mediaType && "application/x-ndjson" != mediaType && "application/ndjson" != mediaType {
+		return nil, NewHTTPEquivError(MarshalerError(Message(
+			r,
+			"Content-Type header is %s, not application/json or application/x-ndjson",
+			r.Header.Get("Content-Type"),
+		)), http.StatusUnsupportedMediaType)
+	}
+	body, err := charsetReader(r)
+	if nil != err {
+		return nil, NewHTTPEquivError(err, http.StatusUnsupportedMediaType)
+	}
+	go s.decode(json.NewDecoder(body), "application/json" == mediaType)
+	return s, nil
+}
+
+func (s *recordStream) decode(decoder *json.Decoder, array bool) {
+	defer close(s.finished)
+	defer s.ch.Close()
+	if array {
+		if s.err = expectDelim(decoder, '['); nil != s.err {
+			return
+		}
+	}
+	for !array || decoder.More() {
+		record := s.newRecord()
+		if err := decoder.Decode(record.Interface()); nil != err {
+			if io.EOF != err || array {
+				s.err = err
+			}
+			return
+		}
+		if reflect.Ptr != s.ch.Type().Elem().Kind() {
+			record = record.Elem()
+		}
+		chosen, _, _ := reflect.Select([]reflect.SelectCase{
+			{Dir: reflect.SelectSend, Chan: s.ch, Send: record},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(s.done)},
+		})
+		if 1 == chosen {
+			return
+		}
+	}
+	s.err = expectDelim(decoder, ']')
+}
+
+func (s *recordStream) newRecord() reflect.Value {
+	elem := s.ch.Type().Elem()
+	if reflect.Ptr == elem.Kind() {
+		return reflect.New(elem.Elem())
+	}
+	return reflect.New(elem)
+}
+
+// Err returns the error that ended decoding, if decoding has ended.
+func (s *recordStream) Err() error {
+	select {
+	case <-s.finished:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Stop releases the decoding goroutine if the handler returned without
+// draining the channel and waits for it to finish, since net/http forbids
+// reading the body once the handler's returned.  A read still waiting on
+// the client is cut short by a read deadline and by closing the body.
+func (s *recordStream) Stop() {
+	close(s.done)
+	select {
+	case <-s.finished:
+		return
+	default:
+	}
+	s.rc.SetReadDeadline(time.Now())
+	if nil != s.body {
+		s.body.Close()
+	}
+	<-s.finished
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if nil != err {
+		return err
+	}
+	if delim != token {
+		return NewMarshalerError("expected %v, found %v", delim, token)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package marshaler
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func testStreamRequest(t *testing.T, contentType, body string) *testResponseWriter {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("POST", "http://example.com/foo", bytes.NewBufferString(body))
+	r.Header.Set("Content-Type", contentType)
+	Handler(func(u *url.URL, h http.Header, rq <-chan *testRequest) (int, http.Header, *testResponse, error) {
+		var foos []string
+		for record := range rq {
+			foos = append(foos, record.Foo)
+		}
+		return http.StatusOK, nil, &testResponse{strings.Join(foos, ",")}, nil
+	}).ServeHTTP(w, r)
+	return w
+}
+
+func TestStreamRequestNDJSON(t *testing.T) {
+	w := testStreamRequest(t, "application/x-ndjson", "{\"foo\":\"a\"}\n{\"foo\":\"b\"}\n")
+	if "{\"foo\":\"a,b\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestStreamRequestArray(t *testing.T) {
+	w := testStreamRequest(t, "application/json", "[{\"foo\":\"a\"}, {\"foo\":\"b\"}, {\"foo\":\"c\"}]")
+	if "{\"foo\":\"a,b,c\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestStreamRequestMalformed(t *testing.T) {
+	w := testStreamRequest(t, "application/json", "[{\"foo\":\"a\"}, {\"foo\":")
+	if http.StatusBadRequest != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
+
+func TestStreamRequestValues(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("POST", "http://example.com/foo", bytes.NewBufferString("1 2 3"))
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	Handler(func(u *url.URL, h http.Header, rq <-chan int) (int, http.Header, int, error) {
+		sum := 0
+		for i := range rq {
+			sum += i
+		}
+		return http.StatusOK, nil, sum, nil
+	}).ServeHTTP(w, r)
+	if "6\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestStreamRequestStop(t *testing.T) {
+	body, client := io.Pipe()
+	r, _ := http.NewRequest("POST", "http://example.com/foo", body)
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	go io.WriteString(client, "{\"foo\":\"a\"}\n")
+	w := &testResponseWriter{}
+	Handler(func(u *url.URL, h http.Header, rq <-chan *testRequest) (int, http.Header, *testResponse, error) {
+		record := <-rq
+		return http.StatusOK, nil, &testResponse{record.Foo}, nil
+	}).ServeHTTP(w, r)
+	if "{\"foo\":\"a\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+	if _, err := io.WriteString(client, "{\"foo\":\"b\"}\n"); io.ErrClosedPipe != err {
+		t.Fatal(err)
+	}
+}
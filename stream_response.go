@@ -0,0 +1,99 @@
+package marshaler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+var streamedType = reflect.TypeOf(Streamed(nil))
+
+// ChunkWriter writes a response as a stream of newline-delimited JSON
+// values.  Since it sets no Content-Length, net/http sends the response with
+// chunked transfer encoding and each Flush sends the values written so far.
+type ChunkWriter struct {
+	w       http.ResponseWriter
+	encoder *json.Encoder
+}
+
+// NewChunkWriter returns a ChunkWriter that writes to w, which should not
+// have been written to yet.
+func NewChunkWriter(w http.ResponseWriter) *ChunkWriter {
+	w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	w.Header().Del("Content-Length")
+	return &ChunkWriter{w: w, encoder: json.NewEncoder(w)}
+}
+
+// WriteChunk encodes a value followed by a newline.
+func (c *ChunkWriter) WriteChunk(v interface{}) error {
+	return c.encoder.Encode(v)
+}
+
+// Flush sends the values written so far to the client, if the underlying
+// http.ResponseWriter is an http.Flusher.
+func (c *ChunkWriter) Flush() {
+	if f, ok := c.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Streamed is a response type for handler functions that produce their
+// responses progressively.  The Marshaler writes the status and headers the
+// handler function returned and then calls the Streamed function to write
+// the body, chunk by chunk.  Errors returned after the status has been sent
+// can only be logged.  Bodies are always newline-delimited JSON, whatever
+// Codecs are registered, so requests whose Accept header allows neither it
+// nor JSON are answered 406 Not Acceptable.
+//
+//	func(u *url.URL, h http.Header) (int, http.Header, marshaler.Streamed, error) {
+//	    return http.StatusOK, nil, func(c *marshaler.ChunkWriter) error {
+//	        for hit := range search(u.Query().Get("q")) {
+//	            if err := c.WriteChunk(hit); nil != err {
+//	                return err
+//	            }
+//	            c.Flush()
+//	        }
+//	        return nil
+//	    }, nil
+//	}
+type Streamed func(*ChunkWriter) error
+
+func (s Streamed) serve(w http.ResponseWriter, r *http.Request, code int) {
+	if !acceptNDJSON(r) {
+		writeError(w, r, NotAcceptable{errors.New(Message(
+			r,
+			"\"%s\" does not contain \"application/x-ndjson\"",
+			r.Header.Get("Accept"),
+		))})
+		return
+	}
+	c := NewChunkWriter(w)
+	w.WriteHeader(code)
+	if "HEAD" == r.Method {
+		return
+	}
+	if err := s(c); nil != err {
+		log.Println(err)
+	}
+}
+
+// acceptNDJSON reports whether the Accept header allows newline-delimited
+// JSON, which clients that accept JSON are taken to understand.
+func acceptNDJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if "" == accept {
+		return true
+	}
+	for _, field := range strings.Split(accept, ",") {
+		switch name, q := qualityValue(field); name {
+		case "application/x-ndjson", "application/ndjson", "application/json", "application/*", "*/*":
+			if 0 < q {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package marshaler
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+type testFlushingResponseWriter struct {
+	testResponseWriter
+	Flushes []string
+}
+
+func (w *testFlushingResponseWriter) Flush() {
+	w.Flushes = append(w.Flushes, w.Body.String())
+}
+
+func TestStreamed(t *testing.T) {
+	w := &testFlushingResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	Handler(func(u *url.URL, h http.Header) (int, http.Header, Streamed, error) {
+		return http.StatusOK, nil, func(c *ChunkWriter) error {
+			for _, foo := range []string{"a", "b"} {
+				if err := c.WriteChunk(&testResponse{foo}); nil != err {
+					return err
+				}
+				c.Flush()
+			}
+			return nil
+		}, nil
+	}).ServeHTTP(w, r)
+	if http.StatusOK != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if "application/x-ndjson; charset=utf-8" != w.Header().Get("Content-Type") {
+		t.Fatal(w.Header().Get("Content-Type"))
+	}
+	if 2 != len(w.Flushes) || "{\"foo\":\"a\"}\n" != w.Flushes[0] {
+		t.Fatal(w.Flushes)
+	}
+	if "{\"foo\":\"a\"}\n{\"foo\":\"b\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestStreamedAccept(t *testing.T) {
+	h := Handler(func(u *url.URL, h http.Header) (int, http.Header, Streamed, error) {
+		return http.StatusOK, nil, func(c *ChunkWriter) error {
+			return c.WriteChunk(&testResponse{"a"})
+		}, nil
+	})
+	for accept, code := range map[string]int{
+		"application/x-ndjson": http.StatusOK,
+		"application/json":     http.StatusOK,
+		"application/bson":     http.StatusNotAcceptable,
+		"text/html":            http.StatusNotAcceptable,
+	} {
+		w := &testResponseWriter{}
+		r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+		r.Header.Set("Accept", accept)
+		h.ServeHTTP(w, r)
+		if code != w.StatusCode {
+			t.Fatal(accept, w.StatusCode, w.Body.String())
+		}
+		if http.StatusOK == code && "application/x-ndjson; charset=utf-8" != w.Header().Get("Content-Type") {
+			t.Fatal(accept, w.Header())
+		}
+	}
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Accept", "application/bson")
+	Handler(func(u *url.URL, h http.Header) (int, http.Header, interface{}, error) {
+		return http.StatusOK, nil, Streamed(func(c *ChunkWriter) error { return nil }), nil
+	}).ServeHTTP(w, r)
+	if http.StatusNotAcceptable != w.StatusCode {
+		t.Fatal(w.StatusCode, w.Header())
+	}
+}
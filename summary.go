@@ -0,0 +1,129 @@
+package marshaler
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// summarySampleSize is how many durations a SummaryLogger keeps each
+// interval to estimate percentiles from.  Up to this many requests, the
+// percentiles are exact.
+const summarySampleSize = 1024
+
+// SummaryLogger is a MetricsSink that logs a line every interval
+// summarizing the requests timed since the last: how many there were and
+// at what rate, how many were errors, with 5xx statuses, and the 50th, 90th,
+// and 99th percentile and the maximum of their durations.  It gives some
+// observability to deployments without a metrics stack.  Only timings are
+// summarized, so wrap handlers with Timed, under any names:
+//
+//	summary := marshaler.NewSummaryLogger(logger, time.Minute)
+//	defer summary.Close()
+//	handler = marshaler.Timed(handler, "", summary)
+//
+// Percentiles are estimated from a uniform sample of the interval's
+// durations once there are more than a thousand or so.
+type SummaryLogger struct {
+	Logger Logger
+
+	mu      sync.Mutex
+	started time.Time
+	count   int64
+	errors  int64
+	max     time.Duration
+	sample  []time.Duration
+	stop    chan struct{}
+	stopped sync.Once
+}
+
+// NewSummaryLogger returns a SummaryLogger that logs to logger every
+// interval until it's closed.
+func NewSummaryLogger(logger Logger, interval time.Duration) *SummaryLogger {
+	s := &SummaryLogger{
+		Logger:  logger,
+		started: time.Now(),
+		sample:  make([]time.Duration, 0, summarySampleSize),
+		stop:    make(chan struct{}),
+	}
+	go s.run(interval)
+	return s
+}
+
+func (s *SummaryLogger) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Close stops the SummaryLogger, logging a last line about the requests
+// timed since the one before.
+func (s *SummaryLogger) Close() error {
+	s.stopped.Do(func() { close(s.stop) })
+	return s.Flush()
+}
+
+// Count does nothing, since requests are counted as they're timed.
+func (s *SummaryLogger) Count(name string, n int64, labels map[string]string) {}
+
+// Timing adds a request's duration to the current interval's summary,
+// counting it as an error if its status is 5xx.
+func (s *SummaryLogger) Timing(name string, d time.Duration, labels map[string]string) {
+	status, _ := strconv.Atoi(labels["status"])
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	if 500 <= status {
+		s.errors++
+	}
+	if d > s.max {
+		s.max = d
+	}
+	if len(s.sample) < summarySampleSize {
+		s.sample = append(s.sample, d)
+	} else if i := rand.Int63n(s.count); i < summarySampleSize {
+		s.sample[i] = d
+	}
+}
+
+// Flush logs the summary of the requests timed since the last line and
+// starts a new interval.  It may be one of a Server's Flushers.
+func (s *SummaryLogger) Flush() error {
+	now := time.Now()
+	s.mu.Lock()
+	elapsed, count, failed, longest := now.Sub(s.started), s.count, s.errors, s.max
+	sample := s.sample
+	s.started, s.count, s.errors, s.max = now, 0, 0, 0
+	s.sample = make([]time.Duration, 0, summarySampleSize)
+	s.mu.Unlock()
+	if 0 == count {
+		s.Logger.Printf("summary: 0 requests in %v", elapsed.Round(time.Millisecond))
+		return nil
+	}
+	sort.Slice(sample, func(i, j int) bool { return sample[i] < sample[j] })
+	percentile := func(p int) time.Duration {
+		return sample[(p*len(sample)+99)/100-1]
+	}
+	s.Logger.Printf(
+		"summary: %d requests in %v (%.2f/s), %d errors (%.1f%%), p50=%v p90=%v p99=%v max=%v",
+		count,
+		elapsed.Round(time.Millisecond),
+		float64(count)/elapsed.Seconds(),
+		failed,
+		float64(failed)*100/float64(count),
+		percentile(50),
+		percentile(90),
+		percentile(99),
+		longest,
+	)
+	return nil
+}
@@ -0,0 +1,49 @@
+package marshaler
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestSummaryLogger(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewSummaryLogger(log.New(&buf, "", 0), time.Hour)
+	for i := 1; i <= 100; i++ {
+		status := "200"
+		if 0 == i%20 {
+			status = "503"
+		}
+		s.Timing("", time.Duration(i)*time.Millisecond, map[string]string{"method": "GET", "status": status})
+	}
+	s.Flush()
+	if !regexp.MustCompile(`^summary: 100 requests in \S+ \(\d+\.\d\d/s\), 5 errors \(5\.0%\), p50=50ms p90=90ms p99=99ms max=100ms\n$`).MatchString(buf.String()) {
+		t.Fatal(buf.String())
+	}
+	buf.Reset()
+	s.Close()
+	if !regexp.MustCompile(`^summary: 0 requests in \S+\n$`).MatchString(buf.String()) {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestSummaryLoggerInterval(t *testing.T) {
+	var buf testSyncBuffer
+	s := NewSummaryLogger(log.New(&buf, "", 0), 10*time.Millisecond)
+	defer s.Close()
+	handler := Timed(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}), "", s)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	deadline := time.Now().Add(time.Second)
+	for !regexp.MustCompile(`summary: 1 requests .* 1 errors \(100\.0%\)`).MatchString(buf.String()) {
+		if time.Now().After(deadline) {
+			t.Fatal(buf.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
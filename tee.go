@@ -0,0 +1,50 @@
+package marshaler
+
+import (
+	"bytes"
+	"io"
+)
+
+// limitedBuffer is a bytes.Buffer that silently discards writes beyond its
+// maximum size.
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room < len(p) {
+		if 0 < room {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// teeReadCloser calls onRead with each chunk of data read from the
+// io.ReadCloser it wraps and, if onEOF is not nil, calls it at the end of the
+// data, returning its error, if any, in place of io.EOF.
+type teeReadCloser struct {
+	io.ReadCloser
+	onRead func([]byte)
+	onEOF  func() error
+	eof    error
+}
+
+func (r *teeReadCloser) Read(p []byte) (int, error) {
+	if nil != r.eof {
+		return 0, r.eof
+	}
+	n, err := r.ReadCloser.Read(p)
+	if 0 < n && nil != r.onRead {
+		r.onRead(p[:n])
+	}
+	if io.EOF == err && nil != r.onEOF {
+		if eofErr := r.onEOF(); nil != eofErr {
+			err = eofErr
+		}
+		r.eof = err
+	}
+	return n, err
+}
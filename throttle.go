@@ -0,0 +1,160 @@
+package marshaler
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// DefaultThrottleIPs is the number of clients Throttled and
+// LimitConnectionsPerIP track at once.  Requests and connections from
+// further clients are refused until some of those tracked finish.
+var DefaultThrottleIPs = 65536
+
+// Throttle is an http.Handler that limits the number of requests each
+// client may have in flight to the handler it wraps, answering those beyond
+// the limit 429 Too Many Requests.  Clients are told apart by a
+// RateLimitKeyer, usually ClientIP.
+type Throttle struct {
+	MaxInFlight int
+	handler     http.Handler
+	keyer       RateLimitKeyer
+	states      *ipStates
+}
+
+// Throttled returns an http.Handler that allows each client at most
+// maxInFlight concurrent requests to the given handler.
+func Throttled(handler http.Handler, keyer RateLimitKeyer, maxInFlight int) *Throttle {
+	return &Throttle{
+		MaxInFlight: maxInFlight,
+		handler:     handler,
+		keyer:       keyer,
+		states:      newIPStates(DefaultThrottleIPs),
+	}
+}
+
+func (t *Throttle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := t.keyer(r)
+	if "" == key {
+		t.handler.ServeHTTP(w, r)
+		return
+	}
+	state, ok := t.states.acquire(key, t.MaxInFlight, func(s *ipState) *int { return &s.requests })
+	if !ok {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, r, TooManyRequests{errors.New(Message(
+			r,
+			"too many concurrent requests; at most %d allowed",
+			t.MaxInFlight,
+		))})
+		return
+	}
+	defer t.states.release(state, func(s *ipState) *int { return &s.requests })
+	t.handler.ServeHTTP(w, r)
+}
+
+// LimitConnectionsPerIP returns a net.Listener that allows each client IP
+// address at most max open connections.  Connections beyond the limit are
+// sent a 429 Too Many Requests response and closed.
+func LimitConnectionsPerIP(l net.Listener, max int) net.Listener {
+	return &ipLimitListener{
+		Listener: l,
+		max:      max,
+		states:   newIPStates(DefaultThrottleIPs),
+	}
+}
+
+type ipLimitListener struct {
+	net.Listener
+	max    int
+	states *ipStates
+}
+
+func (l *ipLimitListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if nil != err {
+			return nil, err
+		}
+		host, _, err := net.SplitHostPort(c.RemoteAddr().String())
+		if nil != err {
+			return c, nil
+		}
+		state, ok := l.states.acquire(host, l.max, func(s *ipState) *int { return &s.conns })
+		if !ok {
+			io.WriteString(c, "HTTP/1.1 429 Too Many Requests\r\nConnection: close\r\nContent-Length: 0\r\nRetry-After: 1\r\n\r\n")
+			c.Close()
+			continue
+		}
+		return &ipLimitConn{Conn: c, release: func() {
+			l.states.release(state, func(s *ipState) *int { return &s.conns })
+		}}, nil
+	}
+}
+
+type ipLimitConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+func (c *ipLimitConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
+
+// ipStates counts the requests and connections of each client, forgetting
+// each client as soon as it has none, so that a client's count is never lost
+// while it has requests or connections to release.  Clients beyond the
+// maxStates with any are refused until some finish.
+type ipStates struct {
+	mu        sync.Mutex
+	states    map[string]*ipState
+	maxStates int
+}
+
+type ipState struct {
+	key      string
+	requests int
+	conns    int
+}
+
+func newIPStates(maxStates int) *ipStates {
+	return &ipStates{
+		states:    make(map[string]*ipState),
+		maxStates: maxStates,
+	}
+}
+
+// acquire increments one of a client's counts unless it has reached max or
+// the client is new and there are already maxStates clients.
+func (s *ipStates) acquire(key string, max int, count func(*ipState) *int) (*ipState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[key]
+	if !ok {
+		if len(s.states) >= s.maxStates || 0 >= max {
+			return nil, false
+		}
+		state = &ipState{key: key}
+		s.states[key] = state
+	}
+	if n := count(state); *n < max {
+		*n++
+		return state, true
+	}
+	return state, false
+}
+
+// release decrements one of a client's counts, forgetting the client once
+// it has none.
+func (s *ipStates) release(state *ipState, count func(*ipState) *int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*count(state)--
+	if 0 == state.requests && 0 == state.conns {
+		delete(s.states, state.key)
+	}
+}
@@ -0,0 +1,91 @@
+package marshaler
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestThrottled(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	h := Throttled(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}), ClientIP, 1)
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(&testResponseWriter{}, r)
+		close(done)
+	}()
+	<-started
+	w := &testResponseWriter{}
+	h.ServeHTTP(w, r)
+	if http.StatusTooManyRequests != w.StatusCode || "1" != w.Header().Get("Retry-After") {
+		t.Fatal(w.StatusCode, w.Header())
+	}
+	other, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	other.RemoteAddr = "192.0.2.2:1234"
+	go h.ServeHTTP(&testResponseWriter{}, other)
+	<-started
+	release <- struct{}{}
+	release <- struct{}{}
+	<-done
+	go h.ServeHTTP(&testResponseWriter{}, r)
+	<-started
+	release <- struct{}{}
+}
+
+func TestLimitConnectionsPerIP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	l = LimitConnectionsPerIP(l, 1)
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if nil != err {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	first, err := net.Dial("tcp", l.Addr().String())
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := net.Dial("tcp", l.Addr().String())
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	resp, err := http.ReadResponse(bufio.NewReader(second), nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if http.StatusTooManyRequests != resp.StatusCode {
+		t.Fatal(resp.StatusCode)
+	}
+}
+
+func TestIPStatesFull(t *testing.T) {
+	s := newIPStates(2)
+	requests := func(s *ipState) *int { return &s.requests }
+	a, _ := s.acquire("a", 1, requests)
+	s.acquire("b", 1, requests)
+	if _, ok := s.acquire("c", 1, requests); ok {
+		t.Fatal("acquired beyond maxStates")
+	}
+	if _, ok := s.acquire("a", 1, requests); ok {
+		t.Fatal("a's in-flight request was forgotten")
+	}
+	s.release(a, requests)
+	if _, ok := s.acquire("c", 1, requests); !ok {
+		t.Fatal("c refused after a finished")
+	}
+}
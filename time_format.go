@@ -0,0 +1,50 @@
+package marshaler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Time formats for the Marshaler's TimeFormat option besides the layouts
+// understood by time.Format.
+const (
+	UnixSeconds      = "unix"
+	UnixMilliseconds = "unixmilli"
+)
+
+// formatTime encodes t according to a TimeFormat.
+func formatTime(t time.Time, format string) interface{} {
+	switch format {
+	case UnixSeconds:
+		return t.Unix()
+	case UnixMilliseconds:
+		return t.UnixMilli()
+	}
+	return t.Format(format)
+}
+
+// parseTime decodes a value encoded according to a TimeFormat.
+func parseTime(v interface{}, format string) (time.Time, error) {
+	switch format {
+	case UnixSeconds, UnixMilliseconds:
+		n, ok := v.(json.Number)
+		if !ok {
+			return time.Time{}, fmt.Errorf("time %v is not a number", v)
+		}
+		i, err := strconv.ParseInt(string(n), 10, 64)
+		if nil != err {
+			return time.Time{}, err
+		}
+		if UnixMilliseconds == format {
+			return time.UnixMilli(i), nil
+		}
+		return time.Unix(i, 0), nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("time %v is not a string", v)
+	}
+	return time.Parse(format, s)
+}
@@ -0,0 +1,76 @@
+package marshaler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testTimes struct {
+	At      time.Time     `json:"at"`
+	Every   time.Duration `json:"every"`
+	History []time.Time   `json:"history,omitempty"`
+}
+
+func testPostJSON(t *testing.T, m *Marshaler, body string) *testResponseWriter {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("POST", "http://example.com/foo", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	m.ServeHTTP(w, r)
+	return w
+}
+
+func testTimesHandler() *Marshaler {
+	return Handler(func(u *url.URL, h http.Header, rq *testTimes) (int, http.Header, *testTimes, error) {
+		return http.StatusOK, nil, rq, nil
+	})
+}
+
+func TestTimeFormatUnix(t *testing.T) {
+	m := testTimesHandler()
+	m.TimeFormat = UnixSeconds
+	w := testPostJSON(t, m, `{"at":1388534400,"every":1000,"history":[1388534401]}`)
+	if http.StatusOK != w.StatusCode {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+	if "{\"at\":1388534400,\"every\":1000,\"history\":[1388534401]}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestTimeFormatUnixMilli(t *testing.T) {
+	m := testTimesHandler()
+	m.TimeFormat = UnixMilliseconds
+	w := testPostJSON(t, m, `{"at":1388534400123,"every":0}`)
+	if "{\"at\":1388534400123,\"every\":0}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestTimeFormatLayout(t *testing.T) {
+	m := testTimesHandler()
+	m.TimeFormat = "2006-01-02"
+	w := testPostJSON(t, m, `{"at":"2014-01-01","every":0}`)
+	if "{\"at\":\"2014-01-01\",\"every\":0}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+	w = testPostJSON(t, m, `{"at":"January 1st","every":0}`)
+	if http.StatusBadRequest != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
+
+func TestHumanDurations(t *testing.T) {
+	m := testTimesHandler()
+	m.HumanDurations = true
+	w := testPostJSON(t, m, `{"at":"2014-01-01T00:00:00Z","every":"1m30s"}`)
+	if "{\"at\":\"2014-01-01T00:00:00Z\",\"every\":\"1m30s\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+	w = testPostJSON(t, m, `{"at":"2014-01-01T00:00:00Z","every":60000000000}`)
+	if "{\"at\":\"2014-01-01T00:00:00Z\",\"every\":\"1m0s\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
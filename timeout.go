@@ -0,0 +1,103 @@
+package marshaler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TimeoutHandler is an http.Handler that gives each request to the handler
+// it wraps a deadline, canceling the request's context when it passes.
+// Responses are buffered so that, should the deadline pass first, the
+// handler's partial response is discarded in favor of a structured error,
+// 504 Gateway Timeout by default, in the format the client accepts.
+type TimeoutHandler struct {
+	StatusCode int
+	handler    http.Handler
+	timeout    time.Duration
+}
+
+// Timeout returns an http.Handler that cancels requests to the given handler
+// after the given timeout and responds 504 Gateway Timeout in their place.
+// Set StatusCode to http.StatusServiceUnavailable to respond 503 instead.
+// Writes made by the handler after the timeout fail with
+// http.ErrHandlerTimeout.
+func Timeout(handler http.Handler, timeout time.Duration) *TimeoutHandler {
+	return &TimeoutHandler{
+		StatusCode: http.StatusGatewayTimeout,
+		handler:    handler,
+		timeout:    timeout,
+	}
+}
+
+func (h *TimeoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+	tw := &timeoutResponseWriter{responseBuffer: newResponseBuffer()}
+	done := make(chan struct{})
+	panics := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if p := recover(); nil != p {
+				panics <- p
+			}
+		}()
+		h.handler.ServeHTTP(tw, r)
+		close(done)
+	}()
+	select {
+	case p := <-panics:
+		panic(p)
+	case <-done:
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		tw.WriteTo(w)
+	case <-ctx.Done():
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		tw.timedOut = true
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return
+		}
+		logRequestLine(r, "timed out after %v", h.timeout)
+		err := errors.New(Message(r, "request timed out after %v", h.timeout))
+		switch h.StatusCode {
+		case http.StatusGatewayTimeout:
+			err = GatewayTimeout{err}
+		case http.StatusServiceUnavailable:
+			err = ServiceUnavailable{err}
+		default:
+			err = NewHTTPEquivError(err, h.StatusCode)
+		}
+		writeError(w, r, err)
+	}
+}
+
+// timeoutResponseWriter buffers a response until the handler returns, failing
+// writes once the deadline has passed.
+type timeoutResponseWriter struct {
+	*responseBuffer
+	mu       sync.Mutex
+	timedOut bool
+}
+
+func (w *timeoutResponseWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	return w.responseBuffer.Write(p)
+}
+
+func (w *timeoutResponseWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return
+	}
+	w.responseBuffer.WriteHeader(code)
+}
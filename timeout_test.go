@@ -0,0 +1,61 @@
+package marshaler
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	h := Timeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		<-r.Context().Done()
+	}), 10*time.Millisecond)
+	var buf bytes.Buffer
+	l := Logged(h, nil)
+	l.Logger = log.New(&buf, "", 0)
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Accept", "application/json")
+	l.ServeHTTP(w, r)
+	if http.StatusGatewayTimeout != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if "{\"description\":\"request timed out after 10ms\",\"error\":\"marshaler.GatewayTimeout\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+	if !strings.Contains(buf.String(), "timed out after 10ms") || strings.Contains(buf.String(), "partial") {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestTimeoutServiceUnavailable(t *testing.T) {
+	h := Timeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}), time.Millisecond)
+	h.StatusCode = http.StatusServiceUnavailable
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Accept", "application/json")
+	h.ServeHTTP(w, r)
+	if http.StatusServiceUnavailable != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
+
+func TestTimeoutNotExceeded(t *testing.T) {
+	h := Timeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Foo", "bar")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}), time.Second)
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	h.ServeHTTP(w, r)
+	if http.StatusCreated != w.StatusCode || "bar" != w.Header().Get("X-Foo") || "created" != w.Body.String() {
+		t.Fatal(w.StatusCode, w.Header(), w.Body.String())
+	}
+}
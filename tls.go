@@ -0,0 +1,65 @@
+package marshaler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+)
+
+// NewTLSConfig returns a tls.Config with modern defaults: TLS 1.2 or later,
+// only forward-secret AEAD cipher suites for TLS 1.2, and the X25519 and
+// P-256 curves.  If clientCAs is not nil, clients must present a certificate
+// signed by one of them.
+func NewTLSConfig(clientCAs *x509.CertPool) *tls.Config {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+	}
+	if nil != clientCAs {
+		config.ClientCAs = clientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config
+}
+
+// ListenAndServeTLS is like http.ListenAndServeTLS but uses the Config
+// returned by NewTLSConfig.
+func ListenAndServeTLS(addr, certFile, keyFile string, handler http.Handler) error {
+	s := &http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: NewTLSConfig(nil),
+	}
+	return s.ListenAndServeTLS(certFile, keyFile)
+}
+
+// ListenAndServeTLS listens on the Server's address and serves TLS until
+// it has shut down.  If the Server has no TLSConfig, it uses the Config
+// returned by NewTLSConfig.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	s.defaultTLSConfig()
+	return s.serve(func() error { return s.Server.ListenAndServeTLS(certFile, keyFile) })
+}
+
+// ServeTLS serves TLS on connections accepted from l until the Server has
+// shut down.  If the Server has no TLSConfig, it uses the Config returned
+// by NewTLSConfig.
+func (s *Server) ServeTLS(l net.Listener, certFile, keyFile string) error {
+	s.defaultTLSConfig()
+	return s.serve(func() error { return s.Server.ServeTLS(l, certFile, keyFile) })
+}
+
+func (s *Server) defaultTLSConfig() {
+	if nil == s.TLSConfig {
+		s.TLSConfig = NewTLSConfig(nil)
+	}
+}
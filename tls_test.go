@@ -0,0 +1,49 @@
+package marshaler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	config := NewTLSConfig(nil)
+	if tls.VersionTLS12 != config.MinVersion || tls.NoClientCert != config.ClientAuth {
+		t.Fatal(config)
+	}
+	for _, id := range config.CipherSuites {
+		for _, suite := range tls.InsecureCipherSuites() {
+			if id == suite.ID {
+				t.Fatal(suite.Name)
+			}
+		}
+	}
+	pool := x509.NewCertPool()
+	if config := NewTLSConfig(pool); tls.RequireAndVerifyClientCert != config.ClientAuth || pool != config.ClientCAs {
+		t.Fatal(config)
+	}
+}
+
+func TestNewTLSConfigHandshake(t *testing.T) {
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	s.TLS = NewTLSConfig(nil)
+	s.StartTLS()
+	defer s.Close()
+	resp, err := s.Client().Get(s.URL)
+	if nil != err {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if tls.VersionTLS12 > resp.TLS.Version {
+		t.Fatal(resp.TLS.Version)
+	}
+	transport := s.Client().Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.MaxVersion = tls.VersionTLS11
+	if _, err := (&http.Client{Transport: transport}).Get(s.URL); nil == err {
+		t.Fatal("TLS 1.1 accepted")
+	}
+}
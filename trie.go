@@ -0,0 +1,137 @@
+package marshaler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime/pprof"
+	"strings"
+)
+
+// TrieServeMux is an http.Handler that dispatches requests by method and by
+// patterns like /users/{id}/orders/{order_id}, in which each segment is
+// either static or a parameter in braces.  Static segments take priority
+// over parameters, but a parameter still matches where the static branch
+// leads to no pattern, so lookup is linear in the number of path segments
+// unless it has to backtrack.  Matched parameters are set as the request's
+// path values, named as in the pattern that matched, so patterns like
+// /users/{id} and /users/{user_id}/posts may coexist.  The path tags of
+// request structs are bound from them, and the matched pattern becomes the
+// route of metrics middleware wrapping the mux with no route of their own.
+// The pattern is also set as the route runtime/pprof label while the
+// matched handler runs.  Requests that match no pattern are answered 404
+// Not Found and those that match a pattern but not a method 405 Method Not
+// Allowed.
+type TrieServeMux struct {
+	root *trieNode
+}
+
+// NewTrieServeMux returns an empty TrieServeMux.
+func NewTrieServeMux() *TrieServeMux {
+	return &TrieServeMux{root: &trieNode{}}
+}
+
+// Handle registers a handler for the given method and pattern.  It panics
+// if the method and pattern are already registered or if another pattern
+// differs from it only in the names of its parameters.
+func (mux *TrieServeMux) Handle(method, pattern string, handler http.Handler) {
+	n := mux.root
+	var params []string
+	for _, segment := range strings.Split(strings.TrimPrefix(pattern, "/"), "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params = append(params, segment[1:len(segment)-1])
+		}
+		n = n.add(segment)
+	}
+	if nil == n.methods {
+		n.methods = make(Methods)
+		n.pattern = pattern
+		n.params = params
+	} else if pattern != n.pattern {
+		panic(fmt.Sprintf("marshaler: %s conflicts with %s", pattern, n.pattern))
+	}
+	if _, ok := n.methods[method]; ok {
+		panic(fmt.Sprintf("marshaler: %s %s is already registered", method, pattern))
+	}
+	n.methods[method] = handler
+}
+
+func (mux *TrieServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+	for i, segment := range segments {
+		value, err := url.PathUnescape(segment)
+		if nil != err {
+			writeError(w, r, BadRequest{err})
+			return
+		}
+		segments[i] = value
+	}
+	n, params := mux.root.match(segments, nil)
+	if nil == n {
+		writeError(w, r, NotFound{errors.New(Message(r, "%s not found", r.URL.Path))})
+		return
+	}
+	for i, name := range n.params {
+		r.SetPathValue(name, params[i])
+	}
+	if recorder, ok := w.(responseRecorder); ok {
+		recorder.responseRecord().Route = n.pattern
+	}
+	pprof.Do(r.Context(), pprof.Labels("route", n.pattern), func(ctx context.Context) {
+		n.methods.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// trieNode is a segment of the patterns in a TrieServeMux.  Those that end
+// a pattern have its methods, the pattern itself, and the names of its
+// parameters.
+type trieNode struct {
+	static  map[string]*trieNode
+	param   *trieNode
+	methods Methods
+	pattern string
+	params  []string
+}
+
+// match returns the node of the pattern matching the rest of a path's
+// segments, trying the static child before the parameter, and the values
+// of the parameters matched along the way.
+func (n *trieNode) match(segments, params []string) (*trieNode, []string) {
+	if 0 == len(segments) {
+		if nil == n.methods {
+			return nil, nil
+		}
+		return n, params
+	}
+	if child, ok := n.static[segments[0]]; ok {
+		if m, matched := child.match(segments[1:], params); nil != m {
+			return m, matched
+		}
+	}
+	if nil != n.param {
+		return n.param.match(segments[1:], append(params, segments[0]))
+	}
+	return nil, nil
+}
+
+// add returns the child for a pattern segment, creating it if need be.
+// Parameters share a child whatever they're named.
+func (n *trieNode) add(segment string) *trieNode {
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		if nil == n.param {
+			n.param = &trieNode{}
+		}
+		return n.param
+	}
+	if nil == n.static {
+		n.static = make(map[string]*trieNode)
+	}
+	child, ok := n.static[segment]
+	if !ok {
+		child = &trieNode{}
+		n.static[segment] = child
+	}
+	return child
+}
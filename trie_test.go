@@ -0,0 +1,147 @@
+package marshaler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestTrieServeMux(t *testing.T) {
+	mux := NewTrieServeMux()
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s %s", name, r.PathValue("id"), r.PathValue("order_id"))
+		})
+	}
+	mux.Handle("GET", "/users/{id}", handler("user"))
+	mux.Handle("GET", "/users/me", handler("me"))
+	mux.Handle("GET", "/users/{id}/orders/{order_id}", handler("order"))
+	mux.Handle("DELETE", "/users/{id}/orders/{order_id}", handler("delete"))
+	for request, body := range map[string]string{
+		"GET /users/1":             "user 1 ",
+		"GET /users/me":            "me  ",
+		"GET /users/a%2Fb":         "user a/b ",
+		"GET /users/1/orders/2":    "order 1 2",
+		"DELETE /users/1/orders/2": "delete 1 2",
+	} {
+		var method, path string
+		fmt.Sscan(request, &method, &path)
+		w := &testResponseWriter{}
+		r, _ := http.NewRequest(method, "http://example.com"+path, nil)
+		mux.ServeHTTP(w, r)
+		if body != w.Body.String() {
+			t.Fatal(request, w.Body.String())
+		}
+	}
+	for path, code := range map[string]int{
+		"/users":          http.StatusNotFound,
+		"/users/1/orders": http.StatusNotFound,
+		"/orders/1":       http.StatusNotFound,
+	} {
+		w := &testResponseWriter{}
+		r, _ := http.NewRequest("GET", "http://example.com"+path, nil)
+		mux.ServeHTTP(w, r)
+		if code != w.StatusCode {
+			t.Fatal(path, w.StatusCode)
+		}
+	}
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("POST", "http://example.com/users/1", nil)
+	mux.ServeHTTP(w, r)
+	if http.StatusMethodNotAllowed != w.StatusCode || "GET, HEAD, OPTIONS" != w.Header().Get("Allow") {
+		t.Fatal(w.StatusCode, w.Header())
+	}
+}
+
+func TestTrieServeMuxBacktracking(t *testing.T) {
+	mux := NewTrieServeMux()
+	mux.Handle("GET", "/users/me/orders", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("orders"))
+	}))
+	mux.Handle("GET", "/users/{id}/posts", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("posts " + r.PathValue("id")))
+	}))
+	for path, body := range map[string]string{
+		"/users/me/orders": "orders",
+		"/users/me/posts":  "posts me",
+		"/users/1/posts":   "posts 1",
+	} {
+		w := &testResponseWriter{}
+		r, _ := http.NewRequest("GET", "http://example.com"+path, nil)
+		mux.ServeHTTP(w, r)
+		if body != w.Body.String() {
+			t.Fatal(path, w.StatusCode, w.Body.String())
+		}
+	}
+}
+
+func TestTrieServeMuxParameterNames(t *testing.T) {
+	mux := NewTrieServeMux()
+	mux.Handle("GET", "/users/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("user " + r.PathValue("id")))
+	}))
+	mux.Handle("GET", "/users/{user_id}/posts", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("posts " + r.PathValue("user_id") + r.PathValue("id")))
+	}))
+	for path, body := range map[string]string{
+		"/users/1":       "user 1",
+		"/users/2/posts": "posts 2",
+	} {
+		w := &testResponseWriter{}
+		r, _ := http.NewRequest("GET", "http://example.com"+path, nil)
+		mux.ServeHTTP(w, r)
+		if body != w.Body.String() {
+			t.Fatal(path, w.Body.String())
+		}
+	}
+}
+
+func TestTrieServeMuxConflict(t *testing.T) {
+	mux := NewTrieServeMux()
+	mux.Handle("GET", "/users/{id}", http.NotFoundHandler())
+	defer func() {
+		if nil == recover() {
+			t.Fatal("no panic")
+		}
+	}()
+	mux.Handle("DELETE", "/users/{user_id}", http.NotFoundHandler())
+}
+
+func TestTrieServeMuxBinding(t *testing.T) {
+	mux := NewTrieServeMux()
+	mux.Handle("GET", "/users/{user_id}/things/{id}", Handler(func(u *url.URL, h http.Header, rq *testPathRequest) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, nil, &testResponse{fmt.Sprint(rq.UserID, rq.ID)}, nil
+	}))
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/users/1/things/foo", nil)
+	r.Header.Set("Accept", "application/json")
+	mux.ServeHTTP(w, r)
+	if "{\"foo\":\"1foo\"}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestTrieServeMuxRoute(t *testing.T) {
+	mux := NewTrieServeMux()
+	mux.Handle("GET", "/users/{id}", http.NotFoundHandler())
+	sink := &testMetricsSink{}
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/users/1", nil)
+	Counted(mux, "", sink).ServeHTTP(w, r)
+	if 1 != len(sink.metrics) || "/users/{id}" != sink.metrics[0].name {
+		t.Fatal(sink.metrics)
+	}
+}
+
+func BenchmarkTrieServeMux(b *testing.B) {
+	m := NewTrieServeMux()
+	for _, pattern := range []string{"/users", "/users/{id}", "/users/{id}/orders", "/users/{id}/orders/{order_id}"} {
+		m.Handle("GET", pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	}
+	r, _ := http.NewRequest("GET", "http://example.com/users/1/orders/2", nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m.ServeHTTP(&testResponseWriter{}, r)
+	}
+}
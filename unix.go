@@ -0,0 +1,81 @@
+package marshaler
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// ListenUnix listens on a Unix domain socket at the given path with the
+// given permissions.  A stale socket left by a process that didn't clean up
+// is removed first, but not one that's still accepting connections.  The
+// socket is bound in a new directory beside path that only the process may
+// enter and is given its permissions there before it's moved into place, so
+// that no one else can connect in the meantime.  The socket is removed when
+// the listener is closed.
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); nil == err {
+		if 0 == fi.Mode()&os.ModeSocket {
+			return nil, fmt.Errorf("%s exists and isn't a socket", path)
+		}
+		if c, err := net.Dial("unix", path); nil == err {
+			c.Close()
+			return nil, fmt.Errorf("%s is in use", path)
+		}
+		if err := os.Remove(path); nil != err {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".sock")
+	if nil != err {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "s")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if nil != err {
+		return nil, err
+	}
+	l.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, mode); nil != err {
+		l.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); nil != err {
+		l.Close()
+		return nil, err
+	}
+	return &unixListener{UnixListener: l, path: path}, nil
+}
+
+// unixListener is a net.UnixListener whose socket was moved to path after
+// it was bound, which it reports as its address and removes when closed.
+type unixListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+func (l *unixListener) Close() error {
+	os.Remove(l.path)
+	return l.UnixListener.Close()
+}
+
+// ListenAndServeUnix listens on a Unix domain socket at the given path with
+// the given permissions, as ListenUnix does, and serves until the Server has
+// shut down, removing the socket.
+func (s *Server) ListenAndServeUnix(path string, mode os.FileMode) error {
+	l, err := ListenUnix(path, mode)
+	if nil != err {
+		return err
+	}
+	defer os.Remove(path)
+	return s.Serve(l)
+}
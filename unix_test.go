@@ -0,0 +1,60 @@
+package marshaler
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListenAndServeUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "marshaler.sock")
+	stale, err := net.Listen("unix", path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	s := NewServer("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	s.Logger = log.New(&testSyncBuffer{}, "", 0)
+	served := make(chan error)
+	go func() { served <- s.ListenAndServeUnix(path, 0600) }()
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	var resp *http.Response
+	for i := 0; i < 100; i++ {
+		if resp, err = client.Get("http://unix/"); nil == err {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if nil != err {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if fi, err := os.Stat(path); nil != err || 0600 != fi.Mode().Perm() {
+		t.Fatal(fi, err)
+	}
+	if entries, err := os.ReadDir(filepath.Dir(path)); nil != err || 1 != len(entries) {
+		t.Fatal(entries, err)
+	}
+	if _, err := ListenUnix(path, 0600); nil == err {
+		t.Fatal("listened on a socket in use")
+	}
+	s.Stop()
+	if err := <-served; nil != err {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,120 @@
+package marshaler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// A Validator validates request structs after they're unmarshaled.  Its
+// signature matches the Validate type from go-playground/validator, so
+// instances of that and similar libraries may be used directly.
+type Validator interface {
+	Struct(interface{}) error
+}
+
+// DefaultValidator, if not nil, validates the requests of every Marshaler
+// that doesn't have a Validator of its own.
+var DefaultValidator Validator
+
+// A FieldError describes why one field of a request failed validation.
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors is the 422 Unprocessable Entity error returned when a
+// Validator rejects a request, which lists each field's error in the
+// response body.
+type ValidationErrors []FieldError
+
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (errs ValidationErrors) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+// validatorFieldError is satisfied by the field errors of
+// go-playground/validator and similar libraries.
+type validatorFieldError interface {
+	error
+	Field() string
+	Tag() string
+}
+
+// NewValidationErrors converts an error returned by a Validator into
+// ValidationErrors.  Errors that are slices of field errors in the style of
+// go-playground/validator become one FieldError each and all other errors
+// become a single FieldError that names no field.
+func NewValidationErrors(err error) ValidationErrors {
+	if errs, ok := err.(ValidationErrors); ok {
+		return errs
+	}
+	if fieldErr, ok := err.(validatorFieldError); ok {
+		return ValidationErrors{newFieldError(fieldErr)}
+	}
+	v := reflect.ValueOf(err)
+	if reflect.Slice == v.Kind() && 0 < v.Len() {
+		errs := make(ValidationErrors, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			fieldErr, ok := v.Index(i).Interface().(validatorFieldError)
+			if !ok {
+				return ValidationErrors{{Message: err.Error()}}
+			}
+			errs = append(errs, newFieldError(fieldErr))
+		}
+		return errs
+	}
+	return ValidationErrors{{Message: err.Error()}}
+}
+
+func newFieldError(err validatorFieldError) FieldError {
+	fieldErr := FieldError{
+		Field:   err.Field(),
+		Rule:    err.Tag(),
+		Message: err.Error(),
+	}
+	if param, ok := err.(interface {
+		Param() string
+	}); ok {
+		fieldErr.Param = param.Param()
+	}
+	return fieldErr
+}
+
+// validate runs the Marshaler's Validator, if any, over a request struct.
+func (m *Marshaler) validate(rq reflect.Value) ValidationErrors {
+	validator := m.Validator
+	if nil == validator {
+		validator = DefaultValidator
+	}
+	if nil == validator || reflect.Ptr != rq.Kind() || rq.IsNil() || reflect.Struct != rq.Elem().Kind() {
+		return nil
+	}
+	if err := validator.Struct(rq.Interface()); nil != err {
+		return NewValidationErrors(err)
+	}
+	return nil
+}
+
+func writeValidationErrors(w http.ResponseWriter, errs ValidationErrors) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(errs.StatusCode())
+	if jsonErr := json.NewEncoder(w).Encode(struct {
+		Description string       `json:"description"`
+		Error       string       `json:"error"`
+		Fields      []FieldError `json:"fields"`
+	}{errs.Error(), errorName(errs, "error"), errs}); nil != jsonErr {
+		log.Printf("Error marshalling error response into JSON output: %s", jsonErr)
+	}
+}
@@ -0,0 +1,90 @@
+package marshaler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type testFieldError struct {
+	field, tag, param string
+}
+
+func (err testFieldError) Error() string {
+	return fmt.Sprintf("%s failed on the %s tag", err.field, err.tag)
+}
+
+func (err testFieldError) Field() string { return err.field }
+
+func (err testFieldError) Tag() string { return err.tag }
+
+func (err testFieldError) Param() string { return err.param }
+
+type testFieldErrors []testFieldError
+
+func (errs testFieldErrors) Error() string { return "validation failed" }
+
+type testValidator func(interface{}) error
+
+func (f testValidator) Struct(v interface{}) error { return f(v) }
+
+func testValidate(t *testing.T, validator Validator) *testResponseWriter {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("POST", "http://example.com/foo", strings.NewReader(`{"foo":"bar"}`))
+	r.Header.Set("Content-Type", "application/json")
+	m := Handler(func(u *url.URL, h http.Header, rq *testRequest) (int, http.Header, *testResponse, error) {
+		return http.StatusOK, nil, &testResponse{rq.Foo}, nil
+	})
+	m.Validator = validator
+	m.ServeHTTP(w, r)
+	return w
+}
+
+func TestValidatorValid(t *testing.T) {
+	w := testValidate(t, testValidator(func(v interface{}) error {
+		if "bar" != v.(*testRequest).Foo {
+			t.Fatal(v)
+		}
+		return nil
+	}))
+	if http.StatusOK != w.StatusCode {
+		t.Fatal(w.StatusCode, w.Body.String())
+	}
+}
+
+func TestValidatorFieldErrors(t *testing.T) {
+	w := testValidate(t, testValidator(func(v interface{}) error {
+		return testFieldErrors{{"Foo", "min", "5"}}
+	}))
+	if http.StatusUnprocessableEntity != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if "{\"description\":\"Foo failed on the min tag\",\"error\":\"marshaler.ValidationErrors\",\"fields\":[{\"field\":\"Foo\",\"rule\":\"min\",\"param\":\"5\",\"message\":\"Foo failed on the min tag\"}]}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestValidatorError(t *testing.T) {
+	w := testValidate(t, testValidator(func(v interface{}) error {
+		return errors.New("foo is bad")
+	}))
+	if http.StatusUnprocessableEntity != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+	if "{\"description\":\"foo is bad\",\"error\":\"marshaler.ValidationErrors\",\"fields\":[{\"message\":\"foo is bad\"}]}\n" != w.Body.String() {
+		t.Fatal(w.Body.String())
+	}
+}
+
+func TestDefaultValidator(t *testing.T) {
+	DefaultValidator = testValidator(func(v interface{}) error {
+		return errors.New("foo is bad")
+	})
+	defer func() { DefaultValidator = nil }()
+	if w := testValidate(t, nil); http.StatusUnprocessableEntity != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}
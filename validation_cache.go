@@ -0,0 +1,233 @@
+package marshaler
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ValidationCache is an http.Handler that remembers the validators, ETag and
+// Last-Modified, of the responses the handler it wraps sends to GET
+// requests and answers conditional requests that match them 304 Not
+// Modified without invoking the handler.  Unlike Cache, it holds no
+// response bodies, so it suits large or per-request responses whose
+// validators are nonetheless stable.  Successful requests with other
+// methods forget the validators of the same URI.
+//
+// Validators are kept apart by the request headers the response's Vary
+// header names, and Accept.  Requests with credentials, Authorization or
+// Cookie, are always passed to the handler, and validators of responses
+// that are private, mustn't be stored, set cookies, or vary on everything
+// aren't remembered, so a 304 never stands in for a response the handler
+// would have refused.
+type ValidationCache struct {
+	handler http.Handler
+	store   ValidatorStore
+	ttl     time.Duration
+}
+
+// DefaultValidatorEntries is the number of entries in the
+// MemoryValidatorStore created by Validated.
+var DefaultValidatorEntries = 4096
+
+// Validated returns an http.Handler that answers revalidation requests to
+// the given handler from validators remembered for up to ttl.  If store is
+// nil, validators are held in a MemoryValidatorStore of
+// DefaultValidatorEntries entries.
+func Validated(handler http.Handler, ttl time.Duration, store ValidatorStore) *ValidationCache {
+	if nil == store {
+		store = NewMemoryValidatorStore(DefaultValidatorEntries)
+	}
+	return &ValidationCache{
+		handler: handler,
+		store:   store,
+		ttl:     ttl,
+	}
+}
+
+// ServeHTTP answers a conditional request from the validators remembered
+// for it, if they match.  The store's Vary entry for the URI names the
+// request headers that tell its variants apart and, as its Created time,
+// when they were last forgotten, before which variants are stale.
+func (c *ValidationCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	base := r.URL.RequestURI()
+	now := time.Now()
+	if "GET" != r.Method && "HEAD" != r.Method {
+		w, record := recordResponse(w)
+		c.handler.ServeHTTP(w, r)
+		if !record.WroteHeader || record.StatusCode < 400 {
+			names := []string{"Accept"}
+			if vary, ok := c.store.Get(varyKey(base)); ok {
+				names = vary.Header["Vary"]
+			}
+			c.store.Set(varyKey(base), &Validators{Header: http.Header{"Vary": names}, Created: now})
+		}
+		return
+	}
+	if "" != r.Header.Get("Authorization") || "" != r.Header.Get("Cookie") {
+		c.handler.ServeHTTP(w, r)
+		return
+	}
+	names, forgotten := []string{"Accept"}, time.Time{}
+	if vary, ok := c.store.Get(varyKey(base)); ok {
+		names, forgotten = vary.Header["Vary"], vary.Created
+	}
+	if v, ok := c.store.Get(cacheKey(base, r, names)); ok && now.Sub(v.Created) < c.ttl && !v.Created.Before(forgotten) && v.matches(r) {
+		copyHeader(w.Header(), v.Header)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	c.handler.ServeHTTP(&validatorResponseWriter{ResponseWriter: w, onHeader: func(code int, header http.Header) {
+		if http.StatusOK != code || "" == header.Get("ETag") && "" == header.Get("Last-Modified") || !validatorsStorable(header) {
+			return
+		}
+		if vary, ok := c.store.Get(varyKey(base)); ok && vary.Created.After(forgotten) {
+			return
+		}
+		vary := http.Header{"Vary": header.Values("Vary")}
+		addVary(vary, "Accept")
+		names := varyNames(vary)
+		c.store.Set(varyKey(base), &Validators{Header: http.Header{"Vary": names}, Created: forgotten})
+		v := &Validators{Header: make(http.Header), Created: now}
+		for _, name := range []string{"Cache-Control", "Content-Location", "ETag", "Expires", "Last-Modified", "Vary"} {
+			if values := header.Values(name); 0 < len(values) {
+				v.Header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+			}
+		}
+		c.store.Set(cacheKey(base, r, names), v)
+	}}, r)
+}
+
+// validatorsStorable reports whether the validators of a response may be
+// remembered: it mustn't be private, forbid storage, set cookies, or vary
+// on everything.
+func validatorsStorable(header http.Header) bool {
+	cacheControl := strings.ToLower(header.Get("Cache-Control"))
+	if strings.Contains(cacheControl, "no-store") || strings.Contains(cacheControl, "private") || "" != header.Get("Set-Cookie") {
+		return false
+	}
+	for _, name := range varyNames(header) {
+		if "*" == name {
+			return false
+		}
+	}
+	return true
+}
+
+// Validators are the validators of a response and the headers RFC 9110
+// requires a 304 Not Modified response to repeat.
+type Validators struct {
+	Header  http.Header
+	Created time.Time
+}
+
+// matches reports whether a request's If-None-Match or, in its absence,
+// If-Modified-Since header matches the validators.
+func (v *Validators) matches(r *http.Request) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); "" != ifNoneMatch {
+		return etagMatch(ifNoneMatch, v.Header.Get("ETag"))
+	}
+	ifModifiedSince, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if nil != err {
+		return false
+	}
+	lastModified, err := http.ParseTime(v.Header.Get("Last-Modified"))
+	return nil == err && !lastModified.After(ifModifiedSince)
+}
+
+// validatorResponseWriter calls onHeader with the response's status code and
+// header as they're written.
+type validatorResponseWriter struct {
+	http.ResponseWriter
+	onHeader    func(int, http.Header)
+	wroteHeader bool
+}
+
+func (w *validatorResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *validatorResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *validatorResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.onHeader(code, w.Header())
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// A ValidatorStore holds Validators for a ValidationCache.  Implementations
+// must be safe for concurrent use and may evict entries at any time.
+type ValidatorStore interface {
+	Get(key string) (*Validators, bool)
+	Set(key string, v *Validators)
+	Delete(key string)
+}
+
+// MemoryValidatorStore is a ValidatorStore that keeps validators in memory,
+// evicting the least recently used when it holds too many.
+type MemoryValidatorStore struct {
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List
+	maxEntries int
+}
+
+// NewMemoryValidatorStore returns a MemoryValidatorStore that holds at most
+// maxEntries validators.
+func NewMemoryValidatorStore(maxEntries int) *MemoryValidatorStore {
+	return &MemoryValidatorStore{
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+	}
+}
+
+type memoryValidatorEntry struct {
+	key string
+	v   *Validators
+}
+
+func (s *MemoryValidatorStore) Get(key string) (*Validators, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	s.lru.MoveToFront(e)
+	return e.Value.(*memoryValidatorEntry).v, true
+}
+
+func (s *MemoryValidatorStore) Set(key string, v *Validators) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.Value.(*memoryValidatorEntry).v = v
+		s.lru.MoveToFront(e)
+		return
+	}
+	s.entries[key] = s.lru.PushFront(&memoryValidatorEntry{key, v})
+	for s.lru.Len() > s.maxEntries {
+		delete(s.entries, s.lru.Remove(s.lru.Back()).(*memoryValidatorEntry).key)
+	}
+}
+
+func (s *MemoryValidatorStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		s.lru.Remove(e)
+		delete(s.entries, key)
+	}
+}
@@ -0,0 +1,129 @@
+package marshaler
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestValidated(t *testing.T) {
+	calls := 0
+	h := Validated(Handler(func(u *url.URL, h http.Header) (int, http.Header, *testResponse, error) {
+		calls++
+		return http.StatusOK, http.Header{"Last-Modified": {"Wed, 01 Jan 2025 00:00:00 GMT"}}, &testResponse{"bar"}, nil
+	}), time.Minute, nil)
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	h.ServeHTTP(w, r)
+	etag := w.Header().Get("ETag")
+	if http.StatusOK != w.StatusCode || "" == etag || 1 != calls {
+		t.Fatal(w.StatusCode, w.Header(), calls)
+	}
+	for name, value := range map[string]string{
+		"If-None-Match":     etag,
+		"If-Modified-Since": "Thu, 02 Jan 2025 00:00:00 GMT",
+	} {
+		w = &testResponseWriter{}
+		r, _ = http.NewRequest("GET", "http://example.com/foo", nil)
+		r.Header.Set(name, value)
+		h.ServeHTTP(w, r)
+		if http.StatusNotModified != w.StatusCode || etag != w.Header().Get("ETag") || 0 != w.Body.Len() || 1 != calls {
+			t.Fatal(name, w.StatusCode, w.Header(), calls)
+		}
+	}
+	w = &testResponseWriter{}
+	r, _ = http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("If-None-Match", "\"stale\"")
+	h.ServeHTTP(w, r)
+	if http.StatusOK != w.StatusCode || 2 != calls {
+		t.Fatal(w.StatusCode, calls)
+	}
+}
+
+func TestValidatedInvalidation(t *testing.T) {
+	calls := 0
+	h := Validated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("ETag", "\"foo\"")
+		w.Write([]byte("foo"))
+	}), time.Minute, nil)
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	h.ServeHTTP(&testResponseWriter{}, r)
+	put, _ := http.NewRequest("PUT", "http://example.com/foo", nil)
+	h.ServeHTTP(&testResponseWriter{}, put)
+	w := &testResponseWriter{}
+	r.Header.Set("If-None-Match", "\"foo\"")
+	h.ServeHTTP(w, r)
+	if 3 != calls {
+		t.Fatal(calls)
+	}
+}
+
+func TestValidatedCredentials(t *testing.T) {
+	calls := 0
+	h := Validated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if "" == r.Header.Get("Authorization") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("ETag", "\"private\"")
+		w.Write([]byte("secret"))
+	}), time.Minute, nil)
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("Authorization", "Bearer foo")
+	h.ServeHTTP(&testResponseWriter{}, r)
+	w := &testResponseWriter{}
+	r, _ = http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Set("If-None-Match", "*")
+	h.ServeHTTP(w, r)
+	if http.StatusUnauthorized != w.StatusCode || "" != w.Header().Get("ETag") || 2 != calls {
+		t.Fatal(w.StatusCode, w.Header(), calls)
+	}
+}
+
+func TestValidatedVary(t *testing.T) {
+	calls := 0
+	h := Validated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Vary", "Accept-Language")
+		w.Header().Set("ETag", "\""+r.Header.Get("Accept-Language")+"\"")
+		w.Write([]byte("hello"))
+	}), time.Minute, nil)
+	for _, language := range []string{"en", "fr"} {
+		r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+		r.Header.Set("Accept-Language", language)
+		h.ServeHTTP(&testResponseWriter{}, r)
+	}
+	for i, language := range []string{"en", "fr", "de"} {
+		w := &testResponseWriter{}
+		r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+		r.Header.Set("Accept-Language", language)
+		r.Header.Set("If-None-Match", "\"en\"")
+		h.ServeHTTP(w, r)
+		if want := []int{http.StatusNotModified, http.StatusOK, http.StatusOK}[i]; want != w.StatusCode {
+			t.Fatal(language, w.StatusCode)
+		}
+	}
+	if 4 != calls {
+		t.Fatal(calls)
+	}
+}
+
+func TestValidatedPrivate(t *testing.T) {
+	calls := 0
+	h := Validated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "private")
+		w.Header().Set("ETag", "\"foo\"")
+		w.Write([]byte("foo"))
+	}), time.Minute, nil)
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	h.ServeHTTP(&testResponseWriter{}, r)
+	r.Header.Set("If-None-Match", "\"foo\"")
+	h.ServeHTTP(&testResponseWriter{}, r)
+	if 2 != calls {
+		t.Fatal(calls)
+	}
+}
@@ -0,0 +1,129 @@
+package marshaler
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIVersionHeader is the request header that may select an API version and
+// the response header that names the version selected.
+const APIVersionHeader = "Api-Version"
+
+// VersionedHandler is an http.Handler that dispatches requests to the
+// handler registered for the API version they select, by a path prefix like
+// /v2/, which is stripped, a version parameter of the Accept header like
+// application/json; version=2, or the Api-Version header, in that order.
+// Requests that select no version are given the Default.  Versions may be
+// given with or without a leading "v".  Responses from deprecated versions
+// carry Deprecation, Sunset, and Link headers as defined by RFC 9745 and RFC
+// 8594.
+//
+//	v := Versioned("2")
+//	v.Handle("1", usersV1)
+//	v.Handle("2", usersV2)
+//	v.Deprecate("1", deprecated, sunset, "https://example.com/migrating")
+type VersionedHandler struct {
+	Default  string
+	versions map[string]*apiVersion
+}
+
+type apiVersion struct {
+	handler    http.Handler
+	deprecated time.Time
+	sunset     time.Time
+	link       string
+}
+
+// Versioned returns an empty VersionedHandler with the given default version.
+func Versioned(defaultVersion string) *VersionedHandler {
+	return &VersionedHandler{
+		Default:  normalizeVersion(defaultVersion),
+		versions: make(map[string]*apiVersion),
+	}
+}
+
+// Handle registers the handler for a version.
+func (v *VersionedHandler) Handle(version string, handler http.Handler) {
+	version = normalizeVersion(version)
+	if av, ok := v.versions[version]; ok {
+		av.handler = handler
+		return
+	}
+	v.versions[version] = &apiVersion{handler: handler}
+}
+
+// Deprecate marks a registered version deprecated since the given date, or
+// now if it's zero, with the date it will be removed, if known, and a link
+// to documentation, if any.
+func (v *VersionedHandler) Deprecate(version string, since, sunset time.Time, link string) {
+	if av, ok := v.versions[normalizeVersion(version)]; ok {
+		if since.IsZero() {
+			since = time.Now()
+		}
+		av.deprecated, av.sunset, av.link = since, sunset, link
+	}
+}
+
+func (v *VersionedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	addVary(header, "Accept")
+	addVary(header, APIVersionHeader)
+	version, r := v.version(r)
+	av, ok := v.versions[version]
+	if !ok {
+		writeError(w, r, NotFound{errors.New(Message(r, "API version %s not found", version))})
+		return
+	}
+	header.Set(APIVersionHeader, version)
+	if !av.deprecated.IsZero() {
+		header.Set("Deprecation", "@"+strconv.FormatInt(av.deprecated.Unix(), 10))
+		if !av.sunset.IsZero() {
+			header.Set("Sunset", av.sunset.UTC().Format(http.TimeFormat))
+		}
+		if "" != av.link {
+			header.Add("Link", "<"+av.link+">; rel=\"deprecation\"")
+		}
+		logRequestLine(r, "deprecated API version %s", version)
+	}
+	av.handler.ServeHTTP(w, r)
+}
+
+// version returns the version a request selects and the request, with the
+// version's path prefix stripped if it was selected that way.
+func (v *VersionedHandler) version(r *http.Request) (string, *http.Request) {
+	if prefix, rest, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/"); ok && isVersion(prefix) {
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = "/" + rest
+		r2.URL.RawPath = ""
+		return normalizeVersion(prefix), r2
+	}
+	for _, accept := range splitHeader(r.Header, "Accept") {
+		if _, params, err := mime.ParseMediaType(accept); nil == err && "" != params["version"] {
+			return normalizeVersion(params["version"]), r
+		}
+	}
+	if version := r.Header.Get(APIVersionHeader); "" != version {
+		return normalizeVersion(version), r
+	}
+	return v.Default, r
+}
+
+// isVersion reports whether a path segment is a version like v2 or v2.1.
+func isVersion(segment string) bool {
+	if len(segment) < 2 || 'v' != segment[0] {
+		return false
+	}
+	return "" == strings.Trim(segment[1:], "0123456789.")
+}
+
+func normalizeVersion(version string) string {
+	return strings.TrimPrefix(strings.TrimSpace(version), "v")
+}
@@ -0,0 +1,74 @@
+package marshaler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func testVersioned() *VersionedHandler {
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + " " + r.URL.Path))
+		})
+	}
+	v := Versioned("2")
+	v.Handle("v1", handler("one"))
+	v.Handle("2", handler("two"))
+	v.Deprecate("1", time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), "https://example.com/migrating")
+	return v
+}
+
+func TestVersioned(t *testing.T) {
+	v := testVersioned()
+	for _, test := range []struct {
+		path, accept, version, body string
+	}{
+		{"/users", "", "", "two /users"},
+		{"/v1/users", "", "", "one /users"},
+		{"/v2/users", "", "1", "two /users"},
+		{"/users", "application/json; version=1", "", "one /users"},
+		{"/users", "", "v1", "one /users"},
+	} {
+		w := &testResponseWriter{}
+		r, _ := http.NewRequest("GET", "http://example.com"+test.path, nil)
+		if "" != test.accept {
+			r.Header.Set("Accept", test.accept)
+		}
+		if "" != test.version {
+			r.Header.Set("Api-Version", test.version)
+		}
+		v.ServeHTTP(w, r)
+		if test.body != w.Body.String() {
+			t.Fatal(test, w.Body.String())
+		}
+	}
+}
+
+func TestVersionedDeprecated(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/v1/users", nil)
+	testVersioned().ServeHTTP(w, r)
+	header := w.Header()
+	if "1" != header.Get("Api-Version") || "@1719792000" != header.Get("Deprecation") {
+		t.Fatal(header)
+	}
+	if "Wed, 01 Jan 2025 00:00:00 GMT" != header.Get("Sunset") || "<https://example.com/migrating>; rel=\"deprecation\"" != header.Get("Link") {
+		t.Fatal(header)
+	}
+	w = &testResponseWriter{}
+	r, _ = http.NewRequest("GET", "http://example.com/v2/users", nil)
+	testVersioned().ServeHTTP(w, r)
+	if "" != w.Header().Get("Deprecation") {
+		t.Fatal(w.Header())
+	}
+}
+
+func TestVersionedNotFound(t *testing.T) {
+	w := &testResponseWriter{}
+	r, _ := http.NewRequest("GET", "http://example.com/v3/users", nil)
+	testVersioned().ServeHTTP(w, r)
+	if http.StatusNotFound != w.StatusCode {
+		t.Fatal(w.StatusCode)
+	}
+}